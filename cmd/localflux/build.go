@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/deployment"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+)
+
+func createBuildCmd() *cobra.Command {
+	prune := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove build cache, or unreferenced blobs from the cluster registry",
+		Long: `
+Remove build cache from the builder of the cluster. Cache used within --keep-duration is kept, and up to --keep-storage
+bytes of cache are kept in total.
+
+With --registry, the garbage collector of the in-cluster registry is run instead, deleting blobs that are not
+referenced by any manifest. --delete-untagged additionally removes manifests without a tag, which includes earlier
+builds of the same image.
+`,
+		RunE: buildPrune,
+		Args: cobra.NoArgs,
+	}
+
+	prune.Flags().String("cluster", "", "Cluster name")
+	prune.Flags().Bool("all", false, "Remove all unused cache, not just dangling records")
+	prune.Flags().Duration("keep-duration", 0, "Keep cache used within the duration")
+	prune.Flags().String("keep-storage", "", "Keep up to the given amount of cache (e.g. 10GB)")
+	prune.Flags().StringArray("filter", nil, "Only remove cache matching the filter (e.g. type==regular)")
+	prune.Flags().Bool("registry", false, "Garbage collect the in-cluster registry instead of the build cache")
+	prune.Flags().Bool("delete-untagged", false, "Also remove untagged manifests when garbage collecting the registry")
+
+	updatePins := &cobra.Command{
+		Use:   "update-pins [image...]",
+		Short: "Resolve the base images of builds to their current digests",
+		Long: `
+Resolve the base images of the named images, or of every image with pinBaseImages enabled, to their current digests
+and record them in ` + deployment.PinsFile + `, next to the config.
+`,
+		RunE: buildUpdatePins,
+	}
+
+	c := &cobra.Command{
+		Use:   "build",
+		Short: "Manage builds",
+	}
+
+	c.AddCommand(prune)
+	c.AddCommand(updatePins)
+
+	return c
+}
+
+func buildPrune(cmd *cobra.Command, _ []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	clusterName, err := cmd.Flags().GetString("cluster")
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster flag: %w", err)
+	}
+
+	registry, err := cmd.Flags().GetBool("registry")
+	if err != nil {
+		return fmt.Errorf("failed to parse registry flag: %w", err)
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	if registry {
+		deleteUntagged, err := cmd.Flags().GetBool("delete-untagged")
+		if err != nil {
+			return fmt.Errorf("failed to parse delete-untagged flag: %w", err)
+		}
+
+		return cm.PruneRegistry(cmd.Context(), clusterName, deleteUntagged, os.Stdout)
+	}
+
+	var opts deployment.PruneOptions
+
+	opts.All, err = cmd.Flags().GetBool("all")
+	if err != nil {
+		return fmt.Errorf("failed to parse all flag: %w", err)
+	}
+
+	opts.KeepDuration, err = cmd.Flags().GetDuration("keep-duration")
+	if err != nil {
+		return fmt.Errorf("failed to parse keep-duration flag: %w", err)
+	}
+
+	keepStorage, err := cmd.Flags().GetString("keep-storage")
+	if err != nil {
+		return fmt.Errorf("failed to parse keep-storage flag: %w", err)
+	}
+
+	if keepStorage != "" {
+		opts.KeepStorage, err = units.RAMInBytes(keepStorage)
+		if err != nil {
+			return fmt.Errorf("failed to parse keep-storage flag: %w", err)
+		}
+	}
+
+	opts.Filters, err = cmd.Flags().GetStringArray("filter")
+	if err != nil {
+		return fmt.Errorf("failed to parse filter flag: %w", err)
+	}
+
+	if clusterName == "" {
+		clusterName = cfg.DefaultCluster
+	}
+
+	if clusterName == "" {
+		return cluster.ErrNoDefault
+	}
+
+	m := deployment.NewManager(logger, cfg, cm)
+
+	res, err := m.PruneBuildCache(cmd.Context(), clusterName, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d cache records, reclaimed %s\n", res.Records, units.HumanSize(float64(res.Reclaimed)))
+
+	return nil
+}
+
+func buildUpdatePins(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	m := deployment.NewManager(logger, cfg, cm)
+
+	updates, err := m.UpdatePins(cmd.Context(), args)
+	if err != nil {
+		return err
+	}
+
+	if len(updates) == 0 {
+		fmt.Println("All base images are up to date")
+
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "IMAGE\tOLD\tNEW")
+
+	for _, u := range updates {
+		old := u.Old
+		if old == "" {
+			old = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", u.Image, old, u.New)
+	}
+
+	return w.Flush()
+}
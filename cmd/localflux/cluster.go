@@ -2,8 +2,14 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
 	"github.com/csnewman/localflux/internal/cluster"
 	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/deployment"
 	"github.com/spf13/cobra"
 )
 
@@ -15,12 +21,28 @@ func createClusterCmd() *cobra.Command {
 		Args:  cobra.MaximumNArgs(1),
 	}
 
+	capabilities := &cobra.Command{
+		Use:   "capabilities [name]",
+		Short: "Show the features detected on a cluster",
+		RunE:  clusterCapabilities,
+		Args:  cobra.MaximumNArgs(1),
+	}
+
+	removeBuilder := &cobra.Command{
+		Use:   "remove-builder [name]",
+		Short: "Remove the buildkit container created on the local Docker host for a cluster",
+		RunE:  clusterRemoveBuilder,
+		Args:  cobra.MaximumNArgs(1),
+	}
+
 	c := &cobra.Command{
 		Use:   "cluster",
 		Short: "Manage clusters",
 	}
 
 	c.AddCommand(start)
+	c.AddCommand(capabilities)
+	c.AddCommand(removeBuilder)
 
 	return c
 }
@@ -43,3 +65,80 @@ func clusterStart(cmd *cobra.Command, args []string) error {
 		return m.Start(ctx, name, cb)
 	})
 }
+
+func clusterCapabilities(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	m := cluster.NewManager(logger, cfg)
+
+	var name string
+
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	caps, err := m.Capabilities(cmd.Context(), name)
+	if err != nil {
+		return err
+	}
+
+	orNone := func(v string) string {
+		if v == "" {
+			return "none"
+		}
+
+		return v
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Server version\t%s\n", caps.ServerVersion)
+	fmt.Fprintf(w, "CNI\t%s\n", orNone(caps.CNI))
+	fmt.Fprintf(w, "Default storage class\t%s\n", orNone(caps.DefaultStorageClass))
+	fmt.Fprintf(w, "LoadBalancer\t%t\n", caps.LoadBalancer)
+	fmt.Fprintf(w, "API groups\t%s\n", strings.Join(caps.APIGroups, ", "))
+
+	return w.Flush()
+}
+
+func clusterRemoveBuilder(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	m := cluster.NewManager(logger, cfg)
+
+	name := cfg.DefaultCluster
+
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	if name == "" {
+		return cluster.ErrNoDefault
+	}
+
+	provider, err := m.Provider(name)
+	if err != nil {
+		return err
+	}
+
+	removed, err := deployment.RemoveHostBuildKit(cmd.Context(), provider)
+	if err != nil {
+		return err
+	}
+
+	if !removed {
+		fmt.Println("No buildkit container found")
+
+		return nil
+	}
+
+	fmt.Println("Removed buildkit container")
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	"github.com/spf13/cobra"
+)
+
+func createConfigCmd() *cobra.Command {
+	validate := &cobra.Command{
+		Use:   "validate [file]",
+		Short: "Check a config file and the files it includes for errors",
+		Long: `
+Check a config file, localflux.yaml by default, and the files it includes. Fields are checked against the schema of
+the config, after which deeper checks find duplicate names, steps without exactly one action, references to images or
+steps that are not defined, and paths that do not exist. Each problem is reported with the line it was found on.
+`,
+		RunE: configValidate,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	schema := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of the config file",
+		Long: `
+Print the JSON Schema of localflux.yaml, for editors to provide completion and validation with. For example, save it
+as localflux.schema.json and reference it from the config with a "$schema: ./localflux.schema.json" field, or with a
+"# yaml-language-server: $schema=./localflux.schema.json" comment for the VS Code YAML extension.
+`,
+		RunE: configSchema,
+		Args: cobra.ExactArgs(0),
+	}
+
+	schema.Flags().String("api-version", v1alpha2.GroupVersion.Version, "Config version to print the schema of")
+
+	migrate := &cobra.Command{
+		Use:   "migrate [file]",
+		Short: "Upgrade a config file to the latest version",
+		Long: `
+Rewrite a config file, localflux.yaml by default, to the latest config version. Older versions are still loaded, as
+they are converted when read, but new fields are only available in the latest version. Comments and the order of fields
+are kept. Included files are not migrated, and may be passed separately.
+`,
+		RunE: configMigrate,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	migrate.Flags().Bool("dry-run", false, "Print the migrated config instead of writing it")
+
+	c := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the config file",
+	}
+
+	c.AddCommand(migrate)
+	c.AddCommand(schema)
+	c.AddCommand(validate)
+
+	return c
+}
+
+func configValidate(_ *cobra.Command, args []string) error {
+	path := "localflux.yaml"
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	problems, err := config.Validate(path)
+	if err != nil {
+		return err
+	}
+
+	if len(problems) == 0 {
+		fmt.Println("No problems found")
+
+		return nil
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+
+	return fmt.Errorf("%w: %d problems", config.ErrValidationFailed, len(problems))
+}
+
+func configMigrate(cmd *cobra.Command, args []string) error {
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return fmt.Errorf("failed to parse dry-run flag: %w", err)
+	}
+
+	path := "localflux.yaml"
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	migrated, changed, err := config.Migrate(raw)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Print(string(migrated))
+
+		return nil
+	}
+
+	if !changed {
+		fmt.Printf("%s is already %s\n", path, v1alpha2.GroupVersion)
+
+		return nil
+	}
+
+	if err := os.WriteFile(path, migrated, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	fmt.Printf("Migrated %s to %s\n", path, v1alpha2.GroupVersion)
+
+	return nil
+}
+
+func configSchema(cmd *cobra.Command, _ []string) error {
+	version, err := cmd.Flags().GetString("api-version")
+	if err != nil {
+		return fmt.Errorf("failed to parse api-version flag: %w", err)
+	}
+
+	schema, err := config.JSONSchema(version)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(schema))
+
+	return nil
+}
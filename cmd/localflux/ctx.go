@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/deployment"
+	"github.com/csnewman/localflux/internal/state"
+	"github.com/spf13/cobra"
+)
+
+// contextSwitchFile records the last context switch within the state directory, so that it can be restored.
+const contextSwitchFile = "context.json"
+
+func createCtxCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "ctx [deployment]",
+		Short: "Switch the current kube context to the cluster",
+		Long: `
+Switch the current kubectl context to the localflux cluster. If a deployment is given, the context's namespace is set
+to the deployment's primary namespace, unless overridden with --namespace. Use --restore to switch back to the
+previous context.
+`,
+		RunE: ctxRun,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	c.Flags().String("cluster", "", "Cluster name")
+	c.Flags().StringP("namespace", "n", "", "Namespace to select")
+	c.Flags().Bool("restore", false, "Switch back to the previous context")
+
+	return c
+}
+
+func ctxRun(cmd *cobra.Command, args []string) error {
+	restore, err := cmd.Flags().GetBool("restore")
+	if err != nil {
+		return fmt.Errorf("failed to parse restore flag: %w", err)
+	}
+
+	store, err := state.Open(cmd.Context(), logger)
+	if err != nil {
+		return err
+	}
+
+	var previous cluster.ContextSwitch
+
+	hasPrevious := true
+
+	if err := store.ReadJSON(contextSwitchFile, &previous); errors.Is(err, os.ErrNotExist) {
+		hasPrevious = false
+	} else if err != nil {
+		return err
+	}
+
+	if restore {
+		if len(args) > 0 {
+			return errors.New("--restore cannot be combined with a deployment name")
+		}
+
+		if !hasPrevious {
+			return errors.New("no context switch to restore")
+		}
+
+		if err := cluster.RestoreContext(&previous); err != nil {
+			return err
+		}
+
+		if err := store.Remove(contextSwitchFile); err != nil {
+			return err
+		}
+
+		if previous.Previous == "" {
+			fmt.Println("Cleared the current context")
+		} else {
+			fmt.Printf("Switched to context %q\n", previous.Previous)
+		}
+
+		return nil
+	}
+
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	clusterName, err := cmd.Flags().GetString("cluster")
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster flag: %w", err)
+	}
+
+	namespace, err := cmd.Flags().GetString("namespace")
+	if err != nil {
+		return fmt.Errorf("failed to parse namespace flag: %w", err)
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	if namespace == "" && len(args) > 0 {
+		m := deployment.NewManager(logger, cfg, cm)
+
+		namespace, err = m.Namespace(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	sw, err := cm.SwitchContext(clusterName, namespace)
+	if err != nil {
+		return err
+	}
+
+	// Switching again keeps the original context, so that restoring returns to where the user started.
+	if hasPrevious && sw.Previous == previous.Context {
+		sw.Previous = previous.Previous
+
+		if sw.Context == previous.Context {
+			sw.PreviousNamespace = previous.PreviousNamespace
+		}
+	}
+
+	if err := store.WriteJSON(contextSwitchFile, sw); err != nil {
+		return err
+	}
+
+	if namespace != "" {
+		fmt.Printf("Switched to context %q with namespace %q\n", sw.Context, namespace)
+	} else {
+		fmt.Printf("Switched to context %q\n", sw.Context)
+	}
+
+	return nil
+}
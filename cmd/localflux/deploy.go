@@ -2,10 +2,20 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
 	"github.com/csnewman/localflux/internal/cluster"
 	"github.com/csnewman/localflux/internal/config"
 	"github.com/csnewman/localflux/internal/deployment"
+	"github.com/csnewman/localflux/internal/state"
+	"github.com/csnewman/localflux/internal/telemetry"
 	"github.com/spf13/cobra"
 )
 
@@ -18,6 +28,16 @@ func createDeployCmd() *cobra.Command {
 	}
 
 	c.Flags().String("cluster", "", "Cluster name")
+	c.Flags().StringArray("step", nil, "Only deploy the given step (repeatable)")
+	c.Flags().StringP("profile", "p", "", "Profile to apply")
+	c.Flags().Bool("all", false, "Deploy every deployment in the config")
+	c.Flags().Int("parallel", 1, "Number of deployments to run at once when using --all")
+	c.Flags().String("result-file", "", "Write a JSON summary of the deployment to the given path")
+	c.Flags().Bool("direct", false, "Render and apply steps directly, bypassing Flux")
+	c.Flags().Bool("skip-build", false, "Reuse the images last pushed to the cluster instead of building")
+	c.Flags().Bool("diff", false, "Show the changes to helm releases before upgrading them")
+	c.Flags().StringArray("set", nil, "Set a helm value as [step:]key=value (repeatable)")
+	c.Flags().StringArrayP("values", "f", nil, "Merge a helm values file as [step:]path (repeatable)")
 
 	return c
 }
@@ -28,6 +48,13 @@ func deploy(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	shutdownTelemetry, err := telemetry.Setup(cmd.Context(), logger, cfg.Telemetry)
+	if err != nil {
+		return err
+	}
+
+	defer flushTelemetry(shutdownTelemetry)
+
 	cm := cluster.NewManager(logger, cfg)
 
 	m := deployment.NewManager(logger, cfg, cm)
@@ -37,13 +64,214 @@ func deploy(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to parse cluster flag: %w", err)
 	}
 
+	steps, err := cmd.Flags().GetStringArray("step")
+	if err != nil {
+		return fmt.Errorf("failed to parse step flag: %w", err)
+	}
+
+	profile, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		return fmt.Errorf("failed to parse profile flag: %w", err)
+	}
+
+	all, err := cmd.Flags().GetBool("all")
+	if err != nil {
+		return fmt.Errorf("failed to parse all flag: %w", err)
+	}
+
+	parallel, err := cmd.Flags().GetInt("parallel")
+	if err != nil {
+		return fmt.Errorf("failed to parse parallel flag: %w", err)
+	}
+
+	resultFile, err := cmd.Flags().GetString("result-file")
+	if err != nil {
+		return fmt.Errorf("failed to parse result-file flag: %w", err)
+	}
+
+	direct, err := cmd.Flags().GetBool("direct")
+	if err != nil {
+		return fmt.Errorf("failed to parse direct flag: %w", err)
+	}
+
+	skipBuild, err := cmd.Flags().GetBool("skip-build")
+	if err != nil {
+		return fmt.Errorf("failed to parse skip-build flag: %w", err)
+	}
+
+	diff, err := cmd.Flags().GetBool("diff")
+	if err != nil {
+		return fmt.Errorf("failed to parse diff flag: %w", err)
+	}
+
+	set, err := cmd.Flags().GetStringArray("set")
+	if err != nil {
+		return fmt.Errorf("failed to parse set flag: %w", err)
+	}
+
+	valueFiles, err := cmd.Flags().GetStringArray("values")
+	if err != nil {
+		return fmt.Errorf("failed to parse values flag: %w", err)
+	}
+
+	if all {
+		if len(args) > 0 || len(steps) > 0 {
+			return errors.New("--all cannot be combined with a deployment name or --step")
+		}
+
+		if len(set) > 0 || len(valueFiles) > 0 {
+			return errors.New("--all cannot be combined with --set or --values")
+		}
+
+		var results []deployment.DeployResult
+
+		err := drive(cmd.Context(), func(ctx context.Context, cb driverCallbacks) error {
+			var err error
+
+			results, err = m.DeployAll(ctx, cluster, deployment.DeployAllOptions{
+				Parallel:  parallel,
+				Profile:   profile,
+				Direct:    direct,
+				SkipBuild: skipBuild,
+				Diff:      diff,
+			}, cb)
+
+			return err
+		})
+
+		printDeploySummary(results)
+
+		if resultFile != "" && len(results) > 0 {
+			summaries := make([]*deployment.Result, 0, len(results))
+
+			for _, res := range results {
+				if res.Result != nil {
+					summaries = append(summaries, res.Result)
+				}
+			}
+
+			if werr := writeResultFile(resultFile, summaries); werr != nil {
+				return errors.Join(err, werr)
+			}
+		}
+
+		for _, res := range results {
+			if res.Result != nil {
+				recordRun(cmd.Context(), res.Result)
+			}
+		}
+
+		return err
+	}
+
 	var name string
 
 	if len(args) > 0 {
 		name = args[0]
 	}
 
-	return drive(cmd.Context(), func(ctx context.Context, cb driverCallbacks) error {
-		return m.Deploy(ctx, cluster, name, cb)
+	var result *deployment.Result
+
+	err = drive(cmd.Context(), func(ctx context.Context, cb driverCallbacks) error {
+		var err error
+
+		result, err = m.Deploy(ctx, cluster, name, deployment.DeployOptions{
+			Steps:      steps,
+			Profile:    profile,
+			Direct:     direct,
+			SkipBuild:  skipBuild,
+			Diff:       diff,
+			ValueFiles: valueFiles,
+			Set:        set,
+		}, cb)
+
+		return err
 	})
+
+	if result != nil {
+		recordRun(cmd.Context(), result)
+	}
+
+	if resultFile != "" && result != nil {
+		if werr := writeResultFile(resultFile, result); werr != nil {
+			return errors.Join(err, werr)
+		}
+	}
+
+	return err
+}
+
+// telemetryFlushTimeout bounds how long exiting waits for spans to be exported.
+const telemetryFlushTimeout = 5 * time.Second
+
+// flushTelemetry exports pending spans. Failures are logged rather than failing the deployment.
+func flushTelemetry(shutdown func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryFlushTimeout)
+	defer cancel()
+
+	if err := shutdown(ctx); err != nil {
+		logger.Warn("Failed to export traces", "err", err)
+	}
+}
+
+// maxRuns is the number of run records kept in the state directory.
+const maxRuns = 100
+
+// recordRun stores the result in the state directory. Failures are logged rather than failing the deployment.
+func recordRun(ctx context.Context, result *deployment.Result) {
+	store, err := state.Open(ctx, logger)
+	if err != nil {
+		logger.Warn("Failed to open state directory", "err", err)
+
+		return
+	}
+
+	name := result.StartedAt.UTC().Format("20060102T150405.000") + "-" + strings.ReplaceAll(result.Deployment, "/", "_")
+
+	if err := store.WriteJSON(filepath.Join(state.DirRuns, name+".json"), result); err != nil {
+		logger.Warn("Failed to record run", "err", err)
+
+		return
+	}
+
+	if err := store.Prune(state.DirRuns, maxRuns); err != nil {
+		logger.Warn("Failed to prune runs", "err", err)
+	}
+}
+
+func writeResultFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write result file: %w", err)
+	}
+
+	return nil
+}
+
+func printDeploySummary(results []deployment.DeployResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "DEPLOYMENT\tSTATUS\tDURATION\tERROR")
+
+	for _, res := range results {
+		status := "ok"
+		errMsg := ""
+
+		if res.Err != nil {
+			status = "failed"
+			errMsg = res.Err.Error()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", res.Name, status, res.Duration.Round(time.Millisecond), errMsg)
+	}
+
+	_ = w.Flush()
 }
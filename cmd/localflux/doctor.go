@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/deployment"
+	"github.com/spf13/cobra"
+)
+
+func createDoctorCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the builder can build the configured images",
+		Long: `
+Check that buildkit is reachable and that it can build every platform requested by the images in localflux.yaml.
+Platforms other than that of the buildkit host need QEMU emulators, which --fix installs into the buildkit host in
+use, either the cluster nodes or the local Docker host.
+`,
+		RunE: runDoctor,
+		Args: cobra.NoArgs,
+	}
+
+	c.Flags().String("cluster", "", "Cluster name")
+	c.Flags().Bool("fix", false, "Install missing emulators")
+
+	return c
+}
+
+func runDoctor(cmd *cobra.Command, _ []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	clusterName, err := cmd.Flags().GetString("cluster")
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster flag: %w", err)
+	}
+
+	fix, err := cmd.Flags().GetBool("fix")
+	if err != nil {
+		return fmt.Errorf("failed to parse fix flag: %w", err)
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	m := deployment.NewManager(logger, cfg, cm)
+
+	checks, err := m.Doctor(cmd.Context(), clusterName, fix)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+
+	failed := 0
+
+	for _, check := range checks {
+		status := "ok"
+
+		if !check.OK {
+			status = "failed"
+			failed++
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", check.Name, status, check.Detail)
+	}
+
+	_ = w.Flush()
+
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+
+	return nil
+}
@@ -11,9 +11,12 @@ import (
 	"github.com/csnewman/localflux/internal/deployment"
 	"github.com/csnewman/localflux/internal/progress"
 	"github.com/csnewman/localflux/internal/relay"
+	"github.com/tonistiigi/units"
 	"golang.org/x/sync/errgroup"
 	"os"
 	"slices"
+	"strings"
+	"text/tabwriter"
 	"time"
 )
 
@@ -27,6 +30,7 @@ var (
 	spinnerStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("63"))
 	detailStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Margin(0, 2)
 	errorDetailStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Margin(0, 2)
+	addedStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("42")).Margin(0, 2)
 	durationStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
 	infoMark         = lipgloss.NewStyle().Foreground(lipgloss.Color("250")).SetString("ℹ")
 	checkMark        = lipgloss.NewStyle().Foreground(lipgloss.Color("42")).SetString("✓")
@@ -83,6 +87,9 @@ func driveUI(ctx context.Context, fn func(ctx context.Context, cb driverCallback
 	return g.Wait()
 }
 
+// maxConnectionLog is the number of recent connection events shown.
+const maxConnectionLog = 5
+
 type model struct {
 	spinner   spinner.Model
 	cleanExit bool
@@ -95,6 +102,9 @@ type model struct {
 	vp        viewport.Model
 
 	trace *progress.Trace
+
+	forwardStats  []*relay.ForwardStats
+	connectionLog []string
 }
 
 func newModel(exitFunc func()) model {
@@ -160,6 +170,18 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.trace.Update(msg, m.width-5)
 		return m, nil
 
+	case forwardStats:
+		m.forwardStats = msg.Stats
+
+		return m, nil
+	case relay.ConnectionEvent:
+		m.connectionLog = append(m.connectionLog, formatConnectionEvent(msg))
+		if len(m.connectionLog) > maxConnectionLog {
+			m.connectionLog = m.connectionLog[len(m.connectionLog)-maxConnectionLog:]
+		}
+
+		return m, nil
+
 	case spinner.TickMsg:
 		var cmd tea.Cmd
 		m.spinner, cmd = m.spinner.Update(msg)
@@ -182,6 +204,20 @@ func (m model) View() string {
 		s += "\n" + detailStyle.Width(m.width).Render(m.state.detail)
 	}
 
+	if len(m.forwardStats) > 0 || len(m.connectionLog) > 0 {
+		s += "\n" + detailStyle.Width(m.width).Render("----")
+
+		if len(m.forwardStats) > 0 {
+			for _, l := range formatForwardStats(m.forwardStats) {
+				s += "\n" + detailStyle.Width(m.width).Render(l)
+			}
+		}
+
+		for _, l := range m.connectionLog {
+			s += "\n" + detailStyle.Width(m.width).Render(fmt.Sprintf("> %s", l))
+		}
+	}
+
 	if len(m.stepLines) > 0 {
 		s += "\n" + detailStyle.Width(m.width).Render("----")
 
@@ -290,6 +326,10 @@ type stepLines struct {
 	Lines []string
 }
 
+type forwardStats struct {
+	Stats []*relay.ForwardStats
+}
+
 type uiCallbacks struct {
 	p *tea.Program
 }
@@ -302,6 +342,35 @@ func (c *uiCallbacks) BuildStatus(name string, graph *deployment.SolveStatus) {
 	c.p.Send(graph)
 }
 
+func (c *uiCallbacks) Connection(event relay.ConnectionEvent) {
+	c.p.Send(event)
+}
+
+func (c *uiCallbacks) Stats(stats []*relay.ForwardStats) {
+	c.p.Send(forwardStats{Stats: stats})
+}
+
+func (c *uiCallbacks) Diagnostics(diag *deployment.Diagnostics) {
+	for _, line := range formatDiagnostics(diag) {
+		c.p.Println(detailStyle.Render(line))
+	}
+}
+
+func (c *uiCallbacks) Diff(diff *deployment.ReleaseDiff) {
+	for _, line := range formatDiff(diff) {
+		style := detailStyle
+
+		switch {
+		case strings.HasPrefix(line, "+"):
+			style = addedStyle
+		case strings.HasPrefix(line, "-"):
+			style = errorDetailStyle
+		}
+
+		c.p.Println(style.Render(line))
+	}
+}
+
 func (c *uiCallbacks) Success(detail string) {
 	c.p.Printf("%s %s", checkMark, detail)
 }
@@ -374,6 +443,25 @@ func (c *plainCallbacks) Completed(msg string, dur time.Duration) {
 	fmt.Println("completed:", msg, dur.Round(time.Second))
 }
 
+func (c *plainCallbacks) Connection(event relay.ConnectionEvent) {
+	fmt.Println("connection:", formatConnectionEvent(event))
+}
+
+// Stats is not printed in plain mode, as connection events are already logged.
+func (c *plainCallbacks) Stats([]*relay.ForwardStats) {}
+
+func (c *plainCallbacks) Diagnostics(diag *deployment.Diagnostics) {
+	for _, line := range formatDiagnostics(diag) {
+		fmt.Println("diagnostics:", line)
+	}
+}
+
+func (c *plainCallbacks) Diff(diff *deployment.ReleaseDiff) {
+	for _, line := range formatDiff(diff) {
+		fmt.Println("diff:", line)
+	}
+}
+
 func (c *plainCallbacks) exiting(err error) {
 	if err != nil && c.trace != nil {
 		fmt.Println(c.trace.ErrorLogs())
@@ -416,3 +504,114 @@ func (c *plainCallbacks) StepLines(lines []string) {
 
 	c.lastLines = slices.Clone(lines)
 }
+
+func formatConnectionEvent(event relay.ConnectionEvent) string {
+	msg := fmt.Sprintf("#%d %s %s from %s", event.ID, event.Forward, event.Kind, event.Peer)
+
+	if event.Kind == relay.ConnectionAccepted {
+		return msg
+	}
+
+	msg += fmt.Sprintf(
+		" after %s (↑%.2f ↓%.2f)",
+		event.Duration.Round(time.Millisecond),
+		units.Bytes(event.Sent),
+		units.Bytes(event.Received),
+	)
+
+	if event.Err != nil {
+		msg += ": " + event.Err.Error()
+	}
+
+	return msg
+}
+
+// formatForwardStats renders the statistics of forwards as aligned table lines.
+func formatForwardStats(stats []*relay.ForwardStats) []string {
+	var buf strings.Builder
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(w, "FORWARD\tACTIVE\tTOTAL\tERRORS\tSENT\tRECEIVED\tLATENCY")
+
+	for _, f := range stats {
+		latency := "-"
+		if f.ConnectLatencyNs > 0 {
+			latency = f.ConnectLatency().Round(time.Microsecond).String()
+		}
+
+		_, _ = fmt.Fprintf(
+			w,
+			"%s\t%d\t%d\t%d\t%.2f\t%.2f\t%s\n",
+			f.Forward,
+			f.Active,
+			f.Total,
+			f.Errors,
+			units.Bytes(f.Sent),
+			units.Bytes(f.Received),
+			latency,
+		)
+	}
+
+	_ = w.Flush()
+
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func formatDiagnostics(diag *deployment.Diagnostics) []string {
+	lines := []string{fmt.Sprintf("Step %q diagnostics:", diag.Step)}
+
+	for _, pod := range diag.Pods {
+		lines = append(lines, fmt.Sprintf("pod %s/%s: %s", pod.Namespace, pod.Name, pod.Phase))
+
+		for _, container := range pod.Containers {
+			line := fmt.Sprintf("  container %s: %d restarts", container.Name, container.Restarts)
+
+			if container.State != "" {
+				line += ", " + container.State
+			}
+
+			lines = append(lines, line)
+
+			for _, l := range container.Logs {
+				lines = append(lines, "    | "+l)
+			}
+		}
+	}
+
+	if len(diag.Events) > 0 {
+		lines = append(lines, "events:")
+
+		for _, event := range diag.Events {
+			lines = append(lines, "  "+event)
+		}
+	}
+
+	return lines
+}
+
+func formatDiff(diff *deployment.ReleaseDiff) []string {
+	title := fmt.Sprintf("Step %q release changes:", diff.Step)
+	if diff.Install {
+		title = fmt.Sprintf("Step %q release will be installed:", diff.Step)
+	}
+
+	lines := []string{title}
+
+	for _, section := range []struct {
+		name string
+		diff string
+	}{
+		{"values", diff.Values},
+		{"manifest", diff.Manifest},
+	} {
+		if section.diff == "" {
+			continue
+		}
+
+		lines = append(lines, section.name+":")
+		lines = append(lines, strings.Split(strings.TrimRight(section.diff, "\n"), "\n")...)
+	}
+
+	return lines
+}
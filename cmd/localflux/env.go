@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/deployment"
+	"github.com/spf13/cobra"
+)
+
+func createEnvCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "env [deployment]",
+		Short: "Print environment variables describing a deployment",
+		Long: `
+Print environment variables describing a deployment, such as the registry address, kube context and the local
+addresses of forwarded ports. Use with eval, e.g. eval $(localflux env myapp).
+`,
+		RunE: env,
+		Args: cobra.ExactArgs(1),
+	}
+
+	c.Flags().String("cluster", "", "Cluster name")
+	c.Flags().Bool("dotenv", false, "Output in .env format instead of shell exports")
+
+	return c
+}
+
+func env(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	clusterName, err := cmd.Flags().GetString("cluster")
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster flag: %w", err)
+	}
+
+	dotenv, err := cmd.Flags().GetBool("dotenv")
+	if err != nil {
+		return fmt.Errorf("failed to parse dotenv flag: %w", err)
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	m := deployment.NewManager(logger, cfg, cm)
+
+	vars, err := m.Env(cmd.Context(), clusterName, args[0])
+	if err != nil {
+		return err
+	}
+
+	for _, v := range vars {
+		if dotenv {
+			fmt.Printf("%s=%s\n", v.Name, v.Value)
+
+			continue
+		}
+
+		fmt.Printf("export %s='%s'\n", v.Name, strings.ReplaceAll(v.Value, "'", `'\''`))
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+	"github.com/csnewman/localflux/internal/relay"
+	"github.com/spf13/cobra"
+)
+
+var errRelayDisabled = errors.New("relay is not enabled for the cluster")
+
+func createExposeCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "expose [service name] [port[:local port]]",
+		Short: "Expose a local port within the cluster until interrupted",
+		Long: `
+Expose a port on this machine within the cluster for the lifetime of the command, as a service that in-cluster apps
+can reach by name, e.g. "localflux expose api 8080 -n backend" serves api.backend.svc.cluster.local:8080 from
+127.0.0.1:8080. Traffic is tunneled back through the relay, which must be enabled for the cluster. The service is
+removed once the command stops.
+`,
+		RunE: exposeRun,
+		Args: cobra.ExactArgs(2),
+	}
+
+	c.Flags().String("cluster", "", "Cluster name")
+	c.Flags().StringP("namespace", "n", "default", "Namespace of the service")
+	c.Flags().String("local-host", "127.0.0.1", "Local host to connect to")
+
+	return c
+}
+
+func exposeRun(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	clusterName, err := cmd.Flags().GetString("cluster")
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster flag: %w", err)
+	}
+
+	if clusterName == "" {
+		clusterName = cfg.DefaultCluster
+	}
+
+	namespace, err := cmd.Flags().GetString("namespace")
+	if err != nil {
+		return fmt.Errorf("failed to parse namespace flag: %w", err)
+	}
+
+	localHost, err := cmd.Flags().GetString("local-host")
+	if err != nil {
+		return fmt.Errorf("failed to parse local-host flag: %w", err)
+	}
+
+	reverse, err := parseReverse(args[0], args[1], namespace, localHost)
+	if err != nil {
+		return err
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	provider, err := cm.Provider(clusterName)
+	if err != nil {
+		return err
+	}
+
+	if !provider.RelayConfig().Enabled {
+		return fmt.Errorf("%w: %s", errRelayDisabled, clusterName)
+	}
+
+	rc := relay.NewClient(logger)
+
+	return drive(cmd.Context(), func(ctx context.Context, cb driverCallbacks) error {
+		kc, err := provider.K8sClient(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		if err := rc.Connect(kc); err != nil {
+			return fmt.Errorf("failed to connect to relay: %w", err)
+		}
+
+		defer rc.Close()
+
+		local := net.JoinHostPort(reverse.LocalHost, strconv.Itoa(reverse.LocalPort))
+
+		cb.Info(fmt.Sprintf(
+			"Exposing %s as %s.%s.svc.cluster.local:%d",
+			local,
+			reverse.Name,
+			reverse.Namespace,
+			reverse.Port,
+		))
+
+		return rc.Reverse(ctx, reverse, cb)
+	})
+}
+
+// parseReverse parses a service name and a port in the form "port[:local port]".
+func parseReverse(name string, ports string, namespace string, localHost string) (*v1alpha1.ReverseForward, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid service name %q", name)
+	}
+
+	remote, local, hasLocal := strings.Cut(ports, ":")
+
+	port, err := strconv.Atoi(remote)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %q", remote)
+	}
+
+	localPort := port
+
+	if hasLocal {
+		localPort, err = strconv.Atoi(local)
+		if err != nil || localPort < 1 || localPort > 65535 {
+			return nil, fmt.Errorf("invalid local port %q", local)
+		}
+	}
+
+	return &v1alpha1.ReverseForward{
+		Namespace: namespace,
+		Name:      name,
+		Port:      port,
+		LocalPort: localPort,
+		LocalHost: localHost,
+	}, nil
+}
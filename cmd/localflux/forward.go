@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+	"github.com/csnewman/localflux/internal/relay"
+	"github.com/spf13/cobra"
+)
+
+// kindAliases maps the short names accepted by kubectl to the kinds understood by the relay.
+var kindAliases = map[string]string{
+	"svc":      "service",
+	"services": "service",
+	"po":       "pod",
+	"pods":     "pod",
+	"deploy":   "deployment",
+	"sts":      "statefulset",
+	"ds":       "daemonset",
+	"rs":       "replicaset",
+}
+
+func createForwardCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "forward [kind/name] [port[:local port]]",
+		Short: "Forward a port until interrupted",
+		Long: `
+Forward a port of a resource in the cluster for the lifetime of the command, without editing localflux.yaml. The
+forward goes through the relay when it is enabled for the cluster, or otherwise through a Kubernetes port-forward per
+connection. The local port defaults to the forwarded port, e.g. "localflux forward svc/my-db 5432:15432 -n infra".
+`,
+		RunE: forwardRun,
+		Args: cobra.ExactArgs(2),
+	}
+
+	c.Flags().String("cluster", "", "Cluster name")
+	c.Flags().StringP("namespace", "n", "default", "Namespace of the resource")
+	c.Flags().String("address", "127.0.0.1", "Local address to serve the forward on")
+	c.Flags().Bool("direct", false, "Use a Kubernetes port-forward even when the relay is enabled")
+	addInspectFlags(c)
+
+	return c
+}
+
+func forwardRun(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	clusterName, err := cmd.Flags().GetString("cluster")
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster flag: %w", err)
+	}
+
+	if clusterName == "" {
+		clusterName = cfg.DefaultCluster
+	}
+
+	namespace, err := cmd.Flags().GetString("namespace")
+	if err != nil {
+		return fmt.Errorf("failed to parse namespace flag: %w", err)
+	}
+
+	address, err := cmd.Flags().GetString("address")
+	if err != nil {
+		return fmt.Errorf("failed to parse address flag: %w", err)
+	}
+
+	direct, err := cmd.Flags().GetBool("direct")
+	if err != nil {
+		return fmt.Errorf("failed to parse direct flag: %w", err)
+	}
+
+	bind, err := netip.ParseAddr(address)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+
+	forward, err := parseForward(args[0], args[1], namespace)
+	if err != nil {
+		return err
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	provider, err := cm.Provider(clusterName)
+	if err != nil {
+		return err
+	}
+
+	rc := relay.NewClient(logger)
+	rc.SetBindAddress(bind)
+
+	if err := enableInspect(cmd, rc); err != nil {
+		return err
+	}
+
+	return drive(cmd.Context(), func(ctx context.Context, cb driverCallbacks) error {
+		kc, err := provider.K8sClient(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		local := netip.AddrPortFrom(bind, uint16(*forward.LocalPort)).String()
+
+		if direct || !provider.RelayConfig().Enabled {
+			cb.Info(fmt.Sprintf("Forwarding %s on %s through port-forwards", args[0], local))
+
+			return rc.ForwardDirect(ctx, kc, forward, cb)
+		}
+
+		if err := rc.Connect(kc); err != nil {
+			return fmt.Errorf("failed to connect to relay: %w", err)
+		}
+
+		defer rc.Close()
+
+		cb.Info(fmt.Sprintf("Forwarding %s on %s through the relay", args[0], local))
+
+		return rc.Forward(ctx, forward, cb)
+	})
+}
+
+func addInspectFlags(c *cobra.Command) {
+	c.Flags().Bool("inspect", false, "Log the HTTP/1.1 requests relayed over forwards")
+	c.Flags().String("inspect-dir", "", "Directory to write inspected request and response bodies to")
+}
+
+// enableInspect enables the inspection of forwarded HTTP traffic when requested by the flags.
+func enableInspect(cmd *cobra.Command, rc *relay.Client) error {
+	inspect, err := cmd.Flags().GetBool("inspect")
+	if err != nil {
+		return fmt.Errorf("failed to parse inspect flag: %w", err)
+	}
+
+	dir, err := cmd.Flags().GetString("inspect-dir")
+	if err != nil {
+		return fmt.Errorf("failed to parse inspect-dir flag: %w", err)
+	}
+
+	if !inspect {
+		return nil
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create inspect directory: %w", err)
+		}
+	}
+
+	rc.EnableInspect(relay.InspectOptions{
+		BodyDir: dir,
+	})
+
+	return nil
+}
+
+// parseForward parses a resource in the form "kind/name" and a port in the form "port[:local port]".
+func parseForward(resource string, ports string, namespace string) (*v1alpha1.PortForward, error) {
+	kind, name, ok := strings.Cut(resource, "/")
+	if !ok || kind == "" || name == "" {
+		return nil, fmt.Errorf("invalid resource %q: expected kind/name", resource)
+	}
+
+	kind = strings.ToLower(kind)
+	if alias, ok := kindAliases[kind]; ok {
+		kind = alias
+	}
+
+	remote, local, hasLocal := strings.Cut(ports, ":")
+
+	port, err := strconv.Atoi(remote)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %q", remote)
+	}
+
+	localPort := port
+
+	if hasLocal {
+		localPort, err = strconv.Atoi(local)
+		if err != nil || localPort < 1 || localPort > 65535 {
+			return nil, fmt.Errorf("invalid local port %q", local)
+		}
+	}
+
+	return &v1alpha1.PortForward{
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Port:      port,
+		Network:   "tcp",
+		LocalPort: &localPort,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/deployment"
+	"github.com/spf13/cobra"
+)
+
+func createGCCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove localflux resources that no longer match the config",
+		Long: `
+Remove Kustomizations, HelmReleases, sources, the Secrets holding resolved secrets of steps and deployment state from
+the localflux namespace that do not correspond to any deployment in the current config. Resources created from other config files sharing the cluster are also
+considered orphaned, so review the list before confirming.
+`,
+		RunE: gc,
+		Args: cobra.NoArgs,
+	}
+
+	c.Flags().String("cluster", "", "Cluster name")
+	c.Flags().BoolP("yes", "y", false, "Remove without asking for confirmation")
+	c.Flags().Bool("dry-run", false, "Only list the orphaned resources")
+
+	return c
+}
+
+func gc(cmd *cobra.Command, _ []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	clusterName, err := cmd.Flags().GetString("cluster")
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster flag: %w", err)
+	}
+
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return fmt.Errorf("failed to parse yes flag: %w", err)
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return fmt.Errorf("failed to parse dry-run flag: %w", err)
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	m := deployment.NewManager(logger, cfg, cm)
+
+	orphans, err := m.FindOrphans(cmd.Context(), clusterName)
+	if err != nil {
+		return err
+	}
+
+	if len(orphans) == 0 {
+		fmt.Println("No orphaned resources found")
+
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "KIND\tNAME")
+
+	for _, orphan := range orphans {
+		fmt.Fprintf(w, "%s\t%s\n", orphan.GVK.Kind, orphan.Name)
+	}
+
+	_ = w.Flush()
+
+	if dryRun {
+		return nil
+	}
+
+	if !yes {
+		fmt.Printf("Remove %d resources? [y/N] ", len(orphans))
+
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Aborted")
+
+			return nil
+		}
+	}
+
+	if err := m.DeleteOrphans(cmd.Context(), clusterName, orphans); err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d resources\n", len(orphans))
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/deployment"
+	"github.com/spf13/cobra"
+)
+
+func createGraphCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "graph [deployment]",
+		Short: "Render the objects a deployment will create as a graph",
+		RunE:  graph,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	c.Flags().String("format", deployment.GraphFormatDot, "Output format (dot, mermaid)")
+
+	return c
+}
+
+func graph(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return fmt.Errorf("failed to parse format flag: %w", err)
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	m := deployment.NewManager(logger, cfg, cm)
+
+	g, err := m.Graph(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+
+	out, err := g.Render(format)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(out)
+
+	return nil
+}
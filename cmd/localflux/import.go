@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/csnewman/localflux/internal/gitops"
+	"github.com/spf13/cobra"
+)
+
+func createImportCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "import [dir]",
+		Short: "Generate a deployment from an existing Flux GitOps directory",
+		RunE:  importGitOps,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	c.Flags().String("name", "", "Name of the generated deployment (defaults to the directory name)")
+	c.Flags().StringP("output", "o", "", "Write the deployment to a file instead of stdout")
+
+	return c
+}
+
+func importGitOps(cmd *cobra.Command, args []string) error {
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return fmt.Errorf("failed to parse name flag: %w", err)
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return fmt.Errorf("failed to parse output flag: %w", err)
+	}
+
+	root, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	if name == "" {
+		name = filepath.Base(root)
+	}
+
+	base, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	imp := gitops.NewImporter(logger, root)
+
+	d, err := imp.Import(name, base)
+	if err != nil {
+		return err
+	}
+
+	for _, warning := range imp.Warnings {
+		fmt.Fprintln(os.Stderr, "Warning:", warning)
+	}
+
+	out, err := gitops.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to encode deployment: %w", err)
+	}
+
+	if output == "" {
+		fmt.Print(string(out))
+
+		return nil
+	}
+
+	if err := os.WriteFile(output, out, 0o644); err != nil {
+		return fmt.Errorf("failed to write deployment: %w", err)
+	}
+
+	return nil
+}
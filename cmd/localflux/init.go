@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/csnewman/localflux/internal/compose"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	"github.com/csnewman/localflux/internal/gitops"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func createInitCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "init",
+		Short: "Create a localflux.yaml for the current directory",
+		Long: `
+Create a localflux.yaml for the current directory, with a minikube cluster and a first deployment. The directory is
+scanned for Dockerfiles, Go modules, Helm charts and kustomizations, and each one found is offered as an image or step
+of the deployment. Alternatively, the services of a Compose file are converted with --from-compose.
+`,
+		RunE: initConfig,
+		Args: cobra.NoArgs,
+	}
+
+	c.Flags().String("from-compose", "", "Convert the services of a Compose file")
+	c.Flags().String("name", "", "Name of the generated deployment (defaults to the compose project or directory name)")
+	c.Flags().String("namespace", "default", "Namespace to deploy the services to")
+	c.Flags().String("registry", "registry.minikube", "Registry to push built images to")
+	c.Flags().String("output-dir", "deploy", "Directory to write the generated manifests to")
+	c.Flags().Bool("force", false, "Overwrite an existing localflux.yaml")
+	c.Flags().BoolP("yes", "y", false, "Accept everything detected without prompting")
+
+	return c
+}
+
+func initConfig(cmd *cobra.Command, args []string) error {
+	composeFile, err := cmd.Flags().GetString("from-compose")
+	if err != nil {
+		return fmt.Errorf("failed to parse from-compose flag: %w", err)
+	}
+
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return fmt.Errorf("failed to parse name flag: %w", err)
+	}
+
+	namespace, err := cmd.Flags().GetString("namespace")
+	if err != nil {
+		return fmt.Errorf("failed to parse namespace flag: %w", err)
+	}
+
+	registry, err := cmd.Flags().GetString("registry")
+	if err != nil {
+		return fmt.Errorf("failed to parse registry flag: %w", err)
+	}
+
+	outputDir, err := cmd.Flags().GetString("output-dir")
+	if err != nil {
+		return fmt.Errorf("failed to parse output-dir flag: %w", err)
+	}
+
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return fmt.Errorf("failed to parse force flag: %w", err)
+	}
+
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return fmt.Errorf("failed to parse yes flag: %w", err)
+	}
+
+	const configFile = "localflux.yaml"
+
+	if _, err := os.Stat(configFile); err == nil && !force {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", configFile)
+	}
+
+	var deployment *v1alpha2.Deployment
+
+	if composeFile != "" {
+		deployment, err = composeDeployment(composeFile, name, namespace, registry, outputDir)
+	} else {
+		deployment, err = detectDeployment(name, namespace, registry, outputDir, newPrompter(yes))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	cfg := &v1alpha2.Config{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha2.GroupVersion.String(),
+			Kind:       "Config",
+		},
+		DefaultCluster: "minikube",
+		Clusters: []*v1alpha2.Cluster{
+			{
+				Name: "minikube",
+				Minikube: &v1alpha2.Minikube{
+					Profile: "minikube",
+				},
+				Relay: &v1alpha2.Relay{
+					Enabled: len(deployment.PortForward) > 0,
+				},
+			},
+		},
+		Deployments: []*v1alpha2.Deployment{deployment},
+	}
+
+	out, err := gitops.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	if err := os.WriteFile(configFile, out, 0o644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	fmt.Printf("Wrote %s\n", configFile)
+
+	return nil
+}
+
+// composeDeployment converts the services of the Compose file into a deployment, writing their manifests to the
+// output directory.
+func composeDeployment(
+	composeFile string,
+	name string,
+	namespace string,
+	registry string,
+	outputDir string,
+) (*v1alpha2.Deployment, error) {
+	project, err := compose.Load(composeFile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, warning := range project.Warnings {
+		fmt.Fprintln(os.Stderr, "Warning:", warning)
+	}
+
+	if name == "" {
+		name = project.Name
+	}
+
+	services, err := project.Select(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests, err := project.Manifests(registry, services)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(outputDir, "services.yaml"), manifests, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write manifests: %w", err)
+	}
+
+	kustomization, err := yaml.Marshal(map[string]any{
+		"apiVersion": "kustomize.config.k8s.io/v1beta1",
+		"kind":       "Kustomization",
+		"resources":  []string{"services.yaml"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode kustomization: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(outputDir, "kustomization.yaml"), kustomization, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write kustomization: %w", err)
+	}
+
+	deployment := &v1alpha2.Deployment{
+		Name: name,
+		Steps: []*v1alpha2.Step{
+			{
+				Name: "services",
+				Kustomize: &v1alpha2.Kustomize{
+					Context:   outputDir,
+					Namespace: namespace,
+				},
+			},
+		},
+	}
+
+	for _, image := range project.Images(registry, services) {
+		deployment.Images = append(deployment.Images, &v1alpha2.Image{
+			Image:     image.Image,
+			Context:   image.Context,
+			File:      image.File,
+			Target:    image.Target,
+			BuildArgs: image.BuildArgs,
+		})
+	}
+
+	for _, service := range services {
+		for _, port := range project.Services[service].Ports {
+			published := port.Published
+			if published == 0 {
+				published = port.Target
+			}
+
+			deployment.PortForward = append(deployment.PortForward, &v1alpha2.PortForward{
+				Kind:      "Service",
+				Namespace: namespace,
+				Name:      compose.Sanitize(service),
+				Port:      published,
+			})
+		}
+	}
+
+	fmt.Printf("Wrote %s\n", outputDir)
+
+	return deployment, nil
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/compose"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// scanDepth is how many directories below the current directory are scanned.
+	scanDepth = 4
+	// buildpacksBuilder is the builder of Go modules without a Dockerfile.
+	buildpacksBuilder = "paketobuildpacks/builder-jammy-base"
+)
+
+// skippedDirs are not scanned, as they hold dependencies or build output rather than the project itself.
+var skippedDirs = map[string]struct{}{
+	"node_modules": {},
+	"vendor":       {},
+	"dist":         {},
+	"target":       {},
+	"build":        {},
+}
+
+// prompter asks the user to confirm what was detected. With yes set, the defaults are accepted without asking.
+type prompter struct {
+	yes    bool
+	reader *bufio.Reader
+}
+
+func newPrompter(yes bool) *prompter {
+	return &prompter{
+		yes:    yes,
+		reader: bufio.NewReader(os.Stdin),
+	}
+}
+
+// confirm asks the question, defaulting to yes.
+func (p *prompter) confirm(question string) bool {
+	answer := strings.ToLower(p.ask(question+" [Y/n]", ""))
+
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// ask asks the question, returning the default when no answer is given.
+func (p *prompter) ask(question string, def string) string {
+	if p.yes {
+		return def
+	}
+
+	if def != "" {
+		fmt.Printf("%s [%s] ", question, def)
+	} else {
+		fmt.Printf("%s ", question)
+	}
+
+	answer, err := p.reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return def
+	}
+
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return def
+	}
+
+	return answer
+}
+
+// detected is what was found by scanning the current directory.
+type detected struct {
+	images []*v1alpha2.Image
+	steps  []*v1alpha2.Step
+	// dockerfiles are the directories containing a Dockerfile.
+	dockerfiles map[string]struct{}
+	// modules are the directories containing a go.mod.
+	modules []string
+}
+
+// detectDeployment scans the current directory for Dockerfiles, Go modules, Helm charts and kustomizations, offering
+// each one found as an image or step of the deployment. A placeholder kustomization is written to the output directory
+// when no steps are accepted.
+func detectDeployment(
+	name string,
+	namespace string,
+	registry string,
+	outputDir string,
+	p *prompter,
+) (*v1alpha2.Deployment, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	if name == "" {
+		name = p.ask("Deployment name?", compose.Sanitize(filepath.Base(cwd)))
+	}
+
+	found := &detected{
+		dockerfiles: make(map[string]struct{}),
+	}
+
+	if err := filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return found.scanDir(path, d.Name(), namespace)
+		}
+
+		found.scanFile(path, d.Name(), namespace, registry)
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to scan directory: %w", err)
+	}
+
+	for _, dir := range found.modules {
+		if _, ok := found.dockerfiles[dir]; ok {
+			continue
+		}
+
+		found.images = append(found.images, &v1alpha2.Image{
+			Image:   imageName(registry, dir, ""),
+			Context: dir,
+			Buildpacks: &v1alpha2.Buildpacks{
+				Builder: buildpacksBuilder,
+			},
+		})
+	}
+
+	deployment := &v1alpha2.Deployment{
+		Name: name,
+	}
+
+	for _, image := range found.images {
+		source := image.Context
+		if image.File != "" {
+			source = image.File
+		} else if image.Buildpacks != nil {
+			source += " (Go module, built with buildpacks)"
+		}
+
+		if p.confirm(fmt.Sprintf("Build image %s from %s?", image.Image, source)) {
+			deployment.Images = append(deployment.Images, image)
+		}
+	}
+
+	names := make(map[string]struct{})
+
+	for _, step := range found.steps {
+		kind, dir := "kustomization", ""
+
+		if step.Helm != nil {
+			kind, dir = "chart", step.Helm.Context
+		} else {
+			dir = step.Kustomize.Context
+		}
+
+		if !p.confirm(fmt.Sprintf("Deploy %s %s?", kind, dir)) {
+			continue
+		}
+
+		step.Name = uniqueName(step.Name, names)
+
+		deployment.Steps = append(deployment.Steps, step)
+	}
+
+	if len(deployment.Steps) == 0 {
+		if err := writePlaceholder(outputDir); err != nil {
+			return nil, err
+		}
+
+		deployment.Steps = append(deployment.Steps, &v1alpha2.Step{
+			Name: "manifests",
+			Kustomize: &v1alpha2.Kustomize{
+				Context:   outputDir,
+				Namespace: namespace,
+			},
+		})
+	}
+
+	for _, image := range deployment.Images {
+		if image.Buildpacks != nil {
+			fmt.Println("Note: images built with buildpacks require the pack CLI and a local Docker daemon")
+
+			break
+		}
+	}
+
+	return deployment, nil
+}
+
+func (d *detected) scanDir(path string, name string, namespace string) error {
+	if path == "." {
+		return nil
+	}
+
+	if _, ok := skippedDirs[name]; ok || strings.HasPrefix(name, ".") {
+		return filepath.SkipDir
+	}
+
+	if strings.Count(filepath.ToSlash(path), "/") >= scanDepth {
+		return filepath.SkipDir
+	}
+
+	chart, err := os.ReadFile(filepath.Join(path, "Chart.yaml"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read chart: %w", err)
+	}
+
+	var meta struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+
+	if err := yaml.Unmarshal(chart, &meta); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filepath.Join(path, "Chart.yaml"), err)
+	}
+
+	if meta.Name == "" {
+		meta.Name = name
+	}
+
+	d.steps = append(d.steps, &v1alpha2.Step{
+		Name: compose.Sanitize(meta.Name),
+		Helm: &v1alpha2.Helm{
+			Context:   path,
+			Chart:     meta.Name,
+			Version:   meta.Version,
+			Namespace: namespace,
+		},
+	})
+
+	// Templates and subcharts of the chart are deployed with it.
+	return filepath.SkipDir
+}
+
+func (d *detected) scanFile(path string, name string, namespace string, registry string) {
+	dir := filepath.Dir(path)
+
+	switch {
+	case name == "go.mod":
+		d.modules = append(d.modules, dir)
+
+	case name == "kustomization.yaml" || name == "kustomization.yml" || name == "Kustomization":
+		stepName := filepath.Base(dir)
+		if dir == "." {
+			stepName = "manifests"
+		}
+
+		d.steps = append(d.steps, &v1alpha2.Step{
+			Name: compose.Sanitize(stepName),
+			Kustomize: &v1alpha2.Kustomize{
+				Context:   dir,
+				Namespace: namespace,
+			},
+		})
+
+	default:
+		variant, ok := dockerfileVariant(name)
+		if !ok {
+			return
+		}
+
+		d.dockerfiles[dir] = struct{}{}
+
+		image := &v1alpha2.Image{
+			Image:   imageName(registry, dir, variant),
+			Context: dir,
+		}
+
+		if name != "Dockerfile" {
+			image.File = path
+		}
+
+		d.images = append(d.images, image)
+	}
+}
+
+// dockerfileVariant reports whether the file is a Dockerfile, returning its variant, e.g. "dev" for "Dockerfile.dev"
+// or "dev.Dockerfile".
+func dockerfileVariant(name string) (string, bool) {
+	switch {
+	case name == "Dockerfile" || name == "Containerfile":
+		return "", true
+	case strings.HasPrefix(name, "Dockerfile."):
+		return strings.TrimPrefix(name, "Dockerfile."), true
+	case strings.HasSuffix(name, ".Dockerfile"):
+		return strings.TrimSuffix(name, ".Dockerfile"), true
+	default:
+		return "", false
+	}
+}
+
+// imageName names the image after its directory, or the current directory for the root.
+func imageName(registry string, dir string, variant string) string {
+	base := filepath.Base(dir)
+
+	if dir == "." {
+		if cwd, err := os.Getwd(); err == nil {
+			base = filepath.Base(cwd)
+		}
+	}
+
+	name := compose.Sanitize(base)
+	if variant != "" {
+		name += "-" + compose.Sanitize(variant)
+	}
+
+	return registry + "/" + name
+}
+
+// uniqueName suffixes the name with a number if it is already taken, then records it.
+func uniqueName(name string, taken map[string]struct{}) string {
+	if name == "" {
+		name = "step"
+	}
+
+	unique := name
+
+	for i := 2; ; i++ {
+		if _, ok := taken[unique]; !ok {
+			break
+		}
+
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+
+	taken[unique] = struct{}{}
+
+	return unique
+}
+
+// writePlaceholder writes an empty kustomization to the directory, for the first manifests of the deployment.
+func writePlaceholder(dir string) error {
+	path := filepath.Join(dir, "kustomization.yaml")
+
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	kustomization, err := yaml.Marshal(map[string]any{
+		"apiVersion": "kustomize.config.k8s.io/v1beta1",
+		"kind":       "Kustomization",
+		"resources":  []string{},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode kustomization: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, kustomization, 0o644); err != nil {
+		return fmt.Errorf("failed to write kustomization: %w", err)
+	}
+
+	fmt.Printf("Wrote %s\n", path)
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/relay"
+	"github.com/spf13/cobra"
+)
+
+func createInterceptCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "intercept [kind/name]",
+		Short: "Redirect the traffic of a workload to a local process until interrupted",
+		Long: `
+Redirect the traffic services send to a port of a deployment or statefulset to a local process, e.g.
+"localflux intercept deployment/api --port 8080 -n backend". The workload is scaled down while intercepted, and its
+services route to the local process through the relay, which must be enabled for the cluster. The workload is scaled
+back up once the command stops.
+`,
+		RunE: interceptRun,
+		Args: cobra.ExactArgs(1),
+	}
+
+	c.Flags().String("cluster", "", "Cluster name")
+	c.Flags().StringP("namespace", "n", "default", "Namespace of the workload")
+	c.Flags().Int("port", 0, "Container port of the workload to intercept")
+	c.Flags().Int("local-port", 0, "Local port to redirect to, defaulting to the container port")
+	c.Flags().String("local-host", "127.0.0.1", "Local host to redirect to")
+
+	_ = c.MarkFlagRequired("port")
+
+	return c
+}
+
+func interceptRun(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	clusterName, err := cmd.Flags().GetString("cluster")
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster flag: %w", err)
+	}
+
+	if clusterName == "" {
+		clusterName = cfg.DefaultCluster
+	}
+
+	opts := relay.InterceptOptions{}
+
+	if opts.Namespace, err = cmd.Flags().GetString("namespace"); err != nil {
+		return fmt.Errorf("failed to parse namespace flag: %w", err)
+	}
+
+	if opts.Port, err = cmd.Flags().GetInt("port"); err != nil {
+		return fmt.Errorf("failed to parse port flag: %w", err)
+	}
+
+	if opts.LocalPort, err = cmd.Flags().GetInt("local-port"); err != nil {
+		return fmt.Errorf("failed to parse local-port flag: %w", err)
+	}
+
+	if opts.LocalHost, err = cmd.Flags().GetString("local-host"); err != nil {
+		return fmt.Errorf("failed to parse local-host flag: %w", err)
+	}
+
+	if opts.Port < 1 || opts.Port > 65535 {
+		return fmt.Errorf("invalid port %d", opts.Port)
+	}
+
+	if opts.LocalPort == 0 {
+		opts.LocalPort = opts.Port
+	}
+
+	kind, name, ok := strings.Cut(args[0], "/")
+	if !ok || kind == "" || name == "" {
+		return fmt.Errorf("invalid workload %q: expected kind/name", args[0])
+	}
+
+	opts.Kind = strings.ToLower(kind)
+	if alias, ok := kindAliases[opts.Kind]; ok {
+		opts.Kind = alias
+	}
+
+	opts.Name = name
+
+	cm := cluster.NewManager(logger, cfg)
+
+	provider, err := cm.Provider(clusterName)
+	if err != nil {
+		return err
+	}
+
+	if !provider.RelayConfig().Enabled {
+		return fmt.Errorf("%w: %s", errRelayDisabled, clusterName)
+	}
+
+	rc := relay.NewClient(logger)
+
+	return drive(cmd.Context(), func(ctx context.Context, cb driverCallbacks) error {
+		kc, err := provider.K8sClient(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		if err := rc.Connect(kc); err != nil {
+			return fmt.Errorf("failed to connect to relay: %w", err)
+		}
+
+		defer rc.Close()
+
+		local := net.JoinHostPort(opts.LocalHost, strconv.Itoa(opts.LocalPort))
+
+		cb.Info(fmt.Sprintf("Redirecting %s port %d to %s", args[0], opts.Port, local))
+
+		return rc.Intercept(ctx, opts, cb)
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/deployment"
+	"github.com/spf13/cobra"
+)
+
+func createLintCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "lint [deployment...]",
+		Short: "Check deployments against best-practice rules",
+		Long: `
+Check deployments against best-practice rules. All deployments are checked unless names are given.
+
+Rules:
+  large-context   contexts without excludePaths that are large or contain directories such as .git
+  unpinned-chart  helm repository charts without an exact version
+  port-collision  forwards using well-known, privileged or already claimed local ports
+  unbuilt-image   images referenced in manifests that look local but are not built
+`,
+		RunE: lint,
+	}
+
+	c.Flags().StringArray("skip", nil, "Skip the given rule (repeatable)")
+
+	return c
+}
+
+func lint(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	skip, err := cmd.Flags().GetStringArray("skip")
+	if err != nil {
+		return fmt.Errorf("failed to parse skip flag: %w", err)
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	m := deployment.NewManager(logger, cfg, cm)
+
+	findings, err := m.Lint(cmd.Context(), args, skip)
+	if err != nil {
+		return err
+	}
+
+	if len(findings) == 0 {
+		fmt.Println("No issues found")
+
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "DEPLOYMENT\tSTEP\tRULE\tMESSAGE")
+
+	for _, f := range findings {
+		step := f.Step
+		if step == "" {
+			step = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Deployment, step, f.Rule, f.Message)
+	}
+
+	_ = w.Flush()
+
+	return fmt.Errorf("%w: %d findings", deployment.ErrLintFailed, len(findings))
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"errors"
 	"io"
 	"k8s.io/klog/v2"
 	"log"
 	"log/slog"
 	"os"
 
+	"github.com/csnewman/localflux/internal/config"
 	"github.com/spf13/cobra"
 )
 
@@ -27,6 +29,15 @@ See https://github.com/csnewman/localflux
 `,
 		SilenceUsage: true,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("plain") {
+				user, err := config.LoadUser()
+				if err != nil {
+					return err
+				}
+
+				plainOutput = user.Plain
+			}
+
 			if debugOutput {
 				plainOutput = true
 
@@ -47,13 +58,38 @@ See https://github.com/csnewman/localflux
 
 	rootCmd.PersistentFlags().BoolVar(&debugOutput, "debug", false, "output debug info")
 	rootCmd.PersistentFlags().BoolVar(&plainOutput, "plain", false, "disable fancy output")
+	rootCmd.PersistentFlags().BoolVar(&config.RefreshIncludes, "refresh", false, "fetch remote config includes again")
 
+	rootCmd.AddCommand(createBuildCmd())
 	rootCmd.AddCommand(createClusterCmd())
+	rootCmd.AddCommand(createConfigCmd())
+	rootCmd.AddCommand(createCtxCmd())
 	rootCmd.AddCommand(createDeployCmd())
+	rootCmd.AddCommand(createDoctorCmd())
+	rootCmd.AddCommand(createEnvCmd())
+	rootCmd.AddCommand(createExposeCmd())
+	rootCmd.AddCommand(createForwardCmd())
+	rootCmd.AddCommand(createGCCmd())
+	rootCmd.AddCommand(createGraphCmd())
+	rootCmd.AddCommand(createImportCmd())
+	rootCmd.AddCommand(createInitCmd())
+	rootCmd.AddCommand(createInterceptCmd())
+	rootCmd.AddCommand(createLintCmd())
+	rootCmd.AddCommand(createRegistryCmd())
 	rootCmd.AddCommand(createRelayCmd())
 	rootCmd.AddCommand(createRelayServerCmd())
+	rootCmd.AddCommand(createRenderCmd())
+	rootCmd.AddCommand(createSelftestCmd())
+	rootCmd.AddCommand(createTestCmd())
+	rootCmd.AddCommand(createWebhookServerCmd())
 
 	if err := rootCmd.Execute(); err != nil {
+		// Propagate specific exit codes, such as those reported by minikube, so scripts can react to the cause.
+		var exitErr interface{ ExitCode() int }
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/deployment"
+	"github.com/spf13/cobra"
+)
+
+func createRegistryCmd() *cobra.Command {
+	gc := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove images from the cluster registry that are no longer referenced",
+		Long: `
+Delete manifests from the cluster registry that are not referenced by any workload in the cluster, including the
+replica sets kept for rollbacks, any Flux source in the localflux namespace, or the images last built for the cluster,
+then run the registry garbage collector to free the space they used. Signatures and attestations are kept along with
+the manifests they belong to. Referenced manifests without a tag are tagged first, so that the collector keeps them.
+`,
+		RunE: registryGC,
+		Args: cobra.NoArgs,
+	}
+
+	gc.Flags().String("cluster", "", "Cluster name")
+	gc.Flags().BoolP("yes", "y", false, "Remove without asking for confirmation")
+	gc.Flags().Bool("dry-run", false, "Only list the unreferenced manifests")
+
+	c := &cobra.Command{
+		Use:   "registry",
+		Short: "Manage the cluster registry",
+	}
+
+	c.AddCommand(gc)
+
+	return c
+}
+
+func registryGC(cmd *cobra.Command, _ []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	clusterName, err := cmd.Flags().GetString("cluster")
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster flag: %w", err)
+	}
+
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return fmt.Errorf("failed to parse yes flag: %w", err)
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return fmt.Errorf("failed to parse dry-run flag: %w", err)
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	m := deployment.NewManager(logger, cfg, cm)
+
+	plan, err := m.PlanRegistryGC(cmd.Context(), clusterName)
+	if err != nil {
+		return err
+	}
+
+	if len(plan.Stale) == 0 {
+		fmt.Println("No unreferenced tagged manifests found")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(w, "REPOSITORY\tDIGEST\tTAGS")
+
+		for _, stale := range plan.Stale {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", stale.Repository, stale.Digest, strings.Join(stale.Tags, ","))
+		}
+
+		_ = w.Flush()
+	}
+
+	if len(plan.Protect) > 0 {
+		fmt.Printf("%d referenced untagged manifests will be tagged to keep them\n", len(plan.Protect))
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	if !yes {
+		fmt.Printf("Remove %d manifests and collect untagged manifests? [y/N] ", len(plan.Stale))
+
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Aborted")
+
+			return nil
+		}
+	}
+
+	if err := m.RunRegistryGC(cmd.Context(), clusterName, plan, os.Stdout); err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d manifests\n", len(plan.Stale))
+
+	return nil
+}
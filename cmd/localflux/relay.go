@@ -2,7 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
 	"github.com/csnewman/localflux/internal/relay"
 	"github.com/spf13/cobra"
 )
@@ -16,6 +25,29 @@ func createRelayCmd() *cobra.Command {
 	}
 
 	c.Flags().String("kube-cfg-b64", "", "Base64 encoded kube config")
+	c.Flags().Bool("dns", false, "Resolve the names of forwards to loopback addresses")
+	c.Flags().String("dns-address", relay.DefaultDNSAddress, "Address to serve DNS on")
+	c.Flags().String("dns-domain", relay.DefaultDNSDomain, "Development domain to serve alongside cluster.local")
+	c.Flags().Bool("dns-register", false, "Register the DNS server as the system resolver for its zones")
+	c.Flags().Bool("hosts", false, "Add the hostnames of deployment ingresses to the hosts file")
+	c.Flags().String("hosts-file", relay.DefaultHostsFile, "Hosts file to maintain")
+	c.Flags().String("hosts-address", relay.DefaultHostsAddress, "Address ingress hostnames resolve to")
+	c.Flags().Bool("http-proxy", false, "Serve cluster services over HTTP, routed by host")
+	c.Flags().String("http-proxy-address", relay.DefaultHTTPProxyAddress, "Address to serve the HTTP proxy on")
+	c.Flags().String("http-proxy-domain", relay.DefaultHTTPProxyDomain, "Domain of hosts served by the HTTP proxy")
+
+	c.Flags().String("bind-address", "127.0.0.1", "Local address to serve forwards on, unless set by the forward")
+	c.Flags().String("status-address", relay.DefaultStatusAddress, "Address to serve the client status on, empty to disable")
+	c.Flags().Bool("websocket", false, "Connect to the relay server over its WebSocket endpoint, not a port-forward")
+	c.Flags().String("websocket-url", "", "URL of the WebSocket endpoint, defaulting to its node port")
+	addInspectFlags(c)
+
+	c.AddCommand(createRelayInstallCmd())
+	c.AddCommand(createRelayStartCmd())
+	c.AddCommand(createRelayStatsCmd())
+	c.AddCommand(createRelayStatusCmd())
+	c.AddCommand(createRelayStopCmd())
+	c.AddCommand(createRelayUninstallCmd())
 
 	return c
 }
@@ -30,11 +62,272 @@ func relayRun(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to parse kube-cfg-b64 flag: %w", err)
 	}
 
+	dns, err := cmd.Flags().GetBool("dns")
+	if err != nil {
+		return fmt.Errorf("failed to parse dns flag: %w", err)
+	}
+
+	if dns {
+		var opts relay.DNSOptions
+
+		if opts.Address, err = cmd.Flags().GetString("dns-address"); err != nil {
+			return fmt.Errorf("failed to parse dns-address flag: %w", err)
+		}
+
+		if opts.Domain, err = cmd.Flags().GetString("dns-domain"); err != nil {
+			return fmt.Errorf("failed to parse dns-domain flag: %w", err)
+		}
+
+		if opts.RegisterResolver, err = cmd.Flags().GetBool("dns-register"); err != nil {
+			return fmt.Errorf("failed to parse dns-register flag: %w", err)
+		}
+
+		c.EnableDNS(opts)
+	}
+
+	hosts, err := cmd.Flags().GetBool("hosts")
+	if err != nil {
+		return fmt.Errorf("failed to parse hosts flag: %w", err)
+	}
+
+	if hosts {
+		var opts relay.HostsOptions
+
+		if opts.File, err = cmd.Flags().GetString("hosts-file"); err != nil {
+			return fmt.Errorf("failed to parse hosts-file flag: %w", err)
+		}
+
+		if opts.Address, err = cmd.Flags().GetString("hosts-address"); err != nil {
+			return fmt.Errorf("failed to parse hosts-address flag: %w", err)
+		}
+
+		c.EnableHosts(opts)
+	}
+
+	httpProxy, err := cmd.Flags().GetBool("http-proxy")
+	if err != nil {
+		return fmt.Errorf("failed to parse http-proxy flag: %w", err)
+	}
+
+	if httpProxy {
+		var opts relay.HTTPProxyOptions
+
+		if opts.Address, err = cmd.Flags().GetString("http-proxy-address"); err != nil {
+			return fmt.Errorf("failed to parse http-proxy-address flag: %w", err)
+		}
+
+		if opts.Domain, err = cmd.Flags().GetString("http-proxy-domain"); err != nil {
+			return fmt.Errorf("failed to parse http-proxy-domain flag: %w", err)
+		}
+
+		c.EnableHTTPProxy(opts)
+	}
+
+	bindAddress, err := cmd.Flags().GetString("bind-address")
+	if err != nil {
+		return fmt.Errorf("failed to parse bind-address flag: %w", err)
+	}
+
+	bind, err := netip.ParseAddr(bindAddress)
+	if err != nil {
+		return fmt.Errorf("invalid bind address: %w", err)
+	}
+
+	c.SetBindAddress(bind)
+
+	statusAddress, err := cmd.Flags().GetString("status-address")
+	if err != nil {
+		return fmt.Errorf("failed to parse status-address flag: %w", err)
+	}
+
+	if statusAddress != "" {
+		c.EnableStatus(statusAddress)
+	}
+
+	if err := enableInspect(cmd, c); err != nil {
+		return err
+	}
+
+	webSocket, err := cmd.Flags().GetBool("websocket")
+	if err != nil {
+		return fmt.Errorf("failed to parse websocket flag: %w", err)
+	}
+
+	if webSocket {
+		var opts relay.WebSocketOptions
+
+		if opts.URL, err = cmd.Flags().GetString("websocket-url"); err != nil {
+			return fmt.Errorf("failed to parse websocket-url flag: %w", err)
+		}
+
+		c.EnableWebSocket(opts)
+	}
+
 	return drive(cmd.Context(), func(ctx context.Context, cb driverCallbacks) error {
 		return c.Run(ctx, name, cfgB64, cb)
 	})
 }
 
+func createRelayStatsCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "stats [context]",
+		Short: "Show the connections relayed by the relay server, or by the running relay client",
+		RunE:  relayStatsRun,
+		Args:  cobra.MaximumNArgs(1),
+	}
+
+	c.Flags().Bool("client", false, "Show the connections of the running relay client, rather than of the server")
+	c.Flags().String("address", relay.DefaultStatusAddress, "Status address of the relay client")
+
+	return c
+}
+
+func relayStatsRun(cmd *cobra.Command, args []string) error {
+	client, err := cmd.Flags().GetBool("client")
+	if err != nil {
+		return fmt.Errorf("failed to parse client flag: %w", err)
+	}
+
+	var stats []*relay.ForwardStats
+
+	if client {
+		address, err := cmd.Flags().GetString("address")
+		if err != nil {
+			return fmt.Errorf("failed to parse address flag: %w", err)
+		}
+
+		if stats, err = relay.QueryStats(cmd.Context(), address); err != nil {
+			return err
+		}
+	} else {
+		if len(args) == 0 {
+			return fmt.Errorf("a context is required, unless --client is set")
+		}
+
+		kc, err := cluster.NewK8sClientForCtx("", args[0])
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		c := relay.NewClient(logger)
+
+		if err := c.Connect(kc); err != nil {
+			return err
+		}
+
+		defer c.Close()
+
+		if stats, err = c.ServerStats(cmd.Context()); err != nil {
+			return err
+		}
+	}
+
+	if len(stats) == 0 {
+		fmt.Println("No connections have been relayed")
+
+		return nil
+	}
+
+	for _, l := range formatForwardStats(stats) {
+		fmt.Println(l)
+	}
+
+	return nil
+}
+
+func createRelayStatusCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "status",
+		Short: "Show the forwards of the running relay client",
+		RunE:  relayStatusRun,
+		Args:  cobra.ExactArgs(0),
+	}
+
+	c.Flags().String("address", relay.DefaultStatusAddress, "Status address of the relay client")
+
+	return c
+}
+
+func relayStatusRun(cmd *cobra.Command, _ []string) error {
+	address, err := cmd.Flags().GetString("address")
+	if err != nil {
+		return fmt.Errorf("failed to parse address flag: %w", err)
+	}
+
+	service, err := relay.ServiceStatus(cmd.Context())
+	if err != nil && !errors.Is(err, relay.ErrServiceUnsupported) {
+		return err
+	}
+
+	report, health, err := relay.QueryStatus(cmd.Context(), address)
+	if err != nil {
+		fmt.Printf("Relay client is not reachable: %v\n", err)
+
+		if service != "" && service != relay.ServiceNotInstalled {
+			fmt.Printf("Relay service is %s, see %q\n", service, relay.ServiceLogsHint())
+
+			return fmt.Errorf("relay client is not reachable")
+		}
+
+		// The client normally runs in the relay container, whose state usually explains why.
+		state, cerr := cluster.RelayContainerState(cmd.Context())
+		if errors.Is(cerr, cluster.ErrRelayContainerMissing) {
+			fmt.Println("Relay container does not exist, start the cluster with the relay enabled or run \"localflux relay\"")
+		} else if cerr != nil {
+			fmt.Printf("Relay container could not be inspected: %v\n", cerr)
+		} else {
+			fmt.Printf("Relay container is %s, see \"docker logs %s\"\n", state, cluster.RelayContainerName)
+		}
+
+		return fmt.Errorf("relay client is not reachable")
+	}
+
+	fmt.Printf("Relaying to %q\n", report.Context)
+
+	if health.Status == relay.HealthStatus_SERVING {
+		fmt.Println("Relay client is healthy")
+	} else {
+		fmt.Printf("Relay client is unhealthy: %s\n", health.Detail)
+	}
+
+	if len(report.Forwards) == 0 {
+		fmt.Println("No forwards")
+
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(w, "FORWARD\tREMOTE\tLOCAL\tHEALTH")
+
+	for _, f := range report.Forwards {
+		remote := f.Remote
+		if remote == "" {
+			remote = "-"
+		}
+
+		local := strings.Join(f.Local, ",")
+		if local == "" {
+			local = "-"
+		}
+
+		health := "ok"
+
+		switch {
+		case f.Error != "":
+			health = "failed: " + f.Error
+		case !f.Active:
+			health = "stopped"
+		case f.Remote == "":
+			health = "resolving"
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Name, remote, local, health)
+	}
+
+	return w.Flush()
+}
+
 func createRelayServerCmd() *cobra.Command {
 	c := &cobra.Command{
 		Use:    "relay-server",
@@ -44,11 +337,201 @@ func createRelayServerCmd() *cobra.Command {
 		Hidden: true,
 	}
 
+	c.Flags().String("websocket-address", "", "Address to serve the WebSocket endpoint on, empty to disable")
+
 	return c
 }
 
 func relayServerRun(cmd *cobra.Command, _ []string) error {
 	s := relay.NewServer(logger)
 
+	wsAddress, err := cmd.Flags().GetString("websocket-address")
+	if err != nil {
+		return fmt.Errorf("failed to parse websocket-address flag: %w", err)
+	}
+
+	if wsAddress != "" {
+		token := os.Getenv("LOCALFLUX_RELAY_TOKEN")
+		if token == "" {
+			return fmt.Errorf("LOCALFLUX_RELAY_TOKEN must be set to serve the WebSocket endpoint")
+		}
+
+		s.EnableWebSocket(wsAddress, token)
+	}
+
 	return s.Run(cmd.Context())
 }
+
+func createRelayInstallCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "install",
+		Short: "Run the relay client as a background service of the current user",
+		Long: `
+Install the relay client as a user-level systemd unit, or a launchd agent on macOS, which runs natively rather than in
+the relay container. The service is started now and on login, keeping forwards available across terminal sessions.
+Set "disableClient" in the relay config so that starting the cluster does not also run the relay container.
+`,
+		RunE: relayInstallRun,
+		Args: cobra.ExactArgs(0),
+	}
+
+	c.Flags().String("cluster", "", "Cluster name")
+
+	return c
+}
+
+func relayInstallRun(cmd *cobra.Command, _ []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	clusterName, err := cmd.Flags().GetString("cluster")
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster flag: %w", err)
+	}
+
+	if clusterName == "" {
+		clusterName = cfg.DefaultCluster
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	provider, err := cm.Provider(clusterName)
+	if err != nil {
+		return err
+	}
+
+	relayConfig := provider.RelayConfig()
+	if !relayConfig.Enabled {
+		return fmt.Errorf("%w: %s", errRelayDisabled, clusterName)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return fmt.Errorf("failed to resolve executable: %w", err)
+	}
+
+	// The service runs as the user, which can not write the hosts file.
+	serviceConfig := relayConfig.DeepCopy()
+	serviceConfig.Hosts = nil
+
+	opts := relay.ServiceOptions{
+		Executable: executable,
+		Args:       append([]string{"relay", "--plain", provider.ContextName()}, cluster.RelayArgs(serviceConfig, "")...),
+	}
+
+	if kubeConfig := provider.KubeConfig(); kubeConfig != "" {
+		if kubeConfig, err = filepath.Abs(kubeConfig); err != nil {
+			return fmt.Errorf("failed to resolve kube config: %w", err)
+		}
+
+		opts.Env = map[string]string{
+			"KUBECONFIG": kubeConfig,
+		}
+	}
+
+	if err := relay.InstallService(cmd.Context(), opts); err != nil {
+		return fmt.Errorf("failed to install relay service: %w", err)
+	}
+
+	fmt.Printf("Relay service installed for %q, see %q for its output\n", clusterName, relay.ServiceLogsHint())
+
+	if hosts := relayConfig.Hosts; hosts != nil && hosts.Enabled {
+		fmt.Println("The hosts file is not maintained by the relay service, as it does not run as root")
+	}
+
+	if !relayConfig.DisableClient {
+		fmt.Println("Set \"disableClient\" in the relay config, as starting the cluster also runs the relay container")
+	}
+
+	return nil
+}
+
+func createRelayUninstallCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "uninstall",
+		Short: "Stop and remove the relay client service",
+		Args:  cobra.ExactArgs(0),
+		RunE:  relayUninstallRun,
+	}
+
+	return c
+}
+
+func relayUninstallRun(cmd *cobra.Command, _ []string) error {
+	if err := relay.UninstallService(cmd.Context()); err != nil {
+		return fmt.Errorf("failed to uninstall relay service: %w", err)
+	}
+
+	fmt.Println("Relay service uninstalled")
+
+	return nil
+}
+
+func createRelayStartCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "start",
+		Short: "Start the installed relay client service",
+		Args:  cobra.ExactArgs(0),
+		RunE:  relayStartRun,
+	}
+
+	return c
+}
+
+func relayStartRun(cmd *cobra.Command, _ []string) error {
+	if err := requireRelayService(cmd.Context()); err != nil {
+		return err
+	}
+
+	if err := relay.StartService(cmd.Context()); err != nil {
+		return fmt.Errorf("failed to start relay service: %w", err)
+	}
+
+	fmt.Println("Relay service started")
+
+	return nil
+}
+
+func createRelayStopCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "stop",
+		Short: "Stop the relay client service until it is next started, or on the next login",
+		Args:  cobra.ExactArgs(0),
+		RunE:  relayStopRun,
+	}
+
+	return c
+}
+
+func relayStopRun(cmd *cobra.Command, _ []string) error {
+	if err := requireRelayService(cmd.Context()); err != nil {
+		return err
+	}
+
+	if err := relay.StopService(cmd.Context()); err != nil {
+		return fmt.Errorf("failed to stop relay service: %w", err)
+	}
+
+	fmt.Println("Relay service stopped")
+
+	return nil
+}
+
+func requireRelayService(ctx context.Context) error {
+	state, err := relay.ServiceStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	if state == relay.ServiceNotInstalled {
+		return fmt.Errorf("relay service is not installed, run \"localflux relay install\"")
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/deployment"
+	"github.com/spf13/cobra"
+)
+
+func createRenderCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "render [deployment]",
+		Short: "Render a deployment's manifests to disk",
+		Long: `
+Render a deployment's manifests to disk without deploying them. Kustomize and helm steps are rendered locally with
+the same substitutions, patches and image replacements a deployment would apply, writing one file per step.
+
+Images are left as written unless --build is passed, in which case they are built on the cluster and referenced by
+digest.
+`,
+		RunE: render,
+		Args: cobra.ExactArgs(1),
+	}
+
+	c.Flags().StringP("output", "o", "rendered", "Output directory")
+	c.Flags().String("cluster", "", "Cluster to build images on")
+	c.Flags().StringArray("step", nil, "Only render the given step (repeatable)")
+	c.Flags().StringP("profile", "p", "", "Profile to apply")
+	c.Flags().Bool("build", false, "Build images so that manifests reference their digests")
+
+	return c
+}
+
+func render(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return fmt.Errorf("failed to parse output flag: %w", err)
+	}
+
+	clusterName, err := cmd.Flags().GetString("cluster")
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster flag: %w", err)
+	}
+
+	steps, err := cmd.Flags().GetStringArray("step")
+	if err != nil {
+		return fmt.Errorf("failed to parse step flag: %w", err)
+	}
+
+	profile, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		return fmt.Errorf("failed to parse profile flag: %w", err)
+	}
+
+	build, err := cmd.Flags().GetBool("build")
+	if err != nil {
+		return fmt.Errorf("failed to parse build flag: %w", err)
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	m := deployment.NewManager(logger, cfg, cm)
+
+	var files []string
+
+	err = drive(cmd.Context(), func(ctx context.Context, cb driverCallbacks) error {
+		var err error
+
+		files, err = m.Render(ctx, args[0], output, deployment.RenderOptions{
+			Steps:   steps,
+			Profile: profile,
+			Build:   build,
+			Cluster: clusterName,
+		}, cb)
+
+		return err
+	})
+
+	for _, file := range files {
+		fmt.Println(file)
+	}
+
+	return err
+}
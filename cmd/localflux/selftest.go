@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/selftest"
+	"github.com/spf13/cobra"
+)
+
+func createSelftestCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "selftest",
+		Short: "Check the cluster works end to end",
+		Long: `
+Build and deploy a small built-in demo, request it through the relay and remove it again. This checks the cluster,
+registry, buildkit, flux and relay integration in one command. Only the clusters are used from localflux.yaml.
+`,
+		RunE: runSelftest,
+		Args: cobra.NoArgs,
+	}
+
+	c.Flags().String("cluster", "", "Cluster name")
+
+	return c
+}
+
+func runSelftest(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	clusterName, err := cmd.Flags().GetString("cluster")
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster flag: %w", err)
+	}
+
+	return drive(cmd.Context(), func(ctx context.Context, cb driverCallbacks) error {
+		return selftest.Run(ctx, logger, cfg, clusterName, cb)
+	})
+}
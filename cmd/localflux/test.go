@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/deployment"
+	"github.com/spf13/cobra"
+)
+
+func createTestCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "test [deployment] -- [command...]",
+		Short: "Run a command with the deployment's ports forwarded",
+		Long: `
+Run a command with the deployment's port-forwards available on ephemeral local ports. The addresses are passed to the
+command as environment variables, in the same form as "localflux env". The deployment may be omitted when the config
+defines only one.
+`,
+		RunE: test,
+		Args: cobra.MinimumNArgs(1),
+	}
+
+	c.Flags().String("cluster", "", "Cluster name")
+
+	return c
+}
+
+func test(cmd *cobra.Command, args []string) error {
+	dash := cmd.ArgsLenAtDash()
+
+	if dash < 0 || dash > 1 || dash == len(args) {
+		return errors.New("expected an optional deployment name followed by -- and the command to run")
+	}
+
+	var name string
+
+	if dash == 1 {
+		name = args[0]
+	}
+
+	cfg, err := config.Load("localflux.yaml")
+	if err != nil {
+		return err
+	}
+
+	clusterName, err := cmd.Flags().GetString("cluster")
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster flag: %w", err)
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	m := deployment.NewManager(logger, cfg, cm)
+
+	// The wrapped command owns the terminal, so progress is always reported as plain output.
+	err = drivePlain(cmd.Context(), func(ctx context.Context, cb driverCallbacks) error {
+		return m.Test(ctx, clusterName, name, args[dash:], cb)
+	})
+
+	var exitErr *exec.ExitError
+
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+
+	return err
+}
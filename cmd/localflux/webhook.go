@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/csnewman/localflux/internal/webhook"
+	"github.com/spf13/cobra"
+)
+
+func createWebhookServerCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:    "webhook-server",
+		Short:  "Server component for the admission webhook",
+		RunE:   webhookServerRun,
+		Args:   cobra.ExactArgs(0),
+		Hidden: true,
+	}
+
+	c.Flags().String("address", fmt.Sprintf(":%d", webhook.Port), "Address to serve the webhook on")
+	c.Flags().String("cert-dir", "/tls", "Directory containing tls.crt and tls.key")
+
+	return c
+}
+
+func webhookServerRun(cmd *cobra.Command, _ []string) error {
+	address, err := cmd.Flags().GetString("address")
+	if err != nil {
+		return fmt.Errorf("failed to parse address flag: %w", err)
+	}
+
+	certDir, err := cmd.Flags().GetString("cert-dir")
+	if err != nil {
+		return fmt.Errorf("failed to parse cert-dir flag: %w", err)
+	}
+
+	s, err := webhook.NewServer(logger)
+	if err != nil {
+		return err
+	}
+
+	return s.Run(cmd.Context(), address, certDir)
+}
@@ -0,0 +1,232 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/containerd/platforms"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/wait"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// BinfmtImage registers QEMU binfmt handlers with the kernel it runs on.
+	BinfmtImage = "tonistiigi/binfmt:qemu-v8.1.5"
+	binfmtPod   = "localflux-binfmt"
+	// binfmtTimeout bounds how long the installer pod may take, including pulling its image.
+	binfmtTimeout = 5 * time.Minute
+)
+
+var ErrBinfmtFailed = errors.New("failed to install emulators")
+
+// EmulatedArchitectures returns the architectures of the image platforms in the config that differ from the native
+// architecture of the builder.
+func EmulatedArchitectures(cfg config.Config, nativeArch string) ([]string, error) {
+	var archs []string
+
+	for _, deployment := range cfg.Deployments {
+		for _, image := range deployment.Images {
+			for _, p := range image.Platforms {
+				parsed, err := platforms.Parse(p)
+				if err != nil {
+					return nil, fmt.Errorf("%w: image %q has invalid platform %q: %w", ErrInvalidConfig, image.Image, p, err)
+				}
+
+				if parsed.Architecture == nativeArch || slices.Contains(archs, parsed.Architecture) {
+					continue
+				}
+
+				archs = append(archs, parsed.Architecture)
+			}
+		}
+	}
+
+	slices.Sort(archs)
+
+	return archs, nil
+}
+
+// BuildKitNode returns the node buildkit runs on. This is the node of the cluster builder pod when there is one, once
+// it is scheduled, and otherwise the control plane node, which runs the buildkit daemon of clusters started by
+// localflux.
+func BuildKitNode(ctx context.Context, kc *K8sClient) (*corev1.Node, error) {
+	nodes := kc.ClientSet().CoreV1().Nodes()
+
+	nodeName, err := buildKitNodeName(ctx, kc)
+	if err != nil {
+		return nil, err
+	}
+
+	if nodeName != "" {
+		node, err := nodes.Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get node: %w", err)
+		}
+
+		return node, nil
+	}
+
+	list, err := nodes.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	if len(list.Items) == 0 {
+		return nil, fmt.Errorf("%w: cluster has no nodes", ErrBinfmtFailed)
+	}
+
+	slices.SortFunc(list.Items, func(a, b corev1.Node) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	for _, node := range list.Items {
+		if _, ok := node.Labels["node-role.kubernetes.io/control-plane"]; ok {
+			return &node, nil
+		}
+	}
+
+	return &list.Items[0], nil
+}
+
+// buildKitNodeName waits until the cluster builder pod is scheduled, returning its node, or an empty string when there
+// is no cluster builder.
+func buildKitNodeName(ctx context.Context, kc *K8sClient) (string, error) {
+	var nodeName string
+
+	err := wait.Poll(ctx, wait.Default.WithTimeout(buildKitReadyTimeout), func(ctx context.Context) (wait.Status, error) {
+		pod, err := kc.ClientSet().CoreV1().Pods(LFNamespace).Get(ctx, buildKitPod, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return wait.Done, nil
+		} else if err != nil {
+			return wait.Pending, fmt.Errorf("failed to get buildkit pod: %w", err)
+		}
+
+		nodeName = pod.Spec.NodeName
+
+		if nodeName == "" {
+			return wait.Pending, nil
+		}
+
+		return wait.Done, nil
+	})
+	if errors.Is(err, wait.ErrTimeout) {
+		return "", fmt.Errorf("%w: builder pod was not scheduled", ErrBuildKitNotReady)
+	} else if err != nil {
+		return "", err
+	}
+
+	return nodeName, nil
+}
+
+// InstallEmulators registers QEMU handlers for the architectures on the node, by running a privileged pod on it.
+// binfmt handlers are global to the kernel, so they apply to the buildkit daemon of the node without a restart.
+func InstallEmulators(ctx context.Context, kc *K8sClient, node string, archs []string) error {
+	pods := kc.ClientSet().CoreV1().Pods(LFNamespace)
+
+	if err := pods.Delete(ctx, binfmtPod, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to remove previous binfmt pod: %w", err)
+	}
+
+	if err := waitPodGone(ctx, kc, binfmtPod); err != nil {
+		return err
+	}
+
+	if _, err := pods.Create(ctx, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      binfmtPod,
+			Namespace: LFNamespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/part-of": "localflux",
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:      node,
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{
+				{
+					Name:  "binfmt",
+					Image: BinfmtImage,
+					Args:  []string{"--install", strings.Join(archs, ",")},
+					SecurityContext: &corev1.SecurityContext{
+						Privileged: ptr(true),
+					},
+				},
+			},
+		},
+	}, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create binfmt pod: %w", err)
+	}
+
+	defer func() {
+		_ = pods.Delete(context.WithoutCancel(ctx), binfmtPod, metav1.DeleteOptions{})
+	}()
+
+	err := wait.Poll(ctx, wait.Default.WithTimeout(binfmtTimeout), func(ctx context.Context) (wait.Status, error) {
+		pod, err := pods.Get(ctx, binfmtPod, metav1.GetOptions{})
+		if err != nil {
+			return wait.Pending, fmt.Errorf("failed to get binfmt pod: %w", err)
+		}
+
+		switch pod.Status.Phase {
+		case corev1.PodSucceeded:
+			return wait.Done, nil
+		case corev1.PodFailed:
+			logs, _ := pods.GetLogs(binfmtPod, &corev1.PodLogOptions{}).DoRaw(ctx)
+
+			return wait.Pending, fmt.Errorf("%w: %s", ErrBinfmtFailed, strings.TrimSpace(string(logs)))
+		default:
+			return wait.Pending, nil
+		}
+	})
+	if errors.Is(err, wait.ErrTimeout) {
+		return fmt.Errorf("%w: timed out waiting for binfmt pod", ErrBinfmtFailed)
+	}
+
+	return err
+}
+
+func waitPodGone(ctx context.Context, kc *K8sClient, name string) error {
+	return wait.Poll(ctx, wait.Default, func(ctx context.Context) (wait.Status, error) {
+		_, err := kc.ClientSet().CoreV1().Pods(LFNamespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return wait.Done, nil
+		}
+
+		if err != nil {
+			return wait.Pending, fmt.Errorf("failed to get pod: %w", err)
+		}
+
+		return wait.Pending, nil
+	})
+}
+
+// InstallEmulators installs QEMU handlers for the architectures into the nodes of the named cluster.
+func (m *Manager) InstallEmulators(ctx context.Context, name string, archs []string) error {
+	if name == "" {
+		name = m.cfg.DefaultCluster
+	}
+
+	p, err := m.Provider(name)
+	if err != nil {
+		return err
+	}
+
+	kc, err := p.K8sClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %w", err)
+	}
+
+	node, err := BuildKitNode(ctx, kc)
+	if err != nil {
+		return err
+	}
+
+	return InstallEmulators(ctx, kc, node.Name, archs)
+}
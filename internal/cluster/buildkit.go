@@ -0,0 +1,176 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"text/template"
+	"time"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/wait"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// BuildKitBackendCluster is the buildkit backend that runs buildkitd as a StatefulSet within the cluster.
+	BuildKitBackendCluster = "cluster"
+	// BuildKitImage matches the version of the buildkit client.
+	BuildKitImage = "moby/buildkit:v0.21.0"
+	buildKitPod   = "buildkitd-0"
+	buildKitPort  = 1234
+	// buildKitReadyTimeout bounds how long to wait for the builder pod, including pulling its image.
+	buildKitReadyTimeout = 3 * time.Minute
+)
+
+var ErrBuildKitNotReady = errors.New("cluster builder not ready")
+
+var buildKitManifests = template.Must(template.New("buildkit").Parse(`
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  labels:
+    app.kubernetes.io/component: buildkitd
+    app.kubernetes.io/instance: localflux
+    app.kubernetes.io/part-of: localflux
+  name: buildkitd
+  namespace: localflux
+spec:
+  serviceName: buildkitd
+  replicas: 1
+  selector:
+    matchLabels:
+      app.kubernetes.io/component: buildkitd
+      app.kubernetes.io/instance: localflux
+      app.kubernetes.io/part-of: localflux
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/component: buildkitd
+        app.kubernetes.io/instance: localflux
+        app.kubernetes.io/part-of: localflux
+{{- if .rootless}}
+      annotations:
+        container.apparmor.security.beta.kubernetes.io/buildkitd: unconfined
+{{- end}}
+    spec:
+      containers:
+      - name: buildkitd
+        image: {{.image}}
+        args:
+        - --addr
+        - unix:///run/buildkit/buildkitd.sock
+        - --addr
+        - tcp://0.0.0.0:{{.port}}
+{{- if .rootless}}
+        - --oci-worker-no-process-sandbox
+{{- end}}
+        readinessProbe:
+          exec:
+            command:
+            - buildctl
+            - --addr
+            - tcp://127.0.0.1:{{.port}}
+            - debug
+            - workers
+          periodSeconds: 5
+        securityContext:
+{{- if .rootless}}
+          runAsUser: 1000
+          runAsGroup: 1000
+          seccompProfile:
+            type: Unconfined
+{{- else}}
+          privileged: true
+{{- end}}
+        volumeMounts:
+        - name: state
+          mountPath: {{.stateDir}}
+{{- if .rootless}}
+        - name: run
+          mountPath: /run/buildkit
+      volumes:
+      - name: run
+        emptyDir: {}
+{{- end}}
+  volumeClaimTemplates:
+  - metadata:
+      name: state
+    spec:
+      accessModes:
+      - ReadWriteOnce
+      resources:
+        requests:
+          storage: 10Gi
+`))
+
+// DeployBuildKit applies the StatefulSet running the cluster builder. The build cache is kept in a volume, so that it
+// survives restarts. Rootless builders run unprivileged, without a process sandbox.
+func DeployBuildKit(ctx context.Context, kc *K8sClient, cfg config.BuildKit) error {
+	image := BuildKitImage
+	stateDir := "/var/lib/buildkit"
+
+	if cfg.Rootless {
+		image += "-rootless"
+		stateDir = "/home/user/.local/share/buildkit"
+	}
+
+	var rendered bytes.Buffer
+
+	if err := buildKitManifests.Execute(&rendered, map[string]any{
+		"image":    image,
+		"port":     buildKitPort,
+		"rootless": cfg.Rootless,
+		"stateDir": stateDir,
+	}); err != nil {
+		return fmt.Errorf("failed to render buildkit manifests: %w", err)
+	}
+
+	if err := kc.Apply(ctx, rendered.String()); err != nil {
+		return fmt.Errorf("failed to apply buildkit manifests: %w", err)
+	}
+
+	return nil
+}
+
+// WaitBuildKit waits until the cluster builder pod is ready.
+func WaitBuildKit(ctx context.Context, kc *K8sClient) error {
+	err := wait.Poll(ctx, wait.Default.WithTimeout(buildKitReadyTimeout), func(ctx context.Context) (wait.Status, error) {
+		pod, err := kc.ClientSet().CoreV1().Pods(LFNamespace).Get(ctx, buildKitPod, metav1.GetOptions{})
+
+		switch {
+		case apierrors.IsNotFound(err):
+			return wait.Pending, nil
+		case err != nil:
+			return wait.Pending, fmt.Errorf("failed to get buildkit pod: %w", err)
+		case podReady(pod):
+			return wait.Done, nil
+		default:
+			return wait.Pending, nil
+		}
+	})
+	if errors.Is(err, wait.ErrTimeout) {
+		return fmt.Errorf("%w: timed out waiting for %s/%s", ErrBuildKitNotReady, LFNamespace, buildKitPod)
+	}
+
+	return err
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// DialBuildKit connects to the cluster builder through a port-forward.
+func DialBuildKit(kc *K8sClient) (net.Conn, error) {
+	return kc.PortForward(LFNamespace, buildKitPod, buildKitPort)
+}
@@ -0,0 +1,208 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var ErrMissingCapability = errors.New("missing cluster capability")
+
+const (
+	CapabilityCNI                 = "cni"
+	CapabilityLoadBalancer        = "loadBalancer"
+	CapabilityDefaultStorageClass = "defaultStorageClass"
+)
+
+const defaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+
+// knownCNIs maps daemonset name prefixes to the CNI they belong to.
+var knownCNIs = map[string]string{
+	"calico":       "calico",
+	"cilium":       "cilium",
+	"flannel":      "flannel",
+	"kube-flannel": "flannel",
+	"weave":        "weave",
+	"antrea":       "antrea",
+	"kube-router":  "kube-router",
+	"kindnet":      "kindnet",
+}
+
+// Capabilities describes the features detected on a cluster.
+type Capabilities struct {
+	ServerVersion       string
+	APIGroups           []string
+	DefaultStorageClass string
+	LoadBalancer        bool
+	CNI                 string
+	ProbedAt            time.Time
+}
+
+// HasAPIGroup reports whether the cluster serves the given API group.
+func (c *Capabilities) HasAPIGroup(group string) bool {
+	return slices.Contains(c.APIGroups, group)
+}
+
+// Check verifies that the named capability is present, returning an error with remediation hints if not.
+func (c *Capabilities) Check(name string) error {
+	switch name {
+	case CapabilityCNI:
+		if c.CNI == "" {
+			return fmt.Errorf("%w: a CNI is required, enable cluster.minikube.cni", ErrMissingCapability)
+		}
+	case CapabilityLoadBalancer:
+		if !c.LoadBalancer {
+			return fmt.Errorf(
+				"%w: LoadBalancer support is required, run \"minikube tunnel\" or enable the metallb addon",
+				ErrMissingCapability,
+			)
+		}
+	case CapabilityDefaultStorageClass:
+		if c.DefaultStorageClass == "" {
+			return fmt.Errorf(
+				"%w: a default storage class is required, enable the default-storageclass addon",
+				ErrMissingCapability,
+			)
+		}
+	default:
+		if !strings.Contains(name, ".") {
+			return fmt.Errorf("%w: unknown capability %q", ErrInvalidConfig, name)
+		}
+
+		if !c.HasAPIGroup(name) && strings.HasSuffix(name, ".toolkit.fluxcd.io") {
+			return fmt.Errorf("%w: flux is not installed, run \"localflux cluster start\"", ErrMissingCapability)
+		}
+
+		if !c.HasAPIGroup(name) {
+			return fmt.Errorf("%w: API group %q is not served, install its CRDs first", ErrMissingCapability, name)
+		}
+	}
+
+	return nil
+}
+
+// Capabilities probes the named cluster. Results are cached for the lifetime of the manager.
+func (m *Manager) Capabilities(ctx context.Context, name string) (*Capabilities, error) {
+	if name == "" {
+		name = m.cfg.DefaultCluster
+	}
+
+	if name == "" {
+		return nil, ErrNoDefault
+	}
+
+	m.capsMu.Lock()
+	defer m.capsMu.Unlock()
+
+	if caps, ok := m.caps[name]; ok {
+		return caps, nil
+	}
+
+	p, err := m.Provider(name)
+	if err != nil {
+		return nil, err
+	}
+
+	kc, err := p.K8sClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create k8s client: %w", err)
+	}
+
+	caps, err := ProbeCapabilities(ctx, kc)
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger.Debug("Probed cluster capabilities", "cluster", name, "capabilities", caps)
+
+	m.caps[name] = caps
+
+	return caps, nil
+}
+
+// ProbeCapabilities inspects the cluster to determine which features are available.
+func ProbeCapabilities(ctx context.Context, kc *K8sClient) (*Capabilities, error) {
+	cs := kc.ClientSet()
+
+	version, err := cs.Discovery().ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server version: %w", err)
+	}
+
+	groups, err := cs.Discovery().ServerGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api groups: %w", err)
+	}
+
+	caps := &Capabilities{
+		ServerVersion: version.GitVersion,
+		ProbedAt:      time.Now(),
+	}
+
+	for _, group := range groups.Groups {
+		if group.Name == "" {
+			continue
+		}
+
+		caps.APIGroups = append(caps.APIGroups, group.Name)
+	}
+
+	slices.Sort(caps.APIGroups)
+
+	classes, err := cs.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage classes: %w", err)
+	}
+
+	for _, class := range classes.Items {
+		if class.Annotations[defaultStorageClassAnnotation] == "true" {
+			caps.DefaultStorageClass = class.Name
+
+			break
+		}
+	}
+
+	daemonSets, err := cs.AppsV1().DaemonSets("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+
+	for _, ds := range daemonSets.Items {
+		for prefix, cni := range knownCNIs {
+			if strings.HasPrefix(ds.Name, prefix) {
+				caps.CNI = cni
+
+				break
+			}
+		}
+
+		if caps.CNI != "" {
+			break
+		}
+	}
+
+	caps.LoadBalancer = caps.HasAPIGroup("metallb.io")
+
+	if !caps.LoadBalancer {
+		services, err := cs.CoreV1().Services("").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list services: %w", err)
+		}
+
+		for _, svc := range services.Items {
+			if svc.Spec.Type == corev1.ServiceTypeLoadBalancer && len(svc.Status.LoadBalancer.Ingress) > 0 {
+				caps.LoadBalancer = true
+
+				break
+			}
+		}
+	}
+
+	return caps, nil
+}
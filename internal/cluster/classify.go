@@ -0,0 +1,224 @@
+package cluster
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrMinikubeMissing    = errors.New("minikube is not installed")
+	ErrDriverMissing      = errors.New("minikube driver is not available")
+	ErrDriverNotRunning   = errors.New("minikube driver is not running")
+	ErrVirtualization     = errors.New("virtualization is not available")
+	ErrInsufficientMemory = errors.New("insufficient memory")
+	ErrInsufficientCPU    = errors.New("insufficient cpus")
+	ErrInsufficientDisk   = errors.New("insufficient disk space")
+)
+
+// MinikubeError is a minikube failure classified into one of the Err* kinds above, with a remediation hint.
+type MinikubeError struct {
+	Kind error
+	// Reason is the minikube reason ID, e.g. RSRC_INSUFFICIENT_SYS_MEMORY, if reported.
+	Reason   string
+	Message  string
+	Hint     string
+	exitCode int
+}
+
+func (e *MinikubeError) Error() string {
+	msg := e.Kind.Error()
+
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+
+	if e.Hint != "" {
+		msg += " (hint: " + e.Hint + ")"
+	}
+
+	return msg
+}
+
+func (e *MinikubeError) Unwrap() error {
+	return e.Kind
+}
+
+// ExitCode returns the exit code reported by minikube, or 1 if unknown.
+func (e *MinikubeError) ExitCode() int {
+	if e.exitCode > 0 {
+		return e.exitCode
+	}
+
+	return 1
+}
+
+type minikubeRule struct {
+	kind error
+	// reasons are substrings matched against the minikube reason ID.
+	reasons []string
+	// patterns are lowercase substrings matched against the message.
+	patterns []string
+	hint     string
+}
+
+// minikubeRules are checked in order, so more specific rules come first.
+var minikubeRules = []minikubeRule{
+	{
+		kind:     ErrDriverNotRunning,
+		reasons:  []string{"NOT_RUNNING", "DRV_NOT_HEALTHY"},
+		patterns: []string{"cannot connect to the docker daemon", "is the docker daemon running"},
+		hint:     "start Docker and try again",
+	},
+	{
+		kind:     ErrDriverMissing,
+		reasons:  []string{"DRV_NOT_DETECTED", "DRV_NOT_FOUND", "PROVIDER_DOCKER_NOT_FOUND", "NOT_INSTALLED"},
+		patterns: []string{"docker: executable file not found", "docker: command not found", "driver not found"},
+		hint:     "install Docker from https://docs.docker.com/get-docker/",
+	},
+	{
+		kind:     ErrVirtualization,
+		reasons:  []string{"HOST_VIRT_UNAVAILABLE", "PR_KVM", "PR_HYPERV", "PR_HYPERKIT"},
+		patterns: []string{"vt-x", "amd-v", "virtualization is not", "virtualization support"},
+		hint:     "enable virtualization (VT-x/AMD-V) in the BIOS or use a container driver",
+	},
+	{
+		kind:     ErrInsufficientMemory,
+		reasons:  []string{"INSUFFICIENT_SYS_MEMORY", "INSUFFICIENT_CONTAINER_MEMORY", "INSUFFICIENT_REQ_MEMORY"},
+		patterns: []string{"insufficient memory", "not enough memory", "cannot allocate memory"},
+		hint:     "free memory, raise the Docker memory limit or pass a lower --memory in customArgs",
+	},
+	{
+		kind:     ErrInsufficientCPU,
+		reasons:  []string{"INSUFFICIENT_CORES"},
+		patterns: []string{"insufficient cpu", "requested cpu count"},
+		hint:     "raise the Docker CPU limit or pass a lower --cpus in customArgs",
+	},
+	{
+		kind:     ErrInsufficientDisk,
+		reasons:  []string{"RSRC_DOCKER_STORAGE", "INSUFFICIENT_STORAGE", "DISK"},
+		patterns: []string{"no space left on device", "docker is out of disk space"},
+		hint:     "free disk space, e.g. with \"docker system prune\"",
+	},
+}
+
+// classifyMinikube matches a minikube reason ID and message against the known failures.
+func classifyMinikube(reason string, message string) *MinikubeError {
+	lower := strings.ToLower(message)
+
+	for _, rule := range minikubeRules {
+		matched := false
+
+		for _, r := range rule.reasons {
+			if reason != "" && strings.Contains(reason, r) {
+				matched = true
+			}
+		}
+
+		for _, p := range rule.patterns {
+			if strings.Contains(lower, p) {
+				matched = true
+			}
+		}
+
+		if matched {
+			return &MinikubeError{
+				Kind:    rule.kind,
+				Reason:  reason,
+				Message: strings.TrimSpace(message),
+				Hint:    rule.hint,
+			}
+		}
+	}
+
+	return nil
+}
+
+// minikubeDiagnosis records the first classified failure seen in minikube's output, so that a failed command can be
+// reported with a specific cause rather than a bare exit status.
+type minikubeDiagnosis struct {
+	mu  sync.Mutex
+	err *MinikubeError
+}
+
+// observeEvent inspects the data of a minikube error event.
+func (d *minikubeDiagnosis) observeEvent(data map[string]string) {
+	if d == nil {
+		return
+	}
+
+	e := classifyMinikube(data["name"], data["message"])
+	if e == nil {
+		return
+	}
+
+	if advice := strings.TrimSpace(data["advice"]); advice != "" {
+		e.Hint = advice
+	}
+
+	e.exitCode, _ = strconv.Atoi(data["exitcode"])
+
+	d.record(e)
+}
+
+// observeLine inspects a line of minikube's stderr.
+func (d *minikubeDiagnosis) observeLine(line string) {
+	if d == nil {
+		return
+	}
+
+	if e := classifyMinikube("", line); e != nil {
+		d.record(e)
+	}
+}
+
+func (d *minikubeDiagnosis) record(e *MinikubeError) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err == nil {
+		d.err = e
+	}
+}
+
+// result returns the classified failure in place of runErr, if one was seen.
+func (d *minikubeDiagnosis) result(runErr error) error {
+	if runErr == nil {
+		return nil
+	}
+
+	if errors.Is(runErr, exec.ErrNotFound) {
+		return classifyRunError(runErr)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err == nil {
+		return runErr
+	}
+
+	if d.err.exitCode == 0 {
+		var exitErr *exec.ExitError
+		if errors.As(runErr, &exitErr) {
+			d.err.exitCode = exitErr.ExitCode()
+		}
+	}
+
+	return d.err
+}
+
+// classifyRunError reports a missing minikube binary as ErrMinikubeMissing, returning other errors unchanged.
+func classifyRunError(err error) error {
+	if !errors.Is(err, exec.ErrNotFound) {
+		return err
+	}
+
+	return &MinikubeError{
+		Kind:    ErrMinikubeMissing,
+		Message: err.Error(),
+		Hint:    "install minikube from https://minikube.sigs.k8s.io/docs/start/",
+	}
+}
@@ -5,15 +5,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/csnewman/localflux/internal/config"
 	"github.com/csnewman/localflux/internal/crds"
 	"github.com/google/go-containerregistry/pkg/authn"
+	corev1 "k8s.io/api/core/v1"
 	cmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
@@ -88,6 +91,9 @@ type Provider interface {
 
 	Reconfigure(ctx context.Context, cb ProviderCallbacks) error
 
+	// RequestedResources returns the resources the cluster will be created with, and the addons it will run.
+	RequestedResources() (Resources, []string)
+
 	ContextName() string
 
 	K8sClient(ctx context.Context) (*K8sClient, error)
@@ -106,18 +112,27 @@ type Provider interface {
 
 	RegistryConn(ctx context.Context) (http.RoundTripper, authn.Authenticator, error)
 
+	// RegistryPod returns the namespace and label selector of the pod running the cluster registry.
+	RegistryPod() (string, string)
+
+	// LoadImage loads the docker format image archive into the container runtime of the cluster nodes.
+	LoadImage(ctx context.Context, archive io.Reader) error
+
 	Name() string
 }
 
 type Manager struct {
 	logger *slog.Logger
 	cfg    config.Config
+	capsMu sync.Mutex
+	caps   map[string]*Capabilities
 }
 
 func NewManager(logger *slog.Logger, cfg config.Config) *Manager {
 	return &Manager{
 		logger: logger,
 		cfg:    cfg,
+		caps:   make(map[string]*Capabilities),
 	}
 }
 
@@ -150,6 +165,11 @@ func (m *Manager) Start(ctx context.Context, name string, cb Callbacks) error {
 		return ErrNoDefault
 	}
 
+	cfg, err := m.GetConfig(name)
+	if err != nil {
+		return err
+	}
+
 	p, err := m.Provider(name)
 	if err != nil {
 		return err
@@ -174,6 +194,8 @@ func (m *Manager) Start(ctx context.Context, name string, cb Callbacks) error {
 	case StatusNotFound:
 		m.logger.Info("Creating cluster", "name", name)
 
+		m.preflight(p, cfg, cb)
+
 		cb.State("Creating cluster", "", start)
 
 		if err := p.Create(ctx, ProviderCallbacks{
@@ -282,9 +304,39 @@ func (m *Manager) Start(ctx context.Context, name string, cb Callbacks) error {
 
 		var rendered bytes.Buffer
 
-		if err := relayManifests.Execute(&rendered, map[string]any{
-			"hostNetwork": !relayConfig.ClusterNetworking,
-		}); err != nil {
+		daemonSet := strings.EqualFold(relayConfig.Mode, RelayModeDaemonSet)
+
+		replicas := 1
+		if relayConfig.Replicas != nil {
+			replicas = *relayConfig.Replicas
+		}
+
+		webSocket := strings.EqualFold(relayConfig.Transport, RelayTransportWebSocket)
+
+		values := map[string]any{
+			"hostNetwork":   !relayConfig.ClusterNetworking,
+			"daemonSet":     daemonSet,
+			"replicas":      replicas,
+			"webSocket":     webSocket,
+			"webSocketPort": relayWebSocketPort,
+		}
+
+		if ws := relayConfig.WebSocket; ws != nil {
+			if ws.NodePort != nil {
+				values["nodePort"] = *ws.NodePort
+			}
+
+			values["host"] = ws.Host
+			values["ingressClassName"] = ws.IngressClassName
+		}
+
+		if webSocket {
+			if err := ensureRelayToken(ctx, kc); err != nil {
+				return err
+			}
+		}
+
+		if err := relayManifests.Execute(&rendered, values); err != nil {
 			return fmt.Errorf("failed to render relay manifests: %w", err)
 		}
 
@@ -292,6 +344,16 @@ func (m *Manager) Start(ctx context.Context, name string, cb Callbacks) error {
 			return fmt.Errorf("failed to apply relay manifests: %w", err)
 		}
 
+		ingress := relayConfig.WebSocket != nil && relayConfig.WebSocket.Host != ""
+
+		if err := removeStaleRelay(ctx, kc, daemonSet, webSocket, ingress); err != nil {
+			return err
+		}
+
+		if err := applyClusterForwards(ctx, kc, relayConfig); err != nil {
+			return err
+		}
+
 		if !relayConfig.DisableClient {
 			cb.State("Deploying relay", "Creating local container", start)
 
@@ -300,7 +362,7 @@ func (m *Manager) Start(ctx context.Context, name string, cb Callbacks) error {
 				return fmt.Errorf("failed to get relay k8 config: %w", err)
 			}
 
-			if err := startRelay(ctx, m.logger, rcfg, cb); err != nil {
+			if err := startRelay(ctx, m.logger, relayConfig, rcfg, cb); err != nil {
 				return fmt.Errorf("failed to start relay: %w", err)
 			}
 		}
@@ -308,6 +370,55 @@ func (m *Manager) Start(ctx context.Context, name string, cb Callbacks) error {
 		cb.Completed("Relay configured", time.Since(start))
 	}
 
+	if buildKitCfg := p.BuildKitConfig(); buildKitCfg.Backend == BuildKitBackendCluster {
+		start = time.Now()
+
+		m.logger.Info("Deploying builder")
+
+		cb.State("Deploying builder", "Applying manifests", start)
+
+		if err := DeployBuildKit(ctx, kc, buildKitCfg); err != nil {
+			return err
+		}
+
+		cb.Completed("Builder configured", time.Since(start))
+	}
+
+	if cfg.RegistryMirror != nil && cfg.RegistryMirror.Enabled {
+		start = time.Now()
+
+		m.logger.Info("Deploying registry mirrors")
+
+		cb.State("Deploying registry mirrors", "Applying manifests", start)
+
+		rendered, err := renderMirrorManifests(cfg.RegistryMirror)
+		if err != nil {
+			return err
+		}
+
+		if err := kc.Apply(ctx, rendered); err != nil {
+			return fmt.Errorf("failed to apply mirror manifests: %w", err)
+		}
+
+		cb.Completed("Registry mirrors configured", time.Since(start))
+	}
+
+	if cfg.Webhook != nil && cfg.Webhook.Enabled {
+		start = time.Now()
+
+		m.logger.Info("Deploying webhook")
+
+		cb.State("Deploying webhook", "Applying manifests", start)
+
+		if err := deployWebhook(ctx, kc, cfg.Webhook); err != nil {
+			return err
+		}
+
+		cb.Completed("Webhook configured", time.Since(start))
+	} else if err := removeWebhook(ctx, kc); err != nil {
+		return err
+	}
+
 	start = time.Now()
 
 	m.logger.Info("Waiting until cluster is ready")
@@ -318,6 +429,36 @@ func (m *Manager) Start(ctx context.Context, name string, cb Callbacks) error {
 		return fmt.Errorf("failed to wait for cluster: %w", err)
 	}
 
+	node, err := BuildKitNode(ctx, kc)
+	if err != nil {
+		return err
+	}
+
+	archs, err := EmulatedArchitectures(m.cfg, node.Labels[corev1.LabelArchStable])
+	if err != nil {
+		return err
+	}
+
+	if len(archs) > 0 {
+		m.logger.Info("Installing emulators", "archs", archs, "node", node.Name)
+
+		cb.State("Installing emulators", strings.Join(archs, ", "), start)
+
+		if err := InstallEmulators(ctx, kc, node.Name, archs); err != nil {
+			return fmt.Errorf("failed to install emulators: %w", err)
+		}
+	}
+
+	if len(cfg.Notifications) > 0 {
+		m.logger.Info("Configuring notifications")
+
+		cb.State("Configuring notifications", "", start)
+	}
+
+	if err := m.configureNotifications(ctx, kc, cfg.Notifications); err != nil {
+		return err
+	}
+
 	m.logger.Info("Cluster ready")
 
 	cb.State("Cluster ready", "", start)
@@ -343,7 +484,7 @@ func (m *Manager) Provider(name string) (Provider, error) {
 	}
 
 	if cfg.Minikube != nil {
-		mc := NewMinikube(m.logger, cfg.SSH)
+		mc := NewMinikube(m.logger, cfg.Minikube.SSH)
 		mp := NewMinikubeProvider(m.logger, mc, cfg)
 
 		return mp, nil
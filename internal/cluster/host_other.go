@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package cluster
+
+// hostMemory is not implemented on this platform, so memory is treated as unknown.
+func hostMemory() int64 {
+	return 0
+}
+
+// hostDisk is not implemented on this platform, so disk is treated as unknown.
+func hostDisk() int64 {
+	return 0
+}
@@ -0,0 +1,63 @@
+//go:build linux || darwin
+
+package cluster
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// hostMemory returns the total memory of the host in bytes, or zero if unknown.
+func hostMemory() int64 {
+	if runtime.GOOS == "darwin" {
+		out, err := exec.Command("sysctl", "-n", "hw.memsize").Output()
+		if err != nil {
+			return 0
+		}
+
+		v, _ := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+
+		return v
+	}
+
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+
+		v, _ := strconv.ParseInt(fields[1], 10, 64)
+
+		return v << 10
+	}
+
+	return 0
+}
+
+// hostDisk returns the free space on the volume holding the home directory in bytes, or zero if unknown.
+func hostDisk() int64 {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return 0
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(home, &st); err != nil {
+		return 0
+	}
+
+	return int64(uint64(st.Bavail) * uint64(st.Bsize))
+}
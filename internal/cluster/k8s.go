@@ -2,14 +2,17 @@ package cluster
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/aojea/rwconn"
 	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+	"github.com/csnewman/localflux/internal/wait"
 	helmv2 "github.com/fluxcd/helm-controller/api/v2"
 	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	sourcev1b2 "github.com/fluxcd/source-controller/api/v1beta2"
 	"github.com/go-logr/logr"
 	"io"
@@ -36,6 +39,7 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 	cmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/tools/remotecommand"
 	"k8s.io/client-go/transport/spdy"
 	"net"
 	"net/http"
@@ -133,7 +137,7 @@ func NewK8sClientFromConfig(config *restclient.Config, rawConfig cmdapi.Config)
 		return nil, fmt.Errorf("failed to load scheme: %w", err)
 	}
 
-	if err := sourcev1b2.AddToScheme(clientsetscheme.Scheme); err != nil {
+	if err := sourcev1.AddToScheme(clientsetscheme.Scheme); err != nil {
 		return nil, fmt.Errorf("failed to load scheme: %w", err)
 	}
 
@@ -183,6 +187,16 @@ func NewK8sClientFromConfig(config *restclient.Config, rawConfig cmdapi.Config)
 }
 
 func (c *K8sClient) Apply(ctx context.Context, data string) error {
+	return c.ApplyInNamespace(ctx, data, "")
+}
+
+// ApplyInNamespace applies the multi-document YAML using server-side apply. Namespaced objects without a namespace
+// are placed in the given namespace, or "default" if empty.
+func (c *K8sClient) ApplyInNamespace(ctx context.Context, data string, namespace string) error {
+	if namespace == "" {
+		namespace = corev1.NamespaceDefault
+	}
+
 	multidocReader := utilyaml.NewYAMLReader(bufio.NewReader(strings.NewReader(data)))
 
 	for {
@@ -194,6 +208,10 @@ func (c *K8sClient) Apply(ctx context.Context, data string) error {
 			return fmt.Errorf("failed to read multidoc: %w", err)
 		}
 
+		if len(bytes.TrimSpace(buf)) == 0 {
+			continue
+		}
+
 		obj := &unstructured.Unstructured{}
 
 		_, gvk, err := decUnstructured.Decode(buf, nil, obj)
@@ -208,6 +226,10 @@ func (c *K8sClient) Apply(ctx context.Context, data string) error {
 
 		var dr dynamic.ResourceInterface
 		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			if obj.GetNamespace() == "" {
+				obj.SetNamespace(namespace)
+			}
+
 			dr = c.dyn.Resource(mapping.Resource).Namespace(obj.GetNamespace())
 		} else {
 			dr = c.dyn.Resource(mapping.Resource)
@@ -255,19 +277,9 @@ func (c *K8sClient) PatchSSA(ctx context.Context, obj controllerclient.Object) e
 }
 
 func (c *K8sClient) WaitNamespaceReady(ctx context.Context, ns []string, cb func(names []string)) error {
-	ctx, cancel := context.WithTimeout(ctx, time.Second*120)
-	defer cancel()
-
-	timer := time.NewTicker(time.Millisecond * 100)
-	defer timer.Stop()
-
-	for {
-		select {
-		case <-timer.C:
-		case <-ctx.Done():
-			return ctx.Err()
-		}
+	var lastNotReady []string
 
+	return wait.Poll(ctx, wait.Default.WithTimeout(time.Second*120), func(ctx context.Context) (wait.Status, error) {
 		var (
 			notReady []string
 			readyNS  int
@@ -278,7 +290,7 @@ func (c *K8sClient) WaitNamespaceReady(ctx context.Context, ns []string, cb func
 
 			ls, err := c.clientset.AppsV1().DaemonSets(n).List(ctx, metav1.ListOptions{})
 			if err != nil {
-				return err
+				return wait.Pending, err
 			}
 
 			for _, item := range ls.Items {
@@ -295,7 +307,7 @@ func (c *K8sClient) WaitNamespaceReady(ctx context.Context, ns []string, cb func
 
 			lsRS, err := c.clientset.AppsV1().ReplicaSets(n).List(ctx, metav1.ListOptions{})
 			if err != nil {
-				return err
+				return wait.Pending, err
 			}
 
 			for _, item := range lsRS.Items {
@@ -319,9 +331,17 @@ func (c *K8sClient) WaitNamespaceReady(ctx context.Context, ns []string, cb func
 		cb(slices.Clone(notReady))
 
 		if len(notReady) == 0 && readyNS == len(ns) {
-			return nil
+			return wait.Done, nil
 		}
-	}
+
+		if !slices.Equal(notReady, lastNotReady) {
+			lastNotReady = notReady
+
+			return wait.Progressing, nil
+		}
+
+		return wait.Pending, nil
+	})
 }
 
 func (c *K8sClient) ClientSet() *kubernetes.Clientset {
@@ -447,6 +467,39 @@ func (c *K8sClient) PortForward(namespace string, pod string, port int) (net.Con
 	return rwConn, nil
 }
 
+// Exec runs the command in the container of the pod, streaming its output.
+func (c *K8sClient) Exec(
+	ctx context.Context,
+	namespace string,
+	pod string,
+	container string,
+	command []string,
+	stdout io.Writer,
+	stderr io.Writer,
+) error {
+	url := c.restClient.Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    stdout != nil,
+			Stderr:    stderr != nil,
+		}, clientsetscheme.ParameterCodec).URL()
+
+	exec, err := remotecommand.NewSPDYExecutor(c.config, http.MethodPost, url)
+	if err != nil {
+		return fmt.Errorf("failed to create executor: %w", err)
+	}
+
+	return exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+}
+
 func ptr[T any](v T) *T {
 	return &v
 }
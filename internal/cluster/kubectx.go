@@ -0,0 +1,118 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/client-go/tools/clientcmd"
+	cmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+var ErrContextNotFound = errors.New("kube context not found")
+
+// ContextSwitch records a change of the current kube context, so that it can be undone.
+type ContextSwitch struct {
+	// KubeConfig is the explicit kubeconfig path, or empty for the default loading rules.
+	KubeConfig string `json:"kubeConfig"`
+	// Previous is the context that was current before the switch.
+	Previous string `json:"previous"`
+	// Context is the context switched to.
+	Context string `json:"context"`
+	// PreviousNamespace is the namespace Context had before the switch.
+	PreviousNamespace string `json:"previousNamespace"`
+}
+
+// SwitchContext makes the cluster's context the current kube context, optionally also setting its default namespace.
+func (m *Manager) SwitchContext(name string, namespace string) (*ContextSwitch, error) {
+	if name == "" {
+		name = m.cfg.DefaultCluster
+	}
+
+	if name == "" {
+		return nil, ErrNoDefault
+	}
+
+	cfg, err := m.GetConfig(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Minikube != nil && cfg.Minikube.SSH != nil {
+		return nil, fmt.Errorf("%w: context switching is not supported for ssh clusters", ErrInvalidConfig)
+	}
+
+	p, err := m.Provider(name)
+	if err != nil {
+		return nil, err
+	}
+
+	sw := &ContextSwitch{
+		KubeConfig: p.KubeConfig(),
+		Context:    p.ContextName(),
+	}
+
+	err = modifyKubeConfig(sw.KubeConfig, func(kcfg *cmdapi.Config) error {
+		kctx, ok := kcfg.Contexts[sw.Context]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrContextNotFound, sw.Context)
+		}
+
+		sw.Previous = kcfg.CurrentContext
+		sw.PreviousNamespace = kctx.Namespace
+
+		kcfg.CurrentContext = sw.Context
+
+		if namespace != "" {
+			kctx.Namespace = namespace
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sw, nil
+}
+
+// RestoreContext undoes a context switch, restoring the previous current context and the namespace of the switched
+// context.
+func RestoreContext(sw *ContextSwitch) error {
+	return modifyKubeConfig(sw.KubeConfig, func(kcfg *cmdapi.Config) error {
+		if kctx, ok := kcfg.Contexts[sw.Context]; ok {
+			kctx.Namespace = sw.PreviousNamespace
+		}
+
+		if sw.Previous != "" {
+			if _, ok := kcfg.Contexts[sw.Previous]; !ok {
+				return fmt.Errorf("%w: %s", ErrContextNotFound, sw.Previous)
+			}
+		}
+
+		kcfg.CurrentContext = sw.Previous
+
+		return nil
+	})
+}
+
+func modifyKubeConfig(path string, fn func(kcfg *cmdapi.Config) error) error {
+	pathOptions := clientcmd.NewDefaultPathOptions()
+	if path != "" {
+		pathOptions.LoadingRules.ExplicitPath = path
+	}
+
+	kcfg, err := pathOptions.GetStartingConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	if err := fn(kcfg); err != nil {
+		return err
+	}
+
+	if err := clientcmd.ModifyConfig(pathOptions, *kcfg, true); err != nil {
+		return fmt.Errorf("failed to write kubeconfig: %w", err)
+	}
+
+	return nil
+}
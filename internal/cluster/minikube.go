@@ -14,14 +14,16 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"slices"
 	"strings"
 	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/csnewman/localflux/internal/config"
-	"github.com/csnewman/localflux/internal/config/v1alpha1"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"golang.org/x/sync/errgroup"
 	cmdapi "k8s.io/client-go/tools/clientcmd/api"
@@ -93,7 +95,12 @@ func (p *MinikubeProvider) Create(ctx context.Context, cb ProviderCallbacks) err
 		return ErrAlreadyExists
 	}
 
-	if err := p.c.Start(ctx, p.ProfileName(), p.cfg.Minikube.CustomArgs, p.cfg.Minikube.CNI, cb); err != nil {
+	args, err := p.startArgs(true)
+	if err != nil {
+		return err
+	}
+
+	if err := p.c.Start(ctx, p.ProfileName(), args, p.cfg.Minikube.CNI, cb); err != nil {
 		return fmt.Errorf("failed to start minikube: %w", err)
 	}
 
@@ -110,7 +117,12 @@ func (p *MinikubeProvider) Start(ctx context.Context, cb ProviderCallbacks) erro
 		return fmt.Errorf("%w: %v", ErrInvalidState, status)
 	}
 
-	if err := p.c.Start(ctx, p.ProfileName(), p.cfg.Minikube.CustomArgs, p.cfg.Minikube.CNI, cb); err != nil {
+	args, err := p.startArgs(false)
+	if err != nil {
+		return err
+	}
+
+	if err := p.c.Start(ctx, p.ProfileName(), args, p.cfg.Minikube.CNI, cb); err != nil {
 		return fmt.Errorf("failed to start minikube: %w", err)
 	}
 
@@ -130,6 +142,23 @@ func (p *MinikubeProvider) Reconfigure(ctx context.Context, cb ProviderCallbacks
 	return p.configureCommon(ctx, cb)
 }
 
+func (p *MinikubeProvider) RequestedResources() (Resources, []string) {
+	addons := slices.Clone(requiredMinikubeAddons)
+
+	for _, addon := range p.cfg.Minikube.Addons {
+		if !slices.Contains(addons, addon) {
+			addons = append(addons, addon)
+		}
+	}
+
+	if p.cfg.Minikube.SSH != nil {
+		// Defaults depend on the remote host, so only explicit arguments are known.
+		return minikubeResources(p.cfg.Minikube.CustomArgs, Resources{}), addons
+	}
+
+	return minikubeResources(p.cfg.Minikube.CustomArgs, hostResources()), addons
+}
+
 const registryAliases = "registry-aliases"
 
 var requiredMinikubeAddons = []string{
@@ -190,6 +219,99 @@ func (p *MinikubeProvider) configureCommon(ctx context.Context, cb ProviderCallb
 		cb.NotifySuccess("Enabled addon: " + name)
 	}
 
+	return p.configureMirrors(ctx, cb)
+}
+
+// containerRuntime returns the container runtime selected by the custom arguments, or the minikube default.
+func (p *MinikubeProvider) containerRuntime() string {
+	args := p.cfg.Minikube.CustomArgs
+
+	for i, arg := range args {
+		if v, ok := strings.CutPrefix(arg, "--container-runtime="); ok {
+			return v
+		}
+
+		if arg == "--container-runtime" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+
+	return "docker"
+}
+
+// startArgs returns the arguments to start minikube with. Registry mirrors require arguments that only take effect
+// when the cluster is created.
+func (p *MinikubeProvider) startArgs(create bool) ([]string, error) {
+	args := slices.Clone(p.cfg.Minikube.CustomArgs)
+
+	mirrorCfg := p.cfg.RegistryMirror
+	if !create || mirrorCfg == nil || !mirrorCfg.Enabled {
+		return args, nil
+	}
+
+	if p.containerRuntime() == "docker" {
+		for _, m := range mirrors(mirrorCfg) {
+			if m.Host == dockerHubHost {
+				args = append(args, "--registry-mirror="+m.URL())
+			}
+		}
+	}
+
+	// Keeping the caches on the host allows them to outlive the cluster.
+	if p.cfg.Minikube.SSH == nil {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find cache directory: %w", err)
+		}
+
+		dir := filepath.Join(cacheDir, "localflux", "mirror", p.ProfileName())
+
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create mirror cache directory: %w", err)
+		}
+
+		args = append(args, "--mount", "--mount-string="+dir+":"+mirrorDataDir)
+	}
+
+	return args, nil
+}
+
+// configureMirrors points containerd at the registry mirrors. The docker runtime is instead configured when the
+// cluster is created, and only supports mirroring Docker Hub.
+func (p *MinikubeProvider) configureMirrors(ctx context.Context, cb ProviderCallbacks) error {
+	mirrorCfg := p.cfg.RegistryMirror
+	if mirrorCfg == nil || !mirrorCfg.Enabled {
+		return nil
+	}
+
+	runtime := p.containerRuntime()
+
+	if runtime != "containerd" {
+		for _, m := range mirrors(mirrorCfg) {
+			if runtime != "docker" || m.Host != dockerHubHost {
+				cb.NotifyWarning(fmt.Sprintf("Registry %q can not be mirrored by the %s runtime", m.Host, runtime))
+			}
+		}
+
+		return nil
+	}
+
+	cb.NotifyStep("Configuring registry mirrors")
+
+	var script strings.Builder
+
+	script.WriteString("set -e\n")
+
+	for _, m := range mirrors(mirrorCfg) {
+		dir := "/etc/containerd/certs.d/" + m.Host
+
+		fmt.Fprintf(&script, "mkdir -p %q\ncat > %q <<'EOF'\n%sEOF\n", dir, dir+"/hosts.toml", m.hostsToml())
+	}
+
+	if err := p.c.RunScript(ctx, p.ProfileName(), script.String()); err != nil {
+		return fmt.Errorf("failed to configure registry mirrors: %w", err)
+	}
+
 	return nil
 }
 
@@ -198,7 +320,7 @@ func (p *MinikubeProvider) ContextName() string {
 }
 
 func (p *MinikubeProvider) KubeConfig() string {
-	if p.cfg.SSH != nil {
+	if p.cfg.Minikube.SSH != nil {
 		panic("todo")
 	}
 
@@ -207,7 +329,7 @@ func (p *MinikubeProvider) KubeConfig() string {
 
 func (p *MinikubeProvider) BuildKitConfig() config.BuildKit {
 	if p.cfg.BuildKit == nil {
-		return &v1alpha1.BuildKit{}
+		return &v1alpha2.BuildKit{}
 	}
 
 	return p.cfg.BuildKit
@@ -216,8 +338,8 @@ func (p *MinikubeProvider) BuildKitConfig() config.BuildKit {
 func (p *MinikubeProvider) BuildKitDialer(ctx context.Context, addr string) (net.Conn, error) {
 	var cmd []string
 
-	if p.cfg.SSH != nil {
-		cmd = append(cmd, "ssh", p.cfg.SSH.Address, "--")
+	if p.cfg.Minikube.SSH != nil {
+		cmd = append(cmd, "ssh", p.cfg.Minikube.SSH.Address, "--")
 	}
 
 	cmd = append(cmd,
@@ -230,10 +352,10 @@ func (p *MinikubeProvider) BuildKitDialer(ctx context.Context, addr string) (net
 
 func (p *MinikubeProvider) RelayConfig() config.Relay {
 	if p.cfg.Relay == nil {
-		return &v1alpha1.Relay{}
+		return &v1alpha2.Relay{}
 	}
 
-	if p.cfg.SSH != nil {
+	if p.cfg.Minikube.SSH != nil {
 		panic("todo")
 	}
 
@@ -241,7 +363,7 @@ func (p *MinikubeProvider) RelayConfig() config.Relay {
 }
 
 func (p *MinikubeProvider) K8sClient(ctx context.Context) (*K8sClient, error) {
-	if p.cfg.SSH == nil {
+	if p.cfg.Minikube.SSH == nil {
 		// TODO: use same minikube config approach
 		kc, err := NewK8sClientForCtx(p.KubeConfig(), p.ContextName())
 		if err != nil {
@@ -281,7 +403,7 @@ func (p *MinikubeProvider) K8sClient(ctx context.Context) (*K8sClient, error) {
 
 	config.Dial = func(ctx context.Context, network, address string) (net.Conn, error) {
 		args := []string{
-			p.cfg.SSH.Address,
+			p.cfg.Minikube.SSH.Address,
 			"--",
 			"socat",
 			"-",
@@ -306,7 +428,7 @@ func (p *MinikubeProvider) K8sClient(ctx context.Context) (*K8sClient, error) {
 }
 
 func (p *MinikubeProvider) RelayK8Config(ctx context.Context) (*cmdapi.Config, error) {
-	if p.cfg.SSH != nil {
+	if p.cfg.Minikube.SSH != nil {
 		panic("todo")
 	}
 
@@ -345,12 +467,20 @@ func (p *MinikubeProvider) Registry() string {
 	return "registry.minikube"
 }
 
+func (p *MinikubeProvider) RegistryPod() (string, string) {
+	return "kube-system", "actual-registry=true"
+}
+
+func (p *MinikubeProvider) LoadImage(ctx context.Context, archive io.Reader) error {
+	return p.c.LoadImage(ctx, p.ProfileName(), archive)
+}
+
 func (p *MinikubeProvider) CNI() string {
 	return p.cfg.Minikube.CNI
 }
 
 func (p *MinikubeProvider) RegistryConn(ctx context.Context) (http.RoundTripper, authn.Authenticator, error) {
-	if p.cfg.SSH != nil {
+	if p.cfg.Minikube.SSH != nil {
 		panic("todo")
 	}
 
@@ -437,24 +567,35 @@ func (m *Minikube) Start(
 	c.Stderr = pwE
 	c.Stdin = nil
 
+	diag := new(minikubeDiagnosis)
+
 	errgrp.Go(func() error {
 		return m.processOutput(pr, func(line string) (bool, error) {
 			return false, nil
-		}, cb)
+		}, diag, cb)
 	})
 
 	errgrp.Go(func() error {
-		return m.processErrOutput(prE, cb)
+		return m.processErrOutput(prE, diag, cb)
 	})
 
+	var runErr error
+
 	errgrp.Go(func() error {
 		defer pw.Close()
 		defer pwE.Close()
 
-		return c.Run()
+		runErr = c.Run()
+
+		return nil
 	})
 
-	return errgrp.Wait()
+	if err := errgrp.Wait(); err != nil {
+		return err
+	}
+
+	// The output is fully processed at this point, so the diagnosis is complete.
+	return diag.result(runErr)
 }
 
 type MinikubeProfile struct {
@@ -509,18 +650,18 @@ func (m *Minikube) Profiles(ctx context.Context, cb ProviderCallbacks) (map[stri
 			}
 
 			return true, nil
-		}, ProviderCallbacks{})
+		}, nil, ProviderCallbacks{})
 	})
 
 	errgrp.Go(func() error {
-		return m.processErrOutput(prE, cb)
+		return m.processErrOutput(prE, nil, cb)
 	})
 
 	errgrp.Go(func() error {
 		defer pw.Close()
 		defer pwE.Close()
 
-		return c.Run()
+		return classifyRunError(c.Run())
 	})
 
 	if err := errgrp.Wait(); err != nil {
@@ -578,11 +719,11 @@ func (m *Minikube) Addons(ctx context.Context, profile string) (map[string]bool,
 			}
 
 			return found, nil
-		}, ProviderCallbacks{})
+		}, nil, ProviderCallbacks{})
 	})
 
 	errgrp.Go(func() error {
-		return m.processErrOutput(prE, ProviderCallbacks{})
+		return m.processErrOutput(prE, nil, ProviderCallbacks{})
 	})
 
 	errgrp.Go(func() error {
@@ -698,6 +839,59 @@ func (m *Minikube) ConfigureRegistryAliases(ctx context.Context, profile string,
 	return ErrAddonFailed
 }
 
+// RunScript runs the shell script as root on the minikube node.
+func (m *Minikube) RunScript(ctx context.Context, profile string, script string) error {
+	c := m.cmd(ctx)
+	c.Args = append(c.Args, "ssh", "--native-ssh=false")
+
+	if profile != "" {
+		c.Args = append(c.Args, "--profile", profile)
+	}
+
+	c.Args = append(c.Args, "--", "sudo", "sh", "-s")
+
+	buffer := bytes.NewBuffer(nil)
+	bufferErr := bytes.NewBuffer(nil)
+
+	c.Stdout = buffer
+	c.Stderr = bufferErr
+	c.Stdin = strings.NewReader(script)
+
+	if err := c.Run(); err != nil {
+		m.logger.Info("Unexpected output", "stdout", buffer.String(), "stderr", bufferErr.String())
+
+		return err
+	}
+
+	return nil
+}
+
+// LoadImage streams the image archive into the nodes of the cluster. The archive is read from stdin, so that it does
+// not need to be copied first when minikube runs on a remote host.
+func (m *Minikube) LoadImage(ctx context.Context, profile string, archive io.Reader) error {
+	c := m.cmd(ctx)
+	c.Args = append(c.Args, "image", "load", "-")
+
+	if profile != "" {
+		c.Args = append(c.Args, "--profile", profile)
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	bufferErr := bytes.NewBuffer(nil)
+
+	c.Stdout = buffer
+	c.Stderr = bufferErr
+	c.Stdin = archive
+
+	if err := c.Run(); err != nil {
+		m.logger.Info("Unexpected output", "stdout", buffer.String(), "stderr", bufferErr.String())
+
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(bufferErr.String()))
+	}
+
+	return nil
+}
+
 func (m *Minikube) IP(ctx context.Context, profile string) (net.IP, error) {
 	c := m.cmd(ctx)
 	c.Args = append(c.Args, "ip")
@@ -732,7 +926,12 @@ func (m *Minikube) IP(ctx context.Context, profile string) (net.IP, error) {
 	return ip, nil
 }
 
-func (m *Minikube) processOutput(pr *io.PipeReader, processor func(line string) (bool, error), cb ProviderCallbacks) error {
+func (m *Minikube) processOutput(
+	pr *io.PipeReader,
+	processor func(line string) (bool, error),
+	diag *minikubeDiagnosis,
+	cb ProviderCallbacks,
+) error {
 	scanner := bufio.NewScanner(pr)
 	for scanner.Scan() {
 		text := scanner.Text()
@@ -799,7 +998,9 @@ func (m *Minikube) processOutput(pr *io.PipeReader, processor func(line string)
 				continue
 			}
 
-			m.logger.Info("Minikube error", "msg", data["message"])
+			m.logger.Info("Minikube error", "msg", data["message"], "reason", data["name"])
+
+			diag.observeEvent(data)
 
 			cb.NotifyError(data["message"])
 
@@ -811,7 +1012,7 @@ func (m *Minikube) processOutput(pr *io.PipeReader, processor func(line string)
 	return nil
 }
 
-func (m *Minikube) processErrOutput(pr *io.PipeReader, cb ProviderCallbacks) error {
+func (m *Minikube) processErrOutput(pr *io.PipeReader, diag *minikubeDiagnosis, cb ProviderCallbacks) error {
 	scanner := bufio.NewScanner(pr)
 	for scanner.Scan() {
 		text := scanner.Text()
@@ -822,6 +1023,8 @@ func (m *Minikube) processErrOutput(pr *io.PipeReader, cb ProviderCallbacks) err
 
 		m.logger.Warn("Minikube std err output", "output", text)
 
+		diag.observeLine(text)
+
 		cb.NotifyWarning("Minikube stderr: " + text)
 	}
 
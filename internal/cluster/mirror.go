@@ -0,0 +1,140 @@
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+)
+
+const (
+	// mirrorBasePort is the node port of the first mirror. Each further registry uses the next port.
+	mirrorBasePort = 5100
+	// mirrorDataDir is the directory on the node the caches are stored in.
+	mirrorDataDir = "/var/lib/localflux/mirror"
+	dockerHubHost = "docker.io"
+)
+
+var defaultMirroredRegistries = []*v1alpha2.MirroredRegistry{
+	{Host: dockerHubHost},
+	{Host: "ghcr.io"},
+}
+
+// mirror is a single pull-through cache.
+type mirror struct {
+	Name     string
+	Host     string
+	Upstream string
+	Port     int
+}
+
+var invalidMirrorChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+func mirrors(cfg config.Mirror) []mirror {
+	registries := cfg.Registries
+	if len(registries) == 0 {
+		registries = defaultMirroredRegistries
+	}
+
+	out := make([]mirror, 0, len(registries))
+
+	for i, r := range registries {
+		upstream := r.URL
+		if upstream == "" {
+			upstream = mirrorUpstream(r.Host)
+		}
+
+		out = append(out, mirror{
+			Name:     "mirror-" + strings.Trim(invalidMirrorChars.ReplaceAllString(strings.ToLower(r.Host), "-"), "-"),
+			Host:     r.Host,
+			Upstream: upstream,
+			Port:     mirrorBasePort + i,
+		})
+	}
+
+	return out
+}
+
+func mirrorUpstream(host string) string {
+	if host == dockerHubHost {
+		return "https://registry-1.docker.io"
+	}
+
+	return "https://" + host
+}
+
+// URL is the address the container runtime on the node pulls through.
+func (m mirror) URL() string {
+	return fmt.Sprintf("http://localhost:%d", m.Port)
+}
+
+// hostsToml is the containerd registry host configuration that pulls through the mirror, falling back to the upstream
+// registry when the mirror is unavailable.
+func (m mirror) hostsToml() string {
+	return fmt.Sprintf("server = %q\n\n[host.%q]\n  capabilities = [\"pull\", \"resolve\"]\n", m.Upstream, m.URL())
+}
+
+var mirrorManifests = template.Must(template.New("mirror").Parse(`
+{{range .}}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    app.kubernetes.io/component: {{.Name}}
+    app.kubernetes.io/instance: localflux
+    app.kubernetes.io/part-of: localflux
+  name: {{.Name}}
+  namespace: localflux
+spec:
+  replicas: 1
+  strategy:
+    type: Recreate
+  selector:
+    matchLabels:
+      app.kubernetes.io/component: {{.Name}}
+      app.kubernetes.io/instance: localflux
+      app.kubernetes.io/part-of: localflux
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/component: {{.Name}}
+        app.kubernetes.io/instance: localflux
+        app.kubernetes.io/part-of: localflux
+    spec:
+      hostNetwork: true
+      containers:
+      - name: registry
+        image: registry:2
+        env:
+        - name: REGISTRY_HTTP_ADDR
+          value: "127.0.0.1:{{.Port}}"
+        - name: REGISTRY_PROXY_REMOTEURL
+          value: "{{.Upstream}}"
+        - name: REGISTRY_STORAGE_DELETE_ENABLED
+          value: "true"
+        volumeMounts:
+        - name: data
+          mountPath: /var/lib/registry
+      volumes:
+      - name: data
+        hostPath:
+          path: ` + mirrorDataDir + `/{{.Name}}
+          type: DirectoryOrCreate
+      priorityClassName: system-cluster-critical
+{{end}}
+`))
+
+func renderMirrorManifests(cfg config.Mirror) (string, error) {
+	var rendered bytes.Buffer
+
+	if err := mirrorManifests.Execute(&rendered, mirrors(cfg)); err != nil {
+		return "", fmt.Errorf("failed to render mirror manifests: %w", err)
+	}
+
+	return rendered.String(), nil
+}
@@ -0,0 +1,143 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/csnewman/localflux/internal/config"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	controllerclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var notificationGV = schema.GroupVersion{Group: "notification.toolkit.fluxcd.io", Version: "v1beta3"}
+
+const (
+	notificationLabel = "localflux.dev/notification"
+
+	notificationProviderKind = "Provider"
+	notificationAlertKind    = "Alert"
+)
+
+// notificationSources are the kinds localflux creates in its namespace, which alerts watch.
+var notificationSources = []string{
+	"Kustomization",
+	"HelmRelease",
+	"OCIRepository",
+	"HelmRepository",
+	"GitRepository",
+}
+
+// configureNotifications creates a Flux provider and alert for each configured notification and removes those that
+// are no longer configured.
+func (m *Manager) configureNotifications(ctx context.Context, kc *K8sClient, notifications []config.Notification) error {
+	names := make([]string, 0, len(notifications))
+
+	for _, n := range notifications {
+		if n.Address == "" && n.SecretRef == "" {
+			return fmt.Errorf("%w: notification %q requires an address or secretRef", ErrInvalidConfig, n.Name)
+		}
+
+		names = append(names, n.Name)
+
+		provider := notificationObject(notificationProviderKind, n.Name)
+
+		spec := map[string]any{
+			"type": n.Type,
+		}
+
+		if n.Address != "" {
+			spec["address"] = n.Address
+		}
+
+		if n.SecretRef != "" {
+			spec["secretRef"] = map[string]any{"name": n.SecretRef}
+		}
+
+		if n.Channel != "" {
+			spec["channel"] = n.Channel
+		}
+
+		provider.Object["spec"] = spec
+
+		if err := kc.PatchSSA(ctx, provider); err != nil {
+			return fmt.Errorf("failed to apply notification provider %q: %w", n.Name, err)
+		}
+
+		severity := n.Severity
+		if severity == "" {
+			severity = "error"
+		}
+
+		sources := make([]any, 0, len(notificationSources))
+
+		for _, kind := range notificationSources {
+			sources = append(sources, map[string]any{
+				"kind":      kind,
+				"name":      "*",
+				"namespace": LFNamespace,
+			})
+		}
+
+		alert := notificationObject(notificationAlertKind, n.Name)
+		alert.Object["spec"] = map[string]any{
+			"providerRef":   map[string]any{"name": n.Name},
+			"eventSeverity": severity,
+			"eventSources":  sources,
+		}
+
+		if err := kc.PatchSSA(ctx, alert); err != nil {
+			return fmt.Errorf("failed to apply notification alert %q: %w", n.Name, err)
+		}
+	}
+
+	// Alerts are removed before providers, as an alert without its provider reports errors.
+	for _, kind := range []string{notificationAlertKind, notificationProviderKind} {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(notificationGV.WithKind(kind + "List"))
+
+		if err := kc.Controller().List(
+			ctx,
+			list,
+			controllerclient.InNamespace(LFNamespace),
+			controllerclient.HasLabels{notificationLabel},
+		); err != nil {
+			// Without notification-controller there is nothing to clean up.
+			if apimeta.IsNoMatchError(err) && len(notifications) == 0 {
+				return nil
+			}
+
+			return fmt.Errorf("failed to list notification %ss: %w", kind, err)
+		}
+
+		for _, item := range list.Items {
+			if slices.Contains(names, item.GetName()) {
+				continue
+			}
+
+			m.logger.Info("Removing notification", "kind", kind, "name", item.GetName())
+
+			if err := kc.Controller().Delete(ctx, &item); err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete notification %s %q: %w", kind, item.GetName(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func notificationObject(kind string, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(notificationGV.WithKind(kind))
+	obj.SetNamespace(LFNamespace)
+	obj.SetName(name)
+	obj.SetLabels(map[string]string{
+		notificationLabel:           "true",
+		"app.kubernetes.io/part-of": "localflux",
+	})
+
+	return obj
+}
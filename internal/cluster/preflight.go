@@ -0,0 +1,226 @@
+package cluster
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/config"
+)
+
+const (
+	mib = int64(1) << 20
+	gib = int64(1) << 30
+)
+
+// Resources describes compute resources. Zero fields are unknown.
+type Resources struct {
+	CPUs   float64
+	Memory int64
+	Disk   int64
+}
+
+func (r Resources) add(o Resources) Resources {
+	return Resources{
+		CPUs:   r.CPUs + o.CPUs,
+		Memory: r.Memory + o.Memory,
+		Disk:   r.Disk + o.Disk,
+	}
+}
+
+// The estimates below are deliberately conservative lower bounds, so that a warning means the cluster almost
+// certainly cannot run the workload, rather than that it might be tight.
+var (
+	// baseResources covers the control plane, kubelet, CoreDNS and kube-proxy, plus the node images.
+	baseResources = Resources{CPUs: 1, Memory: 1024 * mib, Disk: 6 * gib}
+	// fluxResources covers the source, kustomize, helm and notification controllers.
+	fluxResources  = Resources{CPUs: 0.4, Memory: 384 * mib, Disk: 512 * mib}
+	relayResources = Resources{CPUs: 0.05, Memory: 32 * mib, Disk: 64 * mib}
+	// stepResources is a floor for the workloads created by a single deployment step.
+	stepResources = Resources{CPUs: 0.1, Memory: 128 * mib, Disk: 256 * mib}
+	// imageResources is a floor for the disk used by a single built image.
+	imageResources = Resources{Disk: 512 * mib}
+	// addonResources are the known addon footprints. Unknown addons use defaultAddonResources.
+	addonResources = map[string]Resources{
+		"metrics-server":      {CPUs: 0.1, Memory: 64 * mib},
+		"storage-provisioner": {CPUs: 0.01, Memory: 16 * mib},
+		"registry":            {CPUs: 0.05, Memory: 32 * mib, Disk: 1 * gib},
+		registryAliases:       {CPUs: 0.01, Memory: 16 * mib},
+		"ingress":             {CPUs: 0.1, Memory: 96 * mib, Disk: 256 * mib},
+		"dashboard":           {CPUs: 0.1, Memory: 64 * mib, Disk: 256 * mib},
+		"metallb":             {CPUs: 0.1, Memory: 64 * mib},
+	}
+	defaultAddonResources = Resources{CPUs: 0.05, Memory: 64 * mib, Disk: 128 * mib}
+)
+
+// EstimateResources estimates the minimum resources needed to run the cluster with the given addons and every
+// declared deployment.
+func EstimateResources(cfg config.Config, cluster config.Cluster, addons []string) Resources {
+	est := baseResources.add(fluxResources)
+
+	if cluster.Relay != nil && cluster.Relay.Enabled {
+		est = est.add(relayResources)
+	}
+
+	for _, addon := range addons {
+		if r, ok := addonResources[addon]; ok {
+			est = est.add(r)
+		} else {
+			est = est.add(defaultAddonResources)
+		}
+	}
+
+	for _, deployment := range cfg.Deployments {
+		for range deployment.Steps {
+			est = est.add(stepResources)
+		}
+
+		for range deployment.Images {
+			est = est.add(imageResources)
+		}
+	}
+
+	return est
+}
+
+// preflight warns when the cluster about to be created is unlikely to fit the declared deployments, or requests more
+// than the host has.
+func (m *Manager) preflight(p Provider, cfg config.Cluster, cb Callbacks) {
+	requested, addons := p.RequestedResources()
+	estimated := EstimateResources(m.cfg, cfg, addons)
+
+	var host Resources
+
+	// The host is only known when the cluster runs locally.
+	if cfg.Minikube == nil || cfg.Minikube.SSH == nil {
+		host = hostResources()
+	}
+
+	m.logger.Info(
+		"Pre-flight resource estimate",
+		"estimated", estimated,
+		"requested", requested,
+		"host", host,
+	)
+
+	check := func(resource string, estimated float64, requested float64, host float64, format func(float64) string) {
+		if requested > 0 && estimated > requested {
+			cb.Warn(fmt.Sprintf(
+				"Cluster requests %s %s, but the configured deployments need at least %s",
+				format(requested),
+				resource,
+				format(estimated),
+			))
+		}
+
+		if requested > 0 && host > 0 && requested > host {
+			cb.Warn(fmt.Sprintf(
+				"Cluster requests %s %s, but the host only has %s",
+				format(requested),
+				resource,
+				format(host),
+			))
+		} else if requested == 0 && host > 0 && estimated > host {
+			cb.Warn(fmt.Sprintf(
+				"The configured deployments need at least %s %s, but the host only has %s",
+				format(estimated),
+				resource,
+				format(host),
+			))
+		}
+	}
+
+	check("CPUs", estimated.CPUs, requested.CPUs, host.CPUs, formatCPUs)
+	check("memory", float64(estimated.Memory), float64(requested.Memory), float64(host.Memory), formatBytes)
+	check("disk", float64(estimated.Disk), float64(requested.Disk), float64(host.Disk), formatBytes)
+}
+
+func formatCPUs(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func formatBytes(v float64) string {
+	return strconv.FormatFloat(v/float64(gib), 'f', 1, 64) + "GiB"
+}
+
+// hostResources returns the CPUs, memory and disk available on the local host. Disk is measured on the volume
+// holding the home directory, where drivers store their machines.
+func hostResources() Resources {
+	return Resources{
+		CPUs:   float64(runtime.NumCPU()),
+		Memory: hostMemory(),
+		Disk:   hostDisk(),
+	}
+}
+
+// minikubeResources returns the resources requested by minikube start arguments, falling back to minikube's defaults
+// for a host with the given resources.
+func minikubeResources(args []string, host Resources) Resources {
+	res := Resources{
+		CPUs: 2,
+		Disk: 20000 * mib,
+	}
+
+	// Minikube sizes memory to a quarter of the host, clamped to between 2GB and 6GB, unless overridden.
+	if host.Memory > 0 {
+		res.Memory = min(max(host.Memory/4, 2200*mib), 6000*mib)
+	}
+
+	for i := 0; i < len(args); i++ {
+		name, value, ok := strings.Cut(args[i], "=")
+		if !ok && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			value = args[i+1]
+		}
+
+		switch name {
+		case "--cpus":
+			if value == "max" || value == "no-limit" {
+				res.CPUs = host.CPUs
+			} else if v, err := strconv.ParseFloat(value, 64); err == nil {
+				res.CPUs = v
+			}
+
+		case "--memory":
+			if value == "max" || value == "no-limit" {
+				res.Memory = host.Memory
+			} else if v, ok := parseMinikubeSize(value); ok {
+				res.Memory = v
+			}
+
+		case "--disk-size":
+			if v, ok := parseMinikubeSize(value); ok {
+				res.Disk = v
+			}
+		}
+	}
+
+	return res
+}
+
+// parseMinikubeSize parses sizes in the form accepted by minikube, such as "4096", "4096mb" or "4g". Sizes without a
+// unit are in megabytes.
+func parseMinikubeSize(s string) (int64, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "b")
+
+	unit := mib
+
+	switch {
+	case strings.HasSuffix(s, "k"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "m"):
+		unit = mib
+	case strings.HasSuffix(s, "g"):
+		unit = gib
+	case strings.HasSuffix(s, "t"):
+		unit = gib << 10
+	}
+
+	v, err := strconv.ParseFloat(strings.TrimRight(s, "kmgt"), 64)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+
+	return int64(v * float64(unit)), true
+}
@@ -0,0 +1,76 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var ErrRegistryNotFound = errors.New("registry pod not found")
+
+// registryConfigPath is the configuration file of the registry:2 image.
+const registryConfigPath = "/etc/docker/registry/config.yml"
+
+// PruneRegistry runs the registry garbage collector inside the cluster registry, removing blobs that no manifest
+// references. With deleteUntagged, manifests without a tag are removed first, including earlier builds that running
+// pods may still reference by digest.
+func (m *Manager) PruneRegistry(ctx context.Context, name string, deleteUntagged bool, out io.Writer) error {
+	if name == "" {
+		name = m.cfg.DefaultCluster
+	}
+
+	if name == "" {
+		return ErrNoDefault
+	}
+
+	p, err := m.Provider(name)
+	if err != nil {
+		return err
+	}
+
+	kc, err := p.K8sClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %w", err)
+	}
+
+	namespace, selector := p.RegistryPod()
+
+	pods, err := kc.ClientSet().CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list registry pods: %w", err)
+	}
+
+	var pod *corev1.Pod
+
+	for i := range pods.Items {
+		if pods.Items[i].Status.Phase == corev1.PodRunning {
+			pod = &pods.Items[i]
+
+			break
+		}
+	}
+
+	if pod == nil {
+		return fmt.Errorf("%w: no running pod matches %q in %q", ErrRegistryNotFound, selector, namespace)
+	}
+
+	command := []string{"registry", "garbage-collect"}
+
+	if deleteUntagged {
+		command = append(command, "--delete-untagged")
+	}
+
+	command = append(command, registryConfigPath)
+
+	m.logger.Info("Running registry garbage collection", "pod", pod.Name, "command", command)
+
+	if err := kc.Exec(ctx, namespace, pod.Name, pod.Spec.Containers[0].Name, command, out, out); err != nil {
+		return fmt.Errorf("registry garbage collection failed: %w", err)
+	}
+
+	return nil
+}
@@ -3,7 +3,11 @@ package cluster
 import (
 	"bufio"
 	"context"
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -11,14 +15,52 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/csnewman/localflux/internal/config"
+	dv1alpha1 "github.com/csnewman/localflux/internal/deployment/v1alpha1"
 	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/clientcmd"
 	cmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
+// RelayContainerName is the name of the docker container running the host-side relay client.
+const RelayContainerName = "localflux-relay"
+
+var ErrRelayContainerMissing = errors.New("relay container does not exist")
+
+const (
+	// ClusterForwardsConfigMap holds the forwards of the cluster, which the relay client serves alongside those of
+	// deployments.
+	ClusterForwardsConfigMap = "localflux-forwards"
+	// ClusterForwardsKey is the key of the forwards, encoded as a JSON list.
+	ClusterForwardsKey = "forwards.json"
+)
+
+const (
+	RelayModeDeployment = "deployment"
+	RelayModeDaemonSet  = "daemonset"
+)
+
+const (
+	RelayTransportPortForward = "portForward"
+	RelayTransportWebSocket   = "websocket"
+)
+
+const (
+	// RelayTokenSecret holds the token clients of the WebSocket endpoint of the relay server must present.
+	RelayTokenSecret = "relay-token"
+	RelayTokenKey    = "token"
+	// RelayWebSocketService exposes the WebSocket endpoint on a node port.
+	RelayWebSocketService = "relay-websocket"
+	RelayWebSocketPath    = "/tunnel"
+	relayWebSocketPort    = 8081
+)
+
 var relayManifests = template.Must(template.New("relay").Parse(`
 apiVersion: apps/v1
-kind: Deployment
+kind: {{if .daemonSet}}DaemonSet{{else}}Deployment{{end}}
 metadata:
   labels:
     app.kubernetes.io/component: relay
@@ -27,7 +69,20 @@ metadata:
   name: relay
   namespace: localflux
 spec:
-  replicas: 1
+{{if not .daemonSet}}
+  replicas: {{.replicas}}
+{{end}}
+{{if .hostNetwork}}
+{{if .daemonSet}}
+  updateStrategy:
+{{else}}
+  strategy:
+{{end}}
+    type: RollingUpdate
+    rollingUpdate:
+      maxSurge: 0
+      maxUnavailable: 1
+{{end}}
   selector:
     matchLabels:
       app.kubernetes.io/component: relay
@@ -51,11 +106,215 @@ spec:
         args:
         - "relay-server"
         - "--debug"
+{{if .webSocket}}
+        - "--websocket-address=:{{.webSocketPort}}"
+{{end}}
+        ports:
+        - name: grpc
+          containerPort: 8080
+{{if .webSocket}}
+        - name: websocket
+          containerPort: {{.webSocketPort}}
+{{end}}
+        readinessProbe:
+          tcpSocket:
+            port: grpc
+          periodSeconds: 5
+        env:
+        - name: POD_IP
+          valueFrom:
+            fieldRef:
+              fieldPath: status.podIP
+{{if .webSocket}}
+        - name: LOCALFLUX_RELAY_TOKEN
+          valueFrom:
+            secretKeyRef:
+              name: relay-token
+              key: token
+{{end}}
       priorityClassName: system-cluster-critical
+{{if .webSocket}}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  labels:
+    app.kubernetes.io/component: relay
+    app.kubernetes.io/instance: localflux
+    app.kubernetes.io/part-of: localflux
+  name: relay-websocket
+  namespace: localflux
+spec:
+  type: NodePort
+  selector:
+    app.kubernetes.io/component: relay
+    app.kubernetes.io/instance: localflux
+    app.kubernetes.io/part-of: localflux
+  ports:
+  - name: websocket
+    port: {{.webSocketPort}}
+    targetPort: websocket
+{{if .nodePort}}
+    nodePort: {{.nodePort}}
+{{end}}
+{{if .host}}
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  labels:
+    app.kubernetes.io/component: relay
+    app.kubernetes.io/instance: localflux
+    app.kubernetes.io/part-of: localflux
+  name: relay-websocket
+  namespace: localflux
+spec:
+{{if .ingressClassName}}
+  ingressClassName: {{.ingressClassName}}
+{{end}}
+  rules:
+  - host: {{.host}}
+    http:
+      paths:
+      - path: /tunnel
+        pathType: Exact
+        backend:
+          service:
+            name: relay-websocket
+            port:
+              name: websocket
+{{end}}
+{{end}}
 `))
 
-func startRelay(ctx context.Context, logger *slog.Logger, rcfg *cmdapi.Config, cb Callbacks) error {
-	_ = exec.CommandContext(ctx, "docker", "rm", "-f", "localflux-relay").Run()
+// removeStaleRelay removes the relay resources left behind when the mode or transport is changed.
+func removeStaleRelay(ctx context.Context, kc *K8sClient, daemonSet bool, webSocket bool, ingress bool) error {
+	apps := kc.ClientSet().AppsV1()
+	core := kc.ClientSet().CoreV1()
+	networking := kc.ClientSet().NetworkingV1()
+
+	var errs []error
+
+	if daemonSet {
+		errs = append(errs, apps.Deployments(LFNamespace).Delete(ctx, "relay", metav1.DeleteOptions{}))
+	} else {
+		errs = append(errs, apps.DaemonSets(LFNamespace).Delete(ctx, "relay", metav1.DeleteOptions{}))
+	}
+
+	if !webSocket {
+		errs = append(errs, core.Services(LFNamespace).Delete(ctx, RelayWebSocketService, metav1.DeleteOptions{}))
+	}
+
+	if !webSocket || !ingress {
+		errs = append(errs, networking.Ingresses(LFNamespace).Delete(ctx, RelayWebSocketService, metav1.DeleteOptions{}))
+	}
+
+	for _, err := range errs {
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to remove stale relay: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ensureRelayToken creates the token of the WebSocket endpoint, keeping any existing token so that running clients
+// stay authenticated.
+func ensureRelayToken(ctx context.Context, kc *K8sClient) error {
+	token := make([]byte, 32)
+
+	if _, err := rand.Read(token); err != nil {
+		return fmt.Errorf("failed to generate relay token: %w", err)
+	}
+
+	_, err := kc.ClientSet().CoreV1().Secrets(LFNamespace).Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      RelayTokenSecret,
+			Namespace: LFNamespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/component": "relay",
+				"app.kubernetes.io/part-of":   "localflux",
+			},
+		},
+		StringData: map[string]string{
+			RelayTokenKey: hex.EncodeToString(token),
+		},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create relay token: %w", err)
+	}
+
+	return nil
+}
+
+// relayWebSocketURL returns the URL the relay client connects to, or empty to find the node port itself.
+func relayWebSocketURL(relayConfig config.Relay) string {
+	ws := relayConfig.WebSocket
+	if ws == nil {
+		return ""
+	}
+
+	if ws.URL != "" {
+		return ws.URL
+	}
+
+	if ws.Host != "" {
+		return "ws://" + ws.Host + RelayWebSocketPath
+	}
+
+	return ""
+}
+
+// applyClusterForwards publishes the forwards of the cluster for the relay client. The list is always written, so that
+// removed forwards are stopped.
+func applyClusterForwards(ctx context.Context, kc *K8sClient, relayConfig config.Relay) error {
+	forwards := make([]*dv1alpha1.PortForward, 0, len(relayConfig.PortForward))
+
+	for _, forward := range relayConfig.PortForward {
+		network := "tcp"
+		if forward.Network != "" {
+			network = strings.ToLower(forward.Network)
+		}
+
+		forwards = append(forwards, &dv1alpha1.PortForward{
+			Kind:              forward.Kind,
+			Namespace:         forward.Namespace,
+			Name:              forward.Name,
+			Port:              forward.Port,
+			Network:           network,
+			LocalPort:         forward.LocalPort,
+			BindAddress:       forward.BindAddress,
+			Compression:       forward.Compression,
+			NetworkConditions: (*dv1alpha1.NetworkConditions)(forward.NetworkConditions),
+		})
+	}
+
+	data, err := json.Marshal(forwards)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cluster forwards: %w", err)
+	}
+
+	if err := kc.PatchSSA(ctx, &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ClusterForwardsConfigMap,
+			Namespace: LFNamespace,
+		},
+		Data: map[string]string{
+			ClusterForwardsKey: string(data),
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to apply cluster forwards: %w", err)
+	}
+
+	return nil
+}
+
+func startRelay(ctx context.Context, logger *slog.Logger, relayConfig config.Relay, rcfg *cmdapi.Config, cb Callbacks) error {
+	_ = exec.CommandContext(ctx, "docker", "rm", "-f", RelayContainerName).Run()
 
 	eg, ctx := errgroup.WithContext(ctx)
 
@@ -66,14 +325,23 @@ func startRelay(ctx context.Context, logger *slog.Logger, rcfg *cmdapi.Config, c
 
 	b64 := base64.StdEncoding.EncodeToString(data)
 
-	cmd := exec.CommandContext(
-		ctx,
-		"docker",
+	args := []string{
 		"run",
 		"-d",
 		"--network", "host",
-		"--name", "localflux-relay",
+		"--name", RelayContainerName,
+		"--restart", "on-failure",
 		"--pull", "always",
+	}
+
+	hosts := relayConfig.Hosts != nil && relayConfig.Hosts.Enabled
+
+	// The hosts file is rewritten in place, so that the bind mount keeps pointing at the file of the host.
+	if hosts {
+		args = append(args, "--volume", "/etc/hosts:/host/etc/hosts")
+	}
+
+	args = append(args,
 		"ghcr.io/csnewman/localflux:master",
 		"relay",
 		"--debug",
@@ -82,6 +350,15 @@ func startRelay(ctx context.Context, logger *slog.Logger, rcfg *cmdapi.Config, c
 		b64,
 	)
 
+	hostsFile := ""
+	if hosts {
+		hostsFile = "/host/etc/hosts"
+	}
+
+	args = append(args, RelayArgs(relayConfig, hostsFile)...)
+
+	cmd := exec.CommandContext(ctx, "docker", args...)
+
 	or, ow := io.Pipe()
 	er, ew := io.Pipe()
 
@@ -148,3 +425,92 @@ func startRelay(ctx context.Context, logger *slog.Logger, rcfg *cmdapi.Config, c
 
 	return nil
 }
+
+// RelayContainerState describes the state of the relay container, such as "running" or "exited (1)".
+func RelayContainerState(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(
+		ctx,
+		"docker",
+		"inspect",
+		"--format", "{{.State.Status}} {{.State.ExitCode}} {{.State.Error}}",
+		RelayContainerName,
+	).CombinedOutput()
+	if err != nil {
+		if strings.Contains(strings.ToLower(string(out)), "no such") {
+			return "", ErrRelayContainerMissing
+		}
+
+		return "", fmt.Errorf("failed to inspect relay container: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	state, rest, _ := strings.Cut(strings.TrimSpace(string(out)), " ")
+	code, msg, _ := strings.Cut(rest, " ")
+
+	if state == "running" {
+		return state, nil
+	}
+
+	state += " (" + code + ")"
+
+	if msg != "" {
+		state += ": " + msg
+	}
+
+	return state, nil
+}
+
+// RelayArgs returns the flags of the relay command that run the client as configured, maintaining the hosts file at the
+// path when set. The resolver is never registered, as the client does not run as root.
+func RelayArgs(relayConfig config.Relay, hostsFile string) []string {
+	var args []string
+
+	if relayConfig.BindAddress != "" {
+		args = append(args, "--bind-address", relayConfig.BindAddress)
+	}
+
+	if strings.EqualFold(relayConfig.Transport, RelayTransportWebSocket) {
+		args = append(args, "--websocket")
+
+		if url := relayWebSocketURL(relayConfig); url != "" {
+			args = append(args, "--websocket-url", url)
+		}
+	}
+
+	if proxy := relayConfig.HTTPProxy; proxy != nil && proxy.Enabled {
+		args = append(args, "--http-proxy")
+
+		if proxy.Address != "" {
+			args = append(args, "--http-proxy-address", proxy.Address)
+		}
+
+		if proxy.Domain != "" {
+			args = append(args, "--http-proxy-domain", proxy.Domain)
+		}
+	}
+
+	if hosts := relayConfig.Hosts; hosts != nil && hosts.Enabled {
+		args = append(args, "--hosts")
+
+		if hostsFile != "" {
+			args = append(args, "--hosts-file", hostsFile)
+		}
+
+		if hosts.Address != "" {
+			args = append(args, "--hosts-address", hosts.Address)
+		}
+	}
+
+	if dns := relayConfig.DNS; dns != nil && dns.Enabled {
+		args = append(args, "--dns")
+
+		if dns.Address != "" {
+			args = append(args, "--dns-address", dns.Address)
+		}
+
+		if dns.Domain != "" {
+			args = append(args, "--dns-domain", dns.Domain)
+		}
+	}
+
+	return args
+}
@@ -0,0 +1,327 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"text/template"
+	"time"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/webhook"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// WebhookTLSSecret holds the serving certificate of the webhook, and the CA the API server verifies it with.
+	WebhookTLSSecret = "webhook-tls"
+	webhookService   = "webhook"
+	// webhookConfigName is the name of the ValidatingWebhookConfiguration.
+	webhookConfigName = "localflux"
+	// webhookCertValidity is long lived, as the certificate is only trusted by the API server of the local cluster.
+	webhookCertValidity = 10 * 365 * 24 * time.Hour
+)
+
+var webhookManifests = template.Must(template.New("webhook").Parse(`
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  labels:
+    app.kubernetes.io/component: webhook
+    app.kubernetes.io/instance: localflux
+    app.kubernetes.io/part-of: localflux
+  name: webhook
+  namespace: localflux
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  labels:
+    app.kubernetes.io/component: webhook
+    app.kubernetes.io/instance: localflux
+    app.kubernetes.io/part-of: localflux
+  name: localflux-webhook
+rules:
+- apiGroups:
+  - flux.local
+  resources:
+  - deployments
+  verbs:
+  - get
+  - list
+  - watch
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  labels:
+    app.kubernetes.io/component: webhook
+    app.kubernetes.io/instance: localflux
+    app.kubernetes.io/part-of: localflux
+  name: localflux-webhook
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: localflux-webhook
+subjects:
+- kind: ServiceAccount
+  name: webhook
+  namespace: localflux
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    app.kubernetes.io/component: webhook
+    app.kubernetes.io/instance: localflux
+    app.kubernetes.io/part-of: localflux
+  name: webhook
+  namespace: localflux
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app.kubernetes.io/component: webhook
+      app.kubernetes.io/instance: localflux
+      app.kubernetes.io/part-of: localflux
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/component: webhook
+        app.kubernetes.io/instance: localflux
+        app.kubernetes.io/part-of: localflux
+    spec:
+      serviceAccountName: webhook
+      containers:
+      - name: localflux
+        image: ghcr.io/csnewman/localflux:master
+        imagePullPolicy: Always
+        args:
+        - "webhook-server"
+        - "--address=:{{.port}}"
+        - "--cert-dir=/tls"
+        ports:
+        - name: https
+          containerPort: {{.port}}
+        readinessProbe:
+          tcpSocket:
+            port: https
+          periodSeconds: 5
+        volumeMounts:
+        - name: tls
+          mountPath: /tls
+          readOnly: true
+      volumes:
+      - name: tls
+        secret:
+          secretName: {{.secret}}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  labels:
+    app.kubernetes.io/component: webhook
+    app.kubernetes.io/instance: localflux
+    app.kubernetes.io/part-of: localflux
+  name: {{.service}}
+  namespace: localflux
+spec:
+  selector:
+    app.kubernetes.io/component: webhook
+    app.kubernetes.io/instance: localflux
+    app.kubernetes.io/part-of: localflux
+  ports:
+  - name: https
+    port: 443
+    targetPort: https
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  labels:
+    app.kubernetes.io/component: webhook
+    app.kubernetes.io/instance: localflux
+    app.kubernetes.io/part-of: localflux
+  name: {{.name}}
+webhooks:
+- name: deployments.flux.local
+  admissionReviewVersions:
+  - v1
+  sideEffects: None
+  failurePolicy: {{.failurePolicy}}
+  timeoutSeconds: 5
+  clientConfig:
+    caBundle: {{.caBundle}}
+    service:
+      name: {{.service}}
+      namespace: localflux
+      path: {{.path}}
+  rules:
+  - apiGroups:
+    - flux.local
+    apiVersions:
+    - v1alpha1
+    operations:
+    - CREATE
+    - UPDATE
+    resources:
+    - deployments
+`))
+
+// deployWebhook applies the webhook server and registers it with the API server.
+func deployWebhook(ctx context.Context, kc *K8sClient, cfg config.Webhook) error {
+	caCert, err := ensureWebhookCert(ctx, kc)
+	if err != nil {
+		return err
+	}
+
+	failurePolicy := cfg.FailurePolicy
+	if failurePolicy == "" {
+		failurePolicy = "Ignore"
+	}
+
+	var rendered bytes.Buffer
+
+	if err := webhookManifests.Execute(&rendered, map[string]any{
+		"name":          webhookConfigName,
+		"service":       webhookService,
+		"secret":        WebhookTLSSecret,
+		"port":          webhook.Port,
+		"path":          webhook.Path,
+		"failurePolicy": failurePolicy,
+		"caBundle":      base64.StdEncoding.EncodeToString(caCert),
+	}); err != nil {
+		return fmt.Errorf("failed to render webhook manifests: %w", err)
+	}
+
+	if err := kc.Apply(ctx, rendered.String()); err != nil {
+		return fmt.Errorf("failed to apply webhook manifests: %w", err)
+	}
+
+	return nil
+}
+
+// removeWebhook unregisters the webhook, so that a disabled webhook does not keep validating objects.
+func removeWebhook(ctx context.Context, kc *K8sClient) error {
+	err := kc.ClientSet().AdmissionregistrationV1().ValidatingWebhookConfigurations().
+		Delete(ctx, webhookConfigName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to remove webhook: %w", err)
+	}
+
+	return nil
+}
+
+// ensureWebhookCert creates the serving certificate of the webhook, signed by a CA of its own, returning the CA
+// certificate. Existing certificates are kept.
+func ensureWebhookCert(ctx context.Context, kc *K8sClient) ([]byte, error) {
+	secrets := kc.ClientSet().CoreV1().Secrets(LFNamespace)
+
+	existing, err := secrets.Get(ctx, WebhookTLSSecret, metav1.GetOptions{})
+	if err == nil && len(existing.Data["ca.crt"]) > 0 {
+		return existing.Data["ca.crt"], nil
+	} else if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get webhook certificate: %w", err)
+	}
+
+	caCert, cert, key, err := generateWebhookCert(fmt.Sprintf("%s.%s.svc", webhookService, LFNamespace))
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      WebhookTLSSecret,
+			Namespace: LFNamespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/component": "webhook",
+				"app.kubernetes.io/part-of":   "localflux",
+			},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			"ca.crt":                caCert,
+			corev1.TLSCertKey:       cert,
+			corev1.TLSPrivateKeyKey: key,
+		},
+	}
+
+	if existing != nil && existing.Name != "" {
+		secret.ResourceVersion = existing.ResourceVersion
+
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	} else {
+		_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to store webhook certificate: %w", err)
+	}
+
+	return caCert, nil
+}
+
+// generateWebhookCert returns a CA certificate, and a certificate and key for the host signed by it, PEM encoded.
+func generateWebhookCert(host string) ([]byte, []byte, []byte, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	now := time.Now()
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localflux-webhook-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(webhookCertValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create ca certificate: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(webhookCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, leafTemplate, caTemplate, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		nil
+}
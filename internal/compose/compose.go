@@ -0,0 +1,505 @@
+// Package compose converts the services of a Compose file into images and Kubernetes manifests.
+//
+// Only the subset of the Compose Spec that maps onto a Deployment and Service is supported. Other fields are ignored,
+// with warnings for those that change how a service behaves.
+package compose
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/shlex"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	ErrInvalid         = errors.New("invalid compose file")
+	ErrUnknownService  = errors.New("unknown service")
+	ErrNoServicesFound = errors.New("no services found")
+)
+
+// nameLabel is the label used to select the pods of a service.
+const nameLabel = "app.kubernetes.io/name"
+
+// Project is a loaded Compose file.
+type Project struct {
+	// Name is the project name, taken from the file or otherwise from its directory.
+	Name string
+	// Dir is the directory of the Compose file, which build contexts are relative to.
+	Dir      string
+	Services map[string]*Service
+
+	// Warnings contains notes about fields that could not be converted.
+	Warnings []string
+}
+
+type file struct {
+	Name     string              `json:"name"`
+	Services map[string]*Service `json:"services"`
+}
+
+// Service is a Compose service.
+type Service struct {
+	Image       string          `json:"image"`
+	Build       *Build          `json:"build"`
+	Command     shellCommand    `json:"command"`
+	Entrypoint  shellCommand    `json:"entrypoint"`
+	Environment mappingOrList   `json:"environment"`
+	Ports       []Port          `json:"ports"`
+	WorkingDir  string          `json:"working_dir"`
+	Deploy      *Deploy         `json:"deploy"`
+	Volumes     json.RawMessage `json:"volumes"`
+	DependsOn   json.RawMessage `json:"depends_on"`
+}
+
+// Build is the build section of a service.
+type Build struct {
+	Context    string        `json:"context"`
+	Dockerfile string        `json:"dockerfile"`
+	Target     string        `json:"target"`
+	Args       mappingOrList `json:"args"`
+}
+
+func (b *Build) UnmarshalJSON(data []byte) error {
+	var context string
+
+	if err := json.Unmarshal(data, &context); err == nil {
+		b.Context = context
+
+		return nil
+	}
+
+	type plain Build
+
+	return json.Unmarshal(data, (*plain)(b))
+}
+
+// Deploy is the deploy section of a service.
+type Deploy struct {
+	Replicas *int32 `json:"replicas"`
+}
+
+// Port is a port published by a service.
+type Port struct {
+	Target    int    `json:"target"`
+	Published int    `json:"published"`
+	Protocol  string `json:"protocol"`
+}
+
+func (p *Port) UnmarshalJSON(data []byte) error {
+	var short string
+
+	if err := json.Unmarshal(data, &short); err == nil {
+		return p.parse(short)
+	}
+
+	var number int
+
+	if err := json.Unmarshal(data, &number); err == nil {
+		p.Target = number
+
+		return nil
+	}
+
+	// The long syntax allows the published port to be given as a number or a string.
+	var long struct {
+		Target    int             `json:"target"`
+		Published json.RawMessage `json:"published"`
+		Protocol  string          `json:"protocol"`
+	}
+
+	if err := json.Unmarshal(data, &long); err != nil {
+		return err
+	}
+
+	p.Target = long.Target
+	p.Protocol = long.Protocol
+
+	if len(long.Published) > 0 {
+		var published string
+
+		if err := json.Unmarshal(long.Published, &published); err == nil {
+			// Ranges are not supported, the target port is published instead.
+			p.Published, _ = strconv.Atoi(published)
+		} else if err := json.Unmarshal(long.Published, &p.Published); err != nil {
+			return fmt.Errorf("%w: unsupported published port %s", ErrInvalid, long.Published)
+		}
+	}
+
+	return nil
+}
+
+// parse reads the short syntax, "[[ip:]published:]target[/protocol]".
+func (p *Port) parse(short string) error {
+	spec, protocol, _ := strings.Cut(short, "/")
+	p.Protocol = protocol
+
+	parts := strings.Split(spec, ":")
+
+	target, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return fmt.Errorf("%w: unsupported port %q", ErrInvalid, short)
+	}
+
+	p.Target = target
+
+	if len(parts) > 1 && parts[len(parts)-2] != "" {
+		published, err := strconv.Atoi(parts[len(parts)-2])
+		if err != nil {
+			return fmt.Errorf("%w: unsupported port %q", ErrInvalid, short)
+		}
+
+		p.Published = published
+	}
+
+	return nil
+}
+
+// shellCommand is a command given either as a list or as a string split like a shell would.
+type shellCommand []string
+
+func (c *shellCommand) UnmarshalJSON(data []byte) error {
+	var s string
+
+	if err := json.Unmarshal(data, &s); err != nil {
+		return json.Unmarshal(data, (*[]string)(c))
+	}
+
+	parts, err := shlex.Split(s)
+	if err != nil {
+		return fmt.Errorf("%w: failed to split command %q: %w", ErrInvalid, s, err)
+	}
+
+	*c = parts
+
+	return nil
+}
+
+// mappingOrList is a set of variables given either as a map or as a list of "KEY=value" entries. Variables without a
+// value are taken from the environment, as Compose does.
+type mappingOrList map[string]string
+
+func (m *mappingOrList) UnmarshalJSON(data []byte) error {
+	out := make(map[string]string)
+
+	var list []string
+
+	if err := json.Unmarshal(data, &list); err == nil {
+		for _, entry := range list {
+			k, v, ok := strings.Cut(entry, "=")
+			if !ok {
+				v = os.Getenv(k)
+			}
+
+			out[k] = v
+		}
+
+		*m = out
+
+		return nil
+	}
+
+	var mapping map[string]*json.RawMessage
+
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return err
+	}
+
+	for k, raw := range mapping {
+		if raw == nil || string(*raw) == "null" {
+			out[k] = os.Getenv(k)
+
+			continue
+		}
+
+		var s string
+
+		if err := json.Unmarshal(*raw, &s); err == nil {
+			out[k] = s
+
+			continue
+		}
+
+		// Numbers and booleans are kept as written.
+		out[k] = string(*raw)
+	}
+
+	*m = out
+
+	return nil
+}
+
+// Load reads a Compose file.
+func Load(path string) (*Project, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+
+	var f file
+
+	if err := yaml.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	if len(f.Services) == 0 {
+		return nil, fmt.Errorf("%w in %q", ErrNoServicesFound, path)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	p := &Project{
+		Name:     f.Name,
+		Dir:      filepath.Dir(path),
+		Services: f.Services,
+	}
+
+	if p.Name == "" {
+		p.Name = filepath.Base(dir)
+	}
+
+	p.Name = Sanitize(p.Name)
+
+	for _, name := range slices.Sorted(maps.Keys(p.Services)) {
+		svc := p.Services[name]
+
+		if svc.Image == "" && svc.Build == nil {
+			return nil, fmt.Errorf("%w: service %q has neither an image nor a build", ErrInvalid, name)
+		}
+
+		if len(svc.Volumes) > 0 {
+			p.warn("service %q: volumes are not converted", name)
+		}
+
+		if len(svc.DependsOn) > 0 {
+			p.warn("service %q: depends_on is not converted, pods start in any order", name)
+		}
+	}
+
+	return p, nil
+}
+
+func (p *Project) warn(format string, args ...any) {
+	p.Warnings = append(p.Warnings, fmt.Sprintf(format, args...))
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Sanitize converts a Compose name into a valid Kubernetes object name.
+func Sanitize(name string) string {
+	return strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// Select returns the names of the given services, or of all services if none are given, in a stable order.
+func (p *Project) Select(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return slices.Sorted(maps.Keys(p.Services)), nil
+	}
+
+	for _, name := range names {
+		if _, ok := p.Services[name]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownService, name)
+		}
+	}
+
+	return slices.Sorted(slices.Values(names)), nil
+}
+
+// ImageName returns the image a service runs. Built services are pushed to the registry under the Compose default
+// name of "<project>-<service>".
+func (p *Project) ImageName(registry string, name string) string {
+	svc := p.Services[name]
+
+	if svc.Build == nil {
+		return svc.Image
+	}
+
+	return strings.TrimSuffix(registry, "/") + "/" + p.Name + "-" + Sanitize(name)
+}
+
+// Image describes an image built from a service.
+type Image struct {
+	Service string
+	Image   string
+	// Context is the build context, relative to the working directory if the Compose file path was.
+	Context string
+	// File is the Dockerfile path, or empty for the default Dockerfile within the context.
+	File      string
+	Target    string
+	BuildArgs map[string]string
+}
+
+// Images returns the images built by the named services.
+func (p *Project) Images(registry string, names []string) []Image {
+	var images []Image
+
+	for _, name := range names {
+		svc := p.Services[name]
+		if svc.Build == nil {
+			continue
+		}
+
+		context := filepath.Join(p.Dir, svc.Build.Context)
+
+		image := Image{
+			Service:   name,
+			Image:     p.ImageName(registry, name),
+			Context:   context,
+			Target:    svc.Build.Target,
+			BuildArgs: svc.Build.Args,
+		}
+
+		if svc.Build.Dockerfile != "" {
+			image.File = filepath.Join(context, svc.Build.Dockerfile)
+		}
+
+		images = append(images, image)
+	}
+
+	return images
+}
+
+// Manifests returns a Deployment for each named service, and a Service for those with ports, as a multi-document
+// YAML stream.
+func (p *Project) Manifests(registry string, names []string) ([]byte, error) {
+	var docs []string
+
+	for _, name := range names {
+		objects := p.objects(registry, name)
+
+		for _, obj := range objects {
+			data, err := yaml.Marshal(obj)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode service %q: %w", name, err)
+			}
+
+			docs = append(docs, string(data))
+		}
+	}
+
+	return []byte(strings.Join(docs, "---\n")), nil
+}
+
+func (p *Project) objects(registry string, name string) []map[string]any {
+	svc := p.Services[name]
+	objName := Sanitize(name)
+	labels := map[string]any{nameLabel: objName}
+
+	container := map[string]any{
+		"name":  objName,
+		"image": p.ImageName(registry, name),
+	}
+
+	if len(svc.Entrypoint) > 0 {
+		container["command"] = []string(svc.Entrypoint)
+	}
+
+	if len(svc.Command) > 0 {
+		container["args"] = []string(svc.Command)
+	}
+
+	if svc.WorkingDir != "" {
+		container["workingDir"] = svc.WorkingDir
+	}
+
+	if len(svc.Environment) > 0 {
+		var env []map[string]any
+
+		for _, k := range slices.Sorted(maps.Keys(svc.Environment)) {
+			env = append(env, map[string]any{"name": k, "value": svc.Environment[k]})
+		}
+
+		container["env"] = env
+	}
+
+	var (
+		containerPorts []map[string]any
+		servicePorts   []map[string]any
+	)
+
+	for _, port := range svc.Ports {
+		protocol := strings.ToUpper(port.Protocol)
+		if protocol == "" {
+			protocol = "TCP"
+		}
+
+		published := port.Published
+		if published == 0 {
+			published = port.Target
+		}
+
+		containerPorts = append(containerPorts, map[string]any{
+			"containerPort": port.Target,
+			"protocol":      protocol,
+		})
+
+		servicePorts = append(servicePorts, map[string]any{
+			"name":       fmt.Sprintf("%s-%d", strings.ToLower(protocol), published),
+			"port":       published,
+			"targetPort": port.Target,
+			"protocol":   protocol,
+		})
+	}
+
+	if len(containerPorts) > 0 {
+		container["ports"] = containerPorts
+	}
+
+	replicas := int32(1)
+	if svc.Deploy != nil && svc.Deploy.Replicas != nil {
+		replicas = *svc.Deploy.Replicas
+	}
+
+	objects := []map[string]any{
+		{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]any{
+				"name":   objName,
+				"labels": labels,
+			},
+			"spec": map[string]any{
+				"replicas": replicas,
+				"selector": map[string]any{
+					"matchLabels": labels,
+				},
+				"template": map[string]any{
+					"metadata": map[string]any{
+						"labels": labels,
+					},
+					"spec": map[string]any{
+						"containers": []any{container},
+					},
+				},
+			},
+		},
+	}
+
+	if len(servicePorts) > 0 {
+		objects = append(objects, map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata": map[string]any{
+				"name":   objName,
+				"labels": labels,
+			},
+			"spec": map[string]any{
+				"selector": labels,
+				"ports":    servicePorts,
+			},
+		})
+	}
+
+	return objects
+}
@@ -1,38 +1,114 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/csnewman/localflux/internal/config/v1alpha1"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
 	"sigs.k8s.io/yaml"
 )
 
 type (
-	Config     = *v1alpha1.Config
-	Cluster    = *v1alpha1.Cluster
-	SSH        = *v1alpha1.SSH
-	BuildKit   = *v1alpha1.BuildKit
-	Relay      = *v1alpha1.Relay
-	Image      = *v1alpha1.Image
-	Deployment = *v1alpha1.Deployment
-	Step       = *v1alpha1.Step
+	Config       = *v1alpha2.Config
+	Cluster      = *v1alpha2.Cluster
+	SSH          = *v1alpha2.SSH
+	BuildKit     = *v1alpha2.BuildKit
+	Relay        = *v1alpha2.Relay
+	Notification = *v1alpha2.Notification
+	Mirror       = *v1alpha2.RegistryMirror
+	Image        = *v1alpha2.Image
+	BuildCache   = *v1alpha2.BuildCache
+	Buildpacks   = *v1alpha2.Buildpacks
+	CustomBuild  = *v1alpha2.CustomBuild
+	NixBuild     = *v1alpha2.NixBuild
+	BazelBuild   = *v1alpha2.BazelBuild
+	Deployment   = *v1alpha2.Deployment
+	Step         = *v1alpha2.Step
+	Hooks        = *v1alpha2.Hooks
+	Hook         = *v1alpha2.Hook
+	Output       = *v1alpha2.Output
+	Profile      = *v1alpha2.Profile
+	Signing      = *v1alpha2.Signing
+	Telemetry    = *v1alpha2.Telemetry
+	PortForward  = *v1alpha2.PortForward
+	Generate     = *v1alpha2.Generate
+	Generator    = *v1alpha2.Generator
+	Git          = *v1alpha2.Git
+	Compose      = *v1alpha2.Compose
+	Probe        = *v1alpha2.Probe
+	HTTPProbe    = *v1alpha2.HTTPProbe
+	ValuesRef    = *v1alpha2.ValuesReference
+	ImageValue   = *v1alpha2.ImageValue
+	UserConfig   = *v1alpha2.UserConfig
+	Webhook      = *v1alpha2.Webhook
 )
 
-var ErrUnknownVersion = errors.New("unknown version")
+var (
+	ErrUnknownVersion = errors.New("unknown version")
+	ErrInvalidInclude = errors.New("invalid include")
+)
 
 type Wrapper struct {
 	metav1.TypeMeta `json:",inline"`
 }
 
+// Load loads the project config at the path, merging in the files it includes, and then the user config beneath it.
+// Deployments are merged over the deployments they extend, and the defaults of the config are applied to them.
 func Load(path string) (Config, error) {
-	raw, err := os.ReadFile(path)
+	cfg, err := loadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+		return nil, err
+	}
+
+	cfg.Dir = filepath.Dir(path)
+
+	if len(cfg.Include) > 0 {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve path: %w", err)
+		}
+
+		if err := mergeIncludes(cfg, cfg, path, map[string]struct{}{abs: {}}); err != nil {
+			return nil, err
+		}
+
+		if err := checkUnique(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := resolveExtends(cfg); err != nil {
+		return nil, err
 	}
 
+	user, err := LoadUser()
+	if err != nil {
+		return nil, err
+	}
+
+	mergeUser(cfg, user)
+	applyDefaults(cfg)
+
+	return cfg, nil
+}
+
+// loadFile loads the config at the path, or at the remote reference of an include.
+func loadFile(path string) (*v1alpha2.Config, error) {
+	raw, err := readInclude(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(raw)
+}
+
+// decode parses a config of any supported version, converting older versions to the latest.
+func decode(raw []byte) (*v1alpha2.Config, error) {
 	var w Wrapper
 
 	if err := yaml.Unmarshal(raw, &w); err != nil {
@@ -41,23 +117,158 @@ func Load(path string) (Config, error) {
 
 	gvk := w.GroupVersionKind()
 
-	if gvk.Group != v1alpha1.GroupVersion.Group {
+	if gvk.Group != v1alpha2.GroupVersion.Group {
 		return nil, fmt.Errorf("%w: %s", ErrUnknownVersion, gvk.Group)
 	}
 
-	if gvk.Version != v1alpha1.GroupVersion.Version {
-		return nil, fmt.Errorf("%w: %s", ErrUnknownVersion, gvk.Version)
-	}
-
 	if gvk.Kind != "Config" {
 		return nil, fmt.Errorf("%w: %s", ErrUnknownVersion, gvk.Kind)
 	}
 
-	var cfg v1alpha1.Config
+	raw, err := stripSchemaKey(raw)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := yaml.UnmarshalStrict(raw, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal: %w", err)
+	var cfg v1alpha2.Config
+
+	switch gvk.Version {
+	case v1alpha2.GroupVersion.Version:
+		if err := yaml.UnmarshalStrict(raw, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal: %w", err)
+		}
+
+	case v1alpha1.GroupVersion.Version:
+		var old v1alpha1.Config
+
+		if err := yaml.UnmarshalStrict(raw, &old); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal: %w", err)
+		}
+
+		if err := old.ConvertTo(&cfg); err != nil {
+			return nil, fmt.Errorf("failed to convert from %s: %w", v1alpha1.GroupVersion, err)
+		}
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownVersion, gvk.Version)
 	}
 
 	return &cfg, nil
 }
+
+// stripSchemaKey removes the top-level schema key used by editors, which is not part of the config. Files with the key
+// are returned as JSON.
+func stripSchemaKey(raw []byte) ([]byte, error) {
+	var doc map[string]json.RawMessage
+
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal: %w", err)
+	}
+
+	if _, ok := doc[SchemaKey]; !ok {
+		return raw, nil
+	}
+
+	delete(doc, SchemaKey)
+
+	stripped, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal: %w", err)
+	}
+
+	return stripped, nil
+}
+
+// mergeIncludes merges the clusters and deployments of the files included by the config at the path into the root
+// config, in order. Files that were already merged are skipped, so that includes may overlap or form cycles.
+func mergeIncludes(root *v1alpha2.Config, cfg *v1alpha2.Config, path string, seen map[string]struct{}) error {
+	for _, pattern := range cfg.Include {
+		matches, err := resolveInclude(path, pattern)
+		if err != nil {
+			return err
+		}
+
+		for _, match := range matches {
+			key, err := includeKey(match)
+			if err != nil {
+				return err
+			}
+
+			if _, ok := seen[key]; ok {
+				continue
+			}
+
+			seen[key] = struct{}{}
+
+			included, err := loadFile(match)
+			if err != nil {
+				return fmt.Errorf("failed to load include %s: %w", match, err)
+			}
+
+			if included.DefaultCluster != "" || included.Defaults != nil || included.Telemetry != nil {
+				return fmt.Errorf("%w: %s may only set clusters, deployments and includes", ErrInvalidInclude, match)
+			}
+
+			if isRemoteInclude(match) {
+				if found := remoteCommands(included); found != "" && pinnedDigest(match) == "" {
+					return fmt.Errorf("%w: %s: %s, so must be pinned by digest", ErrInvalidInclude, match, found)
+				}
+			} else if err := rebaseInclude(included, root.Dir, match); err != nil {
+				return err
+			}
+
+			root.Clusters = append(root.Clusters, included.Clusters...)
+			root.Deployments = append(root.Deployments, included.Deployments...)
+
+			if err := mergeIncludes(root, included, match, seen); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// expandInclude returns the files matched by the include glob, relative to the directory of the including file.
+func expandInclude(dir string, pattern string) ([]string, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidInclude, pattern, err)
+	}
+
+	// Globs may match nothing, unlike plain paths.
+	if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+		return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidInclude, pattern)
+	}
+
+	return matches, nil
+}
+
+// checkUnique checks that the merged clusters and deployments have unique names.
+func checkUnique(cfg *v1alpha2.Config) error {
+	clusters := make(map[string]struct{}, len(cfg.Clusters))
+
+	for _, cluster := range cfg.Clusters {
+		if _, ok := clusters[cluster.Name]; ok {
+			return fmt.Errorf("%w: cluster %q is defined more than once", ErrInvalidInclude, cluster.Name)
+		}
+
+		clusters[cluster.Name] = struct{}{}
+	}
+
+	deployments := make(map[string]struct{}, len(cfg.Deployments))
+
+	for _, deployment := range cfg.Deployments {
+		if _, ok := deployments[deployment.Name]; ok {
+			return fmt.Errorf("%w: deployment %q is defined more than once", ErrInvalidInclude, deployment.Name)
+		}
+
+		deployments[deployment.Name] = struct{}{}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+)
+
+// applyDefaults fills the fields of the deployments and steps that are left unset with the defaults of the config.
+// The interval and timeout defaults are instead applied when the steps are deployed.
+func applyDefaults(cfg *v1alpha2.Config) {
+	defaults := cfg.Defaults
+	if defaults == nil {
+		return
+	}
+
+	for _, deployment := range cfg.Deployments {
+		for _, image := range deployment.Images {
+			defaultPaths(defaults, &image.IncludePaths, &image.ExcludePaths)
+		}
+
+		for _, profile := range deployment.Profiles {
+			for _, image := range profile.Images {
+				defaultPaths(defaults, &image.IncludePaths, &image.ExcludePaths)
+			}
+		}
+
+		for _, step := range deployment.Steps {
+			defaultStep(defaults, step)
+		}
+
+		for _, forward := range deployment.PortForward {
+			if forward.Namespace == "" && !strings.EqualFold(forward.Kind, "namespace") {
+				forward.Namespace = defaults.Namespace
+			}
+		}
+	}
+}
+
+func defaultStep(defaults *v1alpha2.Defaults, step *v1alpha2.Step) {
+	switch {
+	case step.Kustomize != nil:
+		defaultString(&step.Kustomize.Namespace, defaults.Namespace)
+		defaultPaths(defaults, &step.Kustomize.IncludePaths, &step.Kustomize.ExcludePaths)
+	case step.Helm != nil:
+		defaultString(&step.Helm.Namespace, defaults.Namespace)
+		defaultPaths(defaults, &step.Helm.IncludePaths, &step.Helm.ExcludePaths)
+	case step.Manifests != nil:
+		defaultString(&step.Manifests.Namespace, defaults.Namespace)
+	case step.Git != nil:
+		defaultString(&step.Git.Namespace, defaults.Namespace)
+	case step.Compose != nil:
+		defaultString(&step.Compose.Namespace, defaults.Namespace)
+		defaultString(&step.Compose.Registry, defaults.Registry)
+	}
+}
+
+// defaultPaths sets the default include and exclude paths, unless either is already set.
+func defaultPaths(defaults *v1alpha2.Defaults, include *[]string, exclude *[]string) {
+	if len(*include) > 0 || len(*exclude) > 0 {
+		return
+	}
+
+	*include = slices.Clone(defaults.IncludePaths)
+	*exclude = slices.Clone(defaults.ExcludePaths)
+}
+
+func defaultString(value *string, def string) {
+	if *value == "" {
+		*value = def
+	}
+}
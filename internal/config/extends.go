@@ -0,0 +1,229 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+)
+
+var ErrInvalidExtends = errors.New("invalid extends")
+
+// resolveExtends replaces each deployment that extends another with the result of merging it over the deployment it
+// extends.
+func resolveExtends(cfg *v1alpha2.Config) error {
+	resolved := make(map[string]*v1alpha2.Deployment)
+
+	out := make([]*v1alpha2.Deployment, len(cfg.Deployments))
+
+	for i, deployment := range cfg.Deployments {
+		merged, err := resolveDeployment(cfg.Deployments, deployment, resolved, nil)
+		if err != nil {
+			return err
+		}
+
+		out[i] = merged
+	}
+
+	cfg.Deployments = out
+
+	return nil
+}
+
+// resolveDeployment merges the deployment over the chain of deployments it extends. The chain holds the deployments
+// being resolved, to detect cycles.
+func resolveDeployment(
+	all []*v1alpha2.Deployment,
+	deployment *v1alpha2.Deployment,
+	resolved map[string]*v1alpha2.Deployment,
+	chain []string,
+) (*v1alpha2.Deployment, error) {
+	if deployment.Extends == "" {
+		if deployment.Exclude != nil {
+			return nil, fmt.Errorf(
+				"%w: %q excludes entries but does not extend a deployment",
+				ErrInvalidExtends,
+				deployment.Name,
+			)
+		}
+
+		return deployment, nil
+	}
+
+	if merged, ok := resolved[deployment.Name]; ok {
+		return merged, nil
+	}
+
+	chain = append(chain, deployment.Name)
+
+	if slices.Contains(chain, deployment.Extends) {
+		return nil, fmt.Errorf(
+			"%w: cycle %s -> %s",
+			ErrInvalidExtends,
+			strings.Join(chain, " -> "),
+			deployment.Extends,
+		)
+	}
+
+	idx := slices.IndexFunc(all, func(d *v1alpha2.Deployment) bool {
+		return d.Name == deployment.Extends
+	})
+	if idx == -1 {
+		return nil, fmt.Errorf(
+			"%w: %q extends unknown deployment %q",
+			ErrInvalidExtends,
+			deployment.Name,
+			deployment.Extends,
+		)
+	}
+
+	base, err := resolveDeployment(all, all[idx], resolved, chain)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := extendDeployment(base, deployment)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrInvalidExtends, deployment.Name, err)
+	}
+
+	resolved[deployment.Name] = merged
+
+	return merged, nil
+}
+
+// extendDeployment returns a copy of the base deployment with the exclusions and entries of the deployment applied.
+func extendDeployment(base *v1alpha2.Deployment, deployment *v1alpha2.Deployment) (*v1alpha2.Deployment, error) {
+	out := base.DeepCopy()
+	out.Name = deployment.Name
+	out.Extends = deployment.Extends
+	out.Exclude = nil
+	out.Templating = out.Templating || deployment.Templating
+
+	if err := applyExclusions(out, deployment.Exclude); err != nil {
+		return nil, err
+	}
+
+	for _, image := range deployment.Images {
+		out.Images = mergeEntry(out.Images, image.DeepCopy(), func(existing *v1alpha2.Image) bool {
+			return existing.Image == image.Image
+		})
+	}
+
+	for _, step := range deployment.Steps {
+		out.Steps = mergeEntry(out.Steps, step.DeepCopy(), func(existing *v1alpha2.Step) bool {
+			return existing.Name == step.Name
+		})
+	}
+
+	for _, forward := range deployment.PortForward {
+		out.PortForward = mergeEntry(out.PortForward, forward.DeepCopy(), func(existing *v1alpha2.PortForward) bool {
+			return localPort(existing) == localPort(forward)
+		})
+	}
+
+	for _, forward := range deployment.ReverseForward {
+		out.ReverseForward = mergeEntry(
+			out.ReverseForward,
+			forward.DeepCopy(),
+			func(existing *v1alpha2.ReverseForward) bool {
+				return existing.Name == forward.Name
+			},
+		)
+	}
+
+	for _, profile := range deployment.Profiles {
+		out.Profiles = mergeEntry(out.Profiles, profile.DeepCopy(), func(existing *v1alpha2.Profile) bool {
+			return existing.Name == profile.Name
+		})
+	}
+
+	if deployment.Hooks != nil {
+		if out.Hooks == nil {
+			out.Hooks = &v1alpha2.Hooks{}
+		}
+
+		hooks := deployment.Hooks.DeepCopy()
+
+		out.Hooks.PreBuild = append(out.Hooks.PreBuild, hooks.PreBuild...)
+		out.Hooks.PostBuild = append(out.Hooks.PostBuild, hooks.PostBuild...)
+		out.Hooks.PostReconcile = append(out.Hooks.PostReconcile, hooks.PostReconcile...)
+	}
+
+	if deployment.Sign != nil {
+		out.Sign = deployment.Sign.DeepCopy()
+	}
+
+	return out, nil
+}
+
+func applyExclusions(out *v1alpha2.Deployment, exclude *v1alpha2.Exclusions) error {
+	if exclude == nil {
+		return nil
+	}
+
+	for _, name := range exclude.Images {
+		idx := slices.IndexFunc(out.Images, func(image *v1alpha2.Image) bool {
+			return image.Image == name
+		})
+		if idx == -1 {
+			return fmt.Errorf("excluded image %q is not inherited", name)
+		}
+
+		out.Images = slices.Delete(out.Images, idx, idx+1)
+	}
+
+	for _, name := range exclude.Steps {
+		idx := slices.IndexFunc(out.Steps, func(step *v1alpha2.Step) bool {
+			return step.Name == name
+		})
+		if idx == -1 {
+			return fmt.Errorf("excluded step %q is not inherited", name)
+		}
+
+		out.Steps = slices.Delete(out.Steps, idx, idx+1)
+	}
+
+	for _, port := range exclude.PortForwards {
+		idx := slices.IndexFunc(out.PortForward, func(forward *v1alpha2.PortForward) bool {
+			return localPort(forward) == port
+		})
+		if idx == -1 {
+			return fmt.Errorf("excluded port forward %d is not inherited", port)
+		}
+
+		out.PortForward = slices.Delete(out.PortForward, idx, idx+1)
+	}
+
+	for _, step := range out.Steps {
+		for _, dependency := range step.DependsOn {
+			if slices.Contains(exclude.Steps, dependency) {
+				return fmt.Errorf("step %q depends on excluded step %q", step.Name, dependency)
+			}
+		}
+	}
+
+	return nil
+}
+
+// mergeEntry replaces the first entry matching the override, or appends it when none match.
+func mergeEntry[T any](entries []T, override T, match func(T) bool) []T {
+	if idx := slices.IndexFunc(entries, match); idx != -1 {
+		entries[idx] = override
+
+		return entries
+	}
+
+	return append(entries, override)
+}
+
+// localPort returns the local port the forward is served on, which defaults to the forwarded port.
+func localPort(forward *v1alpha2.PortForward) int {
+	if forward.LocalPort != nil {
+		return *forward.LocalPort
+	}
+
+	return forward.Port
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/csnewman/localflux/internal/config/v1alpha1"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+var ErrMigrationFailed = errors.New("migration failed")
+
+// Migrate upgrades the config file to the latest version, returning whether it was changed. The document is edited in
+// place, so that comments and the order of fields are kept, and the result is checked to load as the same config.
+func Migrate(raw []byte) ([]byte, bool, error) {
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, false, fmt.Errorf("failed to parse: %w", err)
+	}
+
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, false, fmt.Errorf("%w: not a config", ErrUnknownVersion)
+	}
+
+	root := doc.Content[0]
+
+	_, apiVersion, _ := mappingEntry(root, "apiVersion")
+	if apiVersion == nil {
+		return nil, false, fmt.Errorf("%w: no apiVersion", ErrUnknownVersion)
+	}
+
+	switch apiVersion.Value {
+	case v1alpha2.GroupVersion.String():
+		return raw, false, nil
+	case v1alpha1.GroupVersion.String():
+		migrateV1alpha1(root)
+	default:
+		return nil, false, fmt.Errorf("%w: %s", ErrUnknownVersion, apiVersion.Value)
+	}
+
+	apiVersion.Value = v1alpha2.GroupVersion.String()
+
+	var out bytes.Buffer
+
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(&doc); err != nil {
+		return nil, false, fmt.Errorf("failed to encode: %w", err)
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, false, fmt.Errorf("failed to encode: %w", err)
+	}
+
+	before, err := decode(raw)
+	if err != nil {
+		return nil, false, err
+	}
+
+	after, err := decode(out.Bytes())
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %w", ErrMigrationFailed, err)
+	}
+
+	if !equality.Semantic.DeepEqual(before, after) {
+		return nil, false, fmt.Errorf("%w: the migrated config differs from the original", ErrMigrationFailed)
+	}
+
+	return out.Bytes(), true, nil
+}
+
+// migrateV1alpha1 moves the fields of a v1alpha1 config to where v1alpha2 expects them.
+func migrateV1alpha1(root *yaml.Node) {
+	if key, value, i := removeEntry(root, "defaultInterval"); key != nil {
+		key.Value = "interval"
+
+		defaults := ensureMapping(root, "defaults", i)
+		defaults.Content = append(defaults.Content, key, value)
+	}
+
+	_, clusters, _ := mappingEntry(root, "clusters")
+	if clusters == nil || clusters.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for _, cluster := range clusters.Content {
+		if cluster.Kind != yaml.MappingNode {
+			continue
+		}
+
+		if key, value, i := removeEntry(cluster, "ssh"); key != nil {
+			minikube := ensureMapping(cluster, "minikube", i)
+			minikube.Content = append(minikube.Content, key, value)
+		}
+	}
+}
+
+// mappingEntry returns the key and value nodes of the field, and the index of the key within the mapping.
+func mappingEntry(node *yaml.Node, name string) (*yaml.Node, *yaml.Node, int) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == name {
+			return node.Content[i], node.Content[i+1], i
+		}
+	}
+
+	return nil, nil, -1
+}
+
+// removeEntry removes the field from the mapping, returning its nodes and former index.
+func removeEntry(node *yaml.Node, name string) (*yaml.Node, *yaml.Node, int) {
+	key, value, i := mappingEntry(node, name)
+	if key == nil {
+		return nil, nil, -1
+	}
+
+	node.Content = append(node.Content[:i], node.Content[i+2:]...)
+
+	return key, value, i
+}
+
+// ensureMapping returns the mapping value of the field, creating it at the index if it is missing or null.
+func ensureMapping(node *yaml.Node, name string, at int) *yaml.Node {
+	_, value, _ := mappingEntry(node, name)
+
+	switch {
+	case value == nil:
+		value = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}
+
+		node.Content = append(node.Content[:at], append([]*yaml.Node{key, value}, node.Content[at:]...)...)
+	case value.Kind == yaml.ScalarNode && value.Tag == "!!null":
+		*value = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+
+	// Fields added to an empty flow mapping, e.g. "{}", are written in the block style of the rest of the file.
+	value.Style &^= yaml.FlowStyle
+
+	return value
+}
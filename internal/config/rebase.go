@@ -0,0 +1,168 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+)
+
+// rebaseInclude rewrites the relative paths of the deployments of the local file included at the path, which are
+// written relative to that file, to be relative to the directory of the main config instead.
+func rebaseInclude(included *v1alpha2.Config, rootDir string, path string) error {
+	base, err := filepath.Abs(rootDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	rel, err := filepath.Rel(base, dir)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidInclude, path, err)
+	}
+
+	if rel == "." {
+		return nil
+	}
+
+	for _, deployment := range included.Deployments {
+		rebaseDeployment(deployment, rel)
+	}
+
+	return nil
+}
+
+func rebaseDeployment(deployment *v1alpha2.Deployment, dir string) {
+	for _, image := range deployment.Images {
+		rebaseImage(image, dir)
+	}
+
+	for _, step := range deployment.Steps {
+		rebaseStep(step, dir)
+	}
+
+	for _, profile := range deployment.Profiles {
+		for _, image := range profile.Images {
+			rebaseImage(image, dir)
+		}
+
+		for _, step := range profile.Steps {
+			rebaseAll(step.ValueFiles, dir)
+		}
+	}
+
+	rebaseHooks(deployment.Hooks, dir)
+	rebaseSigning(deployment.Sign, dir)
+}
+
+func rebaseImage(image *v1alpha2.Image, dir string) {
+	// An unset context is the directory of the config file.
+	if image.Context == "" {
+		image.Context = dir
+	} else {
+		rebasePath(&image.Context, dir)
+	}
+
+	for name, c := range image.BuildContexts {
+		rebasePath(&c, dir)
+		image.BuildContexts[name] = c
+	}
+
+	for _, caches := range [][]*v1alpha2.BuildCache{image.CacheFrom, image.CacheTo} {
+		for _, cache := range caches {
+			rebasePath(&cache.Path, dir)
+		}
+	}
+
+	rebaseSigning(image.Sign, dir)
+}
+
+func rebaseStep(step *v1alpha2.Step, dir string) {
+	if step.Kustomize != nil {
+		rebasePath(&step.Kustomize.Context, dir)
+	}
+
+	if step.Helm != nil {
+		rebasePath(&step.Helm.Context, dir)
+		rebaseAll(step.Helm.ValueFiles, dir)
+	}
+
+	if step.Manifests != nil {
+		rebaseAll(step.Manifests.Files, dir)
+	}
+
+	if step.Compose != nil {
+		rebasePath(&step.Compose.File, dir)
+	}
+
+	if step.Generate != nil {
+		for _, generators := range [][]*v1alpha2.Generator{step.Generate.ConfigMaps, step.Generate.Secrets} {
+			for _, gen := range generators {
+				for i, file := range gen.Files {
+					if key, path, ok := strings.Cut(file, "="); ok {
+						rebasePath(&path, dir)
+						gen.Files[i] = key + "=" + path
+					} else {
+						rebasePath(&gen.Files[i], dir)
+					}
+				}
+
+				rebaseAll(gen.Envs, dir)
+			}
+		}
+	}
+
+	rebaseHooks(step.Hooks, dir)
+}
+
+func rebaseHooks(hooks *v1alpha2.Hooks, dir string) {
+	if hooks == nil {
+		return
+	}
+
+	for _, list := range [][]*v1alpha2.Hook{hooks.PreBuild, hooks.PostBuild, hooks.PostReconcile} {
+		for _, hook := range list {
+			// An unset directory is the directory of the config file.
+			if hook.Dir == "" {
+				hook.Dir = dir
+			} else {
+				rebasePath(&hook.Dir, dir)
+			}
+		}
+	}
+}
+
+func rebaseSigning(sign *v1alpha2.Signing, dir string) {
+	if sign == nil {
+		return
+	}
+
+	rebasePath(&sign.Key, dir)
+
+	if sign.Verify != nil {
+		rebasePath(&sign.Verify.PublicKey, dir)
+	}
+}
+
+func rebaseAll(paths []string, dir string) {
+	for i := range paths {
+		rebasePath(&paths[i], dir)
+	}
+}
+
+// rebasePath joins a relative local path onto the directory. Absolute paths, URLs, git references and templated values
+// are left as written.
+func rebasePath(path *string, dir string) {
+	p := *path
+
+	if p == "" || filepath.IsAbs(p) || isRemote(p) || strings.Contains(p, "{{") {
+		return
+	}
+
+	*path = filepath.Join(dir, p)
+}
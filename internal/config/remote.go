@@ -0,0 +1,286 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	// remoteIncludeTimeout bounds fetching a single remote include.
+	remoteIncludeTimeout = 30 * time.Second
+	// maxIncludeSize bounds the size of a remote include.
+	maxIncludeSize = 10 << 20
+)
+
+// RefreshIncludes causes remote includes to be fetched again, rather than read from the cache. Includes pinned by
+// digest never change, so are always read from the cache once fetched.
+var RefreshIncludes bool
+
+// isRemoteInclude reports whether the include is a "https://" URL or an "oci://" artifact reference rather than a
+// local glob.
+func isRemoteInclude(pattern string) bool {
+	return strings.HasPrefix(pattern, "https://") || strings.HasPrefix(pattern, "oci://")
+}
+
+// resolveInclude returns the files matched by an include of the file at from, which are either local paths or remote
+// references. Remote files may only include other remote files, as they have no directory to resolve globs against.
+func resolveInclude(from string, pattern string) ([]string, error) {
+	if isRemoteInclude(pattern) {
+		return []string{pattern}, nil
+	}
+
+	if strings.HasPrefix(pattern, "http://") {
+		return nil, fmt.Errorf("%w: %s: remote includes must use https", ErrInvalidInclude, pattern)
+	}
+
+	if isRemoteInclude(from) {
+		return nil, fmt.Errorf("%w: %s: remote files may only include remote files", ErrInvalidInclude, pattern)
+	}
+
+	return expandInclude(filepath.Dir(from), pattern)
+}
+
+// includeKey identifies an included file, so that files included more than once are only merged once.
+func includeKey(source string) (string, error) {
+	if isRemoteInclude(source) {
+		return source, nil
+	}
+
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve include: %w", err)
+	}
+
+	return abs, nil
+}
+
+// readInclude reads an included file, fetching remote files if they are not cached.
+func readInclude(source string) ([]byte, error) {
+	if !isRemoteInclude(source) {
+		raw, err := os.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+
+		return raw, nil
+	}
+
+	cachePath, err := includeCachePath(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if pinnedDigest(source) != "" || !RefreshIncludes {
+		if raw, err := os.ReadFile(cachePath); err == nil {
+			return raw, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteIncludeTimeout)
+	defer cancel()
+
+	var raw []byte
+
+	if ref, ok := strings.CutPrefix(source, "oci://"); ok {
+		raw, err = fetchOCIInclude(ctx, ref)
+	} else {
+		raw, err = fetchHTTPSInclude(ctx, source)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidInclude, source, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create include cache: %w", err)
+	}
+
+	if err := os.WriteFile(cachePath, raw, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write include cache: %w", err)
+	}
+
+	return raw, nil
+}
+
+// pinnedDigest returns the digest the remote include is pinned to, given as "oci://<repo>@sha256:<hex>" or
+// "https://<url>#sha256=<hex>", or an empty string if it is not pinned.
+func pinnedDigest(source string) string {
+	if ref, ok := strings.CutPrefix(source, "oci://"); ok {
+		if _, digest, ok := strings.Cut(ref, "@"); ok {
+			return digest
+		}
+
+		return ""
+	}
+
+	if _, fragment, ok := strings.Cut(source, "#"); ok {
+		if digest, ok := strings.CutPrefix(fragment, "sha256="); ok {
+			return digest
+		}
+	}
+
+	return ""
+}
+
+func includeCachePath(source string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find cache directory: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(source))
+
+	return filepath.Join(dir, "localflux", "includes", hex.EncodeToString(sum[:])+".yaml"), nil
+}
+
+// fetchHTTPSInclude downloads the file, checking it against the digest it is pinned to.
+func fetchHTTPSInclude(ctx context.Context, source string) ([]byte, error) {
+	url, _, _ := strings.Cut(source, "#")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	raw, err := readLimited(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read: %w", err)
+	}
+
+	if digest := pinnedDigest(source); digest != "" {
+		sum := sha256.Sum256(raw)
+
+		if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, digest) {
+			return nil, fmt.Errorf("digest mismatch: pinned %s but fetched %s", digest, actual)
+		}
+	}
+
+	return raw, nil
+}
+
+// fetchOCIInclude pulls an artifact with a single layer holding the file, such as one pushed with
+// "oras push <ref> config.yaml". Credentials are read from the docker config.
+func fetchOCIInclude(ctx context.Context, ref string) ([]byte, error) {
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference: %w", err)
+	}
+
+	img, err := remote.Image(r, remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull: %w", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layers: %w", err)
+	}
+
+	if len(layers) != 1 {
+		return nil, fmt.Errorf("artifact must have a single layer, found %d", len(layers))
+	}
+
+	// The layer is the file as pushed, so is read without decompressing it.
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layer: %w", err)
+	}
+
+	defer rc.Close()
+
+	raw, err := readLimited(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layer: %w", err)
+	}
+
+	return raw, nil
+}
+
+// readLimited reads a remote include, failing rather than truncating files larger than maxIncludeSize.
+func readLimited(r io.Reader) ([]byte, error) {
+	raw, err := io.ReadAll(io.LimitReader(r, maxIncludeSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) > maxIncludeSize {
+		return nil, fmt.Errorf("file exceeds %d bytes", maxIncludeSize)
+	}
+
+	return raw, nil
+}
+
+// remoteCommands describes the local commands run by the deployments of a remote include, such as
+// `deployment "app" has hooks`, or returns an empty string if there are none. Templating counts as well, as templates
+// read local environment variables and git metadata. Remote includes that are not pinned by digest may change without
+// notice, so may not run local commands.
+func remoteCommands(cfg *v1alpha2.Config) string {
+	for _, deployment := range cfg.Deployments {
+		found := func(what string) string {
+			return fmt.Sprintf("deployment %q has %s, which run local commands", deployment.Name, what)
+		}
+
+		if deployment.Templating {
+			return fmt.Sprintf("deployment %q uses templating, which reads the local environment", deployment.Name)
+		}
+
+		if hasHooks(deployment.Hooks) {
+			return found("hooks")
+		}
+
+		images := slices.Clone(deployment.Images)
+
+		for _, profile := range deployment.Profiles {
+			images = append(images, profile.Images...)
+		}
+
+		for _, image := range images {
+			if image.Custom != nil || image.Nix != nil || image.Bazel != nil {
+				return found("custom, Nix or Bazel builds")
+			}
+		}
+
+		for _, step := range deployment.Steps {
+			if hasHooks(step.Hooks) {
+				return found("hooks")
+			}
+
+			for _, probe := range step.Verify {
+				if probe.Exec != nil {
+					return found("exec probes")
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+func hasHooks(hooks *v1alpha2.Hooks) bool {
+	return hooks != nil && len(hooks.PreBuild)+len(hooks.PostBuild)+len(hooks.PostReconcile) > 0
+}
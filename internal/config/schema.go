@@ -0,0 +1,95 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+)
+
+// SchemaKey is the top-level key editors use to find the JSON Schema of a file. It is ignored when loading configs.
+const SchemaKey = "$schema"
+
+// JSONSchema returns a JSON Schema of config files of the version, such as "v1alpha2", derived from the schema of the
+// config CRD, so that editors can complete and validate them. Unlike the CRD, objects reject unknown fields.
+func JSONSchema(version string) ([]byte, error) {
+	props, err := crdSchema(version)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(props)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+
+	var schema map[string]any
+
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schema: %w", err)
+	}
+
+	closeObjects(schema)
+
+	properties, _ := schema["properties"].(map[string]any)
+	if properties == nil {
+		return nil, fmt.Errorf("config schema has no properties")
+	}
+
+	properties[SchemaKey] = map[string]any{
+		"type":        "string",
+		"description": "The JSON Schema of the file, used by editors.",
+	}
+
+	properties["apiVersion"] = map[string]any{
+		"type": "string",
+		"enum": []string{v1alpha2.GroupVersion.Group + "/" + version},
+	}
+
+	properties["kind"] = map[string]any{
+		"type": "string",
+		"enum": []string{"Config"},
+	}
+
+	// Included files only add to the clusters of the main config, so may leave out the clusters and default cluster.
+	required, _ := schema["required"].([]any)
+	required = slices.DeleteFunc(required, func(field any) bool {
+		return field == "clusters" || field == "defaultCluster"
+	})
+
+	schema["required"] = append([]any{"apiVersion", "kind"}, required...)
+
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "localflux config"
+
+	out, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+
+	return out, nil
+}
+
+// closeObjects disallows additional properties on the objects of the schema that list their properties, unless they
+// preserve unknown fields.
+func closeObjects(node any) {
+	switch n := node.(type) {
+	case map[string]any:
+		_, hasProperties := n["properties"]
+		_, hasAdditional := n["additionalProperties"]
+		preserve, _ := n["x-kubernetes-preserve-unknown-fields"].(bool)
+
+		if hasProperties && !hasAdditional && !preserve {
+			n["additionalProperties"] = false
+		}
+
+		for _, child := range n {
+			closeObjects(child)
+		}
+	case []any:
+		for _, child := range n {
+			closeObjects(child)
+		}
+	}
+}
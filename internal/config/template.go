@@ -0,0 +1,291 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+)
+
+var ErrInvalidTemplate = errors.New("invalid template")
+
+// templateFuncs are the sprig functions, without those reading the environment, which templates may only read through
+// the allowed variables of .Env.
+var templateFuncs = func() template.FuncMap {
+	funcs := sprig.TxtFuncMap()
+
+	delete(funcs, "env")
+	delete(funcs, "expandenv")
+
+	return funcs
+}()
+
+// TemplateData is available to the templates of a deployment.
+type TemplateData struct {
+	Env        map[string]string
+	Git        GitInfo
+	Profile    string
+	Cluster    string
+	Deployment string
+}
+
+// GitInfo describes the git repository of the config. The fields are empty outside a repository.
+type GitInfo struct {
+	Commit      string
+	ShortCommit string
+	Branch      string
+	// Tag is the tag pointing at the commit, if any.
+	Tag   string
+	Dirty bool
+}
+
+// NewTemplateData returns the data for templates of the deployment, reading git metadata from the directory. Only the
+// listed environment variables are available.
+func NewTemplateData(
+	ctx context.Context,
+	dir string,
+	envNames []string,
+	deployment string,
+	profile string,
+	cluster string,
+) *TemplateData {
+	env := make(map[string]string, len(envNames))
+
+	for _, name := range envNames {
+		if v, ok := os.LookupEnv(name); ok {
+			env[name] = v
+		}
+	}
+
+	git := func(args ...string) string {
+		out, err := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...).Output()
+		if err != nil {
+			return ""
+		}
+
+		return strings.TrimSpace(string(out))
+	}
+
+	info := GitInfo{
+		Commit: git("rev-parse", "HEAD"),
+	}
+
+	if info.Commit != "" {
+		info.ShortCommit = git("rev-parse", "--short=12", "HEAD")
+		info.Branch = git("rev-parse", "--abbrev-ref", "HEAD")
+		info.Tag = git("describe", "--tags", "--exact-match", "HEAD")
+		info.Dirty = git("status", "--porcelain") != ""
+	}
+
+	return &TemplateData{
+		Env:        env,
+		Git:        info,
+		Profile:    profile,
+		Cluster:    cluster,
+		Deployment: deployment,
+	}
+}
+
+// RenderTemplates returns a copy of the deployment with its string values rendered, and the steps and images whose
+// condition is false removed. Deployments without templating are returned as is.
+func RenderTemplates(deployment Deployment, data *TemplateData) (Deployment, error) {
+	if !deployment.Templating {
+		return deployment, nil
+	}
+
+	var doc any
+
+	if err := convertJSON(deployment, &doc); err != nil {
+		return nil, err
+	}
+
+	doc, err := walkStrings(doc, func(value string) (string, error) {
+		return renderTemplate(value, data)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("deployment %q: %w", deployment.Name, err)
+	}
+
+	var out v1alpha2.Deployment
+
+	if err := convertJSON(doc, &out); err != nil {
+		return nil, err
+	}
+
+	var images []*v1alpha2.Image
+
+	// The steps and images keep their order, so the conditions are matched up by index.
+	for i, image := range out.Images {
+		ok, err := evalCondition(deployment.Images[i].When, image.When)
+		if err != nil {
+			return nil, fmt.Errorf("deployment %q: image %q: %w", out.Name, image.Image, err)
+		}
+
+		if ok {
+			images = append(images, image)
+		}
+	}
+
+	var (
+		steps   []*v1alpha2.Step
+		skipped []string
+	)
+
+	for i, step := range out.Steps {
+		ok, err := evalCondition(deployment.Steps[i].When, step.When)
+		if err != nil {
+			return nil, fmt.Errorf("deployment %q: step %q: %w", out.Name, step.Name, err)
+		}
+
+		if ok {
+			steps = append(steps, step)
+		} else {
+			skipped = append(skipped, step.Name)
+		}
+	}
+
+	for _, step := range steps {
+		step.DependsOn = slices.DeleteFunc(step.DependsOn, func(name string) bool {
+			return slices.Contains(skipped, name)
+		})
+	}
+
+	out.Images = images
+	out.Steps = steps
+
+	return &out, nil
+}
+
+// CheckTemplates returns the errors parsing the templates of the deployment.
+func CheckTemplates(deployment Deployment) []error {
+	var doc any
+
+	if err := convertJSON(deployment, &doc); err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+
+	_, _ = walkStrings(doc, func(value string) (string, error) {
+		if _, err := parseTemplate(value); err != nil {
+			errs = append(errs, err)
+		}
+
+		return value, nil
+	})
+
+	return errs
+}
+
+func parseTemplate(value string) (*template.Template, error) {
+	tmpl, err := template.New("").Funcs(templateFuncs).Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrInvalidTemplate, value, err)
+	}
+
+	return tmpl, nil
+}
+
+func renderTemplate(value string, data *TemplateData) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+
+	tmpl, err := parseTemplate(value)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("%w: %q: %w", ErrInvalidTemplate, value, err)
+	}
+
+	return out.String(), nil
+}
+
+// evalCondition reports whether the condition holds once rendered. Steps and images without a condition are kept, while
+// conditions rendering as an empty string, e.g. from an "if" without an "else", do not hold.
+func evalCondition(condition string, rendered string) (bool, error) {
+	if condition == "" {
+		return true, nil
+	}
+
+	switch strings.TrimSpace(rendered) {
+	case "true":
+		return true, nil
+	case "false", "":
+		return false, nil
+	default:
+		return false, fmt.Errorf("%w: condition rendered as %q, expected true or false", ErrInvalidTemplate, rendered)
+	}
+}
+
+// walkStrings replaces each string within the decoded JSON document, including the keys of objects.
+func walkStrings(doc any, fn func(string) (string, error)) (any, error) {
+	switch value := doc.(type) {
+	case string:
+		return fn(value)
+
+	case []any:
+		for i, item := range value {
+			rendered, err := walkStrings(item, fn)
+			if err != nil {
+				return nil, err
+			}
+
+			value[i] = rendered
+		}
+
+		return value, nil
+
+	case map[string]any:
+		out := make(map[string]any, len(value))
+
+		for k, item := range value {
+			key, err := fn(k)
+			if err != nil {
+				return nil, err
+			}
+
+			rendered, err := walkStrings(item, fn)
+			if err != nil {
+				return nil, err
+			}
+
+			out[key] = rendered
+		}
+
+		return out, nil
+
+	default:
+		return doc, nil
+	}
+}
+
+func convertJSON(in any, out any) error {
+	raw, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to encode: %w", err)
+	}
+
+	// Numbers are kept as written, rather than as floats, so that integers survive the round trip.
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	if err := dec.Decode(out); err != nil {
+		return fmt.Errorf("failed to decode: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	"sigs.k8s.io/yaml"
+)
+
+// UserConfigPath returns the path of the user config, "localflux/config.yaml" within $XDG_CONFIG_HOME, or ~/.config
+// when it is not set.
+func UserConfigPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find home directory: %w", err)
+		}
+
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "localflux", "config.yaml"), nil
+}
+
+// LoadUser loads the user config, returning an empty config if there is none.
+func LoadUser() (UserConfig, error) {
+	path, err := UserConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &v1alpha2.UserConfig{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read user config: %w", err)
+	}
+
+	var w Wrapper
+
+	if err := yaml.Unmarshal(raw, &w); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user config: %w", err)
+	}
+
+	if gvk := w.GroupVersionKind(); gvk.GroupVersion() != v1alpha2.GroupVersion || gvk.Kind != "UserConfig" {
+		return nil, fmt.Errorf("%w: %s: %s", ErrUnknownVersion, path, gvk)
+	}
+
+	var user v1alpha2.UserConfig
+
+	if err := yaml.UnmarshalStrict(raw, &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user config %s: %w", path, err)
+	}
+
+	return &user, nil
+}
+
+// mergeUser merges the user config beneath the project config. Clusters of the user are added unless the project
+// defines a cluster of the same name, and the buildkit settings of the user fill those unset by each cluster.
+func mergeUser(cfg *v1alpha2.Config, user *v1alpha2.UserConfig) {
+	for _, cluster := range user.Clusters {
+		if !hasCluster(cfg, cluster.Name) {
+			cfg.Clusters = append(cfg.Clusters, cluster.DeepCopy())
+		}
+	}
+
+	if user.BuildKit != nil {
+		for _, cluster := range cfg.Clusters {
+			if cluster.BuildKit == nil {
+				cluster.BuildKit = &v1alpha2.BuildKit{}
+			}
+
+			mergeBuildKit(cluster.BuildKit, user.BuildKit)
+		}
+	}
+
+	if cfg.Telemetry == nil && user.Telemetry != nil {
+		cfg.Telemetry = user.Telemetry.DeepCopy()
+	}
+}
+
+func mergeBuildKit(dst *v1alpha2.BuildKit, src *v1alpha2.BuildKit) {
+	if dst.Address == "" {
+		dst.Address = src.Address
+	}
+
+	if dst.Backend == "" {
+		dst.Backend = src.Backend
+	}
+
+	if dst.DockerConfig == "" {
+		dst.DockerConfig = src.DockerConfig
+	}
+
+	if dst.Export == "" {
+		dst.Export = src.Export
+	}
+
+	if dst.RegistryAuthTLSContext == nil {
+		dst.RegistryAuthTLSContext = src.RegistryAuthTLSContext
+	}
+}
+
+func hasCluster(cfg *v1alpha2.Config, name string) bool {
+	for _, cluster := range cfg.Clusters {
+		if cluster.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,91 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConvertTo converts the config to the hub version. Fields that are unchanged between the versions are copied through
+// their JSON encoding, while the moved fields are converted explicitly.
+func (src *Config) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1alpha2.Config)
+	if !ok {
+		return fmt.Errorf("unsupported conversion to %T", dstRaw)
+	}
+
+	if err := convertJSON(src, dst); err != nil {
+		return err
+	}
+
+	dst.APIVersion = v1alpha2.GroupVersion.String()
+
+	if src.DefaultInterval != nil {
+		dst.Defaults = &v1alpha2.Defaults{
+			Interval: src.DefaultInterval.DeepCopy(),
+		}
+	}
+
+	for i, cluster := range src.Clusters {
+		if cluster == nil || cluster.SSH == nil {
+			continue
+		}
+
+		if dst.Clusters[i].Minikube == nil {
+			dst.Clusters[i].Minikube = &v1alpha2.Minikube{}
+		}
+
+		dst.Clusters[i].Minikube.SSH = &v1alpha2.SSH{
+			Address: cluster.SSH.Address,
+		}
+	}
+
+	return nil
+}
+
+// ConvertFrom converts the config from the hub version. The default profile has no equivalent in this version, so is
+// dropped.
+func (dst *Config) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1alpha2.Config)
+	if !ok {
+		return fmt.Errorf("unsupported conversion from %T", srcRaw)
+	}
+
+	if err := convertJSON(src, dst); err != nil {
+		return err
+	}
+
+	dst.APIVersion = GroupVersion.String()
+
+	if src.Defaults != nil && src.Defaults.Interval != nil {
+		dst.DefaultInterval = src.Defaults.Interval.DeepCopy()
+	}
+
+	for i, cluster := range src.Clusters {
+		if cluster == nil || cluster.Minikube == nil || cluster.Minikube.SSH == nil {
+			continue
+		}
+
+		dst.Clusters[i].SSH = &SSH{
+			Address: cluster.Minikube.SSH.Address,
+		}
+	}
+
+	return nil
+}
+
+// convertJSON copies the fields shared by the versions, ignoring those only the source has.
+func convertJSON(src any, dst any) error {
+	raw, err := json.Marshal(src)
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+
+	return nil
+}
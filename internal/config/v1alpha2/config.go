@@ -0,0 +1,1166 @@
+// +kubebuilder:object:generate=true
+// +groupName=flux.local
+package v1alpha2
+
+import (
+	"github.com/fluxcd/pkg/apis/kustomize"
+	"github.com/fluxcd/pkg/apis/meta"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is group version used to register these objects.
+	GroupVersion = schema.GroupVersion{Group: "flux.local", Version: "v1alpha2"}
+
+	// SchemeBuilder is used to add go types to the GroupVersionKind scheme.
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the types in this group-version to the given scheme.
+	AddToScheme = SchemeBuilder.AddToScheme
+)
+
+func init() {
+	SchemeBuilder.Register(&Config{}, &ConfigList{})
+}
+
+// Config represents the project config. It is the version configs of other versions are converted to when loaded.
+//
+// +kubebuilder:object:root=true
+// +kubebuilder:storageversion
+type Config struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// DefaultCluster is the name of the cluster to use if one is not specified.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	DefaultCluster string `json:"defaultCluster"`
+
+	// Defaults apply to all deployments and steps, unless overridden by them.
+	// +optional
+	Defaults *Defaults `json:"defaults"`
+
+	// Clusters is the list of clusters to connect to.
+	// +kubebuilder:validation:MinItems=1
+	Clusters []*Cluster `json:"clusters"`
+
+	// Deployments contains the list of possible deployments.
+	// +optional
+	Deployments []*Deployment `json:"deployments"`
+
+	// Telemetry exports traces of builds and deployments to an OpenTelemetry collector.
+	// +optional
+	Telemetry *Telemetry `json:"telemetry"`
+
+	// Include lists globs of additional config files, relative to this file, whose clusters and deployments are merged
+	// into this config. Included files may only set clusters, deployments and further includes. Paths within local
+	// included files are relative to the included file. Entries may also be "https://" URLs, optionally pinned with a
+	// "#sha256=<hex>" suffix, or "oci://" references to artifacts with a single layer holding the file, optionally
+	// pinned by digest. Remote files are cached until fetched again with --refresh, and may only include other remote
+	// files. Remote files that run local commands, through hooks, custom, Nix or Bazel builds or exec probes, or that
+	// use templating, must be pinned.
+	// +optional
+	Include []string `json:"include"`
+
+	// Dir is the directory of the config file, which relative paths are resolved against. It is set when loaded.
+	Dir string `json:"-"`
+}
+
+// Defaults are the settings shared by all deployments and steps.
+type Defaults struct {
+	// Namespace is the namespace of steps, and of port forwards other than those of the namespace kind, that do not
+	// set one.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	Namespace string `json:"namespace"`
+	// Interval is the reconciliation interval of the Flux objects created for each step, unless overridden by the
+	// step. Defaults to one minute, or five minutes for helm repositories.
+	// +optional
+	Interval *metav1.Duration `json:"interval"`
+	// Timeout bounds each attempt at reconciling a step, unless overridden by the step. Defaults to 30 seconds.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout"`
+	// IncludePaths are used by images, and kustomize and helm steps, that set neither include nor exclude paths.
+	// +optional
+	IncludePaths []string `json:"includePaths"`
+	// ExcludePaths are used by images, and kustomize and helm steps, that set neither include nor exclude paths.
+	// +optional
+	ExcludePaths []string `json:"excludePaths"`
+	// Registry is where compose steps push the images of their services, unless they set their own. Defaults to the
+	// cluster registry.
+	// +optional
+	Registry string `json:"registry"`
+	// Profile is applied to the deployments that define it when no profile is selected on the command line.
+	// +optional
+	Profile string `json:"profile"`
+	// TemplateEnv lists the environment variables that the templates of deployments may read through .Env. Other
+	// variables are not available to templates.
+	// +optional
+	TemplateEnv []string `json:"templateEnv"`
+}
+
+// Telemetry configures the export of traces over OTLP.
+type Telemetry struct {
+	// Endpoint is the host and port of the collector, such as "localhost:4317".
+	// +kubebuilder:validation:MinLength=1
+	Endpoint string `json:"endpoint"`
+	// Protocol is the OTLP transport to use. Defaults to grpc.
+	// +kubebuilder:validation:Enum=grpc;http
+	// +optional
+	Protocol string `json:"protocol"`
+	// Insecure disables TLS when connecting to the collector.
+	// +optional
+	Insecure bool `json:"insecure"`
+	// Headers are sent with every export, for example to authenticate with a hosted collector.
+	// +optional
+	Headers map[string]string `json:"headers"`
+	// ServiceName is the service traces are reported under. Defaults to "localflux".
+	// +optional
+	ServiceName string `json:"serviceName"`
+}
+
+// ConfigList contains a list of Config
+//
+// +kubebuilder:object:root=true
+type ConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Config `json:"items"`
+}
+
+// Cluster represents a kubernetes cluster. At present only Minikube is supported.
+type Cluster struct {
+	// Name is the cluster name.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+	// Minikube provides configuration for automatically starting a Minikube cluster.
+	// +optional
+	Minikube *Minikube `json:"minikube"`
+	// BuildKit controls how images are built.
+	// +optional
+	BuildKit *BuildKit `json:"buildkit"`
+	// +optional
+	KubeConfig string `json:"kubeConfig"`
+	// Relay provides port-forwarding capabilities.
+	// +optional
+	Relay *Relay `json:"relay"`
+	// Notifications configure Flux to send alerts about localflux-created resources, so that reconcile failures are
+	// reported even when the CLI is not running.
+	// +optional
+	Notifications []*Notification `json:"notifications"`
+	// RegistryMirror deploys pull-through caches for upstream registries, so that base images are not downloaded
+	// again after pod restarts or the cluster being recreated.
+	// +optional
+	RegistryMirror *RegistryMirror `json:"registryMirror"`
+	// Webhook deploys a validating admission webhook that rejects flux.local deployments with malformed port forwards,
+	// or forwards colliding with those of other deployments, protecting the relay from objects written by other tools.
+	// +optional
+	Webhook *Webhook `json:"webhook"`
+}
+
+// Webhook configures the admission webhook of the flux.local CRDs.
+type Webhook struct {
+	// Enabled causes the webhook to be deployed when the cluster is started, and removed otherwise.
+	Enabled bool `json:"enabled"`
+	// FailurePolicy is "Ignore" to admit objects while the webhook is unavailable, or "Fail" to reject them. Defaults
+	// to Ignore, so that deployments are not blocked while the webhook starts.
+	// +kubebuilder:validation:Enum=Ignore;Fail
+	// +optional
+	FailurePolicy string `json:"failurePolicy"`
+}
+
+// RegistryMirror configures in-cluster pull-through caches.
+type RegistryMirror struct {
+	// Enabled causes the caches to be deployed and the container runtime configured to pull through them.
+	Enabled bool `json:"enabled"`
+	// Registries are the upstream registries to cache. Defaults to Docker Hub and ghcr.io. The docker container
+	// runtime only supports mirroring Docker Hub, use "--container-runtime=containerd" to mirror other registries.
+	// +optional
+	Registries []*MirroredRegistry `json:"registries"`
+}
+
+// MirroredRegistry is an upstream registry to cache.
+type MirroredRegistry struct {
+	// Host is the registry hostname as used in image references, such as "docker.io".
+	// +kubebuilder:validation:MinLength=1
+	Host string `json:"host"`
+	// URL is the upstream registry. Defaults to "https://<host>", or to the Docker Hub registry for "docker.io".
+	// +optional
+	URL string `json:"url"`
+}
+
+// Notification configures a Flux notification provider and an alert routed to it.
+type Notification struct {
+	// Name identifies the provider and alert.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+	// Type is the kind of service to notify.
+	// +kubebuilder:validation:Enum=slack;discord;generic
+	Type string `json:"type"`
+	// Address is the webhook URL. Use secretRef instead to keep the URL out of the config.
+	// +optional
+	Address string `json:"address"`
+	// SecretRef names a secret in the localflux namespace holding the webhook URL under the "address" key.
+	// +optional
+	SecretRef string `json:"secretRef"`
+	// Channel overrides the channel posted to, where supported.
+	// +optional
+	Channel string `json:"channel"`
+	// Severity filters the events sent. Defaults to error.
+	// +kubebuilder:validation:Enum=info;error
+	// +optional
+	Severity string `json:"severity"`
+}
+
+// SSH configures a remote host. Experimental.
+type SSH struct {
+	Address string `json:"address"`
+}
+
+// Minikube configures a local minikube cluster.
+type Minikube struct {
+	// Profile maps to "minikube --profile"
+	// +optional
+	Profile string `json:"profile"`
+	// SSH runs minikube on a remote host via SSH. Experimental.
+	// +optional
+	SSH *SSH `json:"ssh"`
+	// RegistryAliases is a list of hostnames to alias to the internal cluster registry.
+	// +optional
+	RegistryAliases []string `json:"registryAliases"`
+	// Addons is a list of minikube addons to enable.
+	// +optional
+	Addons []string `json:"addons"`
+	// CNI enables the provided CNI plugin. Necessary for netpols.
+	// +optional
+	CNI string `json:"cni"`
+	// CustomArgs are raw arguments to pass to the minikube start command.
+	// +optional
+	CustomArgs []string `json:"customArgs"`
+}
+
+// BuildKit configures image building.
+type BuildKit struct {
+	// The buildkit builder address.
+	// +optional
+	Address string `json:"address"`
+	// Backend selects where images are built. "buildkit" uses the buildkit address, or the buildkit daemon within the
+	// cluster. "container" runs a buildkit container on the local Docker host, kept between builds and removed with
+	// "localflux cluster remove-builder". "docker" uses the buildkit embedded in the local Docker daemon. Both push the
+	// result to the cluster registry from the host. "cluster" deploys buildkitd as a StatefulSet in the localflux
+	// namespace and connects to it through a port-forward, for clusters whose nodes do not provide buildkit. Defaults
+	// to "auto", which uses buildkit and falls back to a container when no address is set, and then to Docker, if
+	// buildkit is unreachable.
+	// +kubebuilder:validation:Enum=auto;buildkit;container;docker;cluster
+	// +optional
+	Backend string `json:"backend"`
+	// Rootless runs the buildkitd of the "cluster" backend unprivileged. The nodes must allow unprivileged user
+	// namespaces.
+	// +optional
+	Rootless bool `json:"rootless"`
+	// +optional
+	RegistryAuthTLSContext []string `json:"registryAuthTLSContext"`
+	// +optional
+	DockerConfig string `json:"dockerConfig"`
+	// Export controls how built images reach the cluster. "registry" pushes them to the cluster registry. "node" loads
+	// them straight into the container runtime of the node, bypassing the registry, and references them by tag. Images
+	// that custom builds push themselves, Bazel images, and the manifests and charts of steps always go through the
+	// registry. Defaults to "registry".
+	// +kubebuilder:validation:Enum=registry;node
+	// +optional
+	Export string `json:"export"`
+}
+
+// Relay configures port-forwarding.
+type Relay struct {
+	// Enabled causes the port forwarding in-cluster components to be deployed, alongside a docker container on the
+	// host to handle relaying.
+	Enabled bool `json:"enabled"`
+	// DisableClient prevents the host-side docker container being created. Use "localflux relay" instead.
+	// +optional
+	DisableClient bool `json:"disableClient"`
+	// ClusterNetworking controls whether to use host or cluster networking for the cluster side relay server.
+	// +optional
+	ClusterNetworking bool `json:"clusterNetworking"`
+	// Mode is "deployment" to run the relay server as a deployment, or "daemonset" to run it on every node. The client
+	// picks a ready relay pod, and fails over to another once its pod stops. Defaults to deployment.
+	// +kubebuilder:validation:Enum=deployment;daemonset
+	// +optional
+	Mode string `json:"mode"`
+	// Replicas is the number of relay servers in the deployment mode. With host networking, each replica needs its
+	// own node. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas *int `json:"replicas"`
+	// Transport is how the relay client reaches the relay server. "portForward" tunnels through the API server, while
+	// "websocket" connects to a WebSocket endpoint of the relay server instead, for networks that break
+	// port-forwarding. Defaults to portForward.
+	// +kubebuilder:validation:Enum=portForward;websocket
+	// +optional
+	Transport string `json:"transport"`
+	// WebSocket configures the WebSocket endpoint of the websocket transport.
+	// +optional
+	WebSocket *RelayWebSocket `json:"webSocket"`
+	// DNS runs a DNS server in the relay client that resolves forwarded services to loopback addresses.
+	// +optional
+	DNS *RelayDNS `json:"dns"`
+	// Hosts adds the hostnames of Ingress resources created by deployments to the hosts file while the relay runs.
+	// +optional
+	Hosts *RelayHosts `json:"hosts"`
+	// HTTPProxy serves the HTTP services of the cluster on a single local port, routing by host.
+	// +optional
+	HTTPProxy *RelayHTTPProxy `json:"httpProxy"`
+	// BindAddress is the local address forwards are served on, unless set by the forward. Defaults to 127.0.0.1, so
+	// that cluster services are not exposed to the network. IPv6 addresses are supported, e.g. "::1".
+	// +optional
+	BindAddress string `json:"bindAddress"`
+	// PortForward lists ports that are always forwarded while the relay runs, independently of deployments, e.g.
+	// dashboards or shared databases.
+	// +optional
+	PortForward []*PortForward `json:"portForward"`
+}
+
+// RelayWebSocket exposes the WebSocket endpoint of the relay server through a NodePort service, and optionally an
+// ingress. The endpoint requires a token, which the client reads from the cluster.
+type RelayWebSocket struct {
+	// NodePort is the node port of the endpoint. Assigned by Kubernetes when unset.
+	// +kubebuilder:validation:Minimum=30000
+	// +kubebuilder:validation:Maximum=32767
+	// +optional
+	NodePort *int `json:"nodePort"`
+	// Host creates an ingress routing the host to the endpoint, e.g. "relay.dev.example.com".
+	// +optional
+	Host string `json:"host"`
+	// IngressClassName is the class of the ingress. Defaults to the default class of the cluster.
+	// +optional
+	IngressClassName string `json:"ingressClassName"`
+	// URL is the URL the client connects to, e.g. "wss://relay.dev.example.com/tunnel". Defaults to the host of the
+	// ingress when set, or otherwise the node port of the first ready node.
+	// +optional
+	URL string `json:"url"`
+}
+
+// RelayHTTPProxy routes requests for "<service>.<namespace>.<domain>" and "<service>.<namespace>.svc.cluster.local"
+// to the port named "http" of the service, or otherwise its first TCP port, through the relay. Websockets and other
+// upgraded connections are supported.
+type RelayHTTPProxy struct {
+	Enabled bool `json:"enabled"`
+	// Address is the address the proxy listens on. Defaults to 127.0.0.1:8080.
+	// +optional
+	Address string `json:"address"`
+	// Domain is the domain of hosts. Defaults to "localhost", which browsers resolve to loopback without any
+	// configuration, e.g. "http://web.default.localhost:8080".
+	// +optional
+	Domain string `json:"domain"`
+}
+
+// RelayHosts maintains a block of hosts file entries for the Ingress hosts of deployments, pointing at the forwarded
+// ingress controller. Forward the controller to local port 80 for plain hostnames to work in a browser. Wildcard hosts
+// are skipped.
+type RelayHosts struct {
+	Enabled bool `json:"enabled"`
+	// Address the hostnames resolve to. Defaults to 127.0.0.1.
+	// +optional
+	Address string `json:"address"`
+}
+
+// RelayDNS resolves "<name>.<namespace>.svc.cluster.local" for forwarded services, and "<name>.<namespace>.<domain>"
+// for all forwards, to a loopback address per forward. The forward is also served on that address at its cluster
+// port, so that apps can use real service names locally. Loopback addresses other than 127.0.0.1 require Linux, or
+// aliases on the loopback interface.
+type RelayDNS struct {
+	Enabled bool `json:"enabled"`
+	// Address is the address the DNS server listens on. Defaults to 127.0.0.1:5353.
+	// +optional
+	Address string `json:"address"`
+	// Domain is the development domain to serve alongside cluster.local. Defaults to "localflux".
+	// +optional
+	Domain string `json:"domain"`
+	// RegisterResolver registers the server as the system resolver for its zones, using /etc/resolver on macOS and
+	// resolvectl on Linux, while the relay runs. Requires running "localflux relay" on the host as root.
+	// +optional
+	RegisterResolver bool `json:"registerResolver"`
+}
+
+// Deployment is a single deployment with multiple steps.
+type Deployment struct {
+	// Name is the deployment name. Used to specify this deployment from the command line. Localflux relies on this
+	// being a stable identifier.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+	// Templating evaluates the string values of the deployment as Go templates when it is deployed, such as
+	// "{{ .Env.REGISTRY }}/app:{{ .Git.ShortCommit }}". Templates can read the environment variables listed by
+	// defaults.templateEnv (.Env), the git repository of the config (.Git.Commit, .Git.ShortCommit, .Git.Branch,
+	// .Git.Tag and .Git.Dirty), the selected profile (.Profile), the cluster (.Cluster) and the deployment name
+	// (.Deployment), and use the sprig functions other than env and expandenv. Write "{{ `{{` }}" for a literal "{{",
+	// such as within helm values. Commands that describe a deployment without deploying it, such as graph, lint and
+	// env, render the templates without a profile.
+	// +optional
+	Templating bool `json:"templating"`
+	// Extends names a deployment to inherit from. Its images, steps, port forwards, reverse forwards and profiles are
+	// inherited, with entries of this deployment replacing those of the same image, name or local port, and the rest
+	// appended. Hooks are appended to the inherited hooks. The inherited deployment may itself extend another.
+	// +optional
+	Extends string `json:"extends"`
+	// Exclude leaves out entries inherited through extends.
+	// +optional
+	Exclude *Exclusions `json:"exclude"`
+	// Images is a list of images to build.
+	// +optional
+	Images []*Image `json:"images"`
+	// Steps are a list of actions to perform in order.
+	// +optional
+	Steps []*Step `json:"steps"`
+	// PortForward is a list of ports to forward to the cluster.
+	// +optional
+	PortForward []*PortForward `json:"portForward"`
+	// ReverseForward is a list of ports on the host to expose within the cluster, such as an app running locally in a
+	// debugger that in-cluster services call. Requires the relay.
+	// +optional
+	ReverseForward []*ReverseForward `json:"reverseForward"`
+	// Hooks are local commands to run during the deployment.
+	// +optional
+	Hooks *Hooks `json:"hooks"`
+	// Profiles are named variations of the deployment, selected from the command line.
+	// +optional
+	Profiles []*Profile `json:"profiles"`
+	// Sign signs the manifests and charts pushed for the steps with cosign, optionally configuring Flux to verify
+	// them before they are applied.
+	// +optional
+	Sign *Signing `json:"sign"`
+}
+
+// Exclusions name the inherited entries to leave out of a deployment.
+type Exclusions struct {
+	// Images are the names of the inherited images to leave out.
+	// +optional
+	Images []string `json:"images"`
+	// Steps are the names of the inherited steps to leave out. Remaining steps must not depend on them.
+	// +optional
+	Steps []string `json:"steps"`
+	// PortForwards are the local ports of the inherited port forwards to leave out.
+	// +optional
+	PortForwards []int `json:"portForwards"`
+}
+
+// Signing configures signing with cosign. The cosign CLI is required.
+type Signing struct {
+	// Key is the private key to sign with, as a path or a cosign KMS URI. COSIGN_PASSWORD is used to decrypt it.
+	// Either key or keyless must be set.
+	// +optional
+	Key string `json:"key"`
+	// Keyless signs with a short-lived certificate, issued after authenticating with an OIDC provider.
+	// +optional
+	Keyless bool `json:"keyless"`
+	// Verify configures Flux to verify the signatures of step artifacts. Only supported on deployments.
+	// +optional
+	Verify *SignatureVerification `json:"verify"`
+}
+
+// SignatureVerification configures how Flux verifies signatures.
+type SignatureVerification struct {
+	// PublicKey is the path of the public key matching the signing key.
+	// +optional
+	PublicKey string `json:"publicKey"`
+	// Issuer is a regular expression matched against the OIDC issuer of keyless signatures.
+	// +optional
+	Issuer string `json:"issuer"`
+	// Subject is a regular expression matched against the identity of keyless signatures.
+	// +optional
+	Subject string `json:"subject"`
+}
+
+// Profile overrides parts of a deployment when selected.
+type Profile struct {
+	// Name is the profile name.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Images replace the deployment image with the same name, or are added if no such image exists.
+	// +optional
+	Images []*Image `json:"images"`
+	// Steps modify the deployment step with the same name.
+	// +optional
+	Steps []*ProfileStep `json:"steps"`
+}
+
+// ProfileStep modifies a single step when a profile is selected.
+type ProfileStep struct {
+	// Name of the step to modify.
+	Name string `json:"name"`
+	// Substitute is merged into the kustomize substitutions.
+	// +optional
+	Substitute map[string]string `json:"substitute"`
+	// Values are deep merged into the helm values.
+	// +optional
+	Values *apiextensionsv1.JSON `json:"values"`
+	// ValueFiles are appended to the helm value files.
+	// +optional
+	ValueFiles []string `json:"valueFiles"`
+	// Patches are appended to the step patches.
+	// +optional
+	Patches []kustomize.Patch `json:"patches"`
+}
+
+// Image represents a single image to build.
+type Image struct {
+	// Image is the fully qualified name for the image.
+	Image string `json:"image"`
+	// When is a template deciding whether the image is built. The image is skipped unless it renders as "true".
+	// Requires templating.
+	// +optional
+	When string `json:"when"`
+	// Context is the docker build context directory. Dockerfile builds also accept a git URL, optionally followed by
+	// "#<ref>:<subdir>", which buildkit fetches itself. The Dockerfile is then read from the repository, unless File is
+	// set.
+	// +optional
+	Context string `json:"context"`
+	// +optional
+	IncludePaths []string `json:"includePaths"`
+	// +optional
+	ExcludePaths []string `json:"excludePaths"`
+	// File is the Dockerfile to use inside the context.
+	// +optional
+	File string `json:"file"`
+	// Target is the target inside the Dockerfile to build.
+	// +optional
+	Target string `json:"target"`
+	// BuildArgs are passed to the Dockerfile. Values may reference environment variables as "$VAR" or "${VAR}", and
+	// the computed LOCALFLUX_GIT_SHA, LOCALFLUX_GIT_BRANCH and LOCALFLUX_BUILD_TIMESTAMP values. Use "$$" for a literal
+	// "$". Content hashes are computed from the values as written. Values referencing secrets as
+	// "${secretRef:<source>:<key>}" are passed as secrets of the same name instead, as build args are stored in the
+	// image, and are read with "RUN --mount=type=secret,id=<name>,env=<name>".
+	// +optional
+	BuildArgs map[string]string `json:"buildArgs"`
+	// Secrets are available to RUN instructions of the Dockerfile that mount them with "--mount=type=secret,id=<name>",
+	// without being stored in the image like build args. Values may reference secrets as "${secretRef:<source>:<key>}",
+	// as in kustomize substitutions.
+	// +optional
+	Secrets map[string]string `json:"secrets"`
+	// BuildContexts are additional named contexts the Dockerfile can use with "COPY --from=<name>" or "FROM <name>".
+	// Values are local directories, relative to the working directory, or "docker-image://", "https://" and git
+	// URLs. A name matching an image, such as "alpine:3", replaces that image.
+	// +optional
+	BuildContexts map[string]string `json:"buildContexts"`
+	// Platforms are the platforms to build the image for, such as "linux/arm64". Platforms the buildkit host can not
+	// run natively are emulated with QEMU, which "localflux cluster start" installs into the cluster, and "localflux
+	// doctor --fix" into the buildkit host in use. Multiple platforms produce an image index, which can not be loaded
+	// into the nodes. Defaults to the platform of the buildkit host.
+	// +optional
+	Platforms []string `json:"platforms"`
+	// TagStrategy controls how consumers reference the built image. "digest" pins the image by digest, while
+	// "contentHash", "gitSha" and "timestamp" push and reference a tag instead. Defaults to "digest".
+	// +kubebuilder:validation:Enum=digest;contentHash;gitSha;timestamp
+	// +optional
+	TagStrategy string `json:"tagStrategy"`
+	// SkipUnchanged fingerprints the build context and skips the build entirely when it matches the image last pushed
+	// to the cluster.
+	// +optional
+	SkipUnchanged bool `json:"skipUnchanged"`
+	// PinBaseImages resolves the base images of the Dockerfile to digests on first use and records them in
+	// localflux.pins.yaml, so that builds are reproducible and do not check the upstream registries on every build.
+	// Pins are refreshed with "localflux build update-pins".
+	// +optional
+	PinBaseImages bool `json:"pinBaseImages"`
+	// Buildpacks builds the image with Cloud Native Buildpacks instead of a Dockerfile. The pack CLI and a local Docker
+	// daemon are required.
+	// +optional
+	Buildpacks *Buildpacks `json:"buildpacks"`
+	// Custom builds the image by running a command instead of a Dockerfile, for projects with their own build systems.
+	// +optional
+	Custom *CustomBuild `json:"custom"`
+	// Nix builds the image with nixpacks, or from a Nix flake output, instead of a Dockerfile.
+	// +optional
+	Nix *NixBuild `json:"nix"`
+	// Bazel builds the image with a Bazel target producing an OCI layout, such as an rules_oci oci_image.
+	// +optional
+	Bazel *BazelBuild `json:"bazel"`
+	// Sign signs the pushed image with cosign, storing the signature alongside it in the cluster registry.
+	// +optional
+	Sign *Signing `json:"sign"`
+	// CacheFrom lists build caches to import, so that builds can reuse layers built elsewhere, e.g. in CI.
+	// +optional
+	CacheFrom []*BuildCache `json:"cacheFrom"`
+	// CacheTo lists build caches to export once the image is built.
+	// +optional
+	CacheTo []*BuildCache `json:"cacheTo"`
+}
+
+// Buildpacks configures a Cloud Native Buildpacks build.
+type Buildpacks struct {
+	// Builder is the builder image, e.g. "paketobuildpacks/builder-jammy-base".
+	// +kubebuilder:validation:MinLength=1
+	Builder string `json:"builder"`
+	// Buildpacks replaces the buildpacks of the builder, e.g. "paketo-buildpacks/go".
+	// +optional
+	Buildpacks []string `json:"buildpacks"`
+	// Env sets environment variables for the build, e.g. "BP_GO_TARGETS".
+	// +optional
+	Env map[string]string `json:"env"`
+	// ProcessType is the process the image runs by default, e.g. "web".
+	// +optional
+	ProcessType string `json:"processType"`
+}
+
+// CustomBuild configures an image built by a user supplied command.
+type CustomBuild struct {
+	// Command is run with "sh -c" in the build context, e.g. "make image IMAGE=$IMAGE". The IMAGE, IMAGE_REPO,
+	// IMAGE_TAG, REGISTRY, PLATFORM and BUILD_CONTEXT environment variables describe the image to build. The command
+	// must push IMAGE, unless local is set.
+	// +kubebuilder:validation:MinLength=1
+	Command string `json:"command"`
+	// Env sets additional environment variables for the command.
+	// +optional
+	Env map[string]string `json:"env"`
+	// Local indicates the command leaves the image in the local Docker daemon rather than pushing it, in which case
+	// localflux pushes it to the cluster registry.
+	// +optional
+	Local bool `json:"local"`
+}
+
+// NixBuild configures an image built with Nix.
+type NixBuild struct {
+	// Flake is a flake output building a docker image archive, such as with dockerTools.buildLayeredImage or
+	// dockerTools.streamLayeredImage, e.g. ".#image". Relative paths are resolved against the build context. When
+	// unset, the context is built with nixpacks, which requires a local Docker daemon.
+	// +optional
+	Flake string `json:"flake"`
+	// Env sets environment variables for nixpacks builds.
+	// +optional
+	Env map[string]string `json:"env"`
+}
+
+// BazelBuild configures an image built with Bazel.
+type BazelBuild struct {
+	// Target is the label of a target whose output is an OCI layout, e.g. "//app:image". It is built within the build
+	// context, which must be inside the Bazel workspace.
+	// +kubebuilder:validation:MinLength=1
+	Target string `json:"target"`
+	// Args are extra arguments to "bazel build", e.g. "--config=release".
+	// +optional
+	Args []string `json:"args"`
+}
+
+// BuildCache is a buildkit cache location.
+type BuildCache struct {
+	// Type is the cache backend. "registry" stores the cache as a separate image, "inline" embeds it in the built image
+	// and "local" stores it in a directory on the host.
+	// +kubebuilder:validation:Enum=registry;inline;local
+	Type string `json:"type"`
+	// Ref is the cache image of the registry type, e.g. "ghcr.io/org/app:buildcache". When importing an inline cache,
+	// it is the image to import from, defaulting to the image being built.
+	// +optional
+	Ref string `json:"ref"`
+	// Path is the directory of the local type. When unset, a directory managed by localflux is used, kept per project
+	// and image in the user cache directory so that it outlives the cluster.
+	// +optional
+	Path string `json:"path"`
+	// MaxSize bounds the total size of the managed local caches of the project, e.g. "10Gi". Least recently used
+	// caches are removed once it is exceeded. Defaults to 10Gi.
+	// +optional
+	MaxSize *resource.Quantity `json:"maxSize"`
+	// Mode is "min" to export only the layers of the final image, or "max" to export all intermediate layers too.
+	// Defaults to "min".
+	// +kubebuilder:validation:Enum=min;max
+	// +optional
+	Mode string `json:"mode"`
+	// Attrs are passed to the cache backend as-is, e.g. "registry.insecure" or "compression".
+	// +optional
+	Attrs map[string]string `json:"attrs"`
+}
+
+// Step is a single action inside a deployment. One of kustomize, helm, manifests, git or compose may be specified.
+type Step struct {
+	// Name is the step name.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+	// When is a template deciding whether the step is deployed. The step is skipped unless it renders as "true".
+	// Dependencies on skipped steps are dropped. Requires templating.
+	// +optional
+	When string `json:"when"`
+	// +optional
+	Kustomize *Kustomize `json:"kustomize"`
+	// +optional
+	Helm *Helm `json:"helm"`
+	// +optional
+	Manifests *Manifests `json:"manifests"`
+	// +optional
+	Git *Git `json:"git"`
+	// +optional
+	Compose *Compose `json:"compose"`
+	// Hooks are local commands to run while executing this step.
+	// +optional
+	Hooks *Hooks `json:"hooks"`
+	// Outputs are values captured from the cluster once the step has reconciled. Later steps can reference them in
+	// substitutions and helm values using "${outputs.<step>.<name>}".
+	// +optional
+	Outputs []*Output `json:"outputs"`
+	// Requires lists cluster capabilities the step depends on. Supported values are "cni", "loadBalancer" and
+	// "defaultStorageClass", or an API group name such as "monitoring.coreos.com".
+	// +optional
+	Requires []string `json:"requires"`
+	// Interval is the reconciliation interval of the Flux objects created for this step. Long intervals reduce churn
+	// in stable environments, while short intervals help when images are pushed by tag.
+	// +optional
+	Interval *metav1.Duration `json:"interval"`
+	// Timeout bounds each attempt at reconciling the step while waiting for it. Defaults to 30 seconds.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout"`
+	// Generate builds ConfigMaps and Secrets from local files and literals. Only supported by kustomize and manifests
+	// steps.
+	// +optional
+	Generate *Generate `json:"generate"`
+	// ApplyMode selects how the step is applied. "flux" (the default) pushes the manifests and lets Flux reconcile
+	// them. "direct" renders the manifests locally and applies them with server-side apply, which is faster and works
+	// on clusters without Flux, but does not prune removed objects or wait for health checks.
+	// +kubebuilder:validation:Enum=flux;direct
+	// +optional
+	ApplyMode string `json:"applyMode"`
+	// Verify lists probes that must pass once the step has been deployed, so that a broken app fails the deployment.
+	// +optional
+	Verify []*Probe `json:"verify"`
+	// Retries is the number of times a failed reconcile is retried, with backoff, before the step fails. This helps
+	// with transient failures such as a webhook that is not ready yet.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Retries *int `json:"retries"`
+	// DependsOn names steps of the same deployment that must be deployed first. The generated Flux objects also
+	// declare the dependencies, so that the order holds when Flux reconciles without the CLI.
+	// +optional
+	DependsOn []string `json:"dependsOn"`
+}
+
+// Probe checks that a step works once it has been deployed. One of http, tcp or exec must be specified. Values may
+// reference the variables provided to hooks, such as "${LOCALFLUX_REGISTRY}", and, when relay is set, the local
+// addresses of the deployment's port forwards, such as "${LOCALFLUX_WEB_80_ADDR}".
+type Probe struct {
+	// Name is shown in progress and errors. Defaults to the probe type.
+	// +optional
+	Name string `json:"name"`
+	// +optional
+	HTTP *HTTPProbe `json:"http"`
+	// +optional
+	TCP *TCPProbe `json:"tcp"`
+	// +optional
+	Exec *ExecProbe `json:"exec"`
+	// Relay forwards the deployment's ports through the relay while the probe runs.
+	// +optional
+	Relay bool `json:"relay"`
+	// Retries is the number of further attempts after a failure. Defaults to 10.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Retries *int `json:"retries"`
+	// Interval is the time between attempts. Defaults to two seconds.
+	// +optional
+	Interval *metav1.Duration `json:"interval"`
+	// Timeout bounds each attempt. Defaults to five seconds.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout"`
+}
+
+// HTTPProbe sends a request and checks the response.
+type HTTPProbe struct {
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+	// Method defaults to GET.
+	// +optional
+	Method string `json:"method"`
+	// +optional
+	Headers map[string]string `json:"headers"`
+	// ExpectStatus lists the accepted status codes. Defaults to any 2xx or 3xx code.
+	// +optional
+	ExpectStatus []int `json:"expectStatus"`
+	// ExpectBody must be contained in the response body.
+	// +optional
+	ExpectBody string `json:"expectBody"`
+}
+
+// TCPProbe checks that a connection can be opened.
+type TCPProbe struct {
+	// Address is the "host:port" to connect to.
+	// +kubebuilder:validation:MinLength=1
+	Address string `json:"address"`
+}
+
+// ExecProbe runs a local command, which must exit successfully.
+type ExecProbe struct {
+	// +kubebuilder:validation:MinItems=1
+	Command []string `json:"command"`
+}
+
+// Generate lists the ConfigMaps and Secrets to generate for a step. Generated names are suffixed with a hash of their
+// content and references within the step's manifests are updated, so dependent workloads restart on change.
+type Generate struct {
+	// +optional
+	ConfigMaps []*Generator `json:"configMaps"`
+	// +optional
+	Secrets []*Generator `json:"secrets"`
+}
+
+// Generator describes a single generated ConfigMap or Secret.
+type Generator struct {
+	// Name of the object, before the hash suffix is appended.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Namespace of the object. Defaults to the step namespace.
+	// +optional
+	Namespace string `json:"namespace"`
+	// Files to include, either as "path" or "key=path". The key defaults to the file name.
+	// +optional
+	Files []string `json:"files"`
+	// Literals to include, as "key=value".
+	// +optional
+	Literals []string `json:"literals"`
+	// Envs are env files whose "KEY=value" lines are included as separate keys.
+	// +optional
+	Envs []string `json:"envs"`
+	// Type of the Secret. Defaults to Opaque and is ignored for ConfigMaps.
+	// +optional
+	Type string `json:"type"`
+	// DisableHash keeps the name as given, so workloads are not restarted when the content changes.
+	// +optional
+	DisableHash bool `json:"disableHash"`
+}
+
+// Output captures a single value from a cluster object.
+type Output struct {
+	// Name is the output name.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// APIVersion of the object. Defaults to "v1".
+	// +optional
+	APIVersion string `json:"apiVersion"`
+	// Kind of the object, e.g. Service or Secret.
+	Kind string `json:"kind"`
+	// Namespace of the object. Defaults to the step namespace.
+	// +optional
+	Namespace string `json:"namespace"`
+	// Object is the name of the object.
+	Object string `json:"object"`
+	// JSONPath selects the value, e.g. "{.spec.clusterIP}".
+	JSONPath string `json:"jsonPath"`
+	// Base64 decodes the selected value. Useful for Secret data.
+	// +optional
+	Base64 bool `json:"base64"`
+}
+
+// Hooks are local commands executed at points during a deployment. A failing hook aborts the deployment.
+type Hooks struct {
+	// PreBuild hooks run before any images or artifacts are built.
+	// +optional
+	PreBuild []*Hook `json:"preBuild"`
+	// PostBuild hooks run after images or artifacts have been built and pushed.
+	// +optional
+	PostBuild []*Hook `json:"postBuild"`
+	// PostReconcile hooks run after the resources have been reconciled.
+	// +optional
+	PostReconcile []*Hook `json:"postReconcile"`
+}
+
+// Hook is a single local command.
+type Hook struct {
+	// Name is a human-readable name for the hook.
+	// +optional
+	Name string `json:"name"`
+	// Command is executed using "sh -c".
+	// +kubebuilder:validation:MinLength=1
+	Command string `json:"command"`
+	// Dir is the working directory, relative to the config file.
+	// +optional
+	Dir string `json:"dir"`
+	// Env contains additional environment variables.
+	// +optional
+	Env map[string]string `json:"env"`
+}
+
+// Kustomize is a kustomize based action.
+type Kustomize struct {
+	Context string `json:"context"`
+	// +optional
+	IncludePaths []string `json:"includePaths"`
+	// +optional
+	ExcludePaths []string `json:"excludePaths"`
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	Namespace string `json:"namespace"`
+	// +optional
+	Wait *bool `json:"wait"`
+	// +optional
+	Path string `json:"path"`
+	// +optional
+	Components []string `json:"components"`
+	// Substitute are the variables substituted into the manifests by Flux. Values may reference secrets as
+	// "${secretRef:<source>:<key>}", read at deploy time from an environment variable ("env"), a file relative to the
+	// config ("file") or the OS keychain as "<service>/<account>" ("keychain"). Variables referencing secrets are passed
+	// to Flux through a Secret.
+	// +optional
+	Substitute map[string]string `json:"substitute"`
+	// +optional
+	Patches []kustomize.Patch `json:"patches"`
+	// HealthChecks is a list of resources that must become ready before the step is considered deployed. The
+	// namespace defaults to the step namespace.
+	// +optional
+	HealthChecks []meta.NamespacedObjectKindReference `json:"healthChecks"`
+	// HealthCheckExprs are CEL expressions used to evaluate the health of custom resources listed in HealthChecks.
+	// +optional
+	HealthCheckExprs []kustomize.CustomHealthCheck `json:"healthCheckExprs"`
+	// Prune removes objects that are no longer part of the step. Defaults to true.
+	// +optional
+	Prune *bool `json:"prune"`
+	// Force recreates objects that cannot be patched, such as those with changed immutable fields. Defaults to true.
+	// +optional
+	Force *bool `json:"force"`
+	// RestartOnConfigChange annotates workloads with a hash of the ConfigMaps and Secrets they reference, so that
+	// config-only changes roll their pods.
+	// +optional
+	RestartOnConfigChange bool `json:"restartOnConfigChange"`
+}
+
+// Manifests deploys plain YAML files without requiring a kustomization.
+type Manifests struct {
+	// Files is a list of YAML files or glob patterns.
+	// +kubebuilder:validation:MinItems=1
+	Files []string `json:"files"`
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	Namespace string `json:"namespace"`
+	// +optional
+	Wait *bool `json:"wait"`
+	// +optional
+	Substitute map[string]string `json:"substitute"`
+	// Prune removes objects that are no longer part of the step. Defaults to true.
+	// +optional
+	Prune *bool `json:"prune"`
+	// Force recreates objects that cannot be patched, such as those with changed immutable fields. Defaults to true.
+	// +optional
+	Force *bool `json:"force"`
+}
+
+// Compose deploys the services of a Compose file as Deployments, with a Service for each service that publishes
+// ports. Services with a build section are added to the images of the deployment.
+type Compose struct {
+	// File is the path of the Compose file, e.g. "docker-compose.yaml".
+	// +kubebuilder:validation:MinLength=1
+	File string `json:"file"`
+	// Services limits the step to the named services. Defaults to all services.
+	// +optional
+	Services []string `json:"services"`
+	// Registry is where built services are pushed, as "<registry>/<project>-<service>". Defaults to the cluster
+	// registry.
+	// +optional
+	Registry string `json:"registry"`
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	Namespace string `json:"namespace"`
+	// +optional
+	Wait *bool `json:"wait"`
+}
+
+// Git deploys a kustomization from a remote git repository, such as shared infrastructure that lives outside the
+// project. The repository is fetched by Flux from within the cluster.
+type Git struct {
+	// URL is the repository address, e.g. "https://github.com/org/repo" or "ssh://git@github.com/org/repo".
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+	// Branch to check out. Defaults to "master" if no other reference is given.
+	// +optional
+	Branch string `json:"branch"`
+	// Tag to check out, taking precedence over Branch.
+	// +optional
+	Tag string `json:"tag"`
+	// SemVer is a tag range to check out, taking precedence over Tag.
+	// +optional
+	SemVer string `json:"semver"`
+	// Commit SHA to check out, taking precedence over all other references.
+	// +optional
+	Commit string `json:"commit"`
+	// SecretRef is the name of a Secret in the localflux namespace holding credentials for private repositories.
+	// +optional
+	SecretRef string `json:"secretRef"`
+	// Path is the directory within the repository containing the kustomization.
+	// +optional
+	Path string `json:"path"`
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	Namespace string `json:"namespace"`
+	// +optional
+	Wait *bool `json:"wait"`
+	// +optional
+	Components []string `json:"components"`
+	// +optional
+	Substitute map[string]string `json:"substitute"`
+	// +optional
+	Patches []kustomize.Patch `json:"patches"`
+	// Prune removes objects that are no longer part of the step. Defaults to true.
+	// +optional
+	Prune *bool `json:"prune"`
+	// Force recreates objects that cannot be patched, such as those with changed immutable fields. Defaults to true.
+	// +optional
+	Force *bool `json:"force"`
+}
+
+// Helm is a helm based action.
+type Helm struct {
+	// +optional
+	Repo string `json:"repo"`
+	// +optional
+	Context string `json:"context"`
+	// +optional
+	IncludePaths []string `json:"includePaths"`
+	// +optional
+	ExcludePaths []string `json:"excludePaths"`
+	// Chart is the chart name within the repo. Without a repo or context, it may instead be an oci:// reference,
+	// e.g. "oci://ghcr.io/stefanprodan/charts/podinfo", which is deployed through an OCIRepository chartRef. Required
+	// unless a context is given.
+	// +optional
+	Chart string `json:"chart"`
+	// Version is the chart version or semver range. For oci:// charts, values that are not valid ranges are used as
+	// a tag. Defaults to the latest version.
+	// +optional
+	Version string `json:"version"`
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	Namespace string `json:"namespace"`
+	// +optional
+	Wait *bool `json:"wait"`
+	// +optional
+	Patches []kustomize.Patch `json:"patches"`
+	// Values are the helm values. Strings may reference secrets as "${secretRef:<source>:<key>}", as in kustomize
+	// substitutions, in which case the values are passed to Flux through a Secret.
+	// +optional
+	Values *apiextensionsv1.JSON `json:"values"`
+	// +optional
+	ValueFiles []string `json:"valueFiles"`
+	// ValuesFrom reads values from environment variables or from Secrets and ConfigMaps in the cluster. They are merged
+	// after the value files and before the inline values.
+	// +optional
+	ValuesFrom []*ValuesReference `json:"valuesFrom"`
+	// ImageValues injects the references of images built by the deployment into the values, for charts that do not
+	// use the image names as written. They are applied after all other values.
+	// +optional
+	ImageValues []*ImageValue `json:"imageValues"`
+	// Force upgrades and rollbacks through a replacement strategy. Defaults to true.
+	// +optional
+	Force *bool `json:"force"`
+	// Replace re-uses the release name on install, even if a failed release exists. Defaults to true.
+	// +optional
+	Replace *bool `json:"replace"`
+}
+
+type ImageValue struct {
+	// Image is the name of an image built by the deployment.
+	Image string `json:"image"`
+	// Path is set to the full reference of the built image, e.g. "my/app@sha256:...".
+	// +optional
+	Path string `json:"path"`
+	// RepositoryPath is set to the repository of the built image, e.g. "my/app".
+	// +optional
+	RepositoryPath string `json:"repositoryPath"`
+	// TagPath is set to the tag of the built image. It is left unset for images referenced by digest.
+	// +optional
+	TagPath string `json:"tagPath"`
+	// DigestPath is set to the digest of the built image. It is left unset for tagged images.
+	// +optional
+	DigestPath string `json:"digestPath"`
+}
+
+type ValuesReference struct {
+	// +kubebuilder:validation:Enum=Secret;ConfigMap;Env
+	Kind string `json:"kind"`
+	// Name is the name of the object, or of the environment variable for the Env kind.
+	Name string `json:"name"`
+	// Namespace of the object. Defaults to the namespace of the step.
+	// +optional
+	Namespace string `json:"namespace"`
+	// ValuesKey is the key of the object holding the values. Defaults to "values.yaml".
+	// +optional
+	ValuesKey string `json:"valuesKey"`
+	// TargetPath sets the value at the given path, e.g. "image.tag", rather than merging it as a YAML document.
+	// +optional
+	TargetPath string `json:"targetPath"`
+	// Optional skips the reference if the object, key or environment variable does not exist.
+	// +optional
+	Optional bool `json:"optional"`
+}
+
+type PortForward struct {
+	// Kind is the kind of resource to forward to, e.g. "service" or "deployment". The "namespace" kind forwards every
+	// service of the namespace given by Name, creating and removing forwards as services come and go.
+	Kind string `json:"kind"`
+	// Namespace is the namespace of the resource. It is required by all kinds other than namespace.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// +optional
+	Network string `json:"network"`
+	// Port is the port to forward to. For the namespace kind, only service ports matching it are forwarded, or all
+	// ports when unset.
+	// +optional
+	Port int `json:"port"`
+	// LocalPort is the local port to serve the forward on. Defaults to Port. For the namespace kind, it is the start of
+	// the range local ports are assigned from, which defaults to 20000.
+	// +optional
+	LocalPort *int `json:"localPort"`
+	// BindAddress is the local address to serve the forward on, e.g. "0.0.0.0" or "::1". Defaults to the bind address
+	// of the relay.
+	// +optional
+	BindAddress string `json:"bindAddress"`
+	// Compression compresses the data relayed for the forward, which speeds up large, compressible transfers over slow
+	// links. It is negotiated with the relay server. Defaults to none.
+	// +kubebuilder:validation:Enum=none;snappy;zstd
+	// +optional
+	Compression string `json:"compression"`
+	// NetworkConditions degrades the connections of the forward, to test how clients behave against a slow backend.
+	// +optional
+	NetworkConditions *NetworkConditions `json:"networkConditions"`
+}
+
+// NetworkConditions simulates a slow or unreliable network on the data relayed for a forward. Conditions apply to
+// each direction separately, per chunk of data read from either side.
+type NetworkConditions struct {
+	// Latency delays each chunk of data, e.g. "200ms".
+	// +optional
+	Latency *metav1.Duration `json:"latency"`
+	// Bandwidth limits the rate of each direction, in bytes per second, e.g. "256Ki".
+	// +optional
+	Bandwidth *resource.Quantity `json:"bandwidth"`
+	// PacketLoss is the percentage of chunks that are lost. As the forwards relay TCP, lost chunks are not dropped
+	// but delivered after a retransmission timeout, as the connection would recover them.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	PacketLoss int `json:"packetLoss"`
+}
+
+// ReverseForward creates a service in the cluster whose traffic is tunneled back to a port on the host. The service
+// is backed by the relay, and removed once the relay stops.
+type ReverseForward struct {
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	Namespace string `json:"namespace"`
+	// Name is the name of the service to create. It must not clash with a service created by the deployment.
+	Name string `json:"name"`
+	// Port is the service port.
+	Port int `json:"port"`
+	// LocalPort is the port on the host to connect to. Defaults to Port.
+	// +optional
+	LocalPort *int `json:"localPort"`
+	// LocalHost is the host to connect to. Defaults to 127.0.0.1.
+	// +optional
+	LocalHost string `json:"localHost"`
+}
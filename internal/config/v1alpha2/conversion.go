@@ -0,0 +1,4 @@
+package v1alpha2
+
+// Hub marks this version as the one other versions are converted to and from.
+func (*Config) Hub() {}
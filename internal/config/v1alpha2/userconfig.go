@@ -0,0 +1,29 @@
+package v1alpha2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UserConfig holds the settings of the user, shared by all projects. Projects override them.
+type UserConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// BuildKit is merged beneath the buildkit settings of every cluster, filling the fields they do not set, such as
+	// the buildkit address or the docker config of this machine. Paths should be absolute, as they are otherwise
+	// resolved against the project directory.
+	// +optional
+	BuildKit *BuildKit `json:"buildkit"`
+
+	// Telemetry is used by projects that do not configure telemetry themselves.
+	// +optional
+	Telemetry *Telemetry `json:"telemetry"`
+
+	// Clusters are available to all projects, alongside their own clusters. Clusters of a project take precedence over
+	// those of the same name.
+	// +optional
+	Clusters []*Cluster `json:"clusters"`
+
+	// Plain disables fancy output, as with --plain.
+	// +optional
+	Plain bool `json:"plain"`
+}
@@ -0,0 +1,756 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/csnewman/localflux/internal/config/v1alpha1"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	"github.com/csnewman/localflux/internal/crds"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/pruning"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+var ErrValidationFailed = errors.New("config validation failed")
+
+// Problem is an issue found in a config file.
+type Problem struct {
+	File string
+	// Line is the line of the offending field, or of its closest parent when the field is missing. It is zero when
+	// unknown.
+	Line int
+	// Field is the path of the field, e.g. "deployments[0].steps[1]".
+	Field   string
+	Message string
+}
+
+func (p Problem) String() string {
+	location := p.File
+	if p.Line > 0 {
+		location += ":" + strconv.Itoa(p.Line)
+	}
+
+	if p.Field == "" {
+		return location + ": " + p.Message
+	}
+
+	return location + ": " + p.Field + ": " + p.Message
+}
+
+// sourceFile is a config file loaded for validation. Files of older versions are converted to the latest version once
+// checked against their schema.
+type sourceFile struct {
+	path    string
+	root    bool
+	version string
+	cfg     *v1alpha2.Config
+	lines   map[string]int
+}
+
+type validator struct {
+	dir      string
+	files    []*sourceFile
+	seen     map[string]struct{}
+	problems []Problem
+}
+
+// Validate checks the config at the path, and the files it includes, against the schema of the config and for
+// semantic issues, such as duplicate names, references to undefined images or steps, and paths that do not exist.
+// Paths are resolved against the directory of the config. Problems are sorted by file and line. Errors are only
+// returned when the files can not be read or parsed.
+func Validate(path string) ([]Problem, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	v := &validator{
+		dir:  filepath.Dir(path),
+		seen: map[string]struct{}{abs: {}},
+	}
+
+	if err := v.load(path, true); err != nil {
+		return nil, err
+	}
+
+	user, err := LoadUser()
+	if err != nil {
+		return nil, err
+	}
+
+	v.checkNames(user)
+
+	for _, file := range v.files {
+		for i, deployment := range file.cfg.Deployments {
+			v.checkDeployment(file, fmt.Sprintf("deployments[%d]", i), deployment)
+		}
+	}
+
+	slices.SortStableFunc(v.problems, func(a, b Problem) int {
+		if c := strings.Compare(a.File, b.File); c != 0 {
+			return c
+		}
+
+		return a.Line - b.Line
+	})
+
+	return v.problems, nil
+}
+
+// load validates the file, or remote include, against the schema, then loads the files it includes.
+func (v *validator) load(path string, root bool) error {
+	raw, err := readInclude(path)
+	if err != nil {
+		return err
+	}
+
+	var node yaml.Node
+
+	if err := yaml.Unmarshal(raw, &node); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	file := &sourceFile{
+		path:  path,
+		root:  root,
+		cfg:   &v1alpha2.Config{},
+		lines: make(map[string]int),
+	}
+
+	if len(node.Content) > 0 {
+		fieldLines(node.Content[0], "", file.lines)
+	}
+
+	v.files = append(v.files, file)
+
+	jsonRaw, err := sigsyaml.YAMLToJSON(raw)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	var obj map[string]any
+
+	if err := utiljson.Unmarshal(jsonRaw, &obj); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	delete(obj, SchemaKey)
+
+	file.version = v1alpha2.GroupVersion.Version
+
+	if apiVersion, _ := obj["apiVersion"].(string); apiVersion == v1alpha1.GroupVersion.String() {
+		file.version = v1alpha1.GroupVersion.Version
+	}
+
+	if err := v.checkSchema(file, obj); err != nil {
+		return err
+	}
+
+	// Fields of the wrong type have already been reported, so are left unset rather than failing.
+	defaultsField := "defaults"
+
+	if file.version == v1alpha1.GroupVersion.Version {
+		var old v1alpha1.Config
+
+		_ = sigsyaml.Unmarshal(raw, &old)
+
+		if err := old.ConvertTo(file.cfg); err != nil {
+			return fmt.Errorf("failed to convert %s: %w", path, err)
+		}
+
+		defaultsField = "defaultInterval"
+	} else {
+		_ = sigsyaml.Unmarshal(raw, file.cfg)
+	}
+
+	if !root {
+		for field, set := range map[string]bool{
+			"defaultCluster": file.cfg.DefaultCluster != "",
+			defaultsField:    file.cfg.Defaults != nil,
+			"telemetry":      file.cfg.Telemetry != nil,
+		} {
+			if set {
+				v.add(file, field, "included files may only set clusters, deployments and includes")
+			}
+		}
+
+		if isRemoteInclude(path) {
+			if found := remoteCommands(file.cfg); found != "" && pinnedDigest(path) == "" {
+				v.add(file, "", found+", so the include must be pinned by digest")
+			}
+		} else if err := rebaseInclude(file.cfg, v.dir, path); err != nil {
+			return err
+		}
+	}
+
+	for i, pattern := range file.cfg.Include {
+		matches, err := resolveInclude(path, pattern)
+		if err != nil {
+			v.add(file, fmt.Sprintf("include[%d]", i), err.Error())
+
+			continue
+		}
+
+		for _, match := range matches {
+			key, err := includeKey(match)
+			if err != nil {
+				return err
+			}
+
+			if _, ok := v.seen[key]; ok {
+				continue
+			}
+
+			v.seen[key] = struct{}{}
+
+			if err := v.load(match, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// compiledSchema is the schema of a config version, prepared for validation.
+type compiledSchema struct {
+	validator  validation.SchemaValidator
+	structural *structuralschema.Structural
+}
+
+var (
+	schemasMu sync.Mutex
+	schemas   = make(map[string]*compiledSchema)
+)
+
+// crdSchema returns the schema of the config version from its CRD, which holds the kubebuilder validations.
+func crdSchema(version string) (*apiextensionsv1.JSONSchemaProps, error) {
+	var crd apiextensionsv1.CustomResourceDefinition
+
+	if err := sigsyaml.Unmarshal([]byte(crds.Configs), &crd); err != nil {
+		return nil, fmt.Errorf("failed to parse config crd: %w", err)
+	}
+
+	for _, crdVersion := range crd.Spec.Versions {
+		if crdVersion.Name == version && crdVersion.Schema != nil {
+			return crdVersion.Schema.OpenAPIV3Schema, nil
+		}
+	}
+
+	return nil, fmt.Errorf("config crd has no %s schema", version)
+}
+
+// loadSchema loads the validator of the config version schema.
+func loadSchema(version string) (*compiledSchema, error) {
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+
+	if schema, ok := schemas[version]; ok {
+		return schema, nil
+	}
+
+	crdProps, err := crdSchema(version)
+	if err != nil {
+		return nil, err
+	}
+
+	var props apiextensions.JSONSchemaProps
+
+	if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(
+		crdProps,
+		&props,
+		nil,
+	); err != nil {
+		return nil, fmt.Errorf("failed to convert config schema: %w", err)
+	}
+
+	schemaValidator, _, err := validation.NewSchemaValidator(&props)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config schema validator: %w", err)
+	}
+
+	structural, err := structuralschema.NewStructural(&props)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create structural config schema: %w", err)
+	}
+
+	schema := &compiledSchema{
+		validator:  schemaValidator,
+		structural: structural,
+	}
+
+	schemas[version] = schema
+
+	return schema, nil
+}
+
+func (v *validator) checkSchema(file *sourceFile, obj map[string]any) error {
+	schema, err := loadSchema(file.version)
+	if err != nil {
+		return err
+	}
+
+	switch apiVersion, _ := obj["apiVersion"].(string); apiVersion {
+	case v1alpha2.GroupVersion.String(), v1alpha1.GroupVersion.String():
+	default:
+		v.add(file, "apiVersion", fmt.Sprintf("unsupported version %q", apiVersion))
+	}
+
+	if kind, _ := obj["kind"].(string); kind != "Config" {
+		v.add(file, "kind", fmt.Sprintf("unsupported kind %q", kind))
+	}
+
+	unknown := pruning.PruneWithOptions(
+		obj,
+		schema.structural,
+		true,
+		structuralschema.UnknownFieldPathOptions{TrackUnknownFieldPaths: true},
+	)
+
+	for _, path := range unknown {
+		v.add(file, path, "unknown field")
+	}
+
+	for _, fieldErr := range validation.ValidateCustomResource(nil, obj, schema.validator) {
+		// Included files only add to the clusters of the main config, which must define the default cluster.
+		if !file.root && (fieldErr.Field == "defaultCluster" || fieldErr.Field == "clusters") {
+			continue
+		}
+
+		v.add(file, fieldErr.Field, fieldErr.ErrorBody())
+	}
+
+	return nil
+}
+
+// checkNames checks that clusters and deployments are uniquely named across all files, and that the default cluster
+// is defined by them or by the user config.
+func (v *validator) checkNames(user *v1alpha2.UserConfig) {
+	clusters := make(map[string]string)
+	deployments := make(map[string]string)
+
+	for _, file := range v.files {
+		for i, cluster := range file.cfg.Clusters {
+			v.checkUnique(file, fmt.Sprintf("clusters[%d]", i), "cluster", cluster.Name, clusters)
+		}
+
+		for i, deployment := range file.cfg.Deployments {
+			v.checkUnique(file, fmt.Sprintf("deployments[%d]", i), "deployment", deployment.Name, deployments)
+		}
+	}
+
+	// Clusters of the project take precedence over those of the user, so may share their names.
+	for _, cluster := range user.Clusters {
+		if _, ok := clusters[cluster.Name]; !ok {
+			clusters[cluster.Name] = "user config"
+		}
+	}
+
+	root := v.files[0]
+
+	if name := root.cfg.DefaultCluster; name != "" {
+		if _, ok := clusters[name]; !ok {
+			v.add(root, "defaultCluster", fmt.Sprintf("cluster %q is not defined", name))
+		}
+	}
+
+	if root.cfg.Defaults != nil && root.cfg.Defaults.Profile != "" {
+		if name := root.cfg.Defaults.Profile; !v.profileDefined(name) {
+			v.add(root, "defaults.profile", fmt.Sprintf("profile %q is not defined by any deployment", name))
+		}
+	}
+}
+
+// resolve merges the deployment over the deployments it extends, which may be defined by any of the files.
+func (v *validator) resolve(deployment *v1alpha2.Deployment) (*v1alpha2.Deployment, error) {
+	var all []*v1alpha2.Deployment
+
+	for _, file := range v.files {
+		all = append(all, file.cfg.Deployments...)
+	}
+
+	return resolveDeployment(all, deployment, make(map[string]*v1alpha2.Deployment), nil)
+}
+
+func (v *validator) profileDefined(name string) bool {
+	for _, file := range v.files {
+		for _, deployment := range file.cfg.Deployments {
+			for _, profile := range deployment.Profiles {
+				if profile.Name == name {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// checkUnique records the name, reporting it if it was already defined.
+func (v *validator) checkUnique(file *sourceFile, field string, kind string, name string, defined map[string]string) {
+	if name == "" {
+		return
+	}
+
+	location := file.location(field)
+
+	if previous, ok := defined[name]; ok {
+		v.add(file, field, fmt.Sprintf("%s %q is already defined at %s", kind, name, previous))
+
+		return
+	}
+
+	defined[name] = location
+}
+
+func (v *validator) checkDeployment(file *sourceFile, field string, deployment *v1alpha2.Deployment) {
+	images := make(map[string]string)
+	steps := make(map[string]string)
+	profiles := make(map[string]string)
+
+	for i, image := range deployment.Images {
+		imageField := fmt.Sprintf("%s.images[%d]", field, i)
+
+		v.checkUnique(file, imageField, "image", image.Image, images)
+		v.checkImagePaths(file, imageField, image)
+
+		if image.When != "" && !deployment.Templating {
+			v.add(file, imageField+".when", "conditions require templating to be enabled")
+		}
+	}
+
+	if deployment.Templating {
+		for _, err := range CheckTemplates(deployment) {
+			v.add(file, field+".templating", err.Error())
+		}
+	}
+
+	compose := false
+
+	for i, step := range deployment.Steps {
+		v.checkUnique(file, fmt.Sprintf("%s.steps[%d]", field, i), "step", step.Name, steps)
+
+		compose = compose || step.Compose != nil
+	}
+
+	merged, err := v.resolve(deployment)
+	if err != nil {
+		extendsField := field + ".extends"
+		if deployment.Extends == "" {
+			extendsField = field + ".exclude"
+		}
+
+		v.add(file, extendsField, err.Error())
+
+		merged = deployment
+	}
+
+	// Images and steps inherited through extends may also be referenced.
+	for _, image := range merged.Images {
+		if _, ok := images[image.Image]; !ok {
+			images[image.Image] = file.location(field + ".extends")
+		}
+	}
+
+	for _, step := range merged.Steps {
+		if _, ok := steps[step.Name]; !ok {
+			steps[step.Name] = file.location(field + ".extends")
+		}
+
+		compose = compose || step.Compose != nil
+	}
+
+	for i, profile := range deployment.Profiles {
+		profileField := fmt.Sprintf("%s.profiles[%d]", field, i)
+
+		v.checkUnique(file, profileField, "profile", profile.Name, profiles)
+
+		for j, image := range profile.Images {
+			images[image.Image] = file.location(fmt.Sprintf("%s.images[%d]", profileField, j))
+
+			v.checkImagePaths(file, fmt.Sprintf("%s.images[%d]", profileField, j), image)
+		}
+
+		for j, step := range profile.Steps {
+			stepField := fmt.Sprintf("%s.steps[%d]", profileField, j)
+
+			if _, ok := steps[step.Name]; !ok {
+				v.add(file, stepField+".name", fmt.Sprintf("step %q is not defined", step.Name))
+			}
+
+			for k, valueFile := range step.ValueFiles {
+				v.checkPath(file, fmt.Sprintf("%s.valueFiles[%d]", stepField, k), valueFile, false)
+			}
+		}
+	}
+
+	for i, step := range deployment.Steps {
+		stepField := fmt.Sprintf("%s.steps[%d]", field, i)
+
+		v.checkStep(file, stepField, step)
+
+		if step.When != "" && !deployment.Templating {
+			v.add(file, stepField+".when", "conditions require templating to be enabled")
+		}
+
+		for j, dependency := range step.DependsOn {
+			dependencyField := fmt.Sprintf("%s.dependsOn[%d]", stepField, j)
+
+			if dependency == step.Name {
+				v.add(file, dependencyField, "step depends on itself")
+			} else if _, ok := steps[dependency]; !ok {
+				v.add(file, dependencyField, fmt.Sprintf("step %q is not defined", dependency))
+			}
+		}
+
+		// Compose steps add the images of their services, which are only known once the compose file is loaded.
+		if step.Helm != nil && !compose {
+			for j, imageValue := range step.Helm.ImageValues {
+				if _, ok := images[imageValue.Image]; !ok {
+					v.add(
+						file,
+						fmt.Sprintf("%s.helm.imageValues[%d].image", stepField, j),
+						fmt.Sprintf("image %q is not built by the deployment", imageValue.Image),
+					)
+				}
+			}
+		}
+	}
+
+	v.checkHooks(file, field+".hooks", deployment.Hooks)
+	v.checkSigning(file, field+".sign", deployment.Sign)
+}
+
+func (v *validator) checkStep(file *sourceFile, field string, step *v1alpha2.Step) {
+	actions := 0
+
+	for _, set := range []bool{
+		step.Kustomize != nil,
+		step.Helm != nil,
+		step.Manifests != nil,
+		step.Git != nil,
+		step.Compose != nil,
+	} {
+		if set {
+			actions++
+		}
+	}
+
+	switch actions {
+	case 0:
+		v.add(file, field, "step must set one of kustomize, helm, manifests, git or compose")
+	case 1:
+	default:
+		v.add(file, field, "step must set only one of kustomize, helm, manifests, git or compose")
+	}
+
+	if step.Kustomize != nil {
+		v.checkPath(file, field+".kustomize.context", step.Kustomize.Context, true)
+	}
+
+	if step.Helm != nil {
+		if step.Helm.Context != "" {
+			v.checkPath(file, field+".helm.context", step.Helm.Context, true)
+		} else if step.Helm.Chart == "" {
+			v.add(file, field+".helm.chart", "a chart is required unless a context is given")
+		}
+
+		for i, valueFile := range step.Helm.ValueFiles {
+			v.checkPath(file, fmt.Sprintf("%s.helm.valueFiles[%d]", field, i), valueFile, false)
+		}
+	}
+
+	if step.Manifests != nil {
+		for i, pattern := range step.Manifests.Files {
+			matches, err := filepath.Glob(filepath.Join(v.dir, pattern))
+			if err != nil {
+				v.add(file, fmt.Sprintf("%s.manifests.files[%d]", field, i), fmt.Sprintf("invalid pattern: %v", err))
+			} else if len(matches) == 0 {
+				v.add(file, fmt.Sprintf("%s.manifests.files[%d]", field, i), fmt.Sprintf("%q matches no files", pattern))
+			}
+		}
+	}
+
+	if step.Compose != nil {
+		v.checkPath(file, field+".compose.file", step.Compose.File, false)
+	}
+
+	if step.Generate != nil {
+		for i, gen := range step.Generate.ConfigMaps {
+			v.checkGenerator(file, fmt.Sprintf("%s.generate.configMaps[%d]", field, i), gen)
+		}
+
+		for i, gen := range step.Generate.Secrets {
+			v.checkGenerator(file, fmt.Sprintf("%s.generate.secrets[%d]", field, i), gen)
+		}
+	}
+
+	v.checkHooks(file, field+".hooks", step.Hooks)
+}
+
+func (v *validator) checkImagePaths(file *sourceFile, field string, image *v1alpha2.Image) {
+	if image.Context != "" && !isRemote(image.Context) {
+		v.checkPath(file, field+".context", image.Context, true)
+	}
+
+	if image.File != "" {
+		v.checkPath(file, field+".file", image.File, false)
+	}
+
+	for name, value := range image.BuildContexts {
+		if !isRemote(value) {
+			v.checkPath(file, field+".buildContexts."+name, value, true)
+		}
+	}
+
+	v.checkSigning(file, field+".sign", image.Sign)
+}
+
+func (v *validator) checkGenerator(file *sourceFile, field string, gen *v1alpha2.Generator) {
+	for i, source := range gen.Files {
+		_, path, ok := strings.Cut(source, "=")
+		if !ok {
+			path = source
+		}
+
+		v.checkPath(file, fmt.Sprintf("%s.files[%d]", field, i), path, false)
+	}
+
+	for i, env := range gen.Envs {
+		v.checkPath(file, fmt.Sprintf("%s.envs[%d]", field, i), env, false)
+	}
+}
+
+func (v *validator) checkHooks(file *sourceFile, field string, hooks *v1alpha2.Hooks) {
+	if hooks == nil {
+		return
+	}
+
+	for kind, list := range map[string][]*v1alpha2.Hook{
+		"preBuild":      hooks.PreBuild,
+		"postBuild":     hooks.PostBuild,
+		"postReconcile": hooks.PostReconcile,
+	} {
+		for i, hook := range list {
+			if hook.Dir != "" {
+				v.checkPath(file, fmt.Sprintf("%s.%s[%d].dir", field, kind, i), hook.Dir, true)
+			}
+		}
+	}
+}
+
+func (v *validator) checkSigning(file *sourceFile, field string, signing *v1alpha2.Signing) {
+	if signing == nil {
+		return
+	}
+
+	// Keys may also be KMS URIs.
+	if signing.Key != "" && !isRemote(signing.Key) {
+		v.checkPath(file, field+".key", signing.Key, false)
+	}
+
+	if signing.Verify != nil && signing.Verify.PublicKey != "" {
+		v.checkPath(file, field+".verify.publicKey", signing.Verify.PublicKey, false)
+	}
+}
+
+// checkPath checks that the path, relative to the main config file, exists and is a directory or file as expected.
+// Paths of included files have already been rebased onto the main config file.
+func (v *validator) checkPath(file *sourceFile, field string, path string, dir bool) {
+	// Templated paths are only known once rendered.
+	if path == "" || strings.Contains(path, "{{") {
+		return
+	}
+
+	full := path
+	if !filepath.IsAbs(full) {
+		full = filepath.Join(v.dir, path)
+	}
+
+	info, err := os.Stat(full)
+
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		v.add(file, field, fmt.Sprintf("%q does not exist", path))
+	case err != nil:
+		v.add(file, field, fmt.Sprintf("%q can not be read: %v", path, err))
+	case dir && !info.IsDir():
+		v.add(file, field, fmt.Sprintf("%q is not a directory", path))
+	case !dir && info.IsDir():
+		v.add(file, field, fmt.Sprintf("%q is a directory", path))
+	}
+}
+
+func (v *validator) add(file *sourceFile, field string, message string) {
+	v.problems = append(v.problems, Problem{
+		File:    file.path,
+		Line:    file.line(field),
+		Field:   field,
+		Message: message,
+	})
+}
+
+// isRemote reports whether the value is a URL, such as a git context or KMS key, rather than a local path.
+func isRemote(value string) bool {
+	return strings.Contains(value, "://") || strings.HasPrefix(value, "git@")
+}
+
+// line returns the line of the field, or of its closest parent present in the file.
+func (f *sourceFile) line(field string) int {
+	for {
+		if line, ok := f.lines[field]; ok {
+			return line
+		}
+
+		i := strings.LastIndexAny(field, ".[")
+		if i < 0 {
+			return f.lines[""]
+		}
+
+		field = field[:i]
+	}
+}
+
+func (f *sourceFile) location(field string) string {
+	return f.path + ":" + strconv.Itoa(f.line(field))
+}
+
+// fieldLines records the line of each field below the node, keyed by its path in the form used by field errors, e.g.
+// "deployments[0].name".
+func fieldLines(node *yaml.Node, path string, lines map[string]int) {
+	if _, ok := lines[path]; !ok {
+		lines[path] = node.Line
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+
+			lines[child] = node.Content[i].Line
+
+			fieldLines(node.Content[i+1], child, lines)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			fieldLines(item, path+"["+strconv.Itoa(i)+"]", lines)
+		}
+	}
+}
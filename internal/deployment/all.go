@@ -0,0 +1,200 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/csnewman/localflux/internal/config"
+	"golang.org/x/sync/errgroup"
+)
+
+var ErrDeploymentsFailed = errors.New("one or more deployments failed")
+
+// DeployAllOptions customises a run across every configured deployment.
+type DeployAllOptions struct {
+	// Parallel limits how many deployments run at once. Values below one deploy sequentially.
+	Parallel int
+	// Profile is applied to every deployment that defines it. Other deployments are deployed unchanged. At least one
+	// deployment must define it.
+	Profile string
+	// Direct applies every step directly, bypassing Flux.
+	Direct bool
+	// SkipBuild reuses the images last pushed to the cluster instead of building them.
+	SkipBuild bool
+	// Diff shows the changes to the values and manifest of each helm release before upgrading it.
+	Diff bool
+}
+
+// DeployResult describes the outcome of a single deployment within DeployAll.
+type DeployResult struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+	// Result describes the run in detail. It is nil if the deployment failed before any work was started.
+	Result *Result
+}
+
+// DeployAll deploys every deployment in the config to the cluster, sharing a single builder connection. Results are
+// returned in config order, even when a deployment fails.
+func (m *Manager) DeployAll(
+	ctx context.Context,
+	clusterName string,
+	opts DeployAllOptions,
+	cb Callbacks,
+) ([]DeployResult, error) {
+	if clusterName == "" {
+		clusterName = m.cfg.DefaultCluster
+	}
+
+	if len(m.cfg.Deployments) == 0 {
+		return nil, fmt.Errorf("%w: no deployments defined", ErrInvalid)
+	}
+
+	if opts.Profile != "" && !slices.ContainsFunc(m.cfg.Deployments, func(deployment config.Deployment) bool {
+		return findProfile(deployment, opts.Profile) != nil
+	}) {
+		return nil, fmt.Errorf("%w: %q is not defined by any deployment", ErrUnknownProfile, opts.Profile)
+	}
+
+	cb.Info(fmt.Sprintf("Deploying %d deployments to %q", len(m.cfg.Deployments), clusterName))
+
+	t, err := m.connect(ctx, clusterName, cb)
+	if err != nil {
+		return nil, err
+	}
+
+	parallel := max(opts.Parallel, 1)
+
+	results := make([]DeployResult, len(m.cfg.Deployments))
+
+	eg, ectx := errgroup.WithContext(ctx)
+	eg.SetLimit(parallel)
+
+	for i, deployment := range m.cfg.Deployments {
+		dcb := cb
+
+		if parallel > 1 {
+			dcb = &prefixCallbacks{
+				Callbacks: cb,
+				prefix:    deployment.Name,
+			}
+		}
+
+		eg.Go(func() error {
+			start := time.Now()
+
+			dcb.Info(fmt.Sprintf("Deploying %q", deployment.Name))
+
+			deployOpts := DeployOptions{
+				Direct:    opts.Direct,
+				SkipBuild: opts.SkipBuild,
+				Diff:      opts.Diff,
+			}
+
+			if findProfile(deployment, opts.Profile) != nil {
+				deployOpts.Profile = opts.Profile
+			}
+
+			res, err := m.deploy(ectx, t, deployment, deployOpts, dcb)
+			if err != nil {
+				m.logger.Error("Deployment failed", "name", deployment.Name, "err", err)
+
+				dcb.Error(fmt.Sprintf("Deployment %q failed: %v", deployment.Name, err))
+			} else {
+				dcb.Success(fmt.Sprintf("Deployed %q", deployment.Name))
+			}
+
+			results[i] = DeployResult{
+				Name:     deployment.Name,
+				Duration: time.Since(start),
+				Err:      err,
+				Result:   res,
+			}
+
+			// Failures are reported in the results rather than cancelling the remaining deployments.
+			return nil
+		})
+	}
+
+	_ = eg.Wait()
+
+	for _, res := range results {
+		if res.Err != nil {
+			return results, ErrDeploymentsFailed
+		}
+	}
+
+	return results, nil
+}
+
+// prefixCallbacks tags messages with the deployment name so that interleaved parallel output remains readable.
+type prefixCallbacks struct {
+	Callbacks
+
+	prefix string
+}
+
+func (c *prefixCallbacks) tag(msg string) string {
+	return "[" + c.prefix + "] " + msg
+}
+
+func (c *prefixCallbacks) Completed(msg string, dur time.Duration) {
+	c.Callbacks.Completed(c.tag(msg), dur)
+}
+
+func (c *prefixCallbacks) State(msg string, detail string, start time.Time) {
+	c.Callbacks.State(c.tag(msg), detail, start)
+}
+
+func (c *prefixCallbacks) Success(detail string) {
+	c.Callbacks.Success(c.tag(detail))
+}
+
+func (c *prefixCallbacks) Info(msg string) {
+	c.Callbacks.Info(c.tag(msg))
+}
+
+func (c *prefixCallbacks) Warn(msg string) {
+	c.Callbacks.Warn(c.tag(msg))
+}
+
+func (c *prefixCallbacks) Error(msg string) {
+	c.Callbacks.Error(c.tag(msg))
+}
+
+func (c *prefixCallbacks) BuildStatus(name string, graph *SolveStatus) {
+	c.Callbacks.BuildStatus(c.tag(name), graph)
+}
+
+func (c *prefixCallbacks) StepLines(lines []string) {
+	if lines == nil {
+		c.Callbacks.StepLines(nil)
+
+		return
+	}
+
+	tagged := make([]string, len(lines))
+
+	for i, line := range lines {
+		tagged[i] = c.tag(line)
+	}
+
+	c.Callbacks.StepLines(tagged)
+}
+
+func (c *prefixCallbacks) Diagnostics(diag *Diagnostics) {
+	tagged := *diag
+	tagged.Step = c.tag(diag.Step)
+
+	c.Callbacks.Diagnostics(&tagged)
+}
+
+func (c *prefixCallbacks) Diff(diff *ReleaseDiff) {
+	tagged := *diff
+	tagged.Step = c.tag(diff.Step)
+
+	c.Callbacks.Diff(&tagged)
+}
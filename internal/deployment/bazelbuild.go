@@ -0,0 +1,139 @@
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+var ErrBazelNotFound = errors.New("bazel CLI not found")
+
+// buildBazel builds the Bazel target and pushes the OCI layout it produces to the cluster registry, so that images
+// are built by Bazel alone.
+func (b *Builder) buildBazel(ctx context.Context, cfg config.Image, baseDir string, fn func(res *SolveStatus)) (*Artifact, error) {
+	if len(cfg.IncludePaths) > 0 || len(cfg.ExcludePaths) > 0 {
+		return nil, fmt.Errorf("%w: include and exclude paths are not supported by bazel builds", ErrInvalid)
+	}
+
+	if _, err := exec.LookPath("bazel"); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBazelNotFound, err)
+	}
+
+	buildCtx := cfg.Context
+	if buildCtx == "" {
+		buildCtx = baseDir
+	}
+
+	args := append([]string{"build", cfg.Bazel.Target}, cfg.Bazel.Args...)
+
+	b.logger.Info("Running bazel", "args", args)
+
+	cmd := exec.CommandContext(ctx, "bazel", args...)
+	cmd.Dir = buildCtx
+
+	if err := runVertexCommand(cmd, "bazel:"+cfg.Image, "[bazel] bazel build "+cfg.Bazel.Target, fn); err != nil {
+		return nil, fmt.Errorf("bazel build failed: %w", err)
+	}
+
+	execRoot, err := bazelOutput(ctx, buildCtx, "info", "execution_root")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find bazel execution root: %w", err)
+	}
+
+	files, err := bazelOutput(ctx, buildCtx, append([]string{"cquery", cfg.Bazel.Target, "--output=files"}, cfg.Bazel.Args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find bazel outputs: %w", err)
+	}
+
+	outputs := strings.Fields(files)
+	if len(outputs) != 1 {
+		return nil, fmt.Errorf("%w: expected %q to produce a single OCI layout, found %d outputs", ErrInvalid, cfg.Bazel.Target, len(outputs))
+	}
+
+	return b.pushLayout(ctx, filepath.Join(execRoot, outputs[0]), cfg.Image)
+}
+
+func bazelOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "bazel", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// pushLayout pushes the image or index of a single entry OCI layout to the cluster registry.
+func (b *Builder) pushLayout(ctx context.Context, path string, image string) (*Artifact, error) {
+	ref, err := name.ParseReference(image, name.Insecure)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference: %w", err)
+	}
+
+	idx, err := layout.ImageIndexFromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OCI layout: %w", err)
+	}
+
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OCI layout: %w", err)
+	}
+
+	if len(manifest.Manifests) != 1 {
+		return nil, fmt.Errorf("%w: expected a single image in OCI layout, found %d", ErrInvalid, len(manifest.Manifests))
+	}
+
+	desc := manifest.Manifests[0]
+
+	trans, auth, err := b.provider.RegistryConn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to registry: %w", err)
+	}
+
+	opts := []remote.Option{remote.WithContext(ctx), remote.WithTransport(trans), remote.WithAuth(auth)}
+
+	b.logger.Info("Pushing image", "image", image, "digest", desc.Digest)
+
+	switch {
+	case desc.MediaType.IsIndex():
+		child, err := idx.ImageIndex(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image index: %w", err)
+		}
+
+		if err := remote.WriteIndex(ref, child, opts...); err != nil {
+			return nil, fmt.Errorf("failed to push image: %w", err)
+		}
+	case desc.MediaType.IsImage():
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image: %w", err)
+		}
+
+		if err := remote.Write(ref, img, opts...); err != nil {
+			return nil, fmt.Errorf("failed to push image: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported media type %q in OCI layout", ErrInvalid, desc.MediaType)
+	}
+
+	return &Artifact{
+		Name:   image,
+		Digest: desc.Digest.String(),
+	}, nil
+}
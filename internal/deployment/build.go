@@ -2,26 +2,35 @@ package deployment
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"net"
 	"net/url"
+	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/csnewman/localflux/internal/cluster"
 	"github.com/csnewman/localflux/internal/config"
 	dockerconfig "github.com/docker/cli/cli/config"
 	"github.com/docker/cli/cli/config/credentials"
 	"github.com/docker/cli/cli/connhelper/commandconn"
+	dockerclient "github.com/docker/docker/client"
 	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/client/connhelper"
 	"github.com/moby/buildkit/cmd/buildctl/build"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/session/auth/authprovider"
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
 	"github.com/moby/buildkit/util/staticfs"
 	"github.com/tonistiigi/fsutil"
 	fstypes "github.com/tonistiigi/fsutil/types"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -38,37 +47,111 @@ func init() {
 	})
 }
 
+const (
+	BackendAuto      = "auto"
+	BackendBuildKit  = "buildkit"
+	BackendContainer = "container"
+	BackendDocker    = "docker"
+	BackendCluster   = cluster.BuildKitBackendCluster
+)
+
+const (
+	ExportRegistry = "registry"
+	ExportNode     = "node"
+)
+
+// buildKitProbeTimeout bounds how long the auto backend waits for buildkit before falling back to Docker.
+const buildKitProbeTimeout = 30 * time.Second
+
 type Builder struct {
 	logger     *slog.Logger
 	cfg        config.BuildKit
 	c          *client.Client
 	attachable []session.Attachable
+	provider   cluster.Provider
+	// docker is set when building through the Docker daemon, in which case images are pushed by localflux rather than
+	// by buildkit.
+	docker *dockerclient.Client
+	// local is set when buildkit can not reach the cluster registry, in which case images are exported to localflux
+	// and pushed by it.
+	local bool
+	// loadToNode is set when images are loaded into the container runtime of the nodes rather than pushed.
+	loadToNode bool
+	// pinsFile is the file base images are pinned with, kept next to the config. Defaults to PinsFile.
+	pinsFile string
 }
 
 func NewBuilder(ctx context.Context, logger *slog.Logger, provider cluster.Provider) (*Builder, error) {
 	cfg := provider.BuildKitConfig()
 
-	addr := cfg.Address
+	var (
+		c      *client.Client
+		docker *dockerclient.Client
+		local  bool
+		err    error
+	)
 
-	const fallback = "localflux://fallback"
+	switch cfg.Backend {
+	case "", BackendAuto:
+		c, err = newBuildKitClient(ctx, provider, cfg)
+		if err != nil {
+			return nil, err
+		}
 
-	if addr == "" {
-		addr = fallback
-	}
+		probeCtx, cancel := context.WithTimeout(ctx, buildKitProbeTimeout)
+		_, perr := c.ListWorkers(probeCtx)
 
-	c, err := client.New(ctx, addr, client.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
-		if addr == fallback {
-			addr = ""
+		cancel()
+
+		if perr != nil {
+			_ = c.Close()
+
+			c, docker, local, err = newFallbackBuildClient(ctx, logger, provider, cfg, perr)
+			if err != nil {
+				return nil, err
+			}
 		}
+	case BackendBuildKit:
+		c, err = newBuildKitClient(ctx, provider, cfg)
+	case BackendContainer:
+		c, err = newContainerBuildClient(ctx, logger, provider)
+		local = true
+	case BackendDocker:
+		c, docker, err = newDockerBuildClient(ctx)
+	case BackendCluster:
+		c, err = newClusterBuildClient(ctx, provider, cfg)
+	default:
+		return nil, fmt.Errorf("%w: unknown build backend %q", ErrInvalid, cfg.Backend)
+	}
 
-		return provider.BuildKitDialer(ctx, addr)
-	}))
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to buildkit: %w", err)
+		return nil, err
+	}
+
+	closeClients := func() {
+		_ = c.Close()
+
+		if docker != nil {
+			_ = docker.Close()
+		}
+	}
+
+	var loadToNode bool
+
+	switch cfg.Export {
+	case "", ExportRegistry:
+	case ExportNode:
+		loadToNode = true
+	default:
+		closeClients()
+
+		return nil, fmt.Errorf("%w: unknown image export %q", ErrInvalid, cfg.Export)
 	}
 
 	dockerConfig, err := dockerconfig.Load(cfg.DockerConfig)
 	if err != nil {
+		closeClients()
+
 		return nil, fmt.Errorf("failed to load docker config: %w", err)
 	}
 
@@ -78,6 +161,8 @@ func NewBuilder(ctx context.Context, logger *slog.Logger, provider cluster.Provi
 
 	tlsConfigs, err := build.ParseRegistryAuthTLSContext(cfg.RegistryAuthTLSContext)
 	if err != nil {
+		closeClients()
+
 		return nil, fmt.Errorf("failed to parse registry tls auth context: %w", err)
 	}
 
@@ -92,43 +177,178 @@ func NewBuilder(ctx context.Context, logger *slog.Logger, provider cluster.Provi
 		cfg:        cfg,
 		c:          c,
 		attachable: attachable,
+		provider:   provider,
+		docker:     docker,
+		local:      local,
+		loadToNode: loadToNode,
 	}, nil
 }
 
+// newFallbackBuildClient is used when the cluster buildkit is unreachable. Without an explicit address, a buildkit
+// container on the local Docker host is tried first, followed by the buildkit embedded in the Docker daemon.
+func newFallbackBuildClient(
+	ctx context.Context,
+	logger *slog.Logger,
+	provider cluster.Provider,
+	cfg config.BuildKit,
+	cause error,
+) (*client.Client, *dockerclient.Client, bool, error) {
+	errs := []error{fmt.Errorf("failed to connect to buildkit: %w", cause)}
+
+	if cfg.Address == "" {
+		logger.Warn("Buildkit is unreachable, falling back to a buildkit container", "err", cause)
+
+		c, err := newContainerBuildClient(ctx, logger, provider)
+		if err == nil {
+			return c, nil, true, nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	logger.Warn("Buildkit is unreachable, falling back to docker", "err", errors.Join(errs...))
+
+	c, docker, err := newDockerBuildClient(ctx)
+	if err != nil {
+		return nil, nil, false, errors.Join(append(errs, err)...)
+	}
+
+	return c, docker, false, nil
+}
+
+func newBuildKitClient(ctx context.Context, provider cluster.Provider, cfg config.BuildKit) (*client.Client, error) {
+	addr := cfg.Address
+
+	const fallback = "localflux://fallback"
+
+	if addr == "" {
+		addr = fallback
+	}
+
+	c, err := client.New(ctx, addr, client.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		if addr == fallback {
+			addr = ""
+		}
+
+		return provider.BuildKitDialer(ctx, addr)
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to buildkit: %w", err)
+	}
+
+	return c, nil
+}
+
+// newClusterBuildClient connects to the buildkitd StatefulSet in the cluster, deploying it first if needed, so that
+// builds also work against clusters not started by localflux.
+func newClusterBuildClient(ctx context.Context, provider cluster.Provider, cfg config.BuildKit) (*client.Client, error) {
+	kc, err := provider.K8sClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create k8s client: %w", err)
+	}
+
+	if err := cluster.DeployBuildKit(ctx, kc, cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cluster.WaitBuildKit(ctx, kc); err != nil {
+		return nil, err
+	}
+
+	c, err := client.New(ctx, "", client.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return cluster.DialBuildKit(kc)
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to cluster buildkit: %w", err)
+	}
+
+	return c, nil
+}
+
 type Artifact struct {
 	Name   string
 	Digest string
+	// Tag is set when the image must be referenced by tag, as it was loaded into the nodes rather than pushed.
+	Tag string
 }
 
 type SolveStatus = client.SolveStatus
 
-func (b *Builder) Build(ctx context.Context, cfg config.Image, baseDir string, fn func(res *SolveStatus)) (*Artifact, error) {
+// Build builds and pushes the image, tracing the solve.
+func (b *Builder) Build(
+	ctx context.Context,
+	cfg config.Image,
+	baseDir string,
+	ccb ContextCallbacks,
+	fn func(res *SolveStatus),
+) (*Artifact, error) {
+	ctx, span := tracer.Start(ctx, "build "+cfg.Image)
+
+	st := newSolveTracer(ctx)
+
+	artifact, err := b.build(ctx, cfg, baseDir, ccb, st.wrap(fn))
+
+	st.finish()
+
+	if artifact != nil {
+		span.SetAttributes(attribute.String("localflux.digest", artifact.Digest))
+	}
+
+	endSpan(span, err)
+
+	return artifact, err
+}
+
+func (b *Builder) build(
+	ctx context.Context,
+	cfg config.Image,
+	baseDir string,
+	ccb ContextCallbacks,
+	fn func(res *SolveStatus),
+) (*Artifact, error) {
+	builders := 0
+
+	for _, set := range []bool{cfg.Buildpacks != nil, cfg.Custom != nil, cfg.Nix != nil, cfg.Bazel != nil} {
+		if set {
+			builders++
+		}
+	}
+
+	switch {
+	case builders > 1:
+		return nil, fmt.Errorf("%w: %q has multiple builders defined", ErrInvalid, cfg.Image)
+	case builders > 0 && len(cfg.Secrets) > 0:
+		return nil, fmt.Errorf("%w: %q: secrets are only supported for dockerfile builds", ErrInvalid, cfg.Image)
+	case builders > 0 && isGitContext(cfg.Context):
+		return nil, fmt.Errorf("%w: %q: git contexts are only supported for dockerfile builds", ErrInvalid, cfg.Image)
+	case cfg.Buildpacks != nil:
+		return b.buildPacks(ctx, cfg, baseDir, fn)
+	case cfg.Custom != nil:
+		return b.buildCustom(ctx, cfg, baseDir, fn)
+	case cfg.Nix != nil:
+		return b.buildNix(ctx, cfg, baseDir, fn)
+	case cfg.Bazel != nil:
+		return b.buildBazel(ctx, cfg, baseDir, fn)
+	}
+
 	buildCtx := cfg.Context
 	if buildCtx == "" {
 		buildCtx = baseDir
 	}
 
-	buildFile := cfg.File
-	if buildFile == "" {
-		buildFile = filepath.Join(buildCtx, "Dockerfile")
-	}
+	gitCtx := isGitContext(buildCtx)
 
-	cxtLocalMount, err := fsutil.NewFS(buildCtx)
-	if err != nil {
-		return nil, fmt.Errorf("invalid build context: %w", err)
+	if gitCtx && (len(cfg.IncludePaths) > 0 || len(cfg.ExcludePaths) > 0) {
+		return nil, fmt.Errorf("%w: include and exclude paths are not supported by git contexts", ErrInvalid)
 	}
 
-	cxtLocalMount, err = fsutil.NewFilterFS(cxtLocalMount, &fsutil.FilterOpt{
-		IncludePatterns: cfg.IncludePaths,
-		ExcludePatterns: cfg.ExcludePaths,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("invalid filter: %w", err)
+	if gitCtx && cfg.File == "" && cfg.PinBaseImages {
+		return nil, fmt.Errorf("%w: pinning base images of a git context requires an explicit file", ErrInvalid)
 	}
 
-	dockerfileLocalMount, err := fsutil.NewFS(filepath.Dir(buildFile))
-	if err != nil {
-		return nil, fmt.Errorf("invalid dockerfile path: %w", err)
+	buildFile := cfg.File
+	if buildFile == "" {
+		buildFile = filepath.Join(buildCtx, "Dockerfile")
 	}
 
 	frontendAttrs := map[string]string{
@@ -136,6 +356,43 @@ func (b *Builder) Build(ctx context.Context, cfg config.Image, baseDir string, f
 		"filename": filepath.Base(buildFile),
 	}
 
+	localMounts := map[string]fsutil.FS{}
+
+	if gitCtx {
+		// The repository is fetched by buildkit itself, which also reads the Dockerfile from it unless one is given.
+		frontendAttrs["context"] = buildCtx
+
+		if cfg.File == "" {
+			frontendAttrs["filename"] = "Dockerfile"
+		} else {
+			frontendAttrs["dockerfilekey"] = "dockerfile"
+		}
+	} else {
+		excludePaths, err := dockerIgnorePatterns(buildCtx, buildFile)
+		if err != nil {
+			return nil, err
+		}
+
+		// Explicit exclusions are applied last, so that they can not be re-included by the ignore file.
+		excludePaths = append(excludePaths, cfg.ExcludePaths...)
+
+		cxtLocalMount, err := prepareContext(ctx, b.logger, buildCtx, cfg.IncludePaths, excludePaths, ccb)
+		if err != nil {
+			return nil, err
+		}
+
+		localMounts["context"] = cxtLocalMount
+	}
+
+	if !gitCtx || cfg.File != "" {
+		dockerfileLocalMount, err := fsutil.NewFS(filepath.Dir(buildFile))
+		if err != nil {
+			return nil, fmt.Errorf("invalid dockerfile path: %w", err)
+		}
+
+		localMounts["dockerfile"] = dockerfileLocalMount
+	}
+
 	if cfg.Target != "" {
 		frontendAttrs["target"] = cfg.Target
 	}
@@ -144,6 +401,55 @@ func (b *Builder) Build(ctx context.Context, cfg config.Image, baseDir string, f
 		frontendAttrs["build-arg:"+k] = v
 	}
 
+	if len(cfg.Platforms) > 0 {
+		// Only the image exporter of buildkit pushes image indexes, the other export paths handle a single image.
+		if len(cfg.Platforms) > 1 && (b.docker != nil || b.local || b.loadToNode) {
+			return nil, fmt.Errorf("%w: %q: multiple platforms require buildkit to push to the cluster registry", ErrInvalid, cfg.Image)
+		}
+
+		if err := b.checkPlatforms(ctx, cfg.Platforms); err != nil {
+			return nil, err
+		}
+
+		frontendAttrs["platform"] = strings.Join(cfg.Platforms, ",")
+	}
+
+	if cfg.PinBaseImages {
+		pinned, err := b.pinnedContexts(ctx, buildFile, cfg.BuildArgs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to pin base images: %w", err)
+		}
+
+		maps.Copy(frontendAttrs, pinned)
+	}
+
+	// Named contexts are applied after pins, so that explicitly configured contexts take precedence.
+	if err := namedContexts(ctx, b.logger, cfg.BuildContexts, frontendAttrs, localMounts, ccb); err != nil {
+		return nil, err
+	}
+
+	cacheFrom, err := cacheImports(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheTo, err := cacheExports(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	attachable := b.attachable
+
+	if len(cfg.Secrets) > 0 {
+		secrets := make(map[string][]byte, len(cfg.Secrets))
+
+		for k, v := range cfg.Secrets {
+			secrets[k] = []byte(v)
+		}
+
+		attachable = append(slices.Clone(attachable), secretsprovider.FromMap(secrets))
+	}
+
 	solveOpt := client.SolveOpt{
 		Exports: []client.ExportEntry{
 			{
@@ -155,80 +461,65 @@ func (b *Builder) Build(ctx context.Context, cfg config.Image, baseDir string, f
 				},
 			},
 		},
-		LocalMounts: map[string]fsutil.FS{
-			"context":    cxtLocalMount,
-			"dockerfile": dockerfileLocalMount,
-		},
+		LocalMounts:   localMounts,
 		Frontend:      "gateway.v0",
 		FrontendAttrs: frontendAttrs,
-		Session:       b.attachable,
+		CacheImports:  cacheFrom,
+		CacheExports:  cacheTo,
+		Session:       attachable,
 	}
 
-	statusChan := make(chan *client.SolveStatus)
-
-	errgrp, gctx := errgroup.WithContext(ctx)
-
-	var resp *client.SolveResponse
-
-	errgrp.Go(func() error {
-		var err error
-
-		resp, err = b.c.Solve(gctx, nil, solveOpt, statusChan)
-
-		return err
-	})
-
-	errgrp.Go(func() error {
-		for {
-			ss, ok := <-statusChan
-			if !ok {
-				return nil
-			}
-
-			fn(ss)
-		}
-	})
-
-	err = errgrp.Wait()
+	artifact, err := b.solve(ctx, solveOpt, fn)
 	if err != nil {
 		return nil, err
 	}
 
-	b.logger.Info("Build complete", "response", resp.ExporterResponse)
+	if err := pruneManagedCaches(b.logger, cfg); err != nil {
+		b.logger.Warn("Failed to prune build caches", "err", err)
+	}
 
-	return &Artifact{
-		Name:   resp.ExporterResponse["image.name"],
-		Digest: resp.ExporterResponse["containerimage.digest"],
-	}, nil
+	return artifact, nil
 }
 
+// BuildOCI packages the directory as an OCI artifact and pushes it, tracing the solve.
 func (b *Builder) BuildOCI(
 	ctx context.Context,
 	baseDir string,
 	includePaths []string,
 	excludePaths []string,
 	image string,
+	ccb ContextCallbacks,
 	fn func(res *SolveStatus),
 ) (*Artifact, error) {
-	cxtLocalMount, err := fsutil.NewFS(baseDir)
-	if err != nil {
-		return nil, fmt.Errorf("invalid build context: %w", err)
-	}
+	ctx, span := tracer.Start(ctx, "package "+image)
 
-	if len(includePaths) == 0 {
-		includePaths = nil
-	}
+	st := newSolveTracer(ctx)
+
+	artifact, err := b.buildOCI(ctx, baseDir, includePaths, excludePaths, image, ccb, st.wrap(fn))
+
+	st.finish()
 
-	if len(excludePaths) == 0 {
-		excludePaths = nil
+	if artifact != nil {
+		span.SetAttributes(attribute.String("localflux.digest", artifact.Digest))
 	}
 
-	cxtLocalMount, err = fsutil.NewFilterFS(cxtLocalMount, &fsutil.FilterOpt{
-		IncludePatterns: includePaths,
-		ExcludePatterns: excludePaths,
-	})
+	endSpan(span, err)
+
+	return artifact, err
+}
+
+func (b *Builder) buildOCI(
+	ctx context.Context,
+	baseDir string,
+	includePaths []string,
+	excludePaths []string,
+	image string,
+	ccb ContextCallbacks,
+	fn func(res *SolveStatus),
+) (*Artifact, error) {
+	cxtLocalMount, err := prepareContext(ctx, b.logger, baseDir, includePaths, excludePaths, ccb)
 	if err != nil {
-		return nil, fmt.Errorf("invalid filter: %w", err)
+		return nil, err
 	}
 
 	dockerfileLocalMount := staticfs.NewFS()
@@ -266,6 +557,57 @@ COPY . .`),
 		Session: b.attachable,
 	}
 
+	return b.solve(ctx, solveOpt, fn)
+}
+
+// solve runs the build, reporting progress to fn. When building through Docker, the image is exported to the daemon
+// and then pushed to the cluster registry, as the daemon cannot be assumed to reach the registry itself.
+func (b *Builder) solve(ctx context.Context, solveOpt client.SolveOpt, fn func(res *SolveStatus)) (*Artifact, error) {
+	image := solveOpt.Exports[0].Attrs["name"]
+
+	// Step artifacts are pulled by Flux from the registry, so only images are loaded into the nodes. Loaded images are
+	// exported to localflux, even when buildkit could push them itself.
+	load := b.loadToNode && solveOpt.Exports[0].Attrs["oci-artifact"] != "true"
+	local := b.docker == nil && (b.local || load)
+
+	if b.docker != nil {
+		solveOpt.Exports = []client.ExportEntry{
+			{
+				Type: "moby",
+				Attrs: map[string]string{
+					"name": image,
+				},
+			},
+		}
+	}
+
+	var tarPath string
+
+	if local {
+		tmp, err := os.CreateTemp("", "localflux-image-*.tar")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp file: %w", err)
+		}
+
+		tarPath = tmp.Name()
+
+		// Buildkit closes the file once the export is written, but not if the build fails first.
+		defer os.Remove(tarPath)
+		defer tmp.Close()
+
+		solveOpt.Exports = []client.ExportEntry{
+			{
+				Type: client.ExporterDocker,
+				Attrs: map[string]string{
+					"name": image,
+				},
+				Output: func(map[string]string) (io.WriteCloser, error) {
+					return tmp, nil
+				},
+			},
+		}
+	}
+
 	statusChan := make(chan *client.SolveStatus)
 
 	errgrp, gctx := errgroup.WithContext(ctx)
@@ -291,13 +633,32 @@ COPY . .`),
 		}
 	})
 
-	err = errgrp.Wait()
+	err := errgrp.Wait()
 	if err != nil {
 		return nil, err
 	}
 
 	b.logger.Info("Build complete", "response", resp.ExporterResponse)
 
+	if b.docker != nil {
+		path, cleanup, err := saveFromDocker(ctx, b.docker, image)
+		if err != nil {
+			return nil, err
+		}
+
+		defer cleanup()
+
+		tarPath = path
+	}
+
+	if tarPath != "" {
+		if load {
+			return b.loadTarball(ctx, tarPath, image)
+		}
+
+		return b.pushTarball(ctx, tarPath, image)
+	}
+
 	return &Artifact{
 		Name:   resp.ExporterResponse["image.name"],
 		Digest: resp.ExporterResponse["containerimage.digest"],
@@ -0,0 +1,123 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/csnewman/localflux/internal/config"
+)
+
+const (
+	BuildArgGitSHA    = "LOCALFLUX_GIT_SHA"
+	BuildArgGitBranch = "LOCALFLUX_GIT_BRANCH"
+	BuildArgTimestamp = "LOCALFLUX_BUILD_TIMESTAMP"
+)
+
+// resolveBuildArgs expands references to environment variables and to the computed LOCALFLUX_* values within the
+// build args. "$$" produces a literal "$". Computed values are only determined when referenced. Build args referencing
+// secrets are left out, as they are passed as secrets instead.
+func resolveBuildArgs(ctx context.Context, image config.Image, now time.Time) (map[string]string, error) {
+	if len(image.BuildArgs) == 0 {
+		return image.BuildArgs, nil
+	}
+
+	dir := imageContext(image)
+	computed := make(map[string]string)
+
+	var resolveErr error
+
+	lookup := func(key string) string {
+		if key == "$" {
+			return "$"
+		}
+
+		if v, ok := computed[key]; ok {
+			return v
+		}
+
+		var (
+			v   string
+			err error
+		)
+
+		switch {
+		case strings.HasPrefix(key, secretRefPrefix):
+			err = fmt.Errorf("%w: expected ${secretRef:<source>:<key>}", ErrInvalid)
+		case key == BuildArgGitSHA && isGitContext(dir):
+			v, err = gitContextRevision(ctx, dir)
+		case key == BuildArgGitBranch && isGitContext(dir):
+			_, v, _ = splitGitContext(dir)
+		case key == BuildArgGitSHA:
+			v, err = gitOutput(ctx, dir, "rev-parse", "HEAD")
+		case key == BuildArgGitBranch:
+			v, err = gitOutput(ctx, dir, "rev-parse", "--abbrev-ref", "HEAD")
+		case key == BuildArgTimestamp:
+			v = now.UTC().Format(time.RFC3339)
+		default:
+			return os.Getenv(key)
+		}
+
+		if err != nil && resolveErr == nil {
+			resolveErr = fmt.Errorf("failed to resolve %s: %w", key, err)
+		}
+
+		computed[key] = v
+
+		return v
+	}
+
+	out := make(map[string]string, len(image.BuildArgs))
+
+	for k, v := range image.BuildArgs {
+		if hasSecretRefs(v) {
+			continue
+		}
+
+		out[k] = os.Expand(v, lookup)
+	}
+
+	if resolveErr != nil {
+		return nil, resolveErr
+	}
+
+	return out, nil
+}
+
+// buildSecrets returns the secrets of the image, alongside the build args that reference secrets. Build args are
+// recorded in the image history, so those referencing secrets are passed as secrets of the same name instead, which
+// RUN instructions mount with "--mount=type=secret,id=<name>,env=<name>".
+func buildSecrets(image config.Image) (map[string]string, error) {
+	secrets := maps.Clone(image.Secrets)
+
+	for k, v := range image.BuildArgs {
+		if !hasSecretRefs(v) {
+			continue
+		}
+
+		if _, ok := image.Secrets[k]; ok {
+			return nil, fmt.Errorf("%w: build arg %q references secrets, so may not share its name with a secret", ErrInvalid, k)
+		}
+
+		if secrets == nil {
+			secrets = make(map[string]string)
+		}
+
+		secrets[k] = v
+	}
+
+	return secrets, nil
+}
+
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...).Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,373 @@
+package deployment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/moby/buildkit/client"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	CacheTypeRegistry = "registry"
+	CacheTypeInline   = "inline"
+	CacheTypeLocal    = "local"
+)
+
+// cacheImports maps the image's cacheFrom entries to buildkit cache imports.
+func cacheImports(cfg config.Image) ([]client.CacheOptionsEntry, error) {
+	entries := make([]client.CacheOptionsEntry, 0, len(cfg.CacheFrom))
+
+	for _, cache := range cfg.CacheFrom {
+		attrs := maps.Clone(cache.Attrs)
+		if attrs == nil {
+			attrs = make(map[string]string)
+		}
+
+		entry := client.CacheOptionsEntry{
+			Type:  cache.Type,
+			Attrs: attrs,
+		}
+
+		switch cache.Type {
+		case CacheTypeRegistry:
+			if cache.Ref == "" {
+				return nil, fmt.Errorf("%w: registry cache of %q requires a ref", ErrInvalid, cfg.Image)
+			}
+
+			attrs["ref"] = cache.Ref
+		case CacheTypeInline:
+			// Inline caches are embedded in an image, which is imported through the registry backend.
+			entry.Type = CacheTypeRegistry
+			attrs["ref"] = cache.Ref
+
+			if cache.Ref == "" {
+				attrs["ref"] = cfg.Image
+			}
+		case CacheTypeLocal:
+			path, err := cachePath(cfg, cache)
+			if err != nil {
+				return nil, err
+			}
+
+			attrs["src"] = path
+		default:
+			return nil, fmt.Errorf("%w: unknown cache type %q", ErrInvalid, cache.Type)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// cacheExports maps the image's cacheTo entries to buildkit cache exports.
+func cacheExports(cfg config.Image) ([]client.CacheOptionsEntry, error) {
+	entries := make([]client.CacheOptionsEntry, 0, len(cfg.CacheTo))
+
+	for _, cache := range cfg.CacheTo {
+		attrs := maps.Clone(cache.Attrs)
+		if attrs == nil {
+			attrs = make(map[string]string)
+		}
+
+		if cache.Mode != "" {
+			attrs["mode"] = cache.Mode
+		}
+
+		switch cache.Type {
+		case CacheTypeRegistry:
+			if cache.Ref == "" {
+				return nil, fmt.Errorf("%w: registry cache of %q requires a ref", ErrInvalid, cfg.Image)
+			}
+
+			attrs["ref"] = cache.Ref
+		case CacheTypeInline:
+		case CacheTypeLocal:
+			path, err := cachePath(cfg, cache)
+			if err != nil {
+				return nil, err
+			}
+
+			attrs["dest"] = path
+		default:
+			return nil, fmt.Errorf("%w: unknown cache type %q", ErrInvalid, cache.Type)
+		}
+
+		entries = append(entries, client.CacheOptionsEntry{
+			Type:  cache.Type,
+			Attrs: attrs,
+		})
+	}
+
+	return entries, nil
+}
+
+func cachePath(cfg config.Image, cache config.BuildCache) (string, error) {
+	if cache.Path == "" {
+		return managedCacheDir(cfg.Image)
+	}
+
+	path, err := filepath.Abs(cache.Path)
+	if err != nil {
+		return "", fmt.Errorf("invalid cache path: %w", err)
+	}
+
+	return path, nil
+}
+
+// defaultCacheMaxSize bounds the managed caches of a project when no size is configured.
+var defaultCacheMaxSize = resource.MustParse("10Gi")
+
+var invalidCacheChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// managedCacheProjectDir returns the directory holding the managed caches of the project in the working directory.
+// The project is identified by its path, while the directory name keeps it recognisable.
+func managedCacheProjectDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find cache directory: %w", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(wd))
+	project := filepath.Base(wd) + "-" + hex.EncodeToString(sum[:])[:8]
+
+	return filepath.Join(cacheDir, "localflux", "buildcache", project), nil
+}
+
+func managedCacheDir(image string) (string, error) {
+	projectDir, err := managedCacheProjectDir()
+	if err != nil {
+		return "", err
+	}
+
+	repo, _ := splitImageTag(image)
+
+	return filepath.Join(projectDir, invalidCacheChars.ReplaceAllString(repo, "_")), nil
+}
+
+// pruneManagedCaches is run once an image has exported to a managed cache. Blobs no longer referenced by the cache are
+// removed, followed by the least recently used caches of the project while it exceeds its size limit.
+func pruneManagedCaches(logger *slog.Logger, cfg config.Image) error {
+	maxSize := -1
+
+	for _, cache := range cfg.CacheTo {
+		if cache.Type != CacheTypeLocal || cache.Path != "" {
+			continue
+		}
+
+		maxSize = int(defaultCacheMaxSize.Value())
+
+		if cache.MaxSize != nil {
+			maxSize = int(cache.MaxSize.Value())
+		}
+	}
+
+	if maxSize < 0 {
+		return nil
+	}
+
+	current, err := managedCacheDir(cfg.Image)
+	if err != nil {
+		return err
+	}
+
+	if err := gcCacheLayout(current); err != nil {
+		logger.Warn("Failed to remove unreferenced cache blobs", "dir", current, "err", err)
+	}
+
+	projectDir := filepath.Dir(current)
+
+	entries, err := os.ReadDir(projectDir)
+	if err != nil {
+		return fmt.Errorf("failed to list caches: %w", err)
+	}
+
+	type cacheDir struct {
+		path    string
+		size    int
+		modTime time.Time
+	}
+
+	var (
+		dirs  []cacheDir
+		total int
+	)
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(projectDir, entry.Name())
+
+		size, err := dirSize(path)
+		if err != nil {
+			return err
+		}
+
+		// The index is rewritten on every export, so it tracks when the cache was last used.
+		var modTime time.Time
+
+		if info, err := os.Stat(filepath.Join(path, "index.json")); err == nil {
+			modTime = info.ModTime()
+		}
+
+		dirs = append(dirs, cacheDir{path: path, size: size, modTime: modTime})
+		total += size
+	}
+
+	slices.SortFunc(dirs, func(a, b cacheDir) int {
+		return a.modTime.Compare(b.modTime)
+	})
+
+	for _, dir := range dirs {
+		if total <= maxSize {
+			break
+		}
+
+		if dir.path == current {
+			continue
+		}
+
+		logger.Info("Removing least recently used build cache", "dir", dir.path, "size", dir.size)
+
+		if err := os.RemoveAll(dir.path); err != nil {
+			return fmt.Errorf("failed to remove cache: %w", err)
+		}
+
+		total -= dir.size
+	}
+
+	return nil
+}
+
+func dirSize(dir string) (int, error) {
+	var size int
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		size += int(info.Size())
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure cache: %w", err)
+	}
+
+	return size, nil
+}
+
+type cacheDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+}
+
+type cacheNode struct {
+	Manifests []cacheDescriptor `json:"manifests"`
+	Layers    []cacheDescriptor `json:"layers"`
+	Config    *cacheDescriptor  `json:"config"`
+}
+
+// gcCacheLayout removes the blobs of the OCI layout that are not reachable from its index. Buildkit adds blobs to a
+// local cache on every export, but never removes those of earlier exports.
+func gcCacheLayout(dir string) error {
+	keep := make(map[string]bool)
+
+	var walk func(path string) error
+
+	walk = func(path string) error {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var node cacheNode
+
+		if err := json.Unmarshal(raw, &node); err != nil {
+			return err
+		}
+
+		children := append(slices.Clone(node.Manifests), node.Layers...)
+
+		if node.Config != nil {
+			children = append(children, *node.Config)
+		}
+
+		for _, child := range children {
+			if keep[child.Digest] {
+				continue
+			}
+
+			keep[child.Digest] = true
+
+			if !strings.HasSuffix(child.MediaType, "json") ||
+				!(strings.Contains(child.MediaType, "manifest") || strings.Contains(child.MediaType, "index")) {
+				continue
+			}
+
+			algo, hash, ok := strings.Cut(child.Digest, ":")
+			if !ok {
+				return fmt.Errorf("invalid digest %q", child.Digest)
+			}
+
+			if err := walk(filepath.Join(dir, "blobs", algo, hash)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := walk(filepath.Join(dir, "index.json")); err != nil {
+		return err
+	}
+
+	blobsDir := filepath.Join(dir, "blobs")
+
+	return filepath.WalkDir(blobsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(blobsDir, path)
+		if err != nil {
+			return err
+		}
+
+		if keep[strings.Replace(filepath.ToSlash(rel), "/", ":", 1)] {
+			return nil
+		}
+
+		return os.Remove(path)
+	})
+}
@@ -0,0 +1,70 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/tonistiigi/fsutil"
+)
+
+// remoteContextPrefixes are the named context sources resolved by buildkit itself.
+var remoteContextPrefixes = []string{"docker-image://", "target:", "https://", "http://", "git://", "git@"}
+
+// namedContexts adds the frontend attributes and local mounts for the named build contexts. Local directories are
+// mounted under their own name, honouring any .dockerignore within them.
+func namedContexts(
+	ctx context.Context,
+	logger *slog.Logger,
+	contexts map[string]string,
+	frontendAttrs map[string]string,
+	localMounts map[string]fsutil.FS,
+	cb ContextCallbacks,
+) error {
+	for _, name := range slices.Sorted(maps.Keys(contexts)) {
+		value := contexts[name]
+
+		if name == "" || value == "" {
+			return fmt.Errorf("%w: build contexts require a name and a value", ErrInvalid)
+		}
+
+		if slices.ContainsFunc(remoteContextPrefixes, func(prefix string) bool {
+			return strings.HasPrefix(value, prefix)
+		}) {
+			frontendAttrs["context:"+name] = value
+
+			continue
+		}
+
+		if strings.Contains(value, "://") {
+			return fmt.Errorf("%w: unsupported build context %q for %q", ErrInvalid, value, name)
+		}
+
+		if info, err := os.Stat(value); err != nil {
+			return fmt.Errorf("invalid build context %q: %w", name, err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("%w: build context %q is not a directory", ErrInvalid, name)
+		}
+
+		excludePaths, err := dockerIgnorePatterns(value, "")
+		if err != nil {
+			return err
+		}
+
+		mount, err := prepareContext(ctx, logger, value, nil, excludePaths, cb)
+		if err != nil {
+			return fmt.Errorf("invalid build context %q: %w", name, err)
+		}
+
+		mountName := "named-context-" + name
+
+		localMounts[mountName] = mount
+		frontendAttrs["context:"+name] = "local:" + mountName
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os/exec"
+	"slices"
+	"time"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/moby/buildkit/client"
+	"github.com/opencontainers/go-digest"
+)
+
+var ErrPackNotFound = errors.New("pack CLI not found")
+
+// buildPacks builds the image with the pack CLI into the local Docker daemon and pushes it to the cluster registry.
+func (b *Builder) buildPacks(ctx context.Context, cfg config.Image, baseDir string, fn func(res *SolveStatus)) (*Artifact, error) {
+	if len(cfg.IncludePaths) > 0 || len(cfg.ExcludePaths) > 0 {
+		return nil, fmt.Errorf("%w: include and exclude paths are not supported by buildpacks, use project.toml", ErrInvalid)
+	}
+
+	if _, err := exec.LookPath("pack"); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPackNotFound, err)
+	}
+
+	docker, closeDocker, err := b.localDocker()
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeDocker()
+
+	buildCtx := cfg.Context
+	if buildCtx == "" {
+		buildCtx = baseDir
+	}
+
+	args := []string{
+		"build", cfg.Image,
+		"--builder", cfg.Buildpacks.Builder,
+		"--path", buildCtx,
+		"--pull-policy", "if-not-present",
+	}
+
+	for _, bp := range cfg.Buildpacks.Buildpacks {
+		args = append(args, "--buildpack", bp)
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(cfg.Buildpacks.Env)) {
+		args = append(args, "--env", k+"="+cfg.Buildpacks.Env[k])
+	}
+
+	if cfg.Buildpacks.ProcessType != "" {
+		args = append(args, "--default-process", cfg.Buildpacks.ProcessType)
+	}
+
+	b.logger.Info("Running pack", "args", args)
+
+	cmd := exec.CommandContext(ctx, "pack", args...)
+
+	if err := runVertexCommand(cmd, "pack:"+cfg.Image, "[buildpacks] pack build "+cfg.Image, fn); err != nil {
+		return nil, fmt.Errorf("pack build failed: %w", err)
+	}
+
+	return b.pushFromDocker(ctx, docker, cfg.Image)
+}
+
+// runVertexCommand runs the command, reporting it as a single build vertex with its output as the vertex log, so that
+// it is shown like any other build.
+func runVertexCommand(cmd *exec.Cmd, key string, name string, fn func(res *SolveStatus)) error {
+	vertex := &client.Vertex{
+		Digest: digest.FromString(key),
+		Name:   name,
+	}
+
+	started := time.Now()
+	vertex.Started = &started
+
+	fn(&client.SolveStatus{Vertexes: []*client.Vertex{vertex}})
+
+	// A single writer for both streams ensures the output is reported in order.
+	out := &vertexLogWriter{vertex: vertex.Digest, fn: fn}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	err := cmd.Run()
+
+	completed := time.Now()
+	done := *vertex
+	done.Completed = &completed
+
+	if err != nil {
+		done.Error = err.Error()
+	}
+
+	fn(&client.SolveStatus{Vertexes: []*client.Vertex{&done}})
+
+	return err
+}
+
+// vertexLogWriter reports written data as the log of a build vertex.
+type vertexLogWriter struct {
+	vertex digest.Digest
+	fn     func(res *SolveStatus)
+}
+
+func (w *vertexLogWriter) Write(p []byte) (int, error) {
+	w.fn(&client.SolveStatus{
+		Logs: []*client.VertexLog{
+			{
+				Vertex:    w.vertex,
+				Stream:    1,
+				Data:      slices.Clone(p),
+				Timestamp: time.Now(),
+			},
+		},
+	})
+
+	return len(p), nil
+}
@@ -0,0 +1,41 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/csnewman/localflux/internal/config"
+	helmv2 "github.com/fluxcd/helm-controller/api/v2"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
+)
+
+// checkCapabilities verifies that the cluster provides everything the steps depend on, before any work is started.
+func (m *Manager) checkCapabilities(ctx context.Context, clusterName string, steps []config.Step, opts DeployOptions) error {
+	caps, err := m.clusters.Capabilities(ctx, clusterName)
+	if err != nil {
+		return fmt.Errorf("failed to probe cluster capabilities: %w", err)
+	}
+
+	for _, step := range steps {
+		required := step.Requires
+
+		// Directly applied steps do not depend on Flux.
+		if !isDirect(step, opts) {
+			if step.Kustomize != nil || step.Manifests != nil || step.Git != nil || step.Compose != nil {
+				required = append([]string{kustomizev1.GroupVersion.Group}, required...)
+			}
+
+			if step.Helm != nil {
+				required = append([]string{helmv2.GroupVersion.Group}, required...)
+			}
+		}
+
+		for _, name := range required {
+			if err := caps.Check(name); err != nil {
+				return fmt.Errorf("step %q: %w", step.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
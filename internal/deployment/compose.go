@@ -0,0 +1,171 @@
+package deployment
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/csnewman/localflux/internal/compose"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+)
+
+// applyCompose returns a copy of the deployment with the images built by its compose steps added, and their registry
+// resolved to that of the cluster when not set. The original deployment is left unmodified.
+func (m *Manager) applyCompose(deployment config.Deployment, clusterName string) (config.Deployment, error) {
+	if !slices.ContainsFunc(deployment.Steps, func(step config.Step) bool { return step.Compose != nil }) {
+		return deployment, nil
+	}
+
+	out := deployment.DeepCopy()
+
+	for _, step := range out.Steps {
+		if step.Compose == nil {
+			continue
+		}
+
+		if step.Compose.Registry == "" {
+			if clusterName == "" {
+				clusterName = m.cfg.DefaultCluster
+			}
+
+			provider, err := m.clusters.Provider(clusterName)
+			if err != nil {
+				return nil, err
+			}
+
+			step.Compose.Registry = provider.Registry()
+		}
+
+		project, services, err := loadCompose(step.Compose)
+		if err != nil {
+			return nil, fmt.Errorf("step %q: %w", step.Name, err)
+		}
+
+		for _, image := range project.Images(step.Compose.Registry, services) {
+			// Images defined on the deployment take precedence, allowing the build to be customised.
+			if slices.ContainsFunc(out.Images, func(existing *v1alpha2.Image) bool {
+				return existing.Image == image.Image
+			}) {
+				continue
+			}
+
+			out.Images = append(out.Images, &v1alpha2.Image{
+				Image:     image.Image,
+				Context:   image.Context,
+				File:      image.File,
+				Target:    image.Target,
+				BuildArgs: image.BuildArgs,
+			})
+		}
+	}
+
+	return out, nil
+}
+
+func loadCompose(c config.Compose) (*compose.Project, []string, error) {
+	project, err := compose.Load(c.File)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	services, err := project.Select(c.Services)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return project, services, nil
+}
+
+// composeReferencesImage reports whether one of the step's services runs the image.
+func composeReferencesImage(c config.Compose, image string) (bool, error) {
+	project, services, err := loadCompose(c)
+	if err != nil {
+		return false, err
+	}
+
+	return slices.ContainsFunc(services, func(name string) bool {
+		return project.ImageName(c.Registry, name) == image
+	}), nil
+}
+
+// stageCompose converts compose steps into kustomize steps by writing the manifests of their services into a
+// temporary directory alongside a generated kustomization.yaml. Other steps are returned unchanged. The returned
+// cleanup function removes any staged directories.
+func stageCompose(steps []config.Step, cb Callbacks) ([]config.Step, func(), error) {
+	var dirs []string
+
+	cleanup := func() {
+		for _, dir := range dirs {
+			_ = os.RemoveAll(dir)
+		}
+	}
+
+	staged := make([]config.Step, 0, len(steps))
+
+	for _, step := range steps {
+		if step.Compose == nil {
+			staged = append(staged, step)
+
+			continue
+		}
+
+		if step.Kustomize != nil || step.Helm != nil || step.Git != nil || step.Manifests != nil {
+			cleanup()
+
+			return nil, nil, fmt.Errorf("%w: %q has multiple actions defined", ErrInvalid, step.Name)
+		}
+
+		project, services, err := loadCompose(step.Compose)
+		if err != nil {
+			cleanup()
+
+			return nil, nil, fmt.Errorf("step %q: %w", step.Name, err)
+		}
+
+		for _, warning := range project.Warnings {
+			cb.Warn(fmt.Sprintf("Step %q: %s", step.Name, warning))
+		}
+
+		manifests, err := project.Manifests(step.Compose.Registry, services)
+		if err != nil {
+			cleanup()
+
+			return nil, nil, fmt.Errorf("step %q: %w", step.Name, err)
+		}
+
+		dir, err := os.MkdirTemp("", "localflux-compose-")
+		if err != nil {
+			cleanup()
+
+			return nil, nil, fmt.Errorf("failed to create staging directory: %w", err)
+		}
+
+		dirs = append(dirs, dir)
+
+		if err := os.WriteFile(filepath.Join(dir, "services.yaml"), manifests, 0o644); err != nil {
+			cleanup()
+
+			return nil, nil, fmt.Errorf("failed to stage manifests: %w", err)
+		}
+
+		if err := writeKustomization(dir, []string{"services.yaml"}); err != nil {
+			cleanup()
+
+			return nil, nil, err
+		}
+
+		converted := step.DeepCopy()
+		converted.Compose = nil
+		converted.Kustomize = &v1alpha2.Kustomize{
+			Context:   dir,
+			Namespace: step.Compose.Namespace,
+			Wait:      step.Compose.Wait,
+		}
+
+		staged = append(staged, converted)
+	}
+
+	return staged, cleanup, nil
+}
@@ -0,0 +1,301 @@
+package deployment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+
+	"github.com/fluxcd/pkg/apis/kustomize"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resource"
+	kustypes "sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/yaml"
+)
+
+const ConfigHashAnnotation = "flux.local/config-hash"
+
+var workloadKinds = map[string]string{
+	"Deployment":  "apps",
+	"StatefulSet": "apps",
+	"DaemonSet":   "apps",
+}
+
+// renderKustomize builds the kustomization at dir locally, as flux would before substitution. Directories without a
+// kustomization are built from the manifests they contain, as the kustomize-controller does.
+func renderKustomize(dir string) ([]*resource.Resource, error) {
+	fSys := filesys.MakeFsOnDisk()
+
+	if !hasKustomization(fSys, dir) {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve path: %w", err)
+		}
+
+		dir = abs
+
+		mem, err := copyToMemory(fSys, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := editKustomization(mem, dir, func(*kustypes.Kustomization) error { return nil }); err != nil {
+			return nil, err
+		}
+
+		fSys = mem
+	}
+
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+
+	resMap, err := k.Run(fSys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build kustomization: %w", err)
+	}
+
+	return resMap.Resources(), nil
+}
+
+func hasKustomization(fSys filesys.FileSystem, dir string) bool {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if fSys.Exists(filepath.Join(dir, name)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copyToMemory copies the files within dir into an in-memory file system, at the same paths, so that a kustomization
+// can be generated for them without modifying the directory.
+func copyToMemory(fSys filesys.FileSystem, dir string) (filesys.FileSystem, error) {
+	mem := filesys.MakeFsInMemory()
+
+	err := fSys.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return mem.MkdirAll(path)
+		}
+
+		data, err := fSys.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return mem.WriteFile(path, data)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", dir, err)
+	}
+
+	return mem, nil
+}
+
+// configHashPatches renders the kustomization and generates patches that annotate each workload with a hash of the
+// ConfigMaps and Secrets it references. The substitutions are included in the hash, as flux applies them after the
+// build.
+func configHashPatches(dir string, substitute map[string]string) ([]kustomize.Patch, error) {
+	resources, err := renderKustomize(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make(map[string]string)
+
+	for _, res := range resources {
+		kind := res.GetKind()
+		if kind != "ConfigMap" && kind != "Secret" {
+			continue
+		}
+
+		raw, err := res.AsYAML()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s %q: %w", kind, res.GetName(), err)
+		}
+
+		sum := sha256.Sum256(raw)
+
+		configs[kind+"/"+res.GetName()+"/"+res.GetNamespace()] = hex.EncodeToString(sum[:])
+	}
+
+	substituteKeys := make([]string, 0, len(substitute))
+
+	for k := range substitute {
+		substituteKeys = append(substituteKeys, k)
+	}
+
+	slices.Sort(substituteKeys)
+
+	var patches []kustomize.Patch
+
+	for _, res := range resources {
+		group, ok := workloadKinds[res.GetKind()]
+		if !ok {
+			continue
+		}
+
+		refs, err := workloadConfigRefs(res)
+		if err != nil {
+			return nil, err
+		}
+
+		h := sha256.New()
+		found := false
+
+		for _, ref := range refs {
+			sum, ok := configs[ref+"/"+res.GetNamespace()]
+			if !ok {
+				continue
+			}
+
+			found = true
+
+			h.Write([]byte(sum))
+		}
+
+		if !found {
+			continue
+		}
+
+		for _, k := range substituteKeys {
+			h.Write([]byte(k + "=" + substitute[k] + "\n"))
+		}
+
+		metadata := map[string]any{
+			"name": res.GetName(),
+		}
+
+		if ns := res.GetNamespace(); ns != "" {
+			metadata["namespace"] = ns
+		}
+
+		patch, err := yaml.Marshal(map[string]any{
+			"apiVersion": res.GetApiVersion(),
+			"kind":       res.GetKind(),
+			"metadata":   metadata,
+			"spec": map[string]any{
+				"template": map[string]any{
+					"metadata": map[string]any{
+						"annotations": map[string]string{
+							ConfigHashAnnotation: hex.EncodeToString(h.Sum(nil))[:16],
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode patch: %w", err)
+		}
+
+		patches = append(patches, kustomize.Patch{
+			Patch: string(patch),
+			// Workloads of the same name may exist in several namespaces, each with its own config. Workloads without
+			// a namespace are matched in any.
+			Target: &kustomize.Selector{
+				Group:     group,
+				Kind:      res.GetKind(),
+				Name:      res.GetName(),
+				Namespace: res.GetNamespace(),
+			},
+		})
+	}
+
+	return patches, nil
+}
+
+// workloadConfigRefs returns the ConfigMaps and Secrets referenced by the pod template of a workload, in the form
+// "<kind>/<name>".
+func workloadConfigRefs(res *resource.Resource) ([]string, error) {
+	m, err := res.Map()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s %q: %w", res.GetKind(), res.GetName(), err)
+	}
+
+	spec, _ := m["spec"].(map[string]any)
+	rawTemplate, _ := spec["template"].(map[string]any)
+
+	if rawTemplate == nil {
+		return nil, nil
+	}
+
+	var template corev1.PodTemplateSpec
+
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawTemplate, &template); err != nil {
+		return nil, fmt.Errorf("failed to decode pod template of %s %q: %w", res.GetKind(), res.GetName(), err)
+	}
+
+	var refs []string
+
+	add := func(kind string, name string) {
+		ref := kind + "/" + name
+
+		if name != "" && !slices.Contains(refs, ref) {
+			refs = append(refs, ref)
+		}
+	}
+
+	for _, vol := range template.Spec.Volumes {
+		if vol.ConfigMap != nil {
+			add("ConfigMap", vol.ConfigMap.Name)
+		}
+
+		if vol.Secret != nil {
+			add("Secret", vol.Secret.SecretName)
+		}
+
+		if vol.Projected != nil {
+			for _, src := range vol.Projected.Sources {
+				if src.ConfigMap != nil {
+					add("ConfigMap", src.ConfigMap.Name)
+				}
+
+				if src.Secret != nil {
+					add("Secret", src.Secret.Name)
+				}
+			}
+		}
+	}
+
+	containers := slices.Concat(template.Spec.InitContainers, template.Spec.Containers)
+
+	for _, c := range containers {
+		for _, from := range c.EnvFrom {
+			if from.ConfigMapRef != nil {
+				add("ConfigMap", from.ConfigMapRef.Name)
+			}
+
+			if from.SecretRef != nil {
+				add("Secret", from.SecretRef.Name)
+			}
+		}
+
+		for _, env := range c.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+
+			if env.ValueFrom.ConfigMapKeyRef != nil {
+				add("ConfigMap", env.ValueFrom.ConfigMapKeyRef.Name)
+			}
+
+			if env.ValueFrom.SecretKeyRef != nil {
+				add("Secret", env.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+	}
+
+	return refs, nil
+}
+
+func kustomizeDir(context string, path string) string {
+	return filepath.Join(context, filepath.FromSlash(path))
+}
@@ -0,0 +1,313 @@
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/moby/patternmatcher/ignorefile"
+	"github.com/tonistiigi/fsutil"
+	"github.com/tonistiigi/units"
+)
+
+const (
+	// largeFileThreshold is the size above which context files are reported to the user.
+	largeFileThreshold = 50 * 1024 * 1024
+	// progressThreshold is the size above which per-file transfer progress is reported.
+	progressThreshold = 1024 * 1024
+	// progressInterval limits how often transfer progress is reported for a single file.
+	progressInterval = 250 * time.Millisecond
+	// lfsPointerMaxSize is the maximum size of a git-lfs pointer file.
+	lfsPointerMaxSize = 1024
+)
+
+var lfsPointerPrefix = []byte("version https://git-lfs.github.com/spec/v1")
+
+// ContextCallbacks receives notifications while a build context is prepared and transferred.
+type ContextCallbacks struct {
+	Warn func(msg string)
+
+	File func(path string, sent int64, size int64)
+}
+
+func (c ContextCallbacks) warn(msg string) {
+	if c.Warn != nil {
+		c.Warn(msg)
+	}
+}
+
+// contextCallbacks reports context warnings and transfer progress through the deployment callbacks.
+func contextCallbacks(cb Callbacks, msg string, start time.Time) ContextCallbacks {
+	return ContextCallbacks{
+		Warn: cb.Warn,
+		File: func(path string, sent int64, size int64) {
+			cb.State(msg, fmt.Sprintf("Sending %s (%.2f / %.2f)", path, units.Bytes(sent), units.Bytes(size)), start)
+		},
+	}
+}
+
+type contextReport struct {
+	sizes       map[string]int64
+	lfsPointers []string
+	largeFiles  []string
+}
+
+// inspectContext walks the filtered context looking for git-lfs pointers and large files.
+func inspectContext(ctx context.Context, cfs fsutil.FS) (*contextReport, error) {
+	report := &contextReport{
+		sizes: make(map[string]int64),
+	}
+
+	err := cfs.Walk(ctx, "", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		report.sizes[path] = info.Size()
+
+		if info.Size() >= largeFileThreshold {
+			report.largeFiles = append(report.largeFiles, path)
+		}
+
+		if info.Size() > lfsPointerMaxSize {
+			return nil
+		}
+
+		r, err := cfs.Open(path)
+		if err != nil {
+			return err
+		}
+
+		defer r.Close()
+
+		head := make([]byte, len(lfsPointerPrefix))
+
+		if _, err := io.ReadFull(r, head); err != nil {
+			return nil
+		}
+
+		if bytes.Equal(head, lfsPointerPrefix) {
+			report.lfsPointers = append(report.lfsPointers, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect context: %w", err)
+	}
+
+	return report, nil
+}
+
+// dockerIgnorePatterns returns the exclude patterns of the ignore file that applies to the Dockerfile. As with docker,
+// a "<Dockerfile>.dockerignore" file next to the Dockerfile takes precedence over a ".dockerignore" file in the root
+// of the context.
+func dockerIgnorePatterns(contextDir string, dockerfile string) ([]string, error) {
+	paths := []string{filepath.Join(contextDir, ".dockerignore")}
+
+	if dockerfile != "" {
+		paths = slices.Insert(paths, 0, dockerfile+".dockerignore")
+	}
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to open ignore file: %w", err)
+		}
+
+		patterns, err := ignorefile.ReadAll(f)
+
+		_ = f.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %q: %w", path, err)
+		}
+
+		return patterns, nil
+	}
+
+	return nil, nil
+}
+
+// prepareContext opens the build context, resolves any git-lfs pointers where possible and wraps the filesystem to
+// report per-file transfer progress.
+func prepareContext(
+	ctx context.Context,
+	logger *slog.Logger,
+	dir string,
+	includePaths []string,
+	excludePaths []string,
+	cb ContextCallbacks,
+) (fsutil.FS, error) {
+	if len(includePaths) == 0 {
+		includePaths = nil
+	}
+
+	if len(excludePaths) == 0 {
+		excludePaths = nil
+	}
+
+	open := func() (fsutil.FS, error) {
+		cfs, err := fsutil.NewFS(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid build context: %w", err)
+		}
+
+		cfs, err = fsutil.NewFilterFS(cfs, &fsutil.FilterOpt{
+			IncludePatterns: includePaths,
+			ExcludePatterns: excludePaths,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+
+		return cfs, nil
+	}
+
+	cfs, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := inspectContext(ctx, cfs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(report.lfsPointers) > 0 {
+		logger.Info("Found git-lfs pointers in context", "dir", dir, "files", report.lfsPointers)
+
+		if err := pullLFS(ctx, dir, report.lfsPointers); err != nil {
+			logger.Warn("Failed to resolve git-lfs pointers", "err", err)
+
+			cb.warn(fmt.Sprintf(
+				"%d git-lfs pointer(s) in %q were not resolved and will be uploaded as-is (run \"git lfs pull\"): %v",
+				len(report.lfsPointers), dir, err,
+			))
+		} else {
+			cfs, err = open()
+			if err != nil {
+				return nil, err
+			}
+
+			report, err = inspectContext(ctx, cfs)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, path := range report.largeFiles {
+		cb.warn(fmt.Sprintf(
+			"Large file in context %q: %s (%.2f), consider excluding it",
+			dir, path, units.Bytes(report.sizes[path]),
+		))
+	}
+
+	if cb.File == nil {
+		return cfs, nil
+	}
+
+	return &progressFS{
+		FS:    cfs,
+		sizes: report.sizes,
+		fn:    cb.File,
+	}, nil
+}
+
+// pullLFS fetches the content of git-lfs pointer files within dir.
+func pullLFS(ctx context.Context, dir string, paths []string) error {
+	if _, err := exec.LookPath("git-lfs"); err != nil {
+		return errors.New("git-lfs is not installed")
+	}
+
+	prefix, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "--show-prefix").Output()
+	if err != nil {
+		return fmt.Errorf("context is not inside a git repository: %w", err)
+	}
+
+	include := make([]string, 0, len(paths))
+
+	for _, path := range paths {
+		include = append(include, strings.TrimSpace(string(prefix))+filepath.ToSlash(path))
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "lfs", "pull", "--include", strings.Join(include, ","))
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git lfs pull failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// progressFS reports how much of each large file has been read while the context is transferred.
+type progressFS struct {
+	fsutil.FS
+
+	sizes map[string]int64
+	fn    func(path string, sent int64, size int64)
+}
+
+func (p *progressFS) Open(path string) (io.ReadCloser, error) {
+	r, err := p.FS.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	size := p.sizes[path]
+	if size < progressThreshold {
+		return r, nil
+	}
+
+	return &progressReader{
+		ReadCloser: r,
+		path:       path,
+		size:       size,
+		fn:         p.fn,
+	}, nil
+}
+
+type progressReader struct {
+	io.ReadCloser
+
+	path string
+	size int64
+	sent int64
+	last time.Time
+	fn   func(path string, sent int64, size int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+
+	r.sent += int64(n)
+
+	if err != nil || time.Since(r.last) >= progressInterval {
+		r.last = time.Now()
+		r.fn(r.path, r.sent, r.size)
+	}
+
+	return n, err
+}
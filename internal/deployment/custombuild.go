@@ -0,0 +1,103 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// buildCustom builds the image by running the user supplied command, then resolves the digest of the pushed image
+// from the cluster registry.
+func (b *Builder) buildCustom(ctx context.Context, cfg config.Image, baseDir string, fn func(res *SolveStatus)) (*Artifact, error) {
+	buildCtx := cfg.Context
+	if buildCtx == "" {
+		buildCtx = baseDir
+	}
+
+	buildCtx, err := filepath.Abs(buildCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve build context: %w", err)
+	}
+
+	repo, tag := splitImageTag(cfg.Image)
+
+	env := append(os.Environ(),
+		"IMAGE="+cfg.Image,
+		"IMAGE_REPO="+repo,
+		"IMAGE_TAG="+tag,
+		"REGISTRY="+b.provider.Registry(),
+		// Images are built for the cluster nodes, which are assumed to match the host.
+		"PLATFORM=linux/"+runtime.GOARCH,
+		"BUILD_CONTEXT="+buildCtx,
+	)
+
+	for _, k := range slices.Sorted(maps.Keys(cfg.Custom.Env)) {
+		env = append(env, k+"="+cfg.Custom.Env[k])
+	}
+
+	b.logger.Info("Running custom build", "image", cfg.Image, "command", cfg.Custom.Command)
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", cfg.Custom.Command)
+	cmd.Dir = buildCtx
+	cmd.Env = env
+
+	if err := runVertexCommand(cmd, "custom:"+cfg.Image, "[custom] "+cfg.Custom.Command, fn); err != nil {
+		return nil, fmt.Errorf("custom build failed: %w", err)
+	}
+
+	if cfg.Custom.Local {
+		docker, closeDocker, err := b.localDocker()
+		if err != nil {
+			return nil, err
+		}
+
+		defer closeDocker()
+
+		return b.pushFromDocker(ctx, docker, cfg.Image)
+	}
+
+	return b.resolvePushed(ctx, cfg.Image)
+}
+
+// resolvePushed looks up the digest of an image pushed to the cluster registry.
+func (b *Builder) resolvePushed(ctx context.Context, image string) (*Artifact, error) {
+	ref, err := name.ParseReference(image, name.Insecure)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference: %w", err)
+	}
+
+	trans, auth, err := b.provider.RegistryConn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to registry: %w", err)
+	}
+
+	desc, err := remote.Head(ref, remote.WithContext(ctx), remote.WithTransport(trans), remote.WithAuth(auth))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve pushed image %q: %w", image, err)
+	}
+
+	return &Artifact{
+		Name:   image,
+		Digest: desc.Digest.String(),
+	}, nil
+}
+
+// splitImageTag splits an image reference into its repository and tag, defaulting the tag to "latest".
+func splitImageTag(image string) (string, string) {
+	idx := strings.LastIndex(image, ":")
+	if idx == -1 || strings.Contains(image[idx:], "/") {
+		return image, "latest"
+	}
+
+	return image[:idx], image[idx+1:]
+}
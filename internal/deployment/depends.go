@@ -0,0 +1,107 @@
+package deployment
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	helmv2 "github.com/fluxcd/helm-controller/api/v2"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
+	"github.com/fluxcd/pkg/apis/meta"
+)
+
+// orderSteps sorts the steps so that each follows the steps it depends on, otherwise keeping the deployment order.
+// Dependencies on steps that are not in the list are assumed to be deployed already.
+func orderSteps(deployment config.Deployment, steps []config.Step) ([]config.Step, error) {
+	for _, step := range deployment.Steps {
+		for _, dep := range step.DependsOn {
+			if !slices.ContainsFunc(deployment.Steps, func(s config.Step) bool { return s.Name == dep }) {
+				return nil, fmt.Errorf("%w: step %q depends on unknown step %q", ErrInvalid, step.Name, dep)
+			}
+		}
+	}
+
+	ordered := make([]config.Step, 0, len(steps))
+	state := make(map[string]int, len(steps))
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	var visit func(step config.Step) error
+
+	visit = func(step config.Step) error {
+		switch state[step.Name] {
+		case visiting:
+			return fmt.Errorf("%w: dependency cycle involving step %q", ErrInvalid, step.Name)
+		case visited:
+			return nil
+		}
+
+		state[step.Name] = visiting
+
+		for _, dep := range step.DependsOn {
+			idx := slices.IndexFunc(steps, func(s config.Step) bool { return s.Name == dep })
+			if idx < 0 {
+				continue
+			}
+
+			if err := visit(steps[idx]); err != nil {
+				return err
+			}
+		}
+
+		state[step.Name] = visited
+		ordered = append(ordered, step)
+
+		return nil
+	}
+
+	for _, step := range steps {
+		if err := visit(step); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// fluxDependsOn returns the Flux dependencies of an object of the given kind created for the step. Flux can only
+// express dependencies between objects of the same kind, so dependencies on other kinds of step, or on directly
+// applied steps, are left to the client-side ordering.
+func fluxDependsOn(deployment config.Deployment, step config.Step, kind string) []meta.NamespacedObjectReference {
+	var refs []meta.NamespacedObjectReference
+
+	for _, dep := range step.DependsOn {
+		idx := slices.IndexFunc(deployment.Steps, func(s config.Step) bool { return s.Name == dep })
+		if idx < 0 {
+			continue
+		}
+
+		depStep := deployment.Steps[idx]
+
+		var depKind string
+
+		switch {
+		case depStep.ApplyMode == ApplyModeDirect:
+			continue
+		case depStep.Kustomize != nil, depStep.Manifests != nil, depStep.Git != nil:
+			depKind = kustomizev1.KustomizationKind
+		case depStep.Helm != nil:
+			depKind = helmv2.HelmReleaseKind
+		}
+
+		if depKind != kind {
+			continue
+		}
+
+		refs = append(refs, meta.NamespacedObjectReference{
+			Name:      fixName(deployment.Name) + "-" + fixName(depStep.Name),
+			Namespace: cluster.LFNamespace,
+		})
+	}
+
+	return refs
+}
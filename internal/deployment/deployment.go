@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
@@ -20,8 +21,11 @@ import (
 	"github.com/fluxcd/pkg/apis/kustomize"
 	"github.com/fluxcd/pkg/apis/meta"
 	"github.com/fluxcd/pkg/chartutil"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	sourcev1b2 "github.com/fluxcd/source-controller/api/v1beta2"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -49,6 +53,42 @@ func NewManager(logger *slog.Logger, cfg config.Config, clusters *cluster.Manage
 	}
 }
 
+// configPath resolves a path relative to the config file.
+func (m *Manager) configPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(m.cfg.Dir, path)
+}
+
+// renderTemplates renders the templates of the deployment, reading git metadata from the directory of the config.
+// Deployments without templating are returned as is, without collecting the template data.
+func (m *Manager) renderTemplates(
+	ctx context.Context,
+	deployment config.Deployment,
+	profile string,
+	clusterName string,
+) (config.Deployment, error) {
+	if !deployment.Templating {
+		return deployment, nil
+	}
+
+	return config.RenderTemplates(
+		deployment,
+		config.NewTemplateData(ctx, m.configPath("."), m.templateEnv(), deployment.Name, profile, clusterName),
+	)
+}
+
+// templateEnv returns the environment variables templates may read.
+func (m *Manager) templateEnv() []string {
+	if m.cfg.Defaults == nil {
+		return nil
+	}
+
+	return m.cfg.Defaults.TemplateEnv
+}
+
 type Callbacks interface {
 	Completed(msg string, dur time.Duration)
 
@@ -63,39 +103,81 @@ type Callbacks interface {
 	Error(msg string)
 
 	BuildStatus(name string, graph *SolveStatus)
+
+	StepLines(lines []string)
+
+	// Diagnostics reports the state of a step's workloads after it failed to become ready.
+	Diagnostics(diag *Diagnostics)
+
+	// Diff reports the pending changes to a helm step's release.
+	Diff(diff *ReleaseDiff)
 }
 
-func (m *Manager) Deploy(ctx context.Context, clusterName string, name string, cb Callbacks) error {
+// DeployOptions customises a single deployment run.
+type DeployOptions struct {
+	// Steps limits the deployment to the named steps. Other steps are left untouched.
+	Steps []string
+	// Profile selects a named profile defined on the deployment.
+	Profile string
+	// Direct applies every step directly, bypassing Flux, regardless of the step's apply mode.
+	Direct bool
+	// SkipBuild reuses the images last pushed to the cluster instead of building them.
+	SkipBuild bool
+	// Diff shows the changes to the values and manifest of each helm release before upgrading it.
+	Diff bool
+	// ValueFiles are helm value files merged over the inline values of the helm steps. Each may be prefixed with
+	// "<step>:" to target a single step.
+	ValueFiles []string
+	// Set are helm values in "key=value" form, merged after ValueFiles. Each may be prefixed with "<step>:" to target
+	// a single step.
+	Set []string
+}
+
+// Deploy builds and deploys the named deployment. The returned result describes the run and is populated as far as
+// the deployment progressed, so it may be non-nil even when an error is returned.
+func (m *Manager) Deploy(
+	ctx context.Context,
+	clusterName string,
+	name string,
+	opts DeployOptions,
+	cb Callbacks,
+) (*Result, error) {
 	if clusterName == "" {
 		clusterName = m.cfg.DefaultCluster
 	}
 
 	if name == "" {
-		return fmt.Errorf("%w: a deployment name must be passed", ErrInvalid)
+		return nil, fmt.Errorf("%w: a deployment name must be passed", ErrInvalid)
 	}
 
-	provider, err := m.clusters.Provider(clusterName)
+	deployment, err := m.findDeployment(name)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var deployment config.Deployment
-
-	for _, d := range m.cfg.Deployments {
-		if d.Name != name {
-			continue
-		}
+	cb.Info(fmt.Sprintf("Deploying %q to %q", deployment.Name, clusterName))
 
-		deployment = d
+	t, err := m.connect(ctx, clusterName, cb)
+	if err != nil {
+		return nil, err
 	}
 
-	if deployment == nil {
-		return fmt.Errorf("%w: %s", ErrNotFound, name)
-	}
+	return m.deploy(ctx, t, deployment, opts, cb)
+}
 
-	m.logger.Info("Deploying", "name", deployment.Name)
+// target holds the cluster connection state shared between deployments.
+type target struct {
+	clusterName string
+	provider    cluster.Provider
+	builder     *Builder
+	images      *imageCache
+}
 
-	cb.Info(fmt.Sprintf("Deploying %q to %q", deployment.Name, clusterName))
+func (m *Manager) connect(ctx context.Context, clusterName string, cb Callbacks) (*target, error) {
+	provider, err := m.clusters.Provider(clusterName)
+	if err != nil {
+		return nil, err
+	}
 
 	clusterStatus, err := provider.Status(ctx, cluster.ProviderCallbacks{
 		Step:    func(detail string) {},
@@ -105,25 +187,153 @@ func (m *Manager) Deploy(ctx context.Context, clusterName string, name string, c
 		Error:   cb.Error,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to check cluster status: %w", err)
+		return nil, fmt.Errorf("failed to check cluster status: %w", err)
 	}
 
 	if clusterStatus != cluster.StatusActive {
 		cb.Error("Cluster is not in an active state")
 
-		return fmt.Errorf("%w: cluster is not in active state", ErrInvalidCluster)
+		return nil, fmt.Errorf("%w: cluster is not in active state", ErrInvalidCluster)
 	}
 
 	b, err := NewBuilder(ctx, m.logger, provider)
 	if err != nil {
+		return nil, err
+	}
+
+	b.pinsFile = m.configPath(PinsFile)
+
+	// Without the cache every image is built, so failing to open it is not fatal.
+	images, err := openImageCache(ctx, m, clusterName)
+	if err != nil {
+		m.logger.Warn("Failed to open image cache", "err", err)
+	}
+
+	return &target{
+		clusterName: clusterName,
+		provider:    provider,
+		builder:     b,
+		images:      images,
+	}, nil
+}
+
+func (m *Manager) deploy(
+	ctx context.Context,
+	t *target,
+	deployment config.Deployment,
+	opts DeployOptions,
+	cb Callbacks,
+) (*Result, error) {
+	opts.Profile = m.selectProfile(deployment, opts.Profile)
+
+	deployment, err := applyProfile(deployment, opts.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	deployment, err = m.renderTemplates(ctx, deployment, opts.Profile, t.clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	deployment, err = applyValueOverrides(deployment, opts.ValueFiles, opts.Set)
+	if err != nil {
+		return nil, err
+	}
+
+	deployment, err = m.applyCompose(deployment, t.clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Profile != "" {
+		cb.Info(fmt.Sprintf("Using profile %q", opts.Profile))
+	}
+
+	steps, images, err := selectSteps(deployment, opts.Steps)
+	if err != nil {
+		return nil, err
+	}
+
+	res := newResult(t.clusterName, deployment, opts, steps)
+
+	ctx, span := tracer.Start(ctx, "deploy "+deployment.Name, trace.WithAttributes(
+		attribute.String("localflux.cluster", t.clusterName),
+	))
+
+	err = m.deploySteps(ctx, t, deployment, opts, steps, images, res, cb)
+
+	endSpan(span, err)
+
+	res.finish(err)
+
+	return res, err
+}
+
+func (m *Manager) deploySteps(
+	ctx context.Context,
+	t *target,
+	deployment config.Deployment,
+	opts DeployOptions,
+	steps []config.Step,
+	images []config.Image,
+	res *Result,
+	cb Callbacks,
+) error {
+	clusterName := t.clusterName
+	provider := t.provider
+	b := t.builder
+
+	steps, cleanup, err := stageManifests(steps)
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	steps, cleanupCompose, err := stageCompose(steps, cb)
+	if err != nil {
+		return err
+	}
+
+	defer cleanupCompose()
+
+	steps, cleanupGenerated, err := stageGenerators(ctx, steps)
+	if err != nil {
+		return err
+	}
+
+	defer cleanupGenerated()
+
+	partial := len(opts.Steps) > 0
+
+	m.logger.Info("Deploying", "name", deployment.Name)
+
+	if err := m.checkCapabilities(ctx, clusterName, steps, opts); err != nil {
+		cb.Error(err.Error())
+
 		return err
 	}
 
-	replacementImages, err := m.buildImages(ctx, deployment, b, cb)
+	env := hookEnv{
+		cluster:    clusterName,
+		deployment: deployment.Name,
+		provider:   provider,
+	}
+
+	if err := m.runHooks(ctx, hookPreBuild, deployment.Hooks, env, cb); err != nil {
+		return err
+	}
+
+	replacementImages, err := m.buildImages(ctx, t, images, opts.SkipBuild, res, cb)
 	if err != nil {
 		return fmt.Errorf("failed to build images: %w", err)
 	}
 
+	if err := m.runHooks(ctx, hookPostBuild, deployment.Hooks, env, cb); err != nil {
+		return err
+	}
+
 	kc, err := provider.K8sClient(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create k8s client: %w", err)
@@ -138,9 +348,10 @@ func (m *Manager) Deploy(ctx context.Context, clusterName string, name string, c
 	var (
 		kustomizeNames []string
 		helmNames      []string
+		directNames    []string
 	)
 
-	for _, step := range deployment.Steps {
+	for _, step := range steps {
 		defined := 0
 
 		if step.Kustomize != nil {
@@ -151,6 +362,10 @@ func (m *Manager) Deploy(ctx context.Context, clusterName string, name string, c
 			defined++
 		}
 
+		if step.Git != nil {
+			defined++
+		}
+
 		if defined == 0 {
 			return fmt.Errorf("%w: %q has no action defined", ErrInvalid, step.Name)
 		}
@@ -161,7 +376,13 @@ func (m *Manager) Deploy(ctx context.Context, clusterName string, name string, c
 
 		remoteName := fixName(deployment.Name) + "-" + fixName(step.Name)
 
-		if step.Kustomize != nil {
+		if isDirect(step, opts) {
+			directNames = append(directNames, remoteName)
+
+			continue
+		}
+
+		if step.Kustomize != nil || step.Git != nil {
 			kustomizeNames = append(kustomizeNames, remoteName)
 		}
 
@@ -186,6 +407,17 @@ func (m *Manager) Deploy(ctx context.Context, clusterName string, name string, c
 		return fmt.Errorf("failed to get existing deployment: %w", err)
 	}
 
+	if partial {
+		kustomizeNames = mergeNames(kustomizeNames, slices.DeleteFunc(
+			slices.Clone(existingDeployment.KustomizeNames),
+			func(name string) bool { return slices.Contains(directNames, name) },
+		))
+		helmNames = mergeNames(helmNames, slices.DeleteFunc(
+			slices.Clone(existingDeployment.HelmNames),
+			func(name string) bool { return slices.Contains(directNames, name) },
+		))
+	}
+
 	for _, depName := range existingDeployment.KustomizeNames {
 		if slices.Contains(kustomizeNames, depName) {
 			continue
@@ -193,12 +425,34 @@ func (m *Manager) Deploy(ctx context.Context, clusterName string, name string, c
 
 		cb.State("Checking deployment", fmt.Sprintf("Cleaning up %q", depName), start)
 
+		ks := &kustomizev1.Kustomization{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: kustomizev1.GroupVersion.String(),
+				Kind:       kustomizev1.KustomizationKind,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      depName,
+				Namespace: cluster.LFNamespace,
+			},
+		}
+
+		if slices.Contains(directNames, depName) {
+			if err := orphanFluxObject(ctx, kc, ks); err != nil {
+				return err
+			}
+		}
+
+		if err := kc.Controller().Delete(ctx, ks); err != nil && !apierrors.IsNotFound(err) {
+
+			return fmt.Errorf("failed to cleanup deployment: %w", err)
+		}
+
 		if err := kc.Controller().Delete(
 			ctx,
-			&kustomizev1.Kustomization{
+			&sourcev1b2.OCIRepository{
 				TypeMeta: metav1.TypeMeta{
-					APIVersion: kustomizev1.GroupVersion.String(),
-					Kind:       kustomizev1.KustomizationKind,
+					Kind:       sourcev1b2.OCIRepositoryKind,
+					APIVersion: sourcev1b2.GroupVersion.String(),
 				},
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      depName,
@@ -206,16 +460,15 @@ func (m *Manager) Deploy(ctx context.Context, clusterName string, name string, c
 				},
 			},
 		); err != nil && !apierrors.IsNotFound(err) {
-
 			return fmt.Errorf("failed to cleanup deployment: %w", err)
 		}
 
 		if err := kc.Controller().Delete(
 			ctx,
-			&sourcev1b2.OCIRepository{
+			&sourcev1.GitRepository{
 				TypeMeta: metav1.TypeMeta{
-					Kind:       sourcev1b2.OCIRepositoryKind,
-					APIVersion: sourcev1b2.GroupVersion.String(),
+					Kind:       sourcev1.GitRepositoryKind,
+					APIVersion: sourcev1.GroupVersion.String(),
 				},
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      depName,
@@ -236,19 +489,24 @@ func (m *Manager) Deploy(ctx context.Context, clusterName string, name string, c
 
 		cb.State("Checking deployment", fmt.Sprintf("Cleaning up %q", depName), start)
 
-		if err := kc.Controller().Delete(
-			ctx,
-			&helmv2.HelmRelease{
-				TypeMeta: metav1.TypeMeta{
-					Kind:       helmv2.HelmReleaseKind,
-					APIVersion: helmv2.GroupVersion.String(),
-				},
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      depName,
-					Namespace: cluster.LFNamespace,
-				},
+		hr := &helmv2.HelmRelease{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       helmv2.HelmReleaseKind,
+				APIVersion: helmv2.GroupVersion.String(),
 			},
-		); err != nil && !apierrors.IsNotFound(err) {
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      depName,
+				Namespace: cluster.LFNamespace,
+			},
+		}
+
+		if slices.Contains(directNames, depName) {
+			if err := orphanFluxObject(ctx, kc, hr); err != nil {
+				return err
+			}
+		}
+
+		if err := kc.Controller().Delete(ctx, hr); err != nil && !apierrors.IsNotFound(err) {
 			return fmt.Errorf("failed to cleanup deployment: %w", err)
 		}
 
@@ -284,109 +542,540 @@ func (m *Manager) Deploy(ctx context.Context, clusterName string, name string, c
 			return fmt.Errorf("failed to cleanup deployment: %w", err)
 		}
 
-		cb.Success(fmt.Sprintf("Removed %q", depName))
+		cb.Success(fmt.Sprintf("Removed %q", depName))
+	}
+
+	cb.State("Checking deployment", "Storing state", start)
+
+	mappedPorts := mapPortForwards(deployment.PortForward)
+	mappedReverse := mapReverseForwards(deployment)
+
+	if err := kc.PatchSSA(ctx, &v1alpha1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       v1alpha1.DeploymentKind,
+			APIVersion: v1alpha1.GroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      remoteDeploymentName,
+			Namespace: cluster.LFNamespace,
+		},
+		KustomizeNames: kustomizeNames,
+		HelmNames:      helmNames,
+		PortForward:    mappedPorts,
+		ReverseForward: mappedReverse,
+		BindAddress:    provider.RelayConfig().BindAddress,
+	}); err != nil {
+		return fmt.Errorf("failed to create deployment: %w", err)
+	}
+
+	cb.Completed("Checks completed", time.Since(start))
+
+	outputs := make(Outputs)
+
+	if partial {
+		if err := m.captureUnselectedOutputs(ctx, kc, deployment, steps, outputs); err != nil {
+			return err
+		}
+	}
+
+	for _, step := range steps {
+		stepEnv := env
+		stepEnv.step = step.Name
+
+		sr := res.step(step.Name)
+		stepStart := time.Now()
+
+		stepCtx, span := tracer.Start(ctx, "step "+step.Name)
+
+		err := m.deployStep(stepCtx, deployment, step, isDirect(step, opts), opts.Diff, cb, provider, b, replacementImages, kc, stepEnv, outputs, sr)
+
+		endSpan(span, err)
+
+		sr.finish(stepStart, err)
+
+		if err != nil {
+			return fmt.Errorf("step %q failed: %w", step.Name, err)
+		}
+	}
+
+	if err := m.runHooks(ctx, hookPostReconcile, deployment.Hooks, env, cb); err != nil {
+		return err
+	}
+
+	namespaces := usageNamespaces(ctx, kc, deployment, steps, opts)
+
+	if err := m.reportImageUsage(ctx, kc, namespaces, replacementImages, cb); err != nil {
+		m.logger.Warn("Failed to report image usage", "err", err)
+
+		cb.Warn(fmt.Sprintf("Failed to report image usage: %v", err))
+	}
+
+	cb.State("Done", "", time.Now())
+
+	m.logger.Info("Done")
+
+	return nil
+}
+
+func (m *Manager) deployStep(
+	ctx context.Context,
+	deployment config.Deployment,
+	step config.Step,
+	direct bool,
+	diff bool,
+	cb Callbacks,
+	provider cluster.Provider,
+	builder *Builder,
+	replacementImages []kustomize.Image,
+	kc *cluster.K8sClient,
+	env hookEnv,
+	outputs Outputs,
+	sr *StepResult,
+) error {
+	if err := m.runHooks(ctx, hookPreBuild, step.Hooks, env, cb); err != nil {
+		return err
+	}
+
+	if diff && step.Helm != nil && !direct {
+		if err := m.diffHelm(ctx, step, cb, replacementImages, kc, outputs); err != nil {
+			m.logger.Warn("Failed to diff release", "step", step.Name, "err", err)
+
+			cb.Warn(fmt.Sprintf("Failed to diff step %q: %v", step.Name, err))
+		}
+	}
+
+	if direct {
+		if err := m.deployDirect(ctx, step, cb, replacementImages, kc, env, outputs); err != nil {
+			return err
+		}
+	} else if err := m.deployFlux(ctx, deployment, step, cb, provider, builder, replacementImages, kc, env, outputs, sr); err != nil {
+		return err
+	}
+
+	if err := m.captureOutputs(ctx, kc, step, stepNamespace(step), outputs); err != nil {
+		return err
+	}
+
+	if err := m.runHooks(ctx, hookPostReconcile, step.Hooks, env, cb); err != nil {
+		return err
+	}
+
+	return m.verifyStep(ctx, deployment, step, cb, provider, kc, env)
+}
+
+// deployFlux pushes the step and lets Flux reconcile it.
+func (m *Manager) deployFlux(
+	ctx context.Context,
+	deployment config.Deployment,
+	step config.Step,
+	cb Callbacks,
+	provider cluster.Provider,
+	builder *Builder,
+	replacementImages []kustomize.Image,
+	kc *cluster.K8sClient,
+	env hookEnv,
+	outputs Outputs,
+	sr *StepResult,
+) error {
+	if step.Kustomize != nil {
+		if err := m.deployKustomize(ctx, deployment, step, cb, provider, builder, replacementImages, kc, env, outputs, sr); err != nil {
+			return err
+		}
+	}
+
+	if step.Helm != nil {
+		if err := m.deployHelm(ctx, deployment, step, cb, provider, builder, replacementImages, kc, env, outputs, sr); err != nil {
+			return err
+		}
+	}
+
+	if step.Git != nil {
+		if err := m.deployGit(ctx, deployment, step, cb, replacementImages, kc, env, outputs, sr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) findDeployment(name string) (config.Deployment, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: a deployment name must be passed", ErrInvalid)
+	}
+
+	var deployment config.Deployment
+
+	for _, d := range m.cfg.Deployments {
+		if d.Name != name {
+			continue
+		}
+
+		deployment = d
+	}
+
+	if deployment == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	return deployment, nil
+}
+
+// findRendered returns the named deployment with its templates rendered for the cluster, for commands that describe a
+// deployment without deploying it. No profile is selected.
+func (m *Manager) findRendered(ctx context.Context, name string, clusterName string) (config.Deployment, error) {
+	deployment, err := m.findDeployment(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.renderTemplates(ctx, deployment, "", clusterName)
+}
+
+// buildImages builds and pushes the images, returning the replacements that point consumers at them. With skipBuild,
+// the images last pushed to the cluster are used instead.
+func (m *Manager) buildImages(
+	ctx context.Context,
+	t *target,
+	images []config.Image,
+	skipBuild bool,
+	res *Result,
+	cb Callbacks,
+) ([]kustomize.Image, error) {
+	replacementImages := make([]kustomize.Image, 0, len(images))
+
+	if len(images) > 0 {
+		m.logger.Info("Building images")
+
+		for _, image := range images {
+			start := time.Now()
+
+			m.logger.Info("Building image", "image", image.Image)
+
+			cb.State("Building images", image.Image, start)
+
+			record, err := m.reusableImage(ctx, t, image, skipBuild)
+			if err != nil {
+				return nil, err
+			}
+
+			reused := record != nil
+
+			if !reused {
+				record, err = m.buildImage(ctx, t, image, cb, start)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			tag := record.Tag
+
+			replacement := kustomize.Image{
+				Name:    image.Image,
+				NewName: image.Image,
+				Digest:  record.Digest,
+			}
+
+			if tag != "" {
+				replacement.Digest = ""
+				replacement.NewTag = tag
+			}
+
+			replacementImages = append(replacementImages, replacement)
+
+			if res != nil {
+				ref := image.Image + "@" + record.Digest
+				if tag != "" {
+					ref = image.Image + ":" + tag
+				}
+
+				res.Images = append(res.Images, &ImageResult{
+					Image:    image.Image,
+					Ref:      ref,
+					Digest:   record.Digest,
+					Tag:      tag,
+					Reused:   reused,
+					Duration: Duration(time.Since(start)),
+				})
+			}
+
+			if reused {
+				cb.Completed(fmt.Sprintf("Reused image %q", image.Image), time.Since(start))
+			} else {
+				cb.Completed(fmt.Sprintf("Built image %q", image.Image), time.Since(start))
+			}
+		}
+	}
+
+	return replacementImages, nil
+}
+
+// reusableImage returns the record of a previously pushed image to use instead of building, or nil if the image must
+// be built.
+func (m *Manager) reusableImage(ctx context.Context, t *target, image config.Image, skipBuild bool) (*imageRecord, error) {
+	record := t.images.get(image.Image)
+
+	if skipBuild {
+		if record == nil {
+			return nil, fmt.Errorf("%w for %q, deploy once without skipping the build", ErrNoPreviousBuild, image.Image)
+		}
+
+		return record, nil
+	}
+
+	if !image.SkipUnchanged || record == nil || record.Fingerprint == "" {
+		return nil, nil
+	}
+
+	fingerprint, err := contextHash(ctx, image, m.configPath(PinsFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint %q: %w", image.Image, err)
+	}
+
+	if fingerprint != record.Fingerprint {
+		return nil, nil
+	}
+
+	pushed, err := imagePushed(ctx, t.provider, image.Image, record)
+	if err != nil {
+		m.logger.Warn("Failed to check for pushed image", "image", image.Image, "err", err)
+
+		return nil, nil
+	}
+
+	if !pushed {
+		return nil, nil
+	}
+
+	return record, nil
+}
+
+// buildImage builds and pushes a single image, recording it for later reuse.
+func (m *Manager) buildImage(
+	ctx context.Context,
+	t *target,
+	image config.Image,
+	cb Callbacks,
+	start time.Time,
+) (*imageRecord, error) {
+	tag, err := imageTag(ctx, image, m.configPath(PinsFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine tag for %q: %w", image.Image, err)
+	}
+
+	var fingerprint string
+
+	if image.SkipUnchanged {
+		fingerprint, err = contextHash(ctx, image, m.configPath(PinsFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fingerprint %q: %w", image.Image, err)
+		}
+	}
+
+	buildArgs, err := resolveBuildArgs(ctx, image, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve build args for %q: %w", image.Image, err)
+	}
+
+	secrets, err := buildSecrets(image)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err = m.newSecretResolver().expandMap(secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets for %q: %w", image.Image, err)
+	}
+
+	buildCfg := image.DeepCopy()
+	buildCfg.BuildArgs = buildArgs
+	buildCfg.Secrets = secrets
+
+	if tag != "" {
+		buildCfg.Image = image.Image + ":" + tag
+	}
+
+	ccb := contextCallbacks(cb, "Building images", start)
+
+	artifact, err := t.builder.Build(ctx, buildCfg, "./", ccb, func(res *SolveStatus) {
+		cb.BuildStatus(image.Image, res)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build image: %w", err)
+	}
+
+	if image.Sign != nil {
+		if image.Sign.Verify != nil {
+			return nil, fmt.Errorf("%w: %q: verification is only supported for deployments", ErrInvalid, image.Image)
+		}
+
+		if artifact.Tag != "" {
+			return nil, fmt.Errorf("%w: %q: images loaded into the nodes can not be signed", ErrInvalid, image.Image)
+		}
+
+		if err := t.builder.Sign(ctx, image.Sign, buildCfg.Image, artifact.Digest, func(res *SolveStatus) {
+			cb.BuildStatus(image.Image, res)
+		}); err != nil {
+			return nil, fmt.Errorf("failed to sign image: %w", err)
+		}
 	}
 
-	cb.State("Checking deployment", "Storing state", start)
+	cb.BuildStatus(image.Image, nil)
+
+	if artifact.Tag != "" {
+		tag = artifact.Tag
+	}
+
+	record := &imageRecord{
+		Fingerprint: fingerprint,
+		Digest:      artifact.Digest,
+		Tag:         tag,
+		PushedAt:    time.Now(),
+	}
+
+	if err := t.images.put(image.Image, record); err != nil {
+		m.logger.Warn("Failed to record image", "image", image.Image, "err", err)
+	}
+
+	return record, nil
+}
+
+var nameRegex = regexp.MustCompile("[^a-zA-Z0-9]")
+
+func mergeNames(names []string, existing []string) []string {
+	for _, name := range existing {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+func stepNamespace(step config.Step) string {
+	switch {
+	case step.Kustomize != nil:
+		return step.Kustomize.Namespace
+	case step.Manifests != nil:
+		return step.Manifests.Namespace
+	case step.Helm != nil:
+		return step.Helm.Namespace
+	case step.Git != nil:
+		return step.Git.Namespace
+	case step.Compose != nil:
+		return step.Compose.Namespace
+	default:
+		return ""
+	}
+}
 
+func mapPortForwards(forwards []config.PortForward) []*v1alpha1.PortForward {
 	var mappedPorts []*v1alpha1.PortForward
 
-	for _, forward := range deployment.PortForward {
+	for _, forward := range forwards {
 		net := "tcp"
 		if forward.Network != "" {
 			net = strings.ToLower(forward.Network)
 		}
 
 		mappedPorts = append(mappedPorts, &v1alpha1.PortForward{
-			Kind:      forward.Kind,
-			Namespace: forward.Namespace,
-			Name:      forward.Name,
-			Network:   net,
-			Port:      forward.Port,
-			LocalPort: forward.LocalPort,
+			Kind:              forward.Kind,
+			Namespace:         forward.Namespace,
+			Name:              forward.Name,
+			Network:           net,
+			Port:              forward.Port,
+			LocalPort:         forward.LocalPort,
+			BindAddress:       forward.BindAddress,
+			Compression:       forward.Compression,
+			NetworkConditions: (*v1alpha1.NetworkConditions)(forward.NetworkConditions),
 		})
 	}
 
-	if err := kc.PatchSSA(ctx, &v1alpha1.Deployment{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       v1alpha1.DeploymentKind,
-			APIVersion: v1alpha1.GroupVersion.String(),
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      remoteDeploymentName,
-			Namespace: cluster.LFNamespace,
-		},
-		KustomizeNames: kustomizeNames,
-		HelmNames:      helmNames,
-		PortForward:    mappedPorts,
-	}); err != nil {
-		return fmt.Errorf("failed to create deployment: %w", err)
-	}
+	return mappedPorts
+}
 
-	cb.Completed("Checks completed", time.Since(start))
+// directForwards returns the forwards served on a single local port, leaving out those forwarding a whole namespace.
+func directForwards(forwards []config.PortForward) []config.PortForward {
+	var direct []config.PortForward
 
-	for _, step := range deployment.Steps {
-		if step.Kustomize != nil {
-			if err := m.deployKustomize(ctx, deployment, step, cb, provider, b, replacementImages, kc); err != nil {
-				return fmt.Errorf("step %q failed: %w", step.Name, err)
-			}
+	for _, forward := range forwards {
+		if strings.EqualFold(forward.Kind, v1alpha1.ForwardKindNamespace) {
+			continue
 		}
 
-		if step.Helm != nil {
-			if err := m.deployHelm(ctx, deployment, step, cb, provider, b, replacementImages, kc); err != nil {
-				return fmt.Errorf("step %q failed: %w", step.Name, err)
-			}
-		}
+		direct = append(direct, forward)
 	}
 
-	cb.State("Done", "", time.Now())
+	return direct
+}
 
-	m.logger.Info("Done")
+func mapReverseForwards(deployment config.Deployment) []*v1alpha1.ReverseForward {
+	var mapped []*v1alpha1.ReverseForward
 
-	return nil
-}
+	for _, forward := range deployment.ReverseForward {
+		localPort := forward.Port
+		if forward.LocalPort != nil {
+			localPort = *forward.LocalPort
+		}
 
-func (m *Manager) buildImages(
-	ctx context.Context,
-	deployment config.Deployment,
-	builder *Builder,
-	cb Callbacks,
-) ([]kustomize.Image, error) {
-	replacementImages := make([]kustomize.Image, 0, len(deployment.Images))
+		localHost := forward.LocalHost
+		if localHost == "" {
+			localHost = "127.0.0.1"
+		}
 
-	if len(deployment.Images) > 0 {
-		m.logger.Info("Building images")
+		mapped = append(mapped, &v1alpha1.ReverseForward{
+			Namespace: forward.Namespace,
+			Name:      forward.Name,
+			Port:      forward.Port,
+			LocalPort: localPort,
+			LocalHost: localHost,
+		})
+	}
 
-		for _, image := range deployment.Images {
-			start := time.Now()
+	return mapped
+}
 
-			m.logger.Info("Building image", "image", image.Image)
+// interval returns the reconciliation interval for the step's Flux objects, falling back to the config default and
+// then to the given default.
+func (m *Manager) interval(step config.Step, def time.Duration) metav1.Duration {
+	if step.Interval != nil {
+		return *step.Interval
+	}
 
-			cb.State("Building images", image.Image, start)
+	if m.cfg.Defaults != nil && m.cfg.Defaults.Interval != nil {
+		return *m.cfg.Defaults.Interval
+	}
 
-			artifact, err := builder.Build(ctx, image, "./", func(res *SolveStatus) {
-				cb.BuildStatus(image.Image, res)
-			})
-			if err != nil {
-				return nil, fmt.Errorf("failed to build image: %w", err)
-			}
+	return metav1.Duration{Duration: def}
+}
 
-			cb.BuildStatus(image.Image, nil)
+// timeout returns the limit of each attempt at reconciling the step, falling back to the config default and then to
+// 30 seconds.
+func (m *Manager) timeout(step config.Step) time.Duration {
+	if step.Timeout != nil {
+		return step.Timeout.Duration
+	}
 
-			replacementImages = append(replacementImages, kustomize.Image{
-				Name:    image.Image,
-				NewName: image.Image,
-				Digest:  artifact.Digest,
-			})
+	if m.cfg.Defaults != nil && m.cfg.Defaults.Timeout != nil {
+		return m.cfg.Defaults.Timeout.Duration
+	}
 
-			cb.Completed(fmt.Sprintf("Built image %q", image.Image), time.Since(start))
-		}
+	return 30 * time.Second
+}
+
+func retries(step config.Step) int {
+	if step.Retries == nil {
+		return 0
 	}
 
-	return replacementImages, nil
+	return *step.Retries
 }
 
-var nameRegex = regexp.MustCompile("[^a-zA-Z0-9]")
+// enabled returns the value of an optional flag that defaults to true.
+func enabled(v *bool) bool {
+	return v == nil || *v
+}
 
 func fixName(name string) string {
 	return nameRegex.ReplaceAllString(name, "-")
@@ -401,6 +1090,9 @@ func (m *Manager) deployKustomize(
 	builder *Builder,
 	replacementImages []kustomize.Image,
 	kc *cluster.K8sClient,
+	env hookEnv,
+	outputs Outputs,
+	sr *StepResult,
 ) error {
 	start := time.Now()
 
@@ -418,6 +1110,7 @@ func (m *Manager) deployKustomize(
 		step.Kustomize.IncludePaths,
 		step.Kustomize.ExcludePaths,
 		image,
+		contextCallbacks(cb, fmt.Sprintf("Step %q", step.Name), start),
 		func(res *SolveStatus) {
 			cb.BuildStatus("Manifests", res)
 		},
@@ -426,8 +1119,22 @@ func (m *Manager) deployKustomize(
 		return fmt.Errorf("failed to build image: %w", err)
 	}
 
+	if deployment.Sign != nil {
+		if err := builder.Sign(ctx, deployment.Sign, image, artifact.Digest, func(res *SolveStatus) {
+			cb.BuildStatus("Manifests", res)
+		}); err != nil {
+			return fmt.Errorf("failed to sign manifests: %w", err)
+		}
+	}
+
 	cb.BuildStatus("Manifests", nil)
 
+	sr.Artifact = "oci://" + image + "@" + artifact.Digest
+
+	if err := m.runHooks(ctx, hookPostBuild, step.Hooks, env, cb); err != nil {
+		return err
+	}
+
 	m.logger.Info("Deploying")
 
 	cb.State(fmt.Sprintf("Step %q", step.Name), "Deploying namespace", start)
@@ -444,6 +1151,11 @@ func (m *Manager) deployKustomize(
 
 	cb.State(fmt.Sprintf("Step %q", step.Name), "Deploying repo", start)
 
+	verify, err := ociVerification(ctx, kc, deployment)
+	if err != nil {
+		return err
+	}
+
 	if err := kc.PatchSSA(ctx, &sourcev1b2.OCIRepository{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       sourcev1b2.OCIRepositoryKind,
@@ -458,10 +1170,9 @@ func (m *Manager) deployKustomize(
 			Reference: &sourcev1b2.OCIRepositoryRef{
 				Digest: artifact.Digest,
 			},
-			Interval: metav1.Duration{
-				Duration: time.Minute,
-			},
+			Interval: m.interval(step, time.Minute),
 			Insecure: true,
+			Verify:   verify,
 		},
 	}); err != nil {
 		return fmt.Errorf("failed to create oci repository: %w", err)
@@ -471,6 +1182,45 @@ func (m *Manager) deployKustomize(
 
 	tgt := uuid.New().String()
 
+	substitute, err := outputs.expandMap(step.Kustomize.Substitute)
+	if err != nil {
+		return fmt.Errorf("failed to expand substitutions: %w", err)
+	}
+
+	postBuild, err := m.postBuild(ctx, kc, remoteName, substitute)
+	if err != nil {
+		return err
+	}
+
+	patches := slices.Clone(step.Kustomize.Patches)
+
+	if step.Kustomize.RestartOnConfigChange {
+		// Hashes cover the secrets too, so that workloads restart when they change.
+		resolved, err := m.newSecretResolver().expandMap(substitute)
+		if err != nil {
+			return fmt.Errorf("failed to resolve secrets: %w", err)
+		}
+
+		hashPatches, err := configHashPatches(kustomizeDir(step.Kustomize.Context, step.Kustomize.Path), resolved)
+		if err != nil {
+			return fmt.Errorf("failed to compute config hashes: %w", err)
+		}
+
+		m.logger.Debug("Generated config hash patches", "step", step.Name, "count", len(hashPatches))
+
+		patches = append(patches, hashPatches...)
+	}
+
+	healthChecks := make([]meta.NamespacedObjectKindReference, 0, len(step.Kustomize.HealthChecks))
+
+	for _, check := range step.Kustomize.HealthChecks {
+		if check.Namespace == "" {
+			check.Namespace = step.Kustomize.Namespace
+		}
+
+		healthChecks = append(healthChecks, check)
+	}
+
 	if err := kc.PatchSSA(ctx, &kustomizev1.Kustomization{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: kustomizev1.GroupVersion.String(),
@@ -484,25 +1234,24 @@ func (m *Manager) deployKustomize(
 			},
 		},
 		Spec: kustomizev1.KustomizationSpec{
-			Interval: metav1.Duration{
-				Duration: time.Minute,
-			},
-			Path: step.Kustomize.Path,
-			PostBuild: &kustomizev1.PostBuild{
-				Substitute: step.Kustomize.Substitute,
-			},
-			Prune:   true,
-			Patches: step.Kustomize.Patches,
-			Images:  replacementImages,
+			Interval:  m.interval(step, time.Minute),
+			DependsOn: fluxDependsOn(deployment, step, kustomizev1.KustomizationKind),
+			Path:      step.Kustomize.Path,
+			PostBuild: postBuild,
+			Prune:     enabled(step.Kustomize.Prune),
+			Patches:   patches,
+			Images:    replacementImages,
 			SourceRef: kustomizev1.CrossNamespaceSourceReference{
 				APIVersion: sourcev1b2.GroupVersion.String(),
 				Namespace:  cluster.LFNamespace,
 				Kind:       sourcev1b2.OCIRepositoryKind,
 				Name:       remoteName,
 			},
-			TargetNamespace: step.Kustomize.Namespace,
-			Force:           true,
-			Components:      step.Kustomize.Components,
+			TargetNamespace:  step.Kustomize.Namespace,
+			Force:            enabled(step.Kustomize.Force),
+			Components:       step.Kustomize.Components,
+			HealthChecks:     healthChecks,
+			HealthCheckExprs: step.Kustomize.HealthCheckExprs,
 		},
 	}); err != nil {
 		return fmt.Errorf("failed to create kustomization: %w", err)
@@ -515,18 +1264,31 @@ func (m *Manager) deployKustomize(
 	}
 
 	if shouldWait {
+		ks := new(ReconcileKustomization)
+
+		// The health checks are also evaluated here to report progress. kstatus can not evaluate custom expressions,
+		// so with expressions only the Ready condition, which Flux sets once they hold, is relied on.
+		waitChecks := healthChecks
+		if len(step.Kustomize.HealthCheckExprs) > 0 {
+			waitChecks = nil
+		}
+
 		if err := Reconcile[*ReconcileKustomization](
 			ctx,
 			kc,
 			cluster.LFNamespace,
 			remoteName,
 			tgt,
-			time.Second*30,
-			new(ReconcileKustomization),
+			m.timeout(step),
+			retries(step),
+			ks,
+			waitChecks,
 			func(s string) {
 				cb.State(fmt.Sprintf("Step %q", step.Name), "Waiting for reconcile: "+s, start)
 			},
 		); err != nil {
+			m.diagnose(ctx, kc, step, inventoryNamespaces(&ks.Kustomization), cb)
+
 			return fmt.Errorf("failed to reconcile kustomization: %w", err)
 		}
 	}
@@ -536,39 +1298,41 @@ func (m *Manager) deployKustomize(
 	return nil
 }
 
-func (m *Manager) deployHelm(
+// helmValues merges the step's value files, value references, inline values and image values, in that order. Secret
+// and ConfigMap references are left out when kc is nil.
+func helmValues(
 	ctx context.Context,
-	deployment config.Deployment,
+	kc *cluster.K8sClient,
 	step config.Step,
-	cb Callbacks,
-	provider cluster.Provider,
-	builder *Builder,
 	replacementImages []kustomize.Image,
-	kc *cluster.K8sClient,
-) error {
-	start := time.Now()
-
-	m.logger.Info("Executing step", "step", step.Name)
-
-	cb.State(fmt.Sprintf("Step %q", step.Name), "Reading values", start)
-
+	cb Callbacks,
+) (map[string]any, error) {
 	values := make(map[string]any)
 
 	for _, file := range step.Helm.ValueFiles {
 		data, err := os.ReadFile(file)
 		if err != nil {
-			return fmt.Errorf("failed to read file %q: %w", file, err)
+			return nil, fmt.Errorf("failed to read file %q: %w", file, err)
 		}
 
 		rawJSON, err := yaml.YAMLToJSON(data)
 		if err != nil {
-			return fmt.Errorf("failed to read file %q: %w", file, err)
+			return nil, fmt.Errorf("failed to read file %q: %w", file, err)
 		}
 
 		var extraValues map[string]any
 
 		if err := json.Unmarshal(rawJSON, &extraValues); err != nil {
-			return fmt.Errorf("failed to read file %q: %w", file, err)
+			return nil, fmt.Errorf("failed to read file %q: %w", file, err)
+		}
+
+		values = chartutil.MergeMaps(values, extraValues)
+	}
+
+	if len(step.Helm.ValuesFrom) > 0 {
+		extraValues, err := valuesFrom(ctx, kc, step, cb)
+		if err != nil {
+			return nil, err
 		}
 
 		values = chartutil.MergeMaps(values, extraValues)
@@ -578,12 +1342,49 @@ func (m *Manager) deployHelm(
 		var extraValues map[string]any
 
 		if err := json.Unmarshal(step.Helm.Values.Raw, &extraValues); err != nil {
-			return fmt.Errorf("failed to parse values: %w", err)
+			return nil, fmt.Errorf("failed to parse values: %w", err)
 		}
 
 		values = chartutil.MergeMaps(values, extraValues)
 	}
 
+	return applyImageValues(step, replacementImages, values)
+}
+
+func (m *Manager) deployHelm(
+	ctx context.Context,
+	deployment config.Deployment,
+	step config.Step,
+	cb Callbacks,
+	provider cluster.Provider,
+	builder *Builder,
+	replacementImages []kustomize.Image,
+	kc *cluster.K8sClient,
+	env hookEnv,
+	outputs Outputs,
+	sr *StepResult,
+) error {
+	start := time.Now()
+
+	m.logger.Info("Executing step", "step", step.Name)
+
+	cb.State(fmt.Sprintf("Step %q", step.Name), "Reading values", start)
+
+	values, err := helmValues(ctx, kc, step, replacementImages, cb)
+	if err != nil {
+		return err
+	}
+
+	if _, err := outputs.expandValues(values); err != nil {
+		return fmt.Errorf("failed to expand values: %w", err)
+	}
+
+	secrets := m.newSecretResolver()
+
+	if _, err := walkValues(values, secrets.expand); err != nil {
+		return fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
 	encodedValues, err := json.Marshal(values)
 	if err != nil {
 		return fmt.Errorf("failed to marshal values: %w", err)
@@ -591,8 +1392,8 @@ func (m *Manager) deployHelm(
 
 	remoteName := fixName(deployment.Name) + "-" + fixName(step.Name)
 
-	if step.Helm.Repo != "" && step.Helm.Context != "" {
-		return fmt.Errorf("%w: helm repo and context are mutually exclusive", ErrInvalid)
+	if err := validateHelm(step.Helm); err != nil {
+		return err
 	}
 
 	var (
@@ -624,14 +1425,17 @@ func (m *Manager) deployHelm(
 				//SecretRef:       nil,
 				//CertSecretRef:   nil,
 				//PassCredentials: false,
-				Interval: metav1.Duration{
-					Duration: time.Minute * 5,
-				},
+				Interval: m.interval(step, time.Minute*5),
 			},
 		}); err != nil {
 			return fmt.Errorf("failed to create oci repository: %w", err)
 		}
 
+		sr.Artifact = strings.TrimSuffix(step.Helm.Repo, "/") + "/" + step.Helm.Chart
+		if step.Helm.Version != "" {
+			sr.Artifact += "@" + step.Helm.Version
+		}
+
 		chart = &helmv2.HelmChartTemplate{
 			Spec: helmv2.HelmChartTemplateSpec{
 				Chart:   step.Helm.Chart,
@@ -644,7 +1448,49 @@ func (m *Manager) deployHelm(
 				},
 			},
 		}
+	} else if isOCIChart(step.Helm) {
+		cb.State(fmt.Sprintf("Step %q", step.Name), "Deploying repo", start)
+
+		if err := kc.PatchSSA(ctx, &sourcev1b2.OCIRepository{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       sourcev1b2.OCIRepositoryKind,
+				APIVersion: sourcev1b2.GroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      remoteName,
+				Namespace: cluster.LFNamespace,
+			},
+			Spec: sourcev1b2.OCIRepositorySpec{
+				URL:       step.Helm.Chart,
+				Reference: ociChartRef(step.Helm.Version),
+				LayerSelector: &sourcev1b2.OCILayerSelector{
+					MediaType: helmChartMediaType,
+					Operation: sourcev1b2.OCILayerCopy,
+				},
+				Interval: m.interval(step, time.Minute*5),
+			},
+		}); err != nil {
+			return fmt.Errorf("failed to create oci repository: %w", err)
+		}
+
+		sr.Artifact = step.Helm.Chart
+		if step.Helm.Version != "" {
+			sr.Artifact += "@" + step.Helm.Version
+		}
+
+		chartRef = &helmv2.CrossNamespaceSourceReference{
+			APIVersion: sourcev1b2.GroupVersion.String(),
+			Namespace:  cluster.LFNamespace,
+			Kind:       sourcev1b2.OCIRepositoryKind,
+			Name:       remoteName,
+		}
 	} else {
+		cb.State(fmt.Sprintf("Step %q", step.Name), "Building chart dependencies", start)
+
+		if err := m.buildHelmDependencies(step.Helm.Context); err != nil {
+			return err
+		}
+
 		m.logger.Info("Pushing chart")
 
 		cb.State(fmt.Sprintf("Step %q", step.Name), "Packaging chart", start)
@@ -657,6 +1503,7 @@ func (m *Manager) deployHelm(
 			step.Helm.IncludePaths,
 			step.Helm.ExcludePaths,
 			image,
+			contextCallbacks(cb, fmt.Sprintf("Step %q", step.Name), start),
 			func(res *SolveStatus) {
 				cb.BuildStatus("Chart", res)
 			},
@@ -665,10 +1512,25 @@ func (m *Manager) deployHelm(
 			return fmt.Errorf("failed to build image: %w", err)
 		}
 
+		if deployment.Sign != nil {
+			if err := builder.Sign(ctx, deployment.Sign, image, artifact.Digest, func(res *SolveStatus) {
+				cb.BuildStatus("Chart", res)
+			}); err != nil {
+				return fmt.Errorf("failed to sign chart: %w", err)
+			}
+		}
+
 		cb.BuildStatus("Chart", nil)
 
+		sr.Artifact = "oci://" + image + "@" + artifact.Digest
+
 		cb.State(fmt.Sprintf("Step %q", step.Name), "Deploying repo", start)
 
+		verify, err := ociVerification(ctx, kc, deployment)
+		if err != nil {
+			return err
+		}
+
 		if err := kc.PatchSSA(ctx, &sourcev1b2.OCIRepository{
 			TypeMeta: metav1.TypeMeta{
 				Kind:       sourcev1b2.OCIRepositoryKind,
@@ -683,10 +1545,9 @@ func (m *Manager) deployHelm(
 				Reference: &sourcev1b2.OCIRepositoryRef{
 					Digest: artifact.Digest,
 				},
-				Interval: metav1.Duration{
-					Duration: time.Minute,
-				},
+				Interval: m.interval(step, time.Minute),
 				Insecure: true,
+				Verify:   verify,
 			},
 		}); err != nil {
 			return fmt.Errorf("failed to create oci repository: %w", err)
@@ -700,6 +1561,10 @@ func (m *Manager) deployHelm(
 		}
 	}
 
+	if err := m.runHooks(ctx, hookPostBuild, step.Hooks, env, cb); err != nil {
+		return err
+	}
+
 	cb.State(fmt.Sprintf("Step %q", step.Name), "Deploying namespace", start)
 
 	if err := kc.CreateNamespace(ctx, cluster.LFNamespace); err != nil {
@@ -714,41 +1579,75 @@ func (m *Manager) deployHelm(
 
 	cb.State(fmt.Sprintf("Step %q", step.Name), "Deploying chart", start)
 
+	// Values holding secrets are read by Flux from the Secret of the step, rather than written into the release.
+	var secretValues map[string][]byte
+
+	if len(secrets.secrets) > 0 {
+		secretValues = map[string][]byte{secretValuesKey: encodedValues}
+	}
+
+	secretName, err := applyStepSecrets(ctx, kc, remoteName, secretValues)
+	if err != nil {
+		return err
+	}
+
+	releaseValues := &apiextensionsv1.JSON{Raw: encodedValues}
+
+	var valuesFrom []helmv2.ValuesReference
+
+	if secretName != "" {
+		releaseValues = nil
+		valuesFrom = []helmv2.ValuesReference{
+			{
+				Kind:      "Secret",
+				Name:      secretName,
+				ValuesKey: secretValuesKey,
+			},
+		}
+	}
+
 	tgt := uuid.New().String()
 
+	force := enabled(step.Helm.Force)
+
+	annotations := map[string]string{
+		meta.ReconcileRequestAnnotation: tgt,
+		helmv2.ResetRequestAnnotation:   tgt,
+	}
+
+	if force {
+		annotations[helmv2.ForceRequestAnnotation] = tgt
+	}
+
 	if err := kc.PatchSSA(ctx, &helmv2.HelmRelease{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       helmv2.HelmReleaseKind,
 			APIVersion: helmv2.GroupVersion.String(),
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      remoteName,
-			Namespace: cluster.LFNamespace,
-			Annotations: map[string]string{
-				meta.ReconcileRequestAnnotation: tgt,
-				helmv2.ForceRequestAnnotation:   tgt,
-				helmv2.ResetRequestAnnotation:   tgt,
-			},
+			Name:        remoteName,
+			Namespace:   cluster.LFNamespace,
+			Annotations: annotations,
 		},
 		Spec: helmv2.HelmReleaseSpec{
-			Chart:    chart,
-			ChartRef: chartRef,
-			Interval: metav1.Duration{
-				Duration: time.Minute,
-			},
+			Chart:           chart,
+			ChartRef:        chartRef,
+			Interval:        m.interval(step, time.Minute),
+			DependsOn:       fluxDependsOn(deployment, step, helmv2.HelmReleaseKind),
 			ReleaseName:     step.Name,
 			TargetNamespace: step.Helm.Namespace,
 			Timeout:         nil,
 			Install: &helmv2.Install{
-				Replace: true,
+				Replace: enabled(step.Helm.Replace),
 			},
 			Upgrade: &helmv2.Upgrade{
-				Force: true,
+				Force: force,
 			},
 			Rollback: &helmv2.Rollback{
-				Force: true,
+				Force: force,
 			},
-			Values: &apiextensionsv1.JSON{Raw: encodedValues},
+			Values:     releaseValues,
+			ValuesFrom: valuesFrom,
 			PostRenderers: []helmv2.PostRenderer{
 				{
 					Kustomize: &helmv2.Kustomize{
@@ -775,12 +1674,16 @@ func (m *Manager) deployHelm(
 			cluster.LFNamespace,
 			remoteName,
 			tgt,
-			time.Second*30,
+			m.timeout(step),
+			retries(step),
 			new(ReconcileHelm),
+			nil,
 			func(s string) {
 				cb.State(fmt.Sprintf("Step %q", step.Name), "Waiting for reconcile: "+s, start)
 			},
 		); err != nil {
+			m.diagnose(ctx, kc, step, nil, cb)
+
 			return fmt.Errorf("failed to reconcile helm: %w", err)
 		}
 	}
@@ -0,0 +1,238 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	maxDiagnosticPods   = 5
+	maxDiagnosticEvents = 10
+	diagnosticLogLines  = 20
+)
+
+// Diagnostics describes the workloads of a step that failed to become ready.
+type Diagnostics struct {
+	Step string
+	// Pods lists the pods that are not ready.
+	Pods []PodDiagnostics
+	// Events are the most recent warning events, oldest first.
+	Events []string
+}
+
+// PodDiagnostics describes a pod that is not ready.
+type PodDiagnostics struct {
+	Namespace  string
+	Name       string
+	Phase      string
+	Containers []ContainerDiagnostics
+}
+
+// ContainerDiagnostics describes a container that is not ready.
+type ContainerDiagnostics struct {
+	Name     string
+	Restarts int32
+	// State describes why the container is not running, e.g. "waiting: CrashLoopBackOff".
+	State string
+	// Logs are the last lines logged by the container, or by its previous instance if it restarted.
+	Logs []string
+}
+
+// diagnose gathers the state of the pods and recent warning events in the given namespaces and reports them through
+// the callbacks. Failures are logged, as diagnostics are best effort and must not hide the original error.
+func (m *Manager) diagnose(ctx context.Context, kc *cluster.K8sClient, step config.Step, namespaces []string, cb Callbacks) {
+	if ns := stepNamespace(step); ns != "" {
+		namespaces = append(namespaces, ns)
+	}
+
+	slices.Sort(namespaces)
+	namespaces = slices.Compact(namespaces)
+
+	if len(namespaces) == 0 {
+		return
+	}
+
+	diag := &Diagnostics{
+		Step: step.Name,
+	}
+
+	for _, ns := range namespaces {
+		if err := m.diagnoseNamespace(ctx, kc, ns, diag); err != nil {
+			m.logger.Warn("Failed to collect diagnostics", "namespace", ns, "err", err)
+		}
+	}
+
+	if len(diag.Pods) == 0 && len(diag.Events) == 0 {
+		return
+	}
+
+	if len(diag.Events) > maxDiagnosticEvents {
+		diag.Events = diag.Events[len(diag.Events)-maxDiagnosticEvents:]
+	}
+
+	cb.Diagnostics(diag)
+}
+
+func (m *Manager) diagnoseNamespace(ctx context.Context, kc *cluster.K8sClient, ns string, diag *Diagnostics) error {
+	pods, err := kc.ClientSet().CoreV1().Pods(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	for _, pod := range pods.Items {
+		if len(diag.Pods) >= maxDiagnosticPods {
+			break
+		}
+
+		if pod.Status.Phase == corev1.PodSucceeded || podReady(pod) {
+			continue
+		}
+
+		pd := PodDiagnostics{
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			Phase:     string(pod.Status.Phase),
+		}
+
+		for _, status := range slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses) {
+			if status.Ready {
+				continue
+			}
+
+			cd := ContainerDiagnostics{
+				Name:     status.Name,
+				Restarts: status.RestartCount,
+				State:    containerState(status.State),
+			}
+
+			previous := status.RestartCount > 0 && status.LastTerminationState.Terminated != nil
+
+			if previous && cd.State == "" {
+				cd.State = containerState(status.LastTerminationState)
+			}
+
+			logs, err := containerLogs(ctx, kc, pod, status.Name, previous)
+			if err != nil {
+				m.logger.Debug("Failed to fetch logs", "pod", pod.Name, "container", status.Name, "err", err)
+			}
+
+			cd.Logs = logs
+
+			pd.Containers = append(pd.Containers, cd)
+		}
+
+		diag.Pods = append(diag.Pods, pd)
+	}
+
+	events, err := kc.ClientSet().CoreV1().Events(ns).List(ctx, metav1.ListOptions{
+		FieldSelector: "type=" + corev1.EventTypeWarning,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list events: %w", err)
+	}
+
+	slices.SortFunc(events.Items, func(a, b corev1.Event) int {
+		return eventTime(a).Compare(eventTime(b))
+	})
+
+	for _, event := range events.Items {
+		diag.Events = append(diag.Events, fmt.Sprintf(
+			"%s %s/%s: %s: %s",
+			event.InvolvedObject.Kind,
+			event.InvolvedObject.Namespace,
+			event.InvolvedObject.Name,
+			event.Reason,
+			strings.TrimSpace(event.Message),
+		))
+	}
+
+	return nil
+}
+
+func podReady(pod corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+func containerState(state corev1.ContainerState) string {
+	switch {
+	case state.Waiting != nil:
+		return strings.TrimSuffix("waiting: "+state.Waiting.Reason+": "+state.Waiting.Message, ": ")
+	case state.Terminated != nil:
+		return fmt.Sprintf("terminated: %s (exit code %d)", state.Terminated.Reason, state.Terminated.ExitCode)
+	default:
+		return ""
+	}
+}
+
+func containerLogs(ctx context.Context, kc *cluster.K8sClient, pod corev1.Pod, container string, previous bool) ([]string, error) {
+	stream, err := kc.ClientSet().CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: container,
+		Previous:  previous,
+		TailLines: ptr.To(int64(diagnosticLogLines)),
+	}).Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer stream.Close()
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimRight(string(data), "\n")
+	if text == "" {
+		return nil, nil
+	}
+
+	return strings.Split(text, "\n"), nil
+}
+
+func eventTime(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
+// inventoryNamespaces returns the namespaces of the objects applied by a kustomization.
+func inventoryNamespaces(ks *kustomizev1.Kustomization) []string {
+	if ks.Status.Inventory == nil {
+		return nil
+	}
+
+	var namespaces []string
+
+	for _, entry := range ks.Status.Inventory.Entries {
+		// Entries are identified as "<namespace>_<name>_<group>_<kind>", with an empty namespace for cluster-scoped
+		// objects.
+		ns, _, _ := strings.Cut(entry.ID, "_")
+		if ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	return namespaces
+}
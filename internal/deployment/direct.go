@@ -0,0 +1,96 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/fluxcd/pkg/apis/kustomize"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	ApplyModeFlux   = "flux"
+	ApplyModeDirect = "direct"
+)
+
+// isDirect reports whether the step should be applied directly rather than through Flux.
+func isDirect(step config.Step, opts DeployOptions) bool {
+	return opts.Direct || step.ApplyMode == ApplyModeDirect
+}
+
+// deployDirect renders the step locally and applies the result using server-side apply, bypassing Flux.
+func (m *Manager) deployDirect(
+	ctx context.Context,
+	step config.Step,
+	cb Callbacks,
+	replacementImages []kustomize.Image,
+	kc *cluster.K8sClient,
+	env hookEnv,
+	outputs Outputs,
+) error {
+	start := time.Now()
+
+	m.logger.Info("Executing step directly", "step", step.Name)
+
+	cb.State(fmt.Sprintf("Step %q", step.Name), "Rendering manifests", start)
+
+	var (
+		rendered []byte
+		err      error
+	)
+
+	switch {
+	case step.Kustomize != nil:
+		rendered, err = m.renderKustomizeStep(ctx, step, replacementImages, outputs, cb)
+	case step.Helm != nil:
+		rendered, err = m.renderHelmStep(ctx, step, replacementImages, outputs, cb)
+	case step.Git != nil:
+		rendered, err = m.renderGitStep(ctx, step, replacementImages, outputs, cb)
+	default:
+		err = fmt.Errorf("%w: no action defined", ErrInvalid)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to render: %w", err)
+	}
+
+	if err := m.runHooks(ctx, hookPostBuild, step.Hooks, env, cb); err != nil {
+		return err
+	}
+
+	namespace := stepNamespace(step)
+
+	if namespace != "" {
+		cb.State(fmt.Sprintf("Step %q", step.Name), "Deploying namespace", start)
+
+		if err := kc.CreateNamespace(ctx, namespace); err != nil {
+			return fmt.Errorf("failed to create namespace: %w", err)
+		}
+	}
+
+	cb.State(fmt.Sprintf("Step %q", step.Name), "Applying manifests", start)
+
+	if err := kc.ApplyInNamespace(ctx, string(rendered), namespace); err != nil {
+		return fmt.Errorf("failed to apply: %w", err)
+	}
+
+	cb.Completed(fmt.Sprintf("Applied step %q", step.Name), time.Since(start))
+
+	return nil
+}
+
+// orphanFluxObject suspends a Flux object before it is deleted, so that its controller leaves the objects it manages
+// in place. This is used when a step switches to direct mode, which takes over the same objects.
+func orphanFluxObject(ctx context.Context, kc *cluster.K8sClient, obj client.Object) error {
+	err := kc.Controller().Patch(ctx, obj, client.RawPatch(types.MergePatchType, []byte(`{"spec":{"suspend":true}}`)))
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to suspend %q: %w", obj.GetName(), err)
+	}
+
+	return nil
+}
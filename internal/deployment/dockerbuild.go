@@ -0,0 +1,205 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	dockerclient "github.com/docker/docker/client"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/moby/buildkit/client"
+)
+
+// newDockerBuildClient connects to the buildkit instance embedded in the local Docker daemon, using the same hijacked
+// endpoints as "docker buildx" does for its docker driver.
+func newDockerBuildClient(ctx context.Context) (*client.Client, *dockerclient.Client, error) {
+	docker, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+
+	if _, err := docker.Ping(ctx); err != nil {
+		_ = docker.Close()
+
+		return nil, nil, fmt.Errorf("failed to connect to docker: %w", err)
+	}
+
+	c, err := client.New(
+		ctx,
+		"",
+		client.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return docker.DialHijack(ctx, "/grpc", "h2c", nil)
+		}),
+		client.WithSessionDialer(func(ctx context.Context, proto string, meta map[string][]string) (net.Conn, error) {
+			return docker.DialHijack(ctx, "/session", proto, meta)
+		}),
+	)
+	if err != nil {
+		_ = docker.Close()
+
+		return nil, nil, fmt.Errorf("failed to connect to docker buildkit: %w", err)
+	}
+
+	return c, docker, nil
+}
+
+// localDocker returns a client for the local Docker daemon, reusing that of the docker backend if in use. The returned
+// function releases the client.
+func (b *Builder) localDocker() (*dockerclient.Client, func(), error) {
+	if b.docker != nil {
+		return b.docker, func() {}, nil
+	}
+
+	docker, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+
+	return docker, func() { _ = docker.Close() }, nil
+}
+
+// pushFromDocker saves the image from the Docker daemon and publishes it to the cluster.
+func (b *Builder) pushFromDocker(ctx context.Context, docker *dockerclient.Client, image string) (*Artifact, error) {
+	path, cleanup, err := saveFromDocker(ctx, docker, image)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cleanup()
+
+	return b.publishTarball(ctx, path, image)
+}
+
+// saveFromDocker saves the image from the Docker daemon to a temporary docker format tarball. The returned function
+// removes it.
+func saveFromDocker(ctx context.Context, docker *dockerclient.Client, image string) (string, func(), error) {
+	tmp, err := os.CreateTemp("", "localflux-image-*.tar")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	cleanup := func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}
+
+	stream, err := docker.ImageSave(ctx, []string{image})
+	if err != nil {
+		cleanup()
+
+		return "", nil, fmt.Errorf("failed to save image: %w", err)
+	}
+
+	_, err = io.Copy(tmp, stream)
+
+	_ = stream.Close()
+
+	if err != nil {
+		cleanup()
+
+		return "", nil, fmt.Errorf("failed to save image: %w", err)
+	}
+
+	return tmp.Name(), cleanup, nil
+}
+
+// publishTarball loads the image in the docker format tarball into the nodes, or pushes it to the cluster registry.
+func (b *Builder) publishTarball(ctx context.Context, path string, image string) (*Artifact, error) {
+	if b.loadToNode {
+		return b.loadTarball(ctx, path, image)
+	}
+
+	return b.pushTarball(ctx, path, image)
+}
+
+// pushTarball pushes the image in the docker format tarball to the cluster registry.
+func (b *Builder) pushTarball(ctx context.Context, path string, image string) (*Artifact, error) {
+	ref, err := name.ParseReference(image, name.Insecure)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference: %w", err)
+	}
+
+	img, err := tarball.ImageFromPath(path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	trans, auth, err := b.provider.RegistryConn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to registry: %w", err)
+	}
+
+	b.logger.Info("Pushing image", "image", image)
+
+	if err := remote.Write(ref, img, remote.WithContext(ctx), remote.WithTransport(trans), remote.WithAuth(auth)); err != nil {
+		return nil, fmt.Errorf("failed to push image: %w", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute digest: %w", err)
+	}
+
+	return &Artifact{
+		Name:   image,
+		Digest: digest.String(),
+	}, nil
+}
+
+// loadTarball loads the image in the docker format tarball into the container runtime of the nodes. Images without a
+// tag are tagged after their digest, as a digest computed by localflux may not match the one the runtime assigns, and
+// kubelet would otherwise attempt to pull the latest tag.
+func (b *Builder) loadTarball(ctx context.Context, path string, image string) (*Artifact, error) {
+	ref, err := name.ParseReference(image, name.Insecure)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference: %w", err)
+	}
+
+	img, err := tarball.ImageFromPath(path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute digest: %w", err)
+	}
+
+	tag, ok := ref.(name.Tag)
+	if !ok {
+		return nil, fmt.Errorf("%w: can not load %q by digest", ErrInvalid, image)
+	}
+
+	var loadedTag string
+
+	if tag.TagStr() == name.DefaultTag {
+		loadedTag = "lf-" + digest.Hex[:12]
+		tag = tag.Context().Tag(loadedTag)
+	}
+
+	b.logger.Info("Loading image into nodes", "image", tag.String())
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(tarball.Write(tag, img, pw))
+	}()
+
+	err = b.provider.LoadImage(ctx, pr)
+
+	_ = pr.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load image: %w", err)
+	}
+
+	return &Artifact{
+		Name:   image,
+		Digest: digest.String(),
+		Tag:    loadedTag,
+	}, nil
+}
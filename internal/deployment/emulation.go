@@ -0,0 +1,255 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/containerd/platforms"
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/moby/buildkit/client"
+)
+
+var ErrEmulationMissing = errors.New("platform not supported by builder")
+
+// unsupportedPlatforms returns the requested platforms that no buildkit worker can run, either natively or through a
+// registered emulator. Workers re-detect emulators on every listing.
+func (b *Builder) unsupportedPlatforms(ctx context.Context, requested []string) ([]string, error) {
+	workers, err := b.c.ListWorkers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list buildkit workers: %w", err)
+	}
+
+	var missing []string
+
+	for _, p := range requested {
+		parsed, err := platforms.Parse(p)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid platform %q: %w", ErrInvalid, p, err)
+		}
+
+		matcher := platforms.NewMatcher(parsed)
+
+		supported := slices.ContainsFunc(workers, func(w *client.WorkerInfo) bool {
+			return slices.ContainsFunc(w.Platforms, matcher.Match)
+		})
+
+		if !supported {
+			missing = append(missing, p)
+		}
+	}
+
+	return missing, nil
+}
+
+// checkPlatforms fails when the builder can not run any of the requested platforms.
+func (b *Builder) checkPlatforms(ctx context.Context, requested []string) error {
+	missing, err := b.unsupportedPlatforms(ctx, requested)
+	if err != nil {
+		return err
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf(
+			"%w: %s, install emulators with \"localflux doctor --fix\"",
+			ErrEmulationMissing,
+			strings.Join(missing, ", "),
+		)
+	}
+
+	return nil
+}
+
+// InstallEmulators installs QEMU handlers for the architectures into the buildkit host. Builds on the local Docker
+// host install them there, otherwise they are installed into the cluster nodes.
+func (b *Builder) InstallEmulators(ctx context.Context, archs []string) error {
+	if b.docker == nil && !b.local {
+		kc, err := b.provider.K8sClient(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		node, err := cluster.BuildKitNode(ctx, kc)
+		if err != nil {
+			return err
+		}
+
+		return cluster.InstallEmulators(ctx, kc, node.Name, archs)
+	}
+
+	docker, closeDocker, err := b.localDocker()
+	if err != nil {
+		return err
+	}
+
+	defer closeDocker()
+
+	return installLocalEmulators(ctx, docker, archs)
+}
+
+// installLocalEmulators runs the binfmt installer as a privileged container on the local Docker host.
+func installLocalEmulators(ctx context.Context, docker *dockerclient.Client, archs []string) error {
+	pull, err := docker.ImagePull(ctx, cluster.BinfmtImage, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull binfmt image: %w", err)
+	}
+
+	_, err = io.Copy(io.Discard, pull)
+
+	_ = pull.Close()
+
+	if err != nil {
+		return fmt.Errorf("failed to pull binfmt image: %w", err)
+	}
+
+	created, err := docker.ContainerCreate(
+		ctx,
+		&container.Config{
+			Image: cluster.BinfmtImage,
+			Cmd:   []string{"--install", strings.Join(archs, ",")},
+		},
+		&container.HostConfig{
+			Privileged: true,
+		},
+		nil,
+		nil,
+		"",
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create binfmt container: %w", err)
+	}
+
+	defer func() {
+		_ = docker.ContainerRemove(context.WithoutCancel(ctx), created.ID, container.RemoveOptions{Force: true})
+	}()
+
+	if err := docker.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to start binfmt container: %w", err)
+	}
+
+	waitCh, errCh := docker.ContainerWait(ctx, created.ID, container.WaitConditionNotRunning)
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("failed to wait for binfmt container: %w", err)
+	case res := <-waitCh:
+		if res.StatusCode == 0 {
+			return nil
+		}
+	}
+
+	var output strings.Builder
+
+	logs, err := docker.ContainerLogs(ctx, created.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+	if err == nil {
+		_, _ = stdcopy.StdCopy(&output, &output, logs)
+
+		_ = logs.Close()
+	}
+
+	return fmt.Errorf("%w: %s", cluster.ErrBinfmtFailed, strings.TrimSpace(output.String()))
+}
+
+type DoctorCheck struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// Doctor checks that the builder of the cluster is reachable and can build every platform requested by the images.
+// With fix, missing emulators are installed and the platforms checked again.
+func (m *Manager) Doctor(ctx context.Context, clusterName string, fix bool) ([]DoctorCheck, error) {
+	if clusterName == "" {
+		clusterName = m.cfg.DefaultCluster
+	}
+
+	provider, err := m.clusters.Provider(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := NewBuilder(ctx, m.logger, provider)
+	if err != nil {
+		return []DoctorCheck{{Name: "buildkit", Detail: err.Error()}}, nil
+	}
+
+	defer b.c.Close()
+
+	if b.docker != nil {
+		defer b.docker.Close()
+	}
+
+	backend := BackendBuildKit
+
+	switch {
+	case b.cfg.Backend == BackendCluster:
+		backend = BackendCluster
+	case b.docker != nil:
+		backend = BackendDocker
+	case b.local:
+		backend = BackendContainer
+	}
+
+	checks := []DoctorCheck{{Name: "buildkit", OK: true, Detail: "using " + backend + " backend"}}
+
+	var requested []string
+
+	for _, deployment := range m.cfg.Deployments {
+		for _, image := range deployment.Images {
+			for _, p := range image.Platforms {
+				if !slices.Contains(requested, p) {
+					requested = append(requested, p)
+				}
+			}
+		}
+	}
+
+	slices.Sort(requested)
+
+	missing, err := b.unsupportedPlatforms(ctx, requested)
+	if err != nil {
+		return nil, err
+	}
+
+	if fix && len(missing) > 0 {
+		var archs []string
+
+		for _, p := range missing {
+			arch := platforms.MustParse(p).Architecture
+			if !slices.Contains(archs, arch) {
+				archs = append(archs, arch)
+			}
+		}
+
+		m.logger.Info("Installing emulators", "archs", archs)
+
+		if err := b.InstallEmulators(ctx, archs); err != nil {
+			return nil, err
+		}
+
+		missing, err = b.unsupportedPlatforms(ctx, requested)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range requested {
+		check := DoctorCheck{Name: "platform " + p, OK: true, Detail: "supported"}
+
+		if slices.Contains(missing, p) {
+			check.OK = false
+			check.Detail = "emulation missing"
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks, nil
+}
@@ -0,0 +1,132 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/config"
+)
+
+var envNameRegex = regexp.MustCompile("[^A-Z0-9]+")
+
+// EnvVar is a single environment variable describing the local environment.
+type EnvVar struct {
+	Name  string
+	Value string
+}
+
+// environ returns the variables shared by hooks and the env command.
+func environ(env hookEnv) []EnvVar {
+	vars := []EnvVar{
+		{Name: "LOCALFLUX_CLUSTER", Value: env.cluster},
+		{Name: "LOCALFLUX_DEPLOYMENT", Value: env.deployment},
+	}
+
+	if env.step != "" {
+		vars = append(vars, EnvVar{Name: "LOCALFLUX_STEP", Value: env.step})
+	}
+
+	if env.provider != nil {
+		vars = append(vars,
+			EnvVar{Name: "LOCALFLUX_KUBE_CONTEXT", Value: env.provider.ContextName()},
+			EnvVar{Name: "LOCALFLUX_REGISTRY", Value: env.provider.Registry()},
+		)
+	}
+
+	return vars
+}
+
+func envName(parts ...string) string {
+	name := strings.ToUpper(strings.Join(parts, "_"))
+
+	return strings.Trim(envNameRegex.ReplaceAllString(name, "_"), "_")
+}
+
+// Env returns variables describing the local environment of a deployment: the cluster, registry and the local
+// addresses of forwarded ports. It does not contact the cluster.
+func (m *Manager) Env(ctx context.Context, clusterName string, name string) ([]EnvVar, error) {
+	if clusterName == "" {
+		clusterName = m.cfg.DefaultCluster
+	}
+
+	deployment, err := m.findRendered(ctx, name, clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := m.clusters.Provider(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := environ(hookEnv{
+		cluster:    clusterName,
+		deployment: deployment.Name,
+		provider:   provider,
+	})
+
+	for _, forward := range directForwards(deployment.PortForward) {
+		vars = append(vars, forwardEnv(forward, forwardAddr(forward, provider.RelayConfig().BindAddress))...)
+	}
+
+	return vars, nil
+}
+
+// Namespace returns the primary namespace of a deployment, which is the namespace of its first step that sets one. An
+// empty string is returned if no step sets a namespace.
+func (m *Manager) Namespace(ctx context.Context, name string) (string, error) {
+	deployment, err := m.findRendered(ctx, name, m.cfg.DefaultCluster)
+	if err != nil {
+		return "", err
+	}
+
+	for _, step := range deployment.Steps {
+		if ns := stepNamespace(step); ns != "" {
+			return ns, nil
+		}
+	}
+
+	return "", nil
+}
+
+// forwardAddr returns the local address a forward is reachable on. Forwards served on all interfaces are reached over
+// loopback.
+func forwardAddr(forward config.PortForward, relayBind string) string {
+	localPort := forward.Port
+	if forward.LocalPort != nil {
+		localPort = *forward.LocalPort
+	}
+
+	host := forward.BindAddress
+	if host == "" {
+		host = relayBind
+	}
+
+	addr, err := netip.ParseAddr(host)
+
+	switch {
+	case err != nil:
+		host = "127.0.0.1"
+	case addr.IsUnspecified() && addr.Is6():
+		host = "::1"
+	case addr.IsUnspecified():
+		host = "127.0.0.1"
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(localPort))
+}
+
+// forwardEnv returns the variables describing the local address of a forwarded port.
+func forwardEnv(forward config.PortForward, addr string) []EnvVar {
+	prefix := envName("LOCALFLUX", forward.Name, strconv.Itoa(forward.Port))
+
+	return []EnvVar{
+		{Name: prefix + "_ADDR", Value: addr},
+		{Name: prefix + "_URL", Value: fmt.Sprintf("http://%s", addr)},
+	}
+}
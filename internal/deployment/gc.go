@@ -0,0 +1,174 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+	helmv2 "github.com/fluxcd/helm-controller/api/v2"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	sourcev1b2 "github.com/fluxcd/source-controller/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// gcKinds lists the kinds localflux creates, ordered so that consumers are removed before their sources and the
+// deployment state is removed last.
+var gcKinds = []schema.GroupVersionKind{
+	kustomizev1.GroupVersion.WithKind(kustomizev1.KustomizationKind),
+	helmv2.GroupVersion.WithKind(helmv2.HelmReleaseKind),
+	sourcev1b2.GroupVersion.WithKind(sourcev1b2.OCIRepositoryKind),
+	sourcev1b2.GroupVersion.WithKind(sourcev1b2.HelmRepositoryKind),
+	sourcev1.GroupVersion.WithKind(sourcev1.GitRepositoryKind),
+	corev1.SchemeGroupVersion.WithKind("Secret"),
+	v1alpha1.GroupVersion.WithKind(v1alpha1.DeploymentKind),
+}
+
+// gcSelectors restricts the objects of kinds that localflux shares the namespace with to those it labelled.
+var gcSelectors = map[string]client.MatchingLabels{
+	"Secret": {stepSecretsLabel: "true"},
+}
+
+// Orphan is an object in the localflux namespace that does not correspond to any deployment in the config.
+type Orphan struct {
+	GVK  schema.GroupVersionKind
+	Name string
+}
+
+// FindOrphans lists the objects in the localflux namespace that are not produced by the current config. Kinds that
+// are not installed on the cluster are skipped.
+func (m *Manager) FindOrphans(ctx context.Context, clusterName string) ([]Orphan, error) {
+	kc, err := m.k8sClient(ctx, clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := m.expectedObjects()
+
+	var orphans []Orphan
+
+	for _, gvk := range gcKinds {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+
+		opts := []client.ListOption{client.InNamespace(cluster.LFNamespace)}
+
+		if selector, ok := gcSelectors[gvk.Kind]; ok {
+			opts = append(opts, selector)
+		}
+
+		if err := kc.Controller().List(ctx, list, opts...); err != nil {
+			if apimeta.IsNoMatchError(err) {
+				continue
+			}
+
+			return nil, fmt.Errorf("failed to list %s: %w", gvk.Kind, err)
+		}
+
+		for _, item := range list.Items {
+			if expected[gvk.Kind][item.GetName()] {
+				continue
+			}
+
+			orphans = append(orphans, Orphan{
+				GVK:  gvk,
+				Name: item.GetName(),
+			})
+		}
+	}
+
+	return orphans, nil
+}
+
+// DeleteOrphans removes the given objects from the localflux namespace.
+func (m *Manager) DeleteOrphans(ctx context.Context, clusterName string, orphans []Orphan) error {
+	kc, err := m.k8sClient(ctx, clusterName)
+	if err != nil {
+		return err
+	}
+
+	for _, orphan := range orphans {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(orphan.GVK)
+		obj.SetNamespace(cluster.LFNamespace)
+		obj.SetName(orphan.Name)
+
+		m.logger.Info("Deleting orphan", "kind", orphan.GVK.Kind, "name", orphan.Name)
+
+		if err := kc.Controller().Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete %s %q: %w", orphan.GVK.Kind, orphan.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) k8sClient(ctx context.Context, clusterName string) (*cluster.K8sClient, error) {
+	if clusterName == "" {
+		clusterName = m.cfg.DefaultCluster
+	}
+
+	provider, err := m.clusters.Provider(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	kc, err := provider.K8sClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create k8s client: %w", err)
+	}
+
+	return kc, nil
+}
+
+// expectedObjects returns the names of the objects each deployment in the config creates, keyed by kind.
+func (m *Manager) expectedObjects() map[string]map[string]bool {
+	expected := make(map[string]map[string]bool, len(gcKinds))
+
+	for _, gvk := range gcKinds {
+		expected[gvk.Kind] = make(map[string]bool)
+	}
+
+	for _, deployment := range m.cfg.Deployments {
+		expected[v1alpha1.DeploymentKind][fixName(deployment.Name)] = true
+
+		for _, step := range deployment.Steps {
+			remoteName := fixName(deployment.Name) + "-" + fixName(step.Name)
+
+			for _, kind := range stepKinds(step) {
+				expected[kind][remoteName] = true
+			}
+
+			// Only steps applied through Flux keep their secrets in a Secret.
+			if len(stepKinds(step)) > 0 {
+				expected["Secret"][remoteName+"-secrets"] = true
+			}
+		}
+	}
+
+	return expected
+}
+
+func stepKinds(step config.Step) []string {
+	switch {
+	case step.ApplyMode == ApplyModeDirect:
+		return nil
+	case step.Kustomize != nil, step.Manifests != nil, step.Compose != nil:
+		return []string{kustomizev1.KustomizationKind, sourcev1b2.OCIRepositoryKind}
+	case step.Helm != nil && step.Helm.Repo != "":
+		return []string{helmv2.HelmReleaseKind, sourcev1b2.HelmRepositoryKind}
+	case step.Helm != nil:
+		return []string{helmv2.HelmReleaseKind, sourcev1b2.OCIRepositoryKind}
+	case step.Git != nil:
+		return []string{kustomizev1.KustomizationKind, sourcev1.GitRepositoryKind}
+	default:
+		return nil
+	}
+}
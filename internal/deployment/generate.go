@@ -0,0 +1,185 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/config"
+	kustypes "sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// generatedDir is the directory within a staged kustomization that holds copies of generator sources.
+const generatedDir = "localflux-generated"
+
+// stageGenerators copies the context of each step with generators into a temporary directory and adds the
+// generators to its kustomization, so that kustomize appends content hashes and updates references. Generator
+// sources are copied alongside, as kustomize does not load files from outside the kustomization. Other steps are
+// returned unchanged. The returned cleanup function removes any staged directories.
+func stageGenerators(ctx context.Context, steps []config.Step) ([]config.Step, func(), error) {
+	var dirs []string
+
+	cleanup := func() {
+		for _, dir := range dirs {
+			_ = os.RemoveAll(dir)
+		}
+	}
+
+	staged := make([]config.Step, 0, len(steps))
+
+	for _, step := range steps {
+		if step.Generate == nil {
+			staged = append(staged, step)
+
+			continue
+		}
+
+		if step.Kustomize == nil {
+			cleanup()
+
+			return nil, nil, fmt.Errorf(
+				"%w: %q: generate is only supported by kustomize and manifests steps",
+				ErrInvalid,
+				step.Name,
+			)
+		}
+
+		dir, err := os.MkdirTemp("", "localflux-generate-")
+		if err != nil {
+			cleanup()
+
+			return nil, nil, fmt.Errorf("failed to create staging directory: %w", err)
+		}
+
+		dirs = append(dirs, dir)
+
+		err = copyContext(ctx, step.Kustomize.Context, step.Kustomize.IncludePaths, step.Kustomize.ExcludePaths, dir)
+		if err != nil {
+			cleanup()
+
+			return nil, nil, fmt.Errorf("step %q: %w", step.Name, err)
+		}
+
+		if err := writeGenerators(kustomizeDir(dir, step.Kustomize.Path), step.Generate); err != nil {
+			cleanup()
+
+			return nil, nil, fmt.Errorf("step %q: %w", step.Name, err)
+		}
+
+		converted := step.DeepCopy()
+		converted.Kustomize.Context = dir
+		converted.Kustomize.IncludePaths = nil
+		converted.Kustomize.ExcludePaths = nil
+
+		staged = append(staged, converted)
+	}
+
+	return staged, cleanup, nil
+}
+
+func writeGenerators(dir string, generate config.Generate) error {
+	var (
+		configMaps []kustypes.ConfigMapArgs
+		secrets    []kustypes.SecretArgs
+	)
+
+	for _, gen := range generate.ConfigMaps {
+		args, err := generatorArgs(dir, "configmap", gen)
+		if err != nil {
+			return err
+		}
+
+		configMaps = append(configMaps, kustypes.ConfigMapArgs{
+			GeneratorArgs: args,
+		})
+	}
+
+	for _, gen := range generate.Secrets {
+		args, err := generatorArgs(dir, "secret", gen)
+		if err != nil {
+			return err
+		}
+
+		secrets = append(secrets, kustypes.SecretArgs{
+			GeneratorArgs: args,
+			Type:          gen.Type,
+		})
+	}
+
+	return editKustomization(filesys.MakeFsOnDisk(), dir, func(k *kustypes.Kustomization) error {
+		k.ConfigMapGenerator = append(k.ConfigMapGenerator, configMaps...)
+		k.SecretGenerator = append(k.SecretGenerator, secrets...)
+
+		return nil
+	})
+}
+
+// generatorArgs copies the generator's files into the kustomization and returns the equivalent kustomize generator.
+func generatorArgs(dir string, kind string, gen config.Generator) (kustypes.GeneratorArgs, error) {
+	sourceDir := filepath.Join(generatedDir, kind+"-"+gen.Name)
+
+	if err := os.MkdirAll(filepath.Join(dir, sourceDir), 0o755); err != nil {
+		return kustypes.GeneratorArgs{}, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// stage copies a source file and returns its path relative to the kustomization.
+	stage := func(i int, path string) (string, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %q for %s %q: %w", path, kind, gen.Name, err)
+		}
+
+		// Prefix with the index to avoid collisions between equally named files.
+		rel := filepath.Join(sourceDir, strconv.Itoa(i)+"-"+filepath.Base(path))
+
+		if err := os.WriteFile(filepath.Join(dir, rel), data, 0o600); err != nil {
+			return "", fmt.Errorf("failed to stage %q: %w", path, err)
+		}
+
+		return filepath.ToSlash(rel), nil
+	}
+
+	args := kustypes.GeneratorArgs{
+		Name:      gen.Name,
+		Namespace: gen.Namespace,
+		Behavior:  "create",
+		KvPairSources: kustypes.KvPairSources{
+			LiteralSources: gen.Literals,
+		},
+	}
+
+	for i, file := range gen.Files {
+		key, path, ok := strings.Cut(file, "=")
+		if !ok {
+			key, path = filepath.Base(file), file
+		}
+
+		rel, err := stage(i, path)
+		if err != nil {
+			return kustypes.GeneratorArgs{}, err
+		}
+
+		args.FileSources = append(args.FileSources, key+"="+rel)
+	}
+
+	for i, env := range gen.Envs {
+		rel, err := stage(len(gen.Files)+i, env)
+		if err != nil {
+			return kustypes.GeneratorArgs{}, err
+		}
+
+		args.EnvSources = append(args.EnvSources, rel)
+	}
+
+	if gen.DisableHash {
+		args.Options = &kustypes.GeneratorOptions{
+			DisableNameSuffixHash: true,
+		}
+	}
+
+	return args, nil
+}
@@ -0,0 +1,262 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
+	"github.com/fluxcd/pkg/apis/kustomize"
+	"github.com/fluxcd/pkg/apis/meta"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/google/uuid"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// gitRef returns the repository reference of a git step, or nil to use the default branch.
+func gitRef(git config.Git) *sourcev1.GitRepositoryRef {
+	if git.Branch == "" && git.Tag == "" && git.SemVer == "" && git.Commit == "" {
+		return nil
+	}
+
+	return &sourcev1.GitRepositoryRef{
+		Branch: git.Branch,
+		Tag:    git.Tag,
+		SemVer: git.SemVer,
+		Commit: git.Commit,
+	}
+}
+
+// gitArtifact describes the source of a git step for results, e.g. "https://github.com/org/repo@main".
+func gitArtifact(git config.Git) string {
+	artifact := git.URL
+
+	switch {
+	case git.Commit != "":
+		artifact += "@" + git.Commit
+	case git.SemVer != "":
+		artifact += "@" + git.SemVer
+	case git.Tag != "":
+		artifact += "@" + git.Tag
+	case git.Branch != "":
+		artifact += "@" + git.Branch
+	}
+
+	if git.Path != "" {
+		artifact += "//" + strings.TrimPrefix(git.Path, "./")
+	}
+
+	return artifact
+}
+
+func (m *Manager) deployGit(
+	ctx context.Context,
+	deployment config.Deployment,
+	step config.Step,
+	cb Callbacks,
+	replacementImages []kustomize.Image,
+	kc *cluster.K8sClient,
+	env hookEnv,
+	outputs Outputs,
+	sr *StepResult,
+) error {
+	start := time.Now()
+
+	m.logger.Info("Executing step", "step", step.Name)
+
+	remoteName := fixName(deployment.Name) + "-" + fixName(step.Name)
+
+	sr.Artifact = gitArtifact(step.Git)
+
+	// There is nothing to build locally, but the hook is still run so that steps can be switched between types.
+	if err := m.runHooks(ctx, hookPostBuild, step.Hooks, env, cb); err != nil {
+		return err
+	}
+
+	cb.State(fmt.Sprintf("Step %q", step.Name), "Deploying namespace", start)
+
+	if err := kc.CreateNamespace(ctx, cluster.LFNamespace); err != nil {
+		return fmt.Errorf("failed to create namespace: %w", err)
+	}
+
+	if step.Git.Namespace != "" {
+		if err := kc.CreateNamespace(ctx, step.Git.Namespace); err != nil {
+			return fmt.Errorf("failed to create namespace: %w", err)
+		}
+	}
+
+	cb.State(fmt.Sprintf("Step %q", step.Name), "Deploying repo", start)
+
+	var secretRef *meta.LocalObjectReference
+
+	if step.Git.SecretRef != "" {
+		secretRef = &meta.LocalObjectReference{
+			Name: step.Git.SecretRef,
+		}
+	}
+
+	if err := kc.PatchSSA(ctx, &sourcev1.GitRepository{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       sourcev1.GitRepositoryKind,
+			APIVersion: sourcev1.GroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      remoteName,
+			Namespace: cluster.LFNamespace,
+		},
+		Spec: sourcev1.GitRepositorySpec{
+			URL:       step.Git.URL,
+			SecretRef: secretRef,
+			Interval:  m.interval(step, time.Minute),
+			Reference: gitRef(step.Git),
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to create git repository: %w", err)
+	}
+
+	cb.State(fmt.Sprintf("Step %q", step.Name), "Deploying kustomize", start)
+
+	tgt := uuid.New().String()
+
+	substitute, err := outputs.expandMap(step.Git.Substitute)
+	if err != nil {
+		return fmt.Errorf("failed to expand substitutions: %w", err)
+	}
+
+	postBuild, err := m.postBuild(ctx, kc, remoteName, substitute)
+	if err != nil {
+		return err
+	}
+
+	if err := kc.PatchSSA(ctx, &kustomizev1.Kustomization{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: kustomizev1.GroupVersion.String(),
+			Kind:       kustomizev1.KustomizationKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      remoteName,
+			Namespace: cluster.LFNamespace,
+			Annotations: map[string]string{
+				meta.ReconcileRequestAnnotation: tgt,
+			},
+		},
+		Spec: kustomizev1.KustomizationSpec{
+			Interval:  m.interval(step, time.Minute),
+			DependsOn: fluxDependsOn(deployment, step, kustomizev1.KustomizationKind),
+			Path:      step.Git.Path,
+			PostBuild: postBuild,
+			Prune:     enabled(step.Git.Prune),
+			Patches:   step.Git.Patches,
+			Images:    replacementImages,
+			SourceRef: kustomizev1.CrossNamespaceSourceReference{
+				APIVersion: sourcev1.GroupVersion.String(),
+				Namespace:  cluster.LFNamespace,
+				Kind:       sourcev1.GitRepositoryKind,
+				Name:       remoteName,
+			},
+			TargetNamespace: step.Git.Namespace,
+			Force:           enabled(step.Git.Force),
+			Components:      step.Git.Components,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to create kustomization: %w", err)
+	}
+
+	if step.Git.Wait == nil || *step.Git.Wait {
+		ks := new(ReconcileKustomization)
+
+		if err := Reconcile[*ReconcileKustomization](
+			ctx,
+			kc,
+			cluster.LFNamespace,
+			remoteName,
+			tgt,
+			m.timeout(step),
+			retries(step),
+			ks,
+			nil,
+			func(s string) {
+				cb.State(fmt.Sprintf("Step %q", step.Name), "Waiting for reconcile: "+s, start)
+			},
+		); err != nil {
+			m.diagnose(ctx, kc, step, inventoryNamespaces(&ks.Kustomization), cb)
+
+			return fmt.Errorf("failed to reconcile kustomization: %w", err)
+		}
+	}
+
+	cb.Completed(fmt.Sprintf("Deployed step %q", step.Name), time.Since(start))
+
+	return nil
+}
+
+// cloneGit shallow clones the repository of a git step into dir using the local git client, for commands that need
+// the manifests outside the cluster.
+func cloneGit(ctx context.Context, git config.Git, dir string) error {
+	if git.SemVer != "" {
+		return fmt.Errorf("%w: semver references can only be resolved in-cluster", ErrInvalid)
+	}
+
+	args := []string{"clone", "--quiet"}
+
+	switch {
+	case git.Commit != "":
+		// A commit cannot be shallow cloned by name, so it is checked out after a full clone.
+	case git.Tag != "":
+		args = append(args, "--depth", "1", "--branch", git.Tag)
+	case git.Branch != "":
+		args = append(args, "--depth", "1", "--branch", git.Branch)
+	default:
+		args = append(args, "--depth", "1")
+	}
+
+	args = append(args, git.URL, dir)
+
+	run := func(args ...string) error {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git failed: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+
+		return nil
+	}
+
+	if err := run(args...); err != nil {
+		return err
+	}
+
+	if git.Commit != "" {
+		if err := run("-C", dir, "checkout", "--quiet", git.Commit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// gitKustomizeStep returns a kustomize step equivalent to a git step whose repository has been cloned into dir.
+func gitKustomizeStep(step config.Step, dir string) config.Step {
+	converted := step.DeepCopy()
+	converted.Git = nil
+	converted.Kustomize = &v1alpha2.Kustomize{
+		Context:    dir,
+		Path:       step.Git.Path,
+		Namespace:  step.Git.Namespace,
+		Components: step.Git.Components,
+		Substitute: step.Git.Substitute,
+		Patches:    step.Git.Patches,
+		Prune:      step.Git.Prune,
+		Force:      step.Git.Force,
+		Wait:       step.Git.Wait,
+	}
+
+	return converted
+}
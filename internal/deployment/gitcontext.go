@@ -0,0 +1,57 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// gitContextPrefixes identify image contexts that are git repositories rather than local directories.
+var gitContextPrefixes = []string{"git://", "git@", "ssh://", "https://", "http://"}
+
+var commitRegex = regexp.MustCompile("^[0-9a-f]{40}$")
+
+// isGitContext reports whether the image context is a git URL, in the "<url>#<ref>:<subdir>" form used by docker.
+func isGitContext(c string) bool {
+	for _, prefix := range gitContextPrefixes {
+		if strings.HasPrefix(c, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitGitContext splits a git context into the repository URL, the ref and the subdirectory.
+func splitGitContext(c string) (string, string, string) {
+	url, fragment, _ := strings.Cut(c, "#")
+	ref, subdir, _ := strings.Cut(fragment, ":")
+
+	return url, ref, subdir
+}
+
+// gitContextRevision resolves the ref of a git context to the commit it currently points at.
+func gitContextRevision(ctx context.Context, c string) (string, error) {
+	url, ref, _ := splitGitContext(c)
+
+	if commitRegex.MatchString(ref) {
+		return ref, nil
+	}
+
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	out, err := gitOutput(ctx, "", "ls-remote", url, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %q: %w", c, err)
+	}
+
+	sha, _, _ := strings.Cut(out, "\t")
+	if !commitRegex.MatchString(sha) {
+		return "", fmt.Errorf("%w: ref %q not found in %q", ErrInvalid, ref, url)
+	}
+
+	return sha, nil
+}
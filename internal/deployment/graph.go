@@ -0,0 +1,245 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	helmv2 "github.com/fluxcd/helm-controller/api/v2"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	sourcev1b2 "github.com/fluxcd/source-controller/api/v1beta2"
+)
+
+var ErrUnknownFormat = errors.New("unknown graph format")
+
+const (
+	GraphFormatDot     = "dot"
+	GraphFormatMermaid = "mermaid"
+)
+
+type GraphNode struct {
+	ID    string
+	Kind  string
+	Label string
+}
+
+type GraphEdge struct {
+	From  string
+	To    string
+	Label string
+}
+
+// Graph describes the objects a deployment will create and how they relate.
+type Graph struct {
+	Name  string
+	Nodes []*GraphNode
+	Edges []*GraphEdge
+}
+
+func (g *Graph) addNode(kind string, label string) string {
+	id := "n" + strconv.Itoa(len(g.Nodes))
+
+	g.Nodes = append(g.Nodes, &GraphNode{
+		ID:    id,
+		Kind:  kind,
+		Label: label,
+	})
+
+	return id
+}
+
+func (g *Graph) addEdge(from string, to string, label string) {
+	g.Edges = append(g.Edges, &GraphEdge{
+		From:  from,
+		To:    to,
+		Label: label,
+	})
+}
+
+// Graph builds the deployment graph for the named deployment without contacting the cluster.
+func (m *Manager) Graph(ctx context.Context, name string) (*Graph, error) {
+	deployment, err := m.findRendered(ctx, name, m.cfg.DefaultCluster)
+	if err != nil {
+		return nil, err
+	}
+
+	deployment, err = m.applyCompose(deployment, "")
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{
+		Name: deployment.Name,
+	}
+
+	root := g.addNode("deployment", "Deployment "+deployment.Name)
+
+	var imageIDs []string
+
+	for _, image := range deployment.Images {
+		imageIDs = append(imageIDs, g.addNode("image", "Image "+image.Image))
+	}
+
+	steps, err := orderSteps(deployment, deployment.Steps)
+	if err != nil {
+		return nil, err
+	}
+
+	prev := root
+	stepIDs := make(map[string]string, len(steps))
+
+	for _, step := range steps {
+		stepID := g.addNode("step", "Step "+step.Name)
+		stepIDs[step.Name] = stepID
+
+		g.addEdge(prev, stepID, "then")
+
+		for _, dep := range step.DependsOn {
+			if depID, ok := stepIDs[dep]; ok {
+				g.addEdge(depID, stepID, "dependsOn")
+			}
+		}
+
+		prev = stepID
+
+		remoteName := cluster.LFNamespace + "/" + fixName(deployment.Name) + "-" + fixName(step.Name)
+
+		switch {
+		case step.ApplyMode == ApplyModeDirect:
+			for _, imageID := range imageIDs {
+				g.addEdge(imageID, stepID, "image")
+			}
+
+		case step.Kustomize != nil, step.Manifests != nil, step.Compose != nil:
+			repoID := g.addNode("flux", sourcev1b2.OCIRepositoryKind+" "+remoteName)
+			ksID := g.addNode("flux", kustomizev1.KustomizationKind+" "+remoteName)
+
+			g.addEdge(stepID, repoID, "pushes")
+			g.addEdge(stepID, ksID, "applies")
+			g.addEdge(repoID, ksID, "source")
+
+			for _, imageID := range imageIDs {
+				g.addEdge(imageID, ksID, "image")
+			}
+
+		case step.Git != nil:
+			repoID := g.addNode("flux", sourcev1.GitRepositoryKind+" "+remoteName)
+			ksID := g.addNode("flux", kustomizev1.KustomizationKind+" "+remoteName)
+
+			g.addEdge(stepID, repoID, "creates")
+			g.addEdge(stepID, ksID, "applies")
+			g.addEdge(repoID, ksID, "source")
+
+			for _, imageID := range imageIDs {
+				g.addEdge(imageID, ksID, "image")
+			}
+
+		case step.Helm != nil:
+			sourceKind := sourcev1b2.OCIRepositoryKind
+			if step.Helm.Repo != "" {
+				sourceKind = sourcev1b2.HelmRepositoryKind
+			}
+
+			repoID := g.addNode("flux", sourceKind+" "+remoteName)
+			hrID := g.addNode("flux", helmv2.HelmReleaseKind+" "+remoteName)
+
+			g.addEdge(stepID, repoID, "creates")
+			g.addEdge(stepID, hrID, "applies")
+			g.addEdge(repoID, hrID, "chart")
+
+			for _, imageID := range imageIDs {
+				g.addEdge(imageID, hrID, "image")
+			}
+		}
+	}
+
+	for _, forward := range deployment.PortForward {
+		localPort := forward.Port
+		if forward.LocalPort != nil {
+			localPort = *forward.LocalPort
+		}
+
+		pfID := g.addNode("forward", fmt.Sprintf(
+			"Forward :%d -> %s %s/%s:%d",
+			localPort,
+			forward.Kind,
+			forward.Namespace,
+			forward.Name,
+			forward.Port,
+		))
+
+		g.addEdge(root, pfID, "forwards")
+	}
+
+	return g, nil
+}
+
+// Render renders the graph in the given format.
+func (g *Graph) Render(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case GraphFormatDot, "":
+		return g.renderDot(), nil
+	case GraphFormatMermaid:
+		return g.renderMermaid(), nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+var dotShapes = map[string]string{
+	"deployment": "doubleoctagon",
+	"image":      "box3d",
+	"step":       "box",
+	"flux":       "component",
+	"forward":    "cds",
+}
+
+func (g *Graph) renderDot() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "digraph %q {\n", g.Name)
+	sb.WriteString("  rankdir=LR;\n")
+
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&sb, "  %s [label=%q shape=%s];\n", n.ID, n.Label, dotShapes[n.Kind])
+	}
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&sb, "  %s -> %s [label=%q];\n", e.From, e.To, e.Label)
+	}
+
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+func (g *Graph) renderMermaid() string {
+	var sb strings.Builder
+
+	sb.WriteString("flowchart LR\n")
+
+	for _, n := range g.Nodes {
+		label := strings.ReplaceAll(n.Label, `"`, "#quot;")
+
+		switch n.Kind {
+		case "deployment":
+			fmt.Fprintf(&sb, "  %s{{\"%s\"}}\n", n.ID, label)
+		case "image":
+			fmt.Fprintf(&sb, "  %s[(\"%s\")]\n", n.ID, label)
+		case "forward":
+			fmt.Fprintf(&sb, "  %s>\"%s\"]\n", n.ID, label)
+		default:
+			fmt.Fprintf(&sb, "  %s[\"%s\"]\n", n.ID, label)
+		}
+	}
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&sb, "  %s -->|%s| %s\n", e.From, e.Label, e.To)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,54 @@
+package deployment
+
+import (
+	"bytes"
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+// buildHelmDependencies downloads the dependencies of a local chart into its charts directory, honouring Chart.lock,
+// in the same way as "helm dependency build". Charts whose dependencies are already present are left untouched.
+func (m *Manager) buildHelmDependencies(chartPath string) error {
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return fmt.Errorf("failed to load chart: %w", err)
+	}
+
+	if len(chrt.Metadata.Dependencies) == 0 || action.CheckDependencies(chrt, chrt.Metadata.Dependencies) == nil {
+		return nil
+	}
+
+	m.logger.Info("Building chart dependencies", "chart", chartPath)
+
+	settings := cli.New()
+
+	rc, err := registry.NewClient()
+	if err != nil {
+		return fmt.Errorf("failed to create registry client: %w", err)
+	}
+
+	var out bytes.Buffer
+
+	man := &downloader.Manager{
+		Out:              &out,
+		ChartPath:        chartPath,
+		Getters:          getter.All(settings),
+		RegistryClient:   rc,
+		RepositoryConfig: settings.RepositoryConfig,
+		RepositoryCache:  settings.RepositoryCache,
+	}
+
+	if err := man.Build(); err != nil {
+		m.logger.Debug("Dependency build output", "output", out.String())
+
+		return fmt.Errorf("failed to build chart dependencies: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aymanbagabas/go-udiff"
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/fluxcd/pkg/apis/kustomize"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"sigs.k8s.io/yaml"
+)
+
+// ReleaseDiff describes the changes a helm step makes to its deployed release.
+type ReleaseDiff struct {
+	Step string
+	// Install is set if no release has been deployed yet, in which case the diffs are against an empty release.
+	Install bool
+	// Values is a unified diff of the values passed to the chart. It is empty if the values are unchanged.
+	Values string
+	// Manifest is a unified diff of the rendered manifest, excluding hooks. It is empty if the manifest is unchanged.
+	Manifest string
+}
+
+// diffHelm compares the release helm-controller last deployed for the step with a local render of the pending values
+// and reports the differences through the callbacks.
+func (m *Manager) diffHelm(
+	ctx context.Context,
+	step config.Step,
+	cb Callbacks,
+	replacementImages []kustomize.Image,
+	kc *cluster.K8sClient,
+	outputs Outputs,
+) error {
+	values, err := helmValues(ctx, kc, step, replacementImages, cb)
+	if err != nil {
+		return err
+	}
+
+	if _, err := outputs.expandValues(values); err != nil {
+		return fmt.Errorf("failed to expand values: %w", err)
+	}
+
+	// Secrets are resolved so that the render matches the deployed release, then masked in the diffs. The values the
+	// deployed release holds in their place are masked too, in case the secrets changed.
+	paths := secretValuePaths(values, nil)
+	secrets := m.newSecretResolver()
+
+	if _, err := walkValues(values, secrets.expand); err != nil {
+		return fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
+	pending, err := m.renderHelmRelease(ctx, step, values, replacementImages)
+	if err != nil {
+		return err
+	}
+
+	// helm-controller stores releases in the namespace of the HelmRelease, under the configured release name.
+	store := storage.Init(driver.NewSecrets(kc.ClientSet().CoreV1().Secrets(cluster.LFNamespace)))
+
+	deployed, err := store.Deployed(step.Name)
+	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) && !errors.Is(err, driver.ErrNoDeployedReleases) {
+		return fmt.Errorf("failed to fetch deployed release: %w", err)
+	}
+
+	diff := &ReleaseDiff{
+		Step: step.Name,
+	}
+
+	if deployed == nil {
+		diff.Install = true
+		deployed = &release.Release{}
+	}
+
+	for _, path := range paths {
+		if old, ok := valueAt(deployed.Config, path); ok {
+			secrets.secrets = append(secrets.secrets, old)
+		}
+	}
+
+	oldValues, err := encodeDiffValues(deployed.Config)
+	if err != nil {
+		return err
+	}
+
+	newValues, err := encodeDiffValues(pending.Config)
+	if err != nil {
+		return err
+	}
+
+	diff.Values = udiff.Unified("deployed", "pending", secrets.mask(oldValues), secrets.mask(newValues))
+	diff.Manifest = udiff.Unified(
+		"deployed",
+		"pending",
+		secrets.mask(deployed.Manifest),
+		secrets.mask(pending.Manifest),
+	)
+
+	if diff.Values == "" && diff.Manifest == "" {
+		cb.Info(fmt.Sprintf("Step %q has no changes to its release", step.Name))
+
+		return nil
+	}
+
+	cb.Diff(diff)
+
+	return nil
+}
+
+// secretValuePaths returns the paths of the strings within the values that reference secrets, as map keys and list
+// indexes.
+func secretValuePaths(value any, path []any) [][]any {
+	var paths [][]any
+
+	switch v := value.(type) {
+	case string:
+		if hasSecretRefs(v) {
+			paths = append(paths, slices.Clone(path))
+		}
+	case map[string]any:
+		for k, inner := range v {
+			paths = append(paths, secretValuePaths(inner, append(path, k))...)
+		}
+	case []any:
+		for i, inner := range v {
+			paths = append(paths, secretValuePaths(inner, append(path, i))...)
+		}
+	}
+
+	return paths
+}
+
+// valueAt returns the string at the path within the values.
+func valueAt(values map[string]any, path []any) (string, bool) {
+	var value any = values
+
+	for _, elem := range path {
+		switch key := elem.(type) {
+		case string:
+			m, ok := value.(map[string]any)
+			if !ok {
+				return "", false
+			}
+
+			value = m[key]
+		case int:
+			l, ok := value.([]any)
+			if !ok || key >= len(l) {
+				return "", false
+			}
+
+			value = l[key]
+		}
+	}
+
+	s, ok := value.(string)
+
+	return s, ok
+}
+
+func encodeDiffValues(values map[string]any) (string, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal values: %w", err)
+	}
+
+	return string(data), nil
+}
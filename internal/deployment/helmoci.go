@@ -0,0 +1,53 @@
+package deployment
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	sourcev1b2 "github.com/fluxcd/source-controller/api/v1beta2"
+)
+
+// helmChartMediaType is the layer media type of helm charts stored in OCI registries.
+const helmChartMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+
+// isOCIChart reports whether the helm step references an OCI chart directly, rather than through a repo or context.
+func isOCIChart(helm *v1alpha2.Helm) bool {
+	return helm.Repo == "" && helm.Context == "" && strings.HasPrefix(strings.ToLower(helm.Chart), "oci://")
+}
+
+// validateHelm checks that the helm step specifies exactly one chart source.
+func validateHelm(helm *v1alpha2.Helm) error {
+	if helm.Repo != "" && helm.Context != "" {
+		return fmt.Errorf("%w: helm repo and context are mutually exclusive", ErrInvalid)
+	}
+
+	if helm.Context == "" && helm.Chart == "" {
+		return fmt.Errorf("%w: helm chart is required unless a context is given", ErrInvalid)
+	}
+
+	if (helm.Repo != "" || helm.Context != "") && strings.HasPrefix(strings.ToLower(helm.Chart), "oci://") {
+		return fmt.Errorf("%w: oci chart references cannot be combined with a helm repo or context", ErrInvalid)
+	}
+
+	return nil
+}
+
+// ociChartRef selects the chart version of an OCI chart. Versions that are valid semver ranges, including exact
+// versions, are resolved by Flux, while anything else is used as a tag.
+func ociChartRef(version string) *sourcev1b2.OCIRepositoryRef {
+	if version == "" {
+		return nil
+	}
+
+	if _, err := semver.NewConstraint(version); err == nil {
+		return &sourcev1b2.OCIRepositoryRef{
+			SemVer: version,
+		}
+	}
+
+	return &sourcev1b2.OCIRepositoryRef{
+		Tag: version,
+	}
+}
@@ -0,0 +1,300 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	"github.com/fluxcd/pkg/apis/kustomize"
+	"github.com/fluxcd/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/strvals"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	controllerclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultValuesKey = "values.yaml"
+
+// applyValueOverrides returns a copy of the deployment with the given value files and "key=value" values merged over
+// the inline values of its helm steps, in that order. Each entry may be prefixed with "<step>:" to target a single
+// step, otherwise it applies to every helm step. The original deployment is left unmodified.
+func applyValueOverrides(deployment config.Deployment, files []string, set []string) (config.Deployment, error) {
+	if len(files) == 0 && len(set) == 0 {
+		return deployment, nil
+	}
+
+	out := deployment.DeepCopy()
+
+	overrides := make(map[string]map[string]any)
+
+	target := func(entry string) ([]config.Step, string, error) {
+		if name, rest, ok := strings.Cut(entry, ":"); ok {
+			idx := slices.IndexFunc(out.Steps, func(step *v1alpha2.Step) bool {
+				return step.Name == name
+			})
+
+			if idx != -1 {
+				if out.Steps[idx].Helm == nil {
+					return nil, "", fmt.Errorf("%w: values can only be set on helm steps, %q is not", ErrInvalid, name)
+				}
+
+				return out.Steps[idx : idx+1], rest, nil
+			}
+		}
+
+		var steps []config.Step
+
+		for _, step := range out.Steps {
+			if step.Helm != nil {
+				steps = append(steps, step)
+			}
+		}
+
+		if len(steps) == 0 {
+			return nil, "", fmt.Errorf("%w: values can only be set on helm steps, %q has none", ErrInvalid, deployment.Name)
+		}
+
+		return steps, entry, nil
+	}
+
+	merge := func(steps []config.Step, values map[string]any) {
+		for _, step := range steps {
+			overrides[step.Name] = chartutil.MergeMaps(overrides[step.Name], values)
+		}
+	}
+
+	for _, entry := range files {
+		steps, file, err := target(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		values, err := readValuesFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		merge(steps, values)
+	}
+
+	for _, entry := range set {
+		steps, value, err := target(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make(map[string]any)
+
+		if err := strvals.ParseInto(value, values); err != nil {
+			return nil, fmt.Errorf("%w: failed to parse value %q: %w", ErrInvalid, value, err)
+		}
+
+		merge(steps, values)
+	}
+
+	for _, step := range out.Steps {
+		values, ok := overrides[step.Name]
+		if !ok {
+			continue
+		}
+
+		encoded, err := json.Marshal(values)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode values: %w", err)
+		}
+
+		merged, err := mergeValues(step.Helm.Values, &apiextensionsv1.JSON{Raw: encoded})
+		if err != nil {
+			return nil, err
+		}
+
+		step.Helm.Values = merged
+	}
+
+	return out, nil
+}
+
+func readValuesFile(file string) (map[string]any, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %q: %w", file, err)
+	}
+
+	var values map[string]any
+
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to read file %q: %w", file, err)
+	}
+
+	return values, nil
+}
+
+// valuesFrom resolves the step's value references, merging them in order. Secret and ConfigMap references require a
+// cluster, so they are skipped with a warning when kc is nil.
+func valuesFrom(ctx context.Context, kc *cluster.K8sClient, step config.Step, cb Callbacks) (map[string]any, error) {
+	values := make(map[string]any)
+
+	for _, ref := range step.Helm.ValuesFrom {
+		var (
+			raw   string
+			found bool
+		)
+
+		switch ref.Kind {
+		case "Env":
+			raw, found = os.LookupEnv(ref.Name)
+
+		case "Secret", "ConfigMap":
+			if kc == nil {
+				cb.Warn(fmt.Sprintf("Step %q reads values from %s %q, which are left out without a cluster", step.Name, ref.Kind, ref.Name))
+
+				continue
+			}
+
+			var err error
+
+			raw, found, err = readValuesRef(ctx, kc, step, ref)
+			if err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, fmt.Errorf("%w: unknown values reference kind %q", ErrInvalid, ref.Kind)
+		}
+
+		if !found {
+			if ref.Optional {
+				continue
+			}
+
+			return nil, fmt.Errorf("%w: values reference %s %q not found", ErrInvalid, ref.Kind, ref.Name)
+		}
+
+		extraValues := make(map[string]any)
+
+		if ref.TargetPath != "" {
+			if err := strvals.ParseIntoString(ref.TargetPath+"="+raw, extraValues); err != nil {
+				return nil, fmt.Errorf("failed to set values from %s %q: %w", ref.Kind, ref.Name, err)
+			}
+		} else if err := yaml.Unmarshal([]byte(raw), &extraValues); err != nil {
+			return nil, fmt.Errorf("failed to parse values from %s %q: %w", ref.Kind, ref.Name, err)
+		}
+
+		values = chartutil.MergeMaps(values, extraValues)
+	}
+
+	return values, nil
+}
+
+func readValuesRef(ctx context.Context, kc *cluster.K8sClient, step config.Step, ref config.ValuesRef) (string, bool, error) {
+	key := controllerclient.ObjectKey{
+		Namespace: ref.Namespace,
+		Name:      ref.Name,
+	}
+
+	if key.Namespace == "" {
+		key.Namespace = step.Helm.Namespace
+	}
+
+	if key.Namespace == "" {
+		key.Namespace = "default"
+	}
+
+	valuesKey := ref.ValuesKey
+	if valuesKey == "" {
+		valuesKey = defaultValuesKey
+	}
+
+	if ref.Kind == "Secret" {
+		var secret corev1.Secret
+
+		if err := kc.Controller().Get(ctx, key, &secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				return "", false, nil
+			}
+
+			return "", false, fmt.Errorf("failed to get secret %q: %w", ref.Name, err)
+		}
+
+		data, ok := secret.Data[valuesKey]
+
+		return string(data), ok, nil
+	}
+
+	var cm corev1.ConfigMap
+
+	if err := kc.Controller().Get(ctx, key, &cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", false, nil
+		}
+
+		return "", false, fmt.Errorf("failed to get config map %q: %w", ref.Name, err)
+	}
+
+	data, ok := cm.Data[valuesKey]
+
+	return data, ok, nil
+}
+
+// applyImageValues sets the configured value paths to the references of the built images. A nil replacementImages
+// means no images were built, as when rendering, in which case the image names are used as written.
+func applyImageValues(step config.Step, replacementImages []kustomize.Image, values map[string]any) (map[string]any, error) {
+	for _, mapping := range step.Helm.ImageValues {
+		image := kustomize.Image{
+			Name:    mapping.Image,
+			NewName: mapping.Image,
+		}
+
+		idx := slices.IndexFunc(replacementImages, func(img kustomize.Image) bool {
+			return img.Name == mapping.Image
+		})
+
+		switch {
+		case idx != -1:
+			image = replacementImages[idx]
+		case replacementImages != nil:
+			return nil, fmt.Errorf("%w: image values reference %q, which is not built by the deployment", ErrInvalid, mapping.Image)
+		}
+
+		ref := image.NewName
+
+		switch {
+		case image.NewTag != "":
+			ref += ":" + image.NewTag
+		case image.Digest != "":
+			ref += "@" + image.Digest
+		}
+
+		for _, field := range []struct {
+			path  string
+			value string
+		}{
+			{mapping.Path, ref},
+			{mapping.RepositoryPath, image.NewName},
+			{mapping.TagPath, image.NewTag},
+			{mapping.DigestPath, image.Digest},
+		} {
+			if field.path == "" || field.value == "" {
+				continue
+			}
+
+			extraValues := make(map[string]any)
+
+			if err := strvals.ParseIntoString(field.path+"="+field.value, extraValues); err != nil {
+				return nil, fmt.Errorf("%w: failed to set image value %q: %w", ErrInvalid, field.path, err)
+			}
+
+			values = chartutil.MergeMaps(values, extraValues)
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,182 @@
+package deployment
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"golang.org/x/sync/errgroup"
+)
+
+var ErrHookFailed = errors.New("hook failed")
+
+const (
+	hookErrorLines = 10
+	// hookOutputLines bounds the lines of hook output kept for display.
+	hookOutputLines = 100
+	// maxHookLineSize bounds a single line of hook output.
+	maxHookLineSize = 1024 * 1024
+)
+
+type hookEnv struct {
+	cluster    string
+	deployment string
+	step       string
+	provider   cluster.Provider
+}
+
+const (
+	hookPreBuild      = "preBuild"
+	hookPostBuild     = "postBuild"
+	hookPostReconcile = "postReconcile"
+)
+
+func (m *Manager) runHooks(ctx context.Context, stage string, hooks config.Hooks, env hookEnv, cb Callbacks) error {
+	if hooks == nil {
+		return nil
+	}
+
+	var selected []config.Hook
+
+	switch stage {
+	case hookPreBuild:
+		selected = hooks.PreBuild
+	case hookPostBuild:
+		selected = hooks.PostBuild
+	case hookPostReconcile:
+		selected = hooks.PostReconcile
+	default:
+		panic("unexpected hook stage")
+	}
+
+	for i, hook := range selected {
+		name := hook.Name
+		if name == "" {
+			name = fmt.Sprintf("%s[%d]", stage, i)
+		}
+
+		start := time.Now()
+
+		msg := "Running hook"
+		if env.step != "" {
+			msg = fmt.Sprintf("Step %q", env.step)
+		}
+
+		cb.State(msg, "Running hook "+name, start)
+
+		m.logger.Info("Running hook", "stage", stage, "name", name, "command", hook.Command)
+
+		if err := m.runHook(ctx, hook, env, cb); err != nil {
+			cb.StepLines(nil)
+
+			return fmt.Errorf("%w: %s: %w", ErrHookFailed, name, err)
+		}
+
+		cb.StepLines(nil)
+
+		cb.Completed(fmt.Sprintf("Hook %q", name), time.Since(start))
+	}
+
+	return nil
+}
+
+func (m *Manager) runHook(ctx context.Context, hook config.Hook, env hookEnv, cb Callbacks) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	cmd.Dir = m.configPath(hook.Dir)
+	cmd.Stdin = nil
+
+	cmd.Env = os.Environ()
+
+	for _, v := range environ(env) {
+		cmd.Env = append(cmd.Env, v.Name+"="+v.Value)
+	}
+
+	for k, v := range hook.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	or, ow := io.Pipe()
+	er, ew := io.Pipe()
+
+	cmd.Stdout = ow
+	cmd.Stderr = ew
+
+	eg := &errgroup.Group{}
+
+	var (
+		mu    sync.Mutex
+		lines []string
+	)
+
+	scan := func(r io.Reader, stream string) error {
+		s := bufio.NewScanner(r)
+		s.Buffer(nil, maxHookLineSize)
+
+		for s.Scan() {
+			txt := s.Text()
+
+			if strings.TrimSpace(txt) == "" {
+				continue
+			}
+
+			m.logger.Debug("Hook output", "stream", stream, "line", txt)
+
+			mu.Lock()
+			lines = append(lines, txt)
+
+			if len(lines) > hookOutputLines {
+				lines = slices.Delete(lines, 0, len(lines)-hookOutputLines)
+			}
+
+			cb.StepLines(lines)
+			mu.Unlock()
+		}
+
+		// The rest of the output is drained, so that the hook does not block writing output that is no longer read.
+		_, _ = io.Copy(io.Discard, r)
+
+		if err := s.Err(); err != nil {
+			return fmt.Errorf("failed to read %s: %w", stream, err)
+		}
+
+		return nil
+	}
+
+	eg.Go(func() error {
+		return scan(or, "stdout")
+	})
+
+	eg.Go(func() error {
+		return scan(er, "stderr")
+	})
+
+	runErr := cmd.Run()
+
+	_ = ow.Close()
+	_ = ew.Close()
+
+	scanErr := eg.Wait()
+
+	if runErr != nil {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, line := range lines[max(0, len(lines)-hookErrorLines):] {
+			cb.Error(line)
+		}
+
+		return runErr
+	}
+
+	return scanErr
+}
@@ -0,0 +1,177 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/wait"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/moby/buildkit/client"
+	_ "github.com/moby/buildkit/client/connhelper/dockercontainer"
+)
+
+const (
+	hostBuildKitImage = cluster.BuildKitImage
+	hostBuildKitLabel = "flux.local/buildkitd"
+	// hostBuildKitStartTimeout bounds how long to wait for a newly started buildkitd to accept connections.
+	hostBuildKitStartTimeout = 30 * time.Second
+)
+
+// hostBuildKitName returns the name of the container and state volume used for the cluster.
+func hostBuildKitName(provider cluster.Provider) string {
+	return "localflux-buildkitd-" + provider.ContextName()
+}
+
+// newContainerBuildClient connects to a buildkitd container on the local Docker host, creating or starting it as
+// needed. The container is kept running between builds, with its cache stored in a volume, so that later builds are
+// incremental.
+func newContainerBuildClient(ctx context.Context, logger *slog.Logger, provider cluster.Provider) (*client.Client, error) {
+	docker, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+
+	defer docker.Close()
+
+	name := hostBuildKitName(provider)
+
+	existing, err := docker.ContainerInspect(ctx, name)
+
+	switch {
+	case dockerclient.IsErrNotFound(err):
+		if err := createHostBuildKit(ctx, logger, docker, name); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to inspect buildkit container: %w", err)
+	case existing.Config.Image != hostBuildKitImage:
+		logger.Info("Replacing outdated buildkit container", "name", name, "image", existing.Config.Image)
+
+		if err := docker.ContainerRemove(ctx, name, container.RemoveOptions{Force: true}); err != nil {
+			return nil, fmt.Errorf("failed to remove buildkit container: %w", err)
+		}
+
+		if err := createHostBuildKit(ctx, logger, docker, name); err != nil {
+			return nil, err
+		}
+	case !existing.State.Running:
+		logger.Info("Starting buildkit container", "name", name)
+
+		if err := docker.ContainerStart(ctx, name, container.StartOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to start buildkit container: %w", err)
+		}
+	}
+
+	c, err := client.New(ctx, "docker-container://"+name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to buildkit container: %w", err)
+	}
+
+	// buildkitd takes a moment to listen after the container starts.
+	var probeErr error
+
+	if err := wait.Poll(ctx, wait.Default.WithTimeout(hostBuildKitStartTimeout), func(ctx context.Context) (wait.Status, error) {
+		probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		if _, probeErr = c.ListWorkers(probeCtx); probeErr != nil {
+			return wait.Pending, nil
+		}
+
+		return wait.Done, nil
+	}); err != nil {
+		_ = c.Close()
+
+		if errors.Is(err, wait.ErrTimeout) {
+			return nil, fmt.Errorf("buildkit container did not become ready: %w", probeErr)
+		}
+
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func createHostBuildKit(ctx context.Context, logger *slog.Logger, docker *dockerclient.Client, name string) error {
+	logger.Info("Creating buildkit container", "name", name, "image", hostBuildKitImage)
+
+	pull, err := docker.ImagePull(ctx, hostBuildKitImage, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull buildkit image: %w", err)
+	}
+
+	_, err = io.Copy(io.Discard, pull)
+
+	_ = pull.Close()
+
+	if err != nil {
+		return fmt.Errorf("failed to pull buildkit image: %w", err)
+	}
+
+	if _, err := docker.ContainerCreate(
+		ctx,
+		&container.Config{
+			Image:  hostBuildKitImage,
+			Labels: map[string]string{hostBuildKitLabel: "true"},
+		},
+		&container.HostConfig{
+			Privileged: true,
+			RestartPolicy: container.RestartPolicy{
+				Name: container.RestartPolicyUnlessStopped,
+			},
+			Mounts: []mount.Mount{
+				{
+					Type:   mount.TypeVolume,
+					Source: name,
+					Target: "/var/lib/buildkit",
+				},
+			},
+		},
+		nil,
+		nil,
+		name,
+	); err != nil {
+		return fmt.Errorf("failed to create buildkit container: %w", err)
+	}
+
+	if err := docker.ContainerStart(ctx, name, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to start buildkit container: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveHostBuildKit removes the buildkitd container created for the cluster, alongside its cache. It reports whether
+// a container existed.
+func RemoveHostBuildKit(ctx context.Context, provider cluster.Provider) (bool, error) {
+	docker, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+	if err != nil {
+		return false, fmt.Errorf("failed to create docker client: %w", err)
+	}
+
+	defer docker.Close()
+
+	name := hostBuildKitName(provider)
+
+	removed := true
+
+	if err := docker.ContainerRemove(ctx, name, container.RemoveOptions{Force: true}); dockerclient.IsErrNotFound(err) {
+		removed = false
+	} else if err != nil {
+		return false, fmt.Errorf("failed to remove buildkit container: %w", err)
+	}
+
+	if err := docker.VolumeRemove(ctx, name, true); err != nil && !dockerclient.IsErrNotFound(err) {
+		return removed, fmt.Errorf("failed to remove buildkit volume: %w", err)
+	}
+
+	return removed, nil
+}
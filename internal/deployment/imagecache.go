@@ -0,0 +1,108 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/state"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+var ErrNoPreviousBuild = errors.New("no previous build recorded")
+
+// imageRecord describes the last image pushed for a build, so that later runs can reuse it.
+type imageRecord struct {
+	// Fingerprint is the hash of the build inputs the image was built from.
+	Fingerprint string    `json:"fingerprint"`
+	Digest      string    `json:"digest"`
+	Tag         string    `json:"tag,omitempty"`
+	PushedAt    time.Time `json:"pushedAt"`
+}
+
+// imageCache records the images pushed to a cluster. It is stored in the cache directory of the state store, as it
+// can be recreated by building again.
+type imageCache struct {
+	store *state.Store
+	path  string
+
+	mu     sync.Mutex
+	images map[string]*imageRecord
+}
+
+func openImageCache(ctx context.Context, m *Manager, clusterName string) (*imageCache, error) {
+	store, err := state.Open(ctx, m.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &imageCache{
+		store:  store,
+		path:   filepath.Join(state.DirCache, "images", strings.ReplaceAll(clusterName, "/", "_")+".json"),
+		images: make(map[string]*imageRecord),
+	}
+
+	if err := store.ReadJSON(c.path, &c.images); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *imageCache) get(image string) *imageRecord {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.images[image]
+}
+
+func (c *imageCache) put(image string, record *imageRecord) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.images[image] = record
+
+	return c.store.WriteJSON(c.path, c.images)
+}
+
+// imagePushed reports whether the registry of the cluster still holds the recorded image, which is not the case once
+// the cluster has been recreated.
+func imagePushed(ctx context.Context, provider cluster.Provider, image string, record *imageRecord) (bool, error) {
+	trans, auth, err := provider.RegistryConn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to registry: %w", err)
+	}
+
+	ref, err := name.ParseReference(image+"@"+record.Digest, name.Insecure)
+	if err != nil {
+		return false, fmt.Errorf("invalid image reference: %w", err)
+	}
+
+	if _, err := remote.Head(ref, remote.WithContext(ctx), remote.WithTransport(trans), remote.WithAuth(auth)); err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to check image: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,485 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/tonistiigi/fsutil"
+	"github.com/tonistiigi/units"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+var ErrLintFailed = errors.New("lint found issues")
+
+const (
+	LintRuleLargeContext  = "large-context"
+	LintRuleUnpinnedChart = "unpinned-chart"
+	LintRulePortCollision = "port-collision"
+	LintRuleUnbuiltImage  = "unbuilt-image"
+)
+
+// largeContextThreshold is the total size above which a context without excludePaths is reported.
+const largeContextThreshold = 100 * 1024 * 1024
+
+// heavyContextDirs are directories that rarely belong in a build context.
+var heavyContextDirs = []string{".git", "node_modules", "vendor", "target", "dist", "build", ".venv"}
+
+// wellKnownPorts are local ports commonly held by other services on a developer machine.
+var wellKnownPorts = map[int]string{
+	22:    "ssh",
+	53:    "dns",
+	80:    "http",
+	443:   "https",
+	631:   "cups",
+	3306:  "mysql",
+	5000:  "the macOS AirPlay receiver",
+	5432:  "postgres",
+	6379:  "redis",
+	7000:  "the macOS AirPlay receiver",
+	27017: "mongodb",
+}
+
+// LintFinding is a single issue reported by Lint.
+type LintFinding struct {
+	Rule       string
+	Deployment string
+	Step       string
+	Message    string
+}
+
+// Lint checks the named deployments, or all deployments if none are given, against a set of best-practice rules.
+// Rules named in skip are not run. Findings are advisory and do not prevent a deployment.
+func (m *Manager) Lint(ctx context.Context, names []string, skip []string) ([]LintFinding, error) {
+	var deployments []config.Deployment
+
+	if len(names) == 0 {
+		deployments = m.cfg.Deployments
+	}
+
+	for _, name := range names {
+		deployment, err := m.findDeployment(name)
+		if err != nil {
+			return nil, err
+		}
+
+		deployments = append(deployments, deployment)
+	}
+
+	l := &linter{
+		skip:  skip,
+		ports: make(map[string]string),
+	}
+
+	for _, deployment := range deployments {
+		deployment, err := m.renderTemplates(ctx, deployment, "", m.cfg.DefaultCluster)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := l.lintDeployment(ctx, deployment); err != nil {
+			return nil, fmt.Errorf("failed to lint %q: %w", deployment.Name, err)
+		}
+	}
+
+	return l.findings, nil
+}
+
+type linter struct {
+	skip     []string
+	findings []LintFinding
+	// ports maps each claimed local port to the deployment that forwards it.
+	ports map[string]string
+}
+
+func (l *linter) enabled(rule string) bool {
+	return !slices.Contains(l.skip, rule)
+}
+
+func (l *linter) report(rule string, deployment config.Deployment, step string, msg string) {
+	l.findings = append(l.findings, LintFinding{
+		Rule:       rule,
+		Deployment: deployment.Name,
+		Step:       step,
+		Message:    msg,
+	})
+}
+
+func (l *linter) lintDeployment(ctx context.Context, deployment config.Deployment) error {
+	if l.enabled(LintRuleLargeContext) {
+		for _, image := range deployment.Images {
+			dir := imageContext(image)
+			if isGitContext(dir) {
+				continue
+			}
+
+			if err := l.lintContext(ctx, deployment, "", dir, image.IncludePaths, image.ExcludePaths); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, step := range deployment.Steps {
+		if err := l.lintStep(ctx, deployment, step); err != nil {
+			return fmt.Errorf("step %q: %w", step.Name, err)
+		}
+	}
+
+	if l.enabled(LintRulePortCollision) {
+		l.lintForwards(deployment)
+	}
+
+	return nil
+}
+
+func (l *linter) lintStep(ctx context.Context, deployment config.Deployment, step config.Step) error {
+	switch {
+	case step.Kustomize != nil:
+		if l.enabled(LintRuleLargeContext) {
+			if err := l.lintContext(
+				ctx,
+				deployment,
+				step.Name,
+				step.Kustomize.Context,
+				step.Kustomize.IncludePaths,
+				step.Kustomize.ExcludePaths,
+			); err != nil {
+				return err
+			}
+		}
+
+		if l.enabled(LintRuleUnbuiltImage) {
+			resources, err := renderKustomize(kustomizeDir(step.Kustomize.Context, step.Kustomize.Path))
+			if err != nil {
+				return err
+			}
+
+			nodes := make([]*kyaml.RNode, 0, len(resources))
+
+			for _, res := range resources {
+				nodes = append(nodes, &res.RNode)
+			}
+
+			l.lintImages(deployment, step.Name, nodes)
+		}
+	case step.Manifests != nil:
+		if l.enabled(LintRuleUnbuiltImage) {
+			files, err := expandManifests(step.Manifests)
+			if err != nil {
+				return err
+			}
+
+			var nodes []*kyaml.RNode
+
+			for _, file := range files {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					return fmt.Errorf("failed to read file %q: %w", file, err)
+				}
+
+				fileNodes, err := kio.FromBytes(data)
+				if err != nil {
+					return fmt.Errorf("failed to parse file %q: %w", file, err)
+				}
+
+				nodes = append(nodes, fileNodes...)
+			}
+
+			l.lintImages(deployment, step.Name, nodes)
+		}
+	case step.Helm != nil:
+		if step.Helm.Repo != "" || isOCIChart(step.Helm) {
+			if l.enabled(LintRuleUnpinnedChart) {
+				l.lintChartVersion(deployment, step)
+			}
+
+			return nil
+		}
+
+		if l.enabled(LintRuleLargeContext) {
+			return l.lintContext(
+				ctx,
+				deployment,
+				step.Name,
+				step.Helm.Context,
+				step.Helm.IncludePaths,
+				step.Helm.ExcludePaths,
+			)
+		}
+	}
+
+	return nil
+}
+
+// lintContext reports contexts without excludePaths that are large or contain directories that are rarely needed.
+func (l *linter) lintContext(
+	ctx context.Context,
+	deployment config.Deployment,
+	step string,
+	dir string,
+	include []string,
+	exclude []string,
+) error {
+	if len(exclude) > 0 || dir == "" {
+		return nil
+	}
+
+	var heavy []string
+
+	for _, name := range heavyContextDirs {
+		if matchesAny(name, include) {
+			continue
+		}
+
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.IsDir() {
+			heavy = append(heavy, name)
+		}
+	}
+
+	if len(heavy) > 0 {
+		l.report(LintRuleLargeContext, deployment, step, fmt.Sprintf(
+			"Context %q has no excludePaths but contains %s",
+			dir,
+			strings.Join(heavy, ", "),
+		))
+	}
+
+	cfs, err := fsutil.NewFS(dir)
+	if err != nil {
+		return fmt.Errorf("invalid context %q: %w", dir, err)
+	}
+
+	cfs, err = fsutil.NewFilterFS(cfs, &fsutil.FilterOpt{
+		IncludePatterns: include,
+	})
+	if err != nil {
+		return fmt.Errorf("invalid filter: %w", err)
+	}
+
+	report, err := inspectContext(ctx, cfs)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+
+	for _, size := range report.sizes {
+		total += size
+	}
+
+	if total >= largeContextThreshold {
+		l.report(LintRuleLargeContext, deployment, step, fmt.Sprintf(
+			"Context %q has no excludePaths and is %.2f",
+			dir,
+			units.Bytes(total),
+		))
+	}
+
+	return nil
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.TrimSuffix(strings.TrimPrefix(pattern, "./"), "/") == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lintChartVersion reports repository charts that are not pinned to an exact version.
+func (l *linter) lintChartVersion(deployment config.Deployment, step config.Step) {
+	version := step.Helm.Version
+
+	switch {
+	case version == "":
+		l.report(LintRuleUnpinnedChart, deployment, step.Name, fmt.Sprintf(
+			"Chart %q has no version and will float to the latest release",
+			step.Helm.Chart,
+		))
+	case strings.ContainsAny(version, "*^~<>=|xX ") || strings.Count(version, ".") < 2:
+		l.report(LintRuleUnpinnedChart, deployment, step.Name, fmt.Sprintf(
+			"Chart %q uses the version range %q rather than an exact version",
+			step.Helm.Chart,
+			version,
+		))
+	}
+}
+
+// lintForwards reports local ports that are commonly in use, require elevated privileges or are claimed by more than
+// one forward.
+func (l *linter) lintForwards(deployment config.Deployment) {
+	for _, forward := range directForwards(deployment.PortForward) {
+		localPort := forward.Port
+		if forward.LocalPort != nil {
+			localPort = *forward.LocalPort
+		}
+
+		network := forward.Network
+		if network == "" {
+			network = "tcp"
+		}
+
+		target := fmt.Sprintf("%s/%s %s:%d", forward.Namespace, forward.Kind, forward.Name, forward.Port)
+
+		if service, ok := wellKnownPorts[localPort]; ok {
+			l.report(LintRulePortCollision, deployment, "", fmt.Sprintf(
+				"Forward of %s uses local port %d, which is commonly used by %s",
+				target,
+				localPort,
+				service,
+			))
+		} else if localPort < 1024 {
+			l.report(LintRulePortCollision, deployment, "", fmt.Sprintf(
+				"Forward of %s uses privileged local port %d",
+				target,
+				localPort,
+			))
+		}
+
+		key := network + "/" + strconv.Itoa(localPort)
+
+		if owner, ok := l.ports[key]; ok {
+			l.report(LintRulePortCollision, deployment, "", fmt.Sprintf(
+				"Forward of %s uses local port %d, which is already forwarded by %q",
+				target,
+				localPort,
+				owner,
+			))
+
+			continue
+		}
+
+		l.ports[key] = deployment.Name
+	}
+}
+
+// lintImages reports container images that look like they should be built locally, but are not in the deployment's
+// build list. Images are considered local when they are untagged, point at a local registry or share a registry with
+// a built image.
+func (l *linter) lintImages(deployment config.Deployment, step string, nodes []*kyaml.RNode) {
+	built := make(map[string]bool, len(deployment.Images))
+	registries := make(map[string]bool)
+
+	for _, image := range deployment.Images {
+		built[image.Image] = true
+
+		if host := imageRegistry(image.Image); host != "" {
+			registries[host] = true
+		}
+	}
+
+	var reported []string
+
+	for _, node := range nodes {
+		for _, ref := range containerImages(node.YNode()) {
+			name, pinned := imageName(ref)
+
+			if built[name] || slices.Contains(reported, name) {
+				continue
+			}
+
+			host := imageRegistry(name)
+
+			if pinned && !registries[host] && !isLocalRegistry(host) {
+				continue
+			}
+
+			reported = append(reported, name)
+
+			l.report(LintRuleUnbuiltImage, deployment, step, fmt.Sprintf(
+				"Image %q is referenced by %s %q but is not built by the deployment",
+				ref,
+				node.GetKind(),
+				node.GetName(),
+			))
+		}
+	}
+}
+
+// containerImages returns the image of every container, init container and ephemeral container in the object.
+func containerImages(node *kyaml.Node) []string {
+	var images []string
+
+	switch node.Kind {
+	case kyaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			value := node.Content[i+1]
+
+			if value.Kind == kyaml.SequenceNode &&
+				(key == "containers" || key == "initContainers" || key == "ephemeralContainers") {
+				for _, container := range value.Content {
+					if image := mappingValue(container, "image"); image != "" {
+						images = append(images, image)
+					}
+				}
+
+				continue
+			}
+
+			images = append(images, containerImages(value)...)
+		}
+	case kyaml.SequenceNode, kyaml.DocumentNode:
+		for _, child := range node.Content {
+			images = append(images, containerImages(child)...)
+		}
+	}
+
+	return images
+}
+
+func mappingValue(node *kyaml.Node, key string) string {
+	if node.Kind != kyaml.MappingNode {
+		return ""
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1].Value
+		}
+	}
+
+	return ""
+}
+
+// imageName strips the tag and digest from an image reference, reporting whether either was present.
+func imageName(ref string) (string, bool) {
+	name, _, hasDigest := strings.Cut(ref, "@")
+
+	slash := strings.LastIndex(name, "/")
+
+	if colon := strings.LastIndex(name, ":"); colon > slash {
+		return name[:colon], true
+	}
+
+	return name, hasDigest
+}
+
+// imageRegistry returns the registry host of an image name, or an empty string for images on the default registry.
+func imageRegistry(name string) string {
+	host, _, ok := strings.Cut(name, "/")
+	if !ok {
+		return ""
+	}
+
+	if host == "localhost" || strings.ContainsAny(host, ".:") {
+		return host
+	}
+
+	return ""
+}
+
+func isLocalRegistry(host string) bool {
+	hostname, _, _ := strings.Cut(host, ":")
+
+	return hostname == "localhost" || hostname == "127.0.0.1" || strings.HasSuffix(hostname, ".local")
+}
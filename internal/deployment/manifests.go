@@ -0,0 +1,145 @@
+package deployment
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	"sigs.k8s.io/yaml"
+)
+
+// expandManifests resolves the file globs of a manifests step, in order and without duplicates.
+func expandManifests(manifests *v1alpha2.Manifests) ([]string, error) {
+	var files []string
+
+	seen := make(map[string]bool)
+
+	for _, pattern := range manifests.Files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%w: %q matched no files", ErrInvalid, pattern)
+		}
+
+		for _, match := range matches {
+			if seen[match] {
+				continue
+			}
+
+			seen[match] = true
+			files = append(files, match)
+		}
+	}
+
+	return files, nil
+}
+
+// stageManifests converts manifests steps into kustomize steps by copying their files into a temporary directory
+// alongside a generated kustomization.yaml. Other steps are returned unchanged. The returned cleanup function removes
+// any staged directories.
+func stageManifests(steps []config.Step) ([]config.Step, func(), error) {
+	var dirs []string
+
+	cleanup := func() {
+		for _, dir := range dirs {
+			_ = os.RemoveAll(dir)
+		}
+	}
+
+	staged := make([]config.Step, 0, len(steps))
+
+	for _, step := range steps {
+		if step.Manifests == nil {
+			staged = append(staged, step)
+
+			continue
+		}
+
+		if step.Kustomize != nil || step.Helm != nil || step.Git != nil || step.Compose != nil {
+			cleanup()
+
+			return nil, nil, fmt.Errorf("%w: %q has multiple actions defined", ErrInvalid, step.Name)
+		}
+
+		dir, err := os.MkdirTemp("", "localflux-manifests-")
+		if err != nil {
+			cleanup()
+
+			return nil, nil, fmt.Errorf("failed to create staging directory: %w", err)
+		}
+
+		dirs = append(dirs, dir)
+
+		if err := writeManifests(dir, step.Manifests); err != nil {
+			cleanup()
+
+			return nil, nil, fmt.Errorf("step %q: %w", step.Name, err)
+		}
+
+		converted := step.DeepCopy()
+		converted.Manifests = nil
+		converted.Kustomize = &v1alpha2.Kustomize{
+			Context:    dir,
+			Namespace:  step.Manifests.Namespace,
+			Wait:       step.Manifests.Wait,
+			Substitute: step.Manifests.Substitute,
+			Prune:      step.Manifests.Prune,
+			Force:      step.Manifests.Force,
+		}
+
+		staged = append(staged, converted)
+	}
+
+	return staged, cleanup, nil
+}
+
+func writeManifests(dir string, manifests *v1alpha2.Manifests) error {
+	files, err := expandManifests(manifests)
+	if err != nil {
+		return err
+	}
+
+	resources := make([]string, 0, len(files))
+
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read manifest: %w", err)
+		}
+
+		// Prefix with the index to keep the original order and avoid collisions between equally named files.
+		name := strconv.Itoa(i) + "-" + filepath.Base(file)
+
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return fmt.Errorf("failed to stage manifest: %w", err)
+		}
+
+		resources = append(resources, name)
+	}
+
+	return writeKustomization(dir, resources)
+}
+
+// writeKustomization writes a kustomization.yaml listing the given resources into dir.
+func writeKustomization(dir string, resources []string) error {
+	kustomization, err := yaml.Marshal(map[string]any{
+		"apiVersion": "kustomize.config.k8s.io/v1beta1",
+		"kind":       "Kustomization",
+		"resources":  resources,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode kustomization: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), kustomization, 0o644); err != nil {
+		return fmt.Errorf("failed to write kustomization: %w", err)
+	}
+
+	return nil
+}
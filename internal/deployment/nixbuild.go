@@ -0,0 +1,157 @@
+package deployment
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+
+	"github.com/csnewman/localflux/internal/config"
+)
+
+var (
+	ErrNixpacksNotFound = errors.New("nixpacks CLI not found")
+	ErrNixNotFound      = errors.New("nix CLI not found")
+)
+
+// buildNix builds the image with nixpacks, or from a flake output, and pushes it to the cluster registry.
+func (b *Builder) buildNix(ctx context.Context, cfg config.Image, baseDir string, fn func(res *SolveStatus)) (*Artifact, error) {
+	if len(cfg.IncludePaths) > 0 || len(cfg.ExcludePaths) > 0 {
+		return nil, fmt.Errorf("%w: include and exclude paths are not supported by nix builds", ErrInvalid)
+	}
+
+	buildCtx := cfg.Context
+	if buildCtx == "" {
+		buildCtx = baseDir
+	}
+
+	if cfg.Nix.Flake != "" {
+		return b.buildFlake(ctx, cfg, buildCtx, fn)
+	}
+
+	if _, err := exec.LookPath("nixpacks"); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNixpacksNotFound, err)
+	}
+
+	docker, closeDocker, err := b.localDocker()
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeDocker()
+
+	args := []string{"build", buildCtx, "--name", cfg.Image}
+
+	for _, k := range slices.Sorted(maps.Keys(cfg.Nix.Env)) {
+		args = append(args, "--env", k+"="+cfg.Nix.Env[k])
+	}
+
+	b.logger.Info("Running nixpacks", "args", args)
+
+	cmd := exec.CommandContext(ctx, "nixpacks", args...)
+
+	if err := runVertexCommand(cmd, "nixpacks:"+cfg.Image, "[nixpacks] nixpacks build "+cfg.Image, fn); err != nil {
+		return nil, fmt.Errorf("nixpacks build failed: %w", err)
+	}
+
+	return b.pushFromDocker(ctx, docker, cfg.Image)
+}
+
+// buildFlake builds the flake output and pushes the resulting image archive.
+func (b *Builder) buildFlake(ctx context.Context, cfg config.Image, buildCtx string, fn func(res *SolveStatus)) (*Artifact, error) {
+	if _, err := exec.LookPath("nix"); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNixNotFound, err)
+	}
+
+	tmp, err := os.MkdirTemp("", "localflux-nix-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	link := filepath.Join(tmp, "result")
+
+	args := []string{
+		"build", cfg.Nix.Flake,
+		"--extra-experimental-features", "nix-command flakes",
+		"--out-link", link,
+	}
+
+	b.logger.Info("Running nix", "args", args)
+
+	cmd := exec.CommandContext(ctx, "nix", args...)
+	cmd.Dir = buildCtx
+
+	if err := runVertexCommand(cmd, "nix:"+cfg.Image, "[nix] nix build "+cfg.Nix.Flake, fn); err != nil {
+		return nil, fmt.Errorf("nix build failed: %w", err)
+	}
+
+	archive := filepath.Join(tmp, "image.tar")
+
+	if err := writeImageArchive(ctx, link, archive); err != nil {
+		return nil, err
+	}
+
+	return b.publishTarball(ctx, archive, cfg.Image)
+}
+
+// writeImageArchive converts the output of a flake into an uncompressed docker archive. buildImage and
+// buildLayeredImage produce a gzipped archive, while streamLayeredImage produces a script that writes the archive.
+func writeImageArchive(ctx context.Context, result string, dst string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create image archive: %w", err)
+	}
+
+	defer out.Close()
+
+	in, err := os.Open(result)
+	if err != nil {
+		return fmt.Errorf("failed to open nix result: %w", err)
+	}
+
+	defer in.Close()
+
+	head := make([]byte, 2)
+
+	if _, err := io.ReadFull(in, head); err != nil {
+		return fmt.Errorf("failed to read nix result: %w", err)
+	}
+
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read nix result: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(head, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return fmt.Errorf("failed to decompress nix result: %w", err)
+		}
+
+		if _, err := io.Copy(out, gz); err != nil {
+			return fmt.Errorf("failed to decompress nix result: %w", err)
+		}
+	case bytes.Equal(head, []byte("#!")):
+		cmd := exec.CommandContext(ctx, result)
+		cmd.Stdout = out
+
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to stream nix image: %w", err)
+		}
+	default:
+		if _, err := io.Copy(out, in); err != nil {
+			return fmt.Errorf("failed to copy nix result: %w", err)
+		}
+	}
+
+	return nil
+}
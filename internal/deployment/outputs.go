@@ -0,0 +1,224 @@
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+var ErrUnknownOutput = errors.New("unknown output")
+
+var outputRefRegex = regexp.MustCompile(`\$\{outputs\.([^.}]+)\.([^.}]+)}`)
+
+// Outputs holds values exported by previously executed steps, keyed by "<step>.<name>".
+type Outputs map[string]string
+
+func (o Outputs) expand(value string) (string, error) {
+	var missing error
+
+	expanded := outputRefRegex.ReplaceAllStringFunc(value, func(ref string) string {
+		parts := outputRefRegex.FindStringSubmatch(ref)
+
+		v, ok := o[parts[1]+"."+parts[2]]
+		if !ok {
+			missing = fmt.Errorf("%w: %s.%s", ErrUnknownOutput, parts[1], parts[2])
+
+			return ref
+		}
+
+		return v
+	})
+
+	return expanded, missing
+}
+
+func (o Outputs) expandMap(values map[string]string) (map[string]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	expanded := make(map[string]string, len(values))
+
+	for k, v := range values {
+		e, err := o.expand(v)
+		if err != nil {
+			return nil, err
+		}
+
+		expanded[k] = e
+	}
+
+	return expanded, nil
+}
+
+func (o Outputs) expandValues(value any) (any, error) {
+	return walkValues(value, o.expand)
+}
+
+// walkValues replaces the strings within the helm values, in place.
+func walkValues(value any, fn func(string) (string, error)) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return fn(v)
+	case map[string]any:
+		for k, inner := range v {
+			e, err := walkValues(inner, fn)
+			if err != nil {
+				return nil, err
+			}
+
+			v[k] = e
+		}
+
+		return v, nil
+	case []any:
+		for i, inner := range v {
+			e, err := walkValues(inner, fn)
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = e
+		}
+
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// captureUnselectedOutputs captures the outputs that the selected steps of a partial deployment use from steps that are
+// not selected, from the resources those steps deployed before.
+func (m *Manager) captureUnselectedOutputs(
+	ctx context.Context,
+	kc *cluster.K8sClient,
+	deployment config.Deployment,
+	selected []config.Step,
+	outputs Outputs,
+) error {
+	producers, err := referencedOutputSteps(selected)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range deployment.Steps {
+		if !slices.Contains(producers, step.Name) || slices.ContainsFunc(selected, func(s config.Step) bool {
+			return s.Name == step.Name
+		}) {
+			continue
+		}
+
+		if err := m.captureOutputs(ctx, kc, step, stepNamespace(step), outputs); err != nil {
+			return fmt.Errorf(
+				"%w: the selected steps use the outputs of step %q, which is not selected and must be deployed first: %w",
+				ErrUnknownOutput,
+				step.Name,
+				err,
+			)
+		}
+	}
+
+	return nil
+}
+
+// referencedOutputSteps returns the names of the steps whose outputs the steps reference.
+func referencedOutputSteps(steps []config.Step) ([]string, error) {
+	var names []string
+
+	for _, step := range steps {
+		raw, err := json.Marshal(step)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode step %q: %w", step.Name, err)
+		}
+
+		for _, match := range outputRefRegex.FindAllSubmatch(raw, -1) {
+			if name := string(match[1]); !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+func (m *Manager) captureOutputs(
+	ctx context.Context,
+	kc *cluster.K8sClient,
+	step config.Step,
+	namespace string,
+	outputs Outputs,
+) error {
+	for _, output := range step.Outputs {
+		value, err := captureOutput(ctx, kc, output, namespace)
+		if err != nil {
+			return fmt.Errorf("failed to capture output %q: %w", output.Name, err)
+		}
+
+		m.logger.Debug("Captured output", "step", step.Name, "name", output.Name)
+
+		outputs[step.Name+"."+output.Name] = value
+	}
+
+	return nil
+}
+
+func captureOutput(ctx context.Context, kc *cluster.K8sClient, output config.Output, namespace string) (string, error) {
+	apiVersion := output.APIVersion
+	if apiVersion == "" {
+		apiVersion = "v1"
+	}
+
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return "", fmt.Errorf("invalid api version: %w", err)
+	}
+
+	if output.Namespace != "" {
+		namespace = output.Namespace
+	}
+
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gv.WithKind(output.Kind))
+
+	if err := kc.Controller().Get(ctx, types.NamespacedName{
+		Namespace: namespace,
+		Name:      output.Object,
+	}, u); err != nil {
+		return "", fmt.Errorf("failed to get %s %s/%s: %w", output.Kind, namespace, output.Object, err)
+	}
+
+	jp := jsonpath.New(output.Name)
+
+	if err := jp.Parse(output.JSONPath); err != nil {
+		return "", fmt.Errorf("invalid json path: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := jp.Execute(&buf, u.Object); err != nil {
+		return "", fmt.Errorf("failed to evaluate json path: %w", err)
+	}
+
+	if !output.Base64 {
+		return buf.String(), nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(buf.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to decode value: %w", err)
+	}
+
+	return string(decoded), nil
+}
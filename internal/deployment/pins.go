@@ -0,0 +1,326 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"sigs.k8s.io/yaml"
+)
+
+// PinsFile records the digests base images are pinned to. It is kept next to the config, so that it can be committed
+// alongside it.
+const PinsFile = "localflux.pins.yaml"
+
+// pinsMu serialises access to the pins file, as images may be built in parallel.
+var pinsMu sync.Mutex
+
+type basePins struct {
+	// Pins maps base image references, as written in the Dockerfile, to their digest.
+	Pins map[string]string `json:"pins"`
+}
+
+func loadPins(path string) (*basePins, error) {
+	pins := &basePins{
+		Pins: make(map[string]string),
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return pins, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read pins: %w", err)
+	}
+
+	if err := yaml.Unmarshal(raw, pins); err != nil {
+		return nil, fmt.Errorf("failed to parse pins: %w", err)
+	}
+
+	if pins.Pins == nil {
+		pins.Pins = make(map[string]string)
+	}
+
+	return pins, nil
+}
+
+func (p *basePins) save(path string) error {
+	raw, err := yaml.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pins: %w", err)
+	}
+
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		return fmt.Errorf("failed to write pins: %w", err)
+	}
+
+	return nil
+}
+
+// imageDockerfile returns the Dockerfile of an image built from one.
+func imageDockerfile(image config.Image) string {
+	if image.File != "" {
+		return image.File
+	}
+
+	return filepath.Join(imageContext(image), "Dockerfile")
+}
+
+// baseImages returns the external images the stages of the Dockerfile are based on. Stages based on earlier stages,
+// scratch, references already pinned by digest and references that can not be expanded are skipped.
+func baseImages(path string, buildArgs map[string]string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dockerfile: %w", err)
+	}
+
+	defer f.Close()
+
+	res, err := parser.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dockerfile: %w", err)
+	}
+
+	args := make(map[string]string)
+	stages := make(map[string]bool)
+	seenFrom := false
+
+	var images []string
+
+	for _, node := range res.AST.Children {
+		switch strings.ToLower(node.Value) {
+		case "arg":
+			if seenFrom || node.Next == nil {
+				continue
+			}
+
+			for n := node.Next; n != nil; n = n.Next {
+				k, v, _ := strings.Cut(n.Value, "=")
+				args[k] = strings.Trim(v, `"'`)
+			}
+		case "from":
+			seenFrom = true
+
+			if node.Next == nil {
+				continue
+			}
+
+			ref := os.Expand(node.Next.Value, func(k string) string {
+				if v, ok := buildArgs[k]; ok {
+					return v
+				}
+
+				return args[k]
+			})
+
+			switch {
+			case ref == "" || strings.Contains(ref, "$") || strings.Contains(ref, "@"):
+			case strings.EqualFold(ref, "scratch"), stages[strings.ToLower(ref)]:
+			default:
+				if !slices.Contains(images, ref) {
+					images = append(images, ref)
+				}
+			}
+
+			if as := node.Next.Next; as != nil && strings.EqualFold(as.Value, "as") && as.Next != nil {
+				stages[strings.ToLower(as.Next.Value)] = true
+			}
+		}
+	}
+
+	return images, nil
+}
+
+// namedContextKey returns the name the dockerfile frontend looks up the named context of a base image by.
+func namedContextKey(ref string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid base image %q: %w", ref, err)
+	}
+
+	return strings.TrimSuffix(reference.FamiliarString(named), ":latest"), nil
+}
+
+// resolveDigest looks up the current digest of a remote image.
+func resolveDigest(ctx context.Context, ref string) (string, error) {
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid base image %q: %w", ref, err)
+	}
+
+	desc, err := remote.Head(r, remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %q: %w", ref, err)
+	}
+
+	return desc.Digest.String(), nil
+}
+
+// pinnedContexts returns the frontend attributes that replace the base images of the Dockerfile with their pinned
+// digests. Base images without a pin are resolved and recorded.
+func (b *Builder) pinnedContexts(ctx context.Context, buildFile string, buildArgs map[string]string) (map[string]string, error) {
+	refs, err := baseImages(buildFile, buildArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	pinsMu.Lock()
+	defer pinsMu.Unlock()
+
+	path := b.pinsFile
+	if path == "" {
+		path = PinsFile
+	}
+
+	pins, err := loadPins(path)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make(map[string]string, len(refs))
+	changed := false
+
+	for _, ref := range refs {
+		key, err := namedContextKey(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		digest, ok := pins.Pins[ref]
+		if !ok {
+			digest, err = resolveDigest(ctx, ref)
+			if err != nil {
+				return nil, err
+			}
+
+			b.logger.Info("Pinned base image", "image", ref, "digest", digest)
+
+			pins.Pins[ref] = digest
+			changed = true
+		}
+
+		attrs["context:"+key] = "docker-image://" + ref + "@" + digest
+	}
+
+	if changed {
+		if err := pins.save(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return attrs, nil
+}
+
+// PinUpdate describes a base image whose pin was changed.
+type PinUpdate struct {
+	Image string
+	Old   string
+	New   string
+}
+
+// UpdatePins resolves the base images of the named images, or of all images with pinning enabled, to their current
+// digests and records them.
+func (m *Manager) UpdatePins(ctx context.Context, images []string) ([]PinUpdate, error) {
+	var selected []config.Image
+
+	for _, deployment := range m.cfg.Deployments {
+		for _, image := range deployment.Images {
+			if image.Buildpacks != nil || image.Custom != nil || image.Nix != nil || image.Bazel != nil {
+				continue
+			}
+
+			// The Dockerfile of a git context is only available to buildkit.
+			if isGitContext(image.Context) && image.File == "" {
+				continue
+			}
+
+			if len(images) > 0 && !slices.Contains(images, image.Image) {
+				continue
+			}
+
+			if len(images) == 0 && !image.PinBaseImages {
+				continue
+			}
+
+			selected = append(selected, image)
+		}
+	}
+
+	if len(images) > 0 && len(selected) == 0 {
+		return nil, fmt.Errorf("%w: no dockerfile images match %v", ErrInvalid, images)
+	}
+
+	pinsMu.Lock()
+	defer pinsMu.Unlock()
+
+	path := m.configPath(PinsFile)
+
+	pins, err := loadPins(path)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make(map[string]string)
+
+	for _, image := range selected {
+		buildArgs, err := resolveBuildArgs(ctx, image, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve build args for %q: %w", image.Image, err)
+		}
+
+		refs, err := baseImages(imageDockerfile(image), buildArgs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read base images of %q: %w", image.Image, err)
+		}
+
+		for _, ref := range refs {
+			if _, ok := resolved[ref]; ok {
+				continue
+			}
+
+			digest, err := resolveDigest(ctx, ref)
+			if err != nil {
+				return nil, err
+			}
+
+			resolved[ref] = digest
+		}
+	}
+
+	var updates []PinUpdate
+
+	for _, ref := range slices.Sorted(maps.Keys(resolved)) {
+		if pins.Pins[ref] == resolved[ref] {
+			continue
+		}
+
+		updates = append(updates, PinUpdate{
+			Image: ref,
+			Old:   pins.Pins[ref],
+			New:   resolved[ref],
+		})
+
+		pins.Pins[ref] = resolved[ref]
+	}
+
+	if len(updates) > 0 {
+		if err := pins.save(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return updates, nil
+}
@@ -0,0 +1,173 @@
+package deployment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	"github.com/fluxcd/pkg/chartutil"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+var ErrUnknownProfile = errors.New("unknown profile")
+
+func findProfile(deployment config.Deployment, name string) config.Profile {
+	for _, profile := range deployment.Profiles {
+		if profile.Name == name {
+			return profile
+		}
+	}
+
+	return nil
+}
+
+// selectProfile returns the profile to apply to the deployment, which is the selected profile, or otherwise the default
+// profile of the config if the deployment defines it.
+func (m *Manager) selectProfile(deployment config.Deployment, selected string) string {
+	if selected != "" || m.cfg.Defaults == nil {
+		return selected
+	}
+
+	if findProfile(deployment, m.cfg.Defaults.Profile) == nil {
+		return ""
+	}
+
+	return m.cfg.Defaults.Profile
+}
+
+// applyProfile returns a copy of the deployment with the named profile applied. The original deployment is left
+// unmodified.
+func applyProfile(deployment config.Deployment, name string) (config.Deployment, error) {
+	if name == "" {
+		return deployment, nil
+	}
+
+	profile := findProfile(deployment, name)
+	if profile == nil {
+		return nil, fmt.Errorf("%w: %q is not defined for %q", ErrUnknownProfile, name, deployment.Name)
+	}
+
+	out := deployment.DeepCopy()
+
+	for _, image := range profile.Images {
+		idx := slices.IndexFunc(out.Images, func(existing *v1alpha2.Image) bool {
+			return existing.Image == image.Image
+		})
+
+		if idx == -1 {
+			out.Images = append(out.Images, image.DeepCopy())
+
+			continue
+		}
+
+		out.Images[idx] = image.DeepCopy()
+	}
+
+	for _, override := range profile.Steps {
+		idx := slices.IndexFunc(out.Steps, func(step *v1alpha2.Step) bool {
+			return step.Name == override.Name
+		})
+
+		if idx == -1 {
+			return nil, fmt.Errorf("%w: profile %q references unknown step %q", ErrInvalid, name, override.Name)
+		}
+
+		if err := applyProfileStep(out.Steps[idx], override); err != nil {
+			return nil, fmt.Errorf("profile %q: step %q: %w", name, override.Name, err)
+		}
+	}
+
+	return out, nil
+}
+
+func applyProfileStep(step config.Step, override *v1alpha2.ProfileStep) error {
+	switch {
+	case step.Kustomize != nil:
+		if override.Values != nil || len(override.ValueFiles) > 0 {
+			return fmt.Errorf("%w: values can only be set on helm steps", ErrInvalid)
+		}
+
+		if len(override.Substitute) > 0 && step.Kustomize.Substitute == nil {
+			step.Kustomize.Substitute = make(map[string]string, len(override.Substitute))
+		}
+
+		for k, v := range override.Substitute {
+			step.Kustomize.Substitute[k] = v
+		}
+
+		step.Kustomize.Patches = append(step.Kustomize.Patches, override.Patches...)
+
+	case step.Git != nil:
+		if override.Values != nil || len(override.ValueFiles) > 0 {
+			return fmt.Errorf("%w: values can only be set on helm steps", ErrInvalid)
+		}
+
+		if len(override.Substitute) > 0 && step.Git.Substitute == nil {
+			step.Git.Substitute = make(map[string]string, len(override.Substitute))
+		}
+
+		for k, v := range override.Substitute {
+			step.Git.Substitute[k] = v
+		}
+
+		step.Git.Patches = append(step.Git.Patches, override.Patches...)
+
+	case step.Manifests != nil:
+		if override.Values != nil || len(override.ValueFiles) > 0 || len(override.Patches) > 0 {
+			return fmt.Errorf("%w: only substitutions can be set on manifests steps", ErrInvalid)
+		}
+
+		if len(override.Substitute) > 0 && step.Manifests.Substitute == nil {
+			step.Manifests.Substitute = make(map[string]string, len(override.Substitute))
+		}
+
+		for k, v := range override.Substitute {
+			step.Manifests.Substitute[k] = v
+		}
+
+	case step.Helm != nil:
+		if len(override.Substitute) > 0 {
+			return fmt.Errorf("%w: substitutions can only be set on kustomize steps", ErrInvalid)
+		}
+
+		if override.Values != nil {
+			merged, err := mergeValues(step.Helm.Values, override.Values)
+			if err != nil {
+				return err
+			}
+
+			step.Helm.Values = merged
+		}
+
+		step.Helm.ValueFiles = append(step.Helm.ValueFiles, override.ValueFiles...)
+		step.Helm.Patches = append(step.Helm.Patches, override.Patches...)
+	}
+
+	return nil
+}
+
+func mergeValues(base *apiextensionsv1.JSON, extra *apiextensionsv1.JSON) (*apiextensionsv1.JSON, error) {
+	values := make(map[string]any)
+
+	if base != nil {
+		if err := json.Unmarshal(base.Raw, &values); err != nil {
+			return nil, fmt.Errorf("failed to parse values: %w", err)
+		}
+	}
+
+	var extraValues map[string]any
+
+	if err := json.Unmarshal(extra.Raw, &extraValues); err != nil {
+		return nil, fmt.Errorf("failed to parse profile values: %w", err)
+	}
+
+	encoded, err := json.Marshal(chartutil.MergeMaps(values, extraValues))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode values: %w", err)
+	}
+
+	return &apiextensionsv1.JSON{Raw: encoded}, nil
+}
@@ -0,0 +1,93 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/moby/buildkit/client"
+)
+
+type PruneOptions struct {
+	// All removes all unused cache records, rather than only those buildkit considers safe to remove.
+	All bool
+	// KeepDuration keeps cache records used within the duration.
+	KeepDuration time.Duration
+	// KeepStorage keeps up to the given number of bytes of cache.
+	KeepStorage int64
+	// Filters are buildkit cache filters, such as "type==regular".
+	Filters []string
+}
+
+type PruneResult struct {
+	Records   int
+	Reclaimed int64
+}
+
+// Prune removes cache records from the buildkit instance the builder is connected to.
+func (b *Builder) Prune(ctx context.Context, opts PruneOptions) (*PruneResult, error) {
+	ch := make(chan client.UsageInfo)
+	done := make(chan *PruneResult)
+
+	go func() {
+		res := &PruneResult{}
+
+		for info := range ch {
+			b.logger.Debug("Pruned cache record", "id", info.ID, "size", info.Size)
+
+			res.Records++
+			res.Reclaimed += info.Size
+		}
+
+		done <- res
+	}()
+
+	pruneOpts := []client.PruneOption{
+		client.WithKeepOpt(opts.KeepDuration, opts.KeepStorage, 0, 0),
+	}
+
+	if len(opts.Filters) > 0 {
+		pruneOpts = append(pruneOpts, client.WithFilter(opts.Filters))
+	}
+
+	if opts.All {
+		pruneOpts = append(pruneOpts, client.PruneAll)
+	}
+
+	err := b.c.Prune(ctx, ch, pruneOpts...)
+
+	close(ch)
+
+	res := <-done
+
+	if err != nil {
+		return res, fmt.Errorf("failed to prune build cache: %w", err)
+	}
+
+	return res, nil
+}
+
+// PruneBuildCache connects to the builder of the cluster and prunes its cache.
+func (m *Manager) PruneBuildCache(ctx context.Context, clusterName string, opts PruneOptions) (*PruneResult, error) {
+	if clusterName == "" {
+		clusterName = m.cfg.DefaultCluster
+	}
+
+	provider, err := m.clusters.Provider(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := NewBuilder(ctx, m.logger, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	defer b.c.Close()
+
+	if b.docker != nil {
+		defer b.docker.Close()
+	}
+
+	return b.Prune(ctx, opts)
+}
@@ -2,27 +2,47 @@ package deployment
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/wait"
 	helmv2 "github.com/fluxcd/helm-controller/api/v2"
 	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
 	"github.com/fluxcd/pkg/apis/meta"
 	"github.com/fluxcd/pkg/runtime/patch"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	kstatus "sigs.k8s.io/cli-utils/pkg/kstatus/status"
 )
 
+var ErrReconcileFailed = errors.New("reconcile failed")
+
+const (
+	retryInitialDelay = 2 * time.Second
+	retryMaxDelay     = 30 * time.Second
+)
+
 type Reconcilable interface {
 	client.Object
 	meta.ObjectWithConditions
 	meta.StatusWithHandledReconcileRequest
 
 	AsObject() client.Object
+
+	// RetryAnnotations returns the annotations that request a fresh attempt after a failure.
+	RetryAnnotations(token string) map[string]string
 }
 
 type ReconcileKustomization struct {
@@ -37,6 +57,12 @@ func (r *ReconcileKustomization) GetLastHandledReconcileRequest() string {
 	return r.Status.GetLastHandledReconcileRequest()
 }
 
+func (r *ReconcileKustomization) RetryAnnotations(token string) map[string]string {
+	return map[string]string{
+		meta.ReconcileRequestAnnotation: token,
+	}
+}
+
 type ReconcileHelm struct {
 	helmv2.HelmRelease
 }
@@ -49,6 +75,18 @@ func (r *ReconcileHelm) GetLastHandledReconcileRequest() string {
 	return r.Status.GetLastHandledReconcileRequest()
 }
 
+// RetryAnnotations also resets the failure counts, as the release would otherwise not be retried once its
+// remediation attempts are exhausted.
+func (r *ReconcileHelm) RetryAnnotations(token string) map[string]string {
+	return map[string]string{
+		meta.ReconcileRequestAnnotation: token,
+		helmv2.ResetRequestAnnotation:   token,
+	}
+}
+
+// Reconcile waits until the object has handled the reconcile request tgt and is healthy. A failed attempt is retried
+// up to retries times with backoff, each time with a fresh request, before ErrReconcileFailed is returned. The limit
+// applies to each attempt.
 func Reconcile[T Reconcilable](
 	ctx context.Context,
 	kc *cluster.K8sClient,
@@ -56,57 +94,219 @@ func Reconcile[T Reconcilable](
 	name string,
 	tgt string,
 	limit time.Duration,
+	retries int,
 	obj T,
+	checks []meta.NamespacedObjectKindReference,
 	cb func(string),
-) error {
+) (err error) {
+	ctx, span := tracer.Start(ctx, "reconcile "+name, trace.WithAttributes(
+		attribute.String("localflux.namespace", ns),
+	))
+
+	defer func() {
+		endSpan(span, err)
+	}()
+
 	namespacedName := types.NamespacedName{
 		Namespace: ns,
 		Name:      name,
 	}
 
 	controller := kc.Controller()
-	first := true
-	timeout := time.After(limit)
-
-	for {
-		if !first {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(time.Millisecond * 100):
-
-			case <-timeout:
-				return fmt.Errorf("timed out waiting for reconciliation")
+	lastState := ""
+
+	var (
+		attempt int
+		retryAt time.Time
+	)
+
+	timeout := time.Duration(retries+1)*limit + time.Duration(retries)*retryMaxDelay
+
+	err = wait.Poll(ctx, wait.Default.WithTimeout(timeout), func(ctx context.Context) (wait.Status, error) {
+		if !retryAt.IsZero() {
+			if time.Now().Before(retryAt) {
+				return wait.Pending, nil
 			}
-		}
 
-		first = false
+			retryAt = time.Time{}
+			tgt = uuid.New().String()
+
+			if err := requestRetry(ctx, kc, obj, tgt); err != nil {
+				return wait.Pending, err
+			}
+
+			return wait.Progressing, nil
+		}
 
 		if err := controller.Get(ctx, namespacedName, obj.AsObject()); err != nil {
-			return err
+			return wait.Pending, err
+		}
+
+		state, done, err := reconcileState(ctx, kc, obj, tgt, checks)
+		if err != nil {
+			return wait.Pending, err
+		}
+
+		if done {
+			return wait.Done, nil
+		}
+
+		if attemptFailed(obj, tgt) {
+			if attempt >= retries {
+				return wait.Pending, fmt.Errorf("%w: %s", ErrReconcileFailed, state)
+			}
+
+			delay := min(retryInitialDelay<<attempt, retryMaxDelay)
+			attempt++
+			retryAt = time.Now().Add(delay)
+
+			span.AddEvent("retry", trace.WithAttributes(
+				attribute.Int("localflux.attempt", attempt),
+				attribute.String("localflux.state", state),
+			))
+
+			cb(fmt.Sprintf("Retrying (%d/%d) in %s after %s", attempt, retries, delay, state))
+
+			return wait.Progressing, nil
 		}
 
-		readyCond := apimeta.FindStatusCondition(obj.GetConditions(), meta.ReadyCondition)
+		cb(state)
 
-		if readyCond == nil || obj.GetLastHandledReconcileRequest() != tgt {
-			cb("Awaiting attempt")
+		if state != lastState {
+			lastState = state
 
-			continue
+			return wait.Progressing, nil
 		}
 
-		cb(fmt.Sprintf("%s: %s", readyCond.Reason, readyCond.Message))
+		return wait.Pending, nil
+	})
+	if errors.Is(err, wait.ErrTimeout) {
+		return fmt.Errorf("timed out waiting for reconciliation")
+	}
+
+	return err
+}
+
+// attemptFailed reports whether the object has finished handling the reconcile request tgt without becoming ready.
+// Waiting on a dependency is not considered a failure, as Flux retries it without intervention.
+func attemptFailed[T Reconcilable](obj T, tgt string) bool {
+	if obj.GetLastHandledReconcileRequest() != tgt {
+		return false
+	}
+
+	if apimeta.IsStatusConditionTrue(obj.GetConditions(), meta.StalledCondition) {
+		return true
+	}
+
+	readyCond := apimeta.FindStatusCondition(obj.GetConditions(), meta.ReadyCondition)
+
+	return readyCond != nil &&
+		readyCond.Status == metav1.ConditionFalse &&
+		readyCond.Reason != meta.DependencyNotReadyReason &&
+		!apimeta.IsStatusConditionTrue(obj.GetConditions(), meta.ReconcilingCondition)
+}
 
-		result, err := kstatusCompute(obj.AsObject())
+// requestRetry annotates the object to request a new attempt identified by tgt.
+func requestRetry[T Reconcilable](ctx context.Context, kc *cluster.K8sClient, obj T, tgt string) error {
+	data, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": obj.RetryAnnotations(tgt),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := kc.Controller().Patch(ctx, obj.AsObject(), client.RawPatch(types.MergePatchType, data)); err != nil {
+		return fmt.Errorf("failed to request retry: %w", err)
+	}
+
+	return nil
+}
+
+// reconcileState describes the progress of the reconciliation, reporting whether it has completed and all health
+// checks have passed.
+func reconcileState[T Reconcilable](
+	ctx context.Context,
+	kc *cluster.K8sClient,
+	obj T,
+	tgt string,
+	checks []meta.NamespacedObjectKindReference,
+) (string, bool, error) {
+	readyCond := apimeta.FindStatusCondition(obj.GetConditions(), meta.ReadyCondition)
+
+	if readyCond == nil || obj.GetLastHandledReconcileRequest() != tgt {
+		return "Awaiting attempt", false, nil
+	}
+
+	state := fmt.Sprintf("%s: %s", readyCond.Reason, readyCond.Message)
+
+	result, err := kstatusCompute(obj.AsObject())
+	if err != nil {
+		return "", false, fmt.Errorf("failed to compute status: %w", err)
+	}
+
+	if result.Status != kstatus.CurrentStatus {
+		return state, false, nil
+	}
+
+	pending, err := pendingHealthChecks(ctx, kc, checks)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to check health: %w", err)
+	}
+
+	if pending == "" {
+		return state, true, nil
+	}
+
+	return "Waiting for " + pending, false, nil
+}
+
+// pendingHealthChecks returns a description of the first health check that is not yet current, or an empty string if
+// all checks have passed.
+func pendingHealthChecks(ctx context.Context, kc *cluster.K8sClient, checks []meta.NamespacedObjectKindReference) (string, error) {
+	for _, check := range checks {
+		gv, err := schema.ParseGroupVersion(check.APIVersion)
+		if err != nil {
+			return "", fmt.Errorf("invalid api version %q: %w", check.APIVersion, err)
+		}
+
+		gvk := gv.WithKind(check.Kind)
+
+		if gvk.Version == "" {
+			mapping, err := kc.Mapper().RESTMapping(gvk.GroupKind())
+			if err != nil {
+				return "", fmt.Errorf("failed to resolve %s: %w", check.Kind, err)
+			}
+
+			gvk = mapping.GroupVersionKind
+		}
+
+		desc := fmt.Sprintf("%s %s/%s", check.Kind, check.Namespace, check.Name)
+
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+
+		if err := kc.Controller().Get(ctx, types.NamespacedName{
+			Namespace: check.Namespace,
+			Name:      check.Name,
+		}, u); apierrors.IsNotFound(err) {
+			return desc + ": not found", nil
+		} else if err != nil {
+			return "", err
+		}
+
+		result, err := kstatus.Compute(u)
 		if err != nil {
-			return fmt.Errorf("failed to compute status: %w", err)
+			return "", fmt.Errorf("failed to compute status of %s: %w", desc, err)
 		}
 
-		if result.Status == kstatus.CurrentStatus {
-			break
+		if result.Status != kstatus.CurrentStatus {
+			return fmt.Sprintf("%s: %s", desc, result.Message), nil
 		}
 	}
 
-	return nil
+	return "", nil
 }
 
 // kstatusCompute returns the kstatus computed result of a given object.
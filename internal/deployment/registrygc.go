@@ -0,0 +1,420 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	sourcev1b2 "github.com/fluxcd/source-controller/api/v1beta2"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// keepTagPrefix prefixes the tags given to referenced manifests that have no tag, as the registry garbage collector
+// removes untagged manifests.
+const keepTagPrefix = "localflux-keep-"
+
+// StaleManifest is a manifest in the cluster registry that nothing references.
+type StaleManifest struct {
+	Repository string
+	Digest     string
+	Tags       []string
+}
+
+// RegistryGCPlan describes the changes a registry garbage collection makes.
+type RegistryGCPlan struct {
+	// Stale are the tagged manifests to delete.
+	Stale []StaleManifest
+	// Protect are referenced manifests without a tag, which are tagged so that they survive the collection.
+	Protect []name.Digest
+
+	reg   name.Registry
+	trans remote.Option
+	auth  remote.Option
+}
+
+// PlanRegistryGC lists the manifests of the cluster registry and determines which are not referenced by any workload
+// in the cluster, any Flux source created by localflux, or the images last built for the cluster.
+func (m *Manager) PlanRegistryGC(ctx context.Context, clusterName string) (*RegistryGCPlan, error) {
+	if clusterName == "" {
+		clusterName = m.cfg.DefaultCluster
+	}
+
+	provider, err := m.clusters.Provider(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	kc, err := provider.K8sClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create k8s client: %w", err)
+	}
+
+	trans, auth, err := provider.RegistryConn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to registry: %w", err)
+	}
+
+	reg, err := name.NewRegistry(provider.Registry(), name.Insecure)
+	if err != nil {
+		return nil, fmt.Errorf("invalid registry: %w", err)
+	}
+
+	plan := &RegistryGCPlan{
+		reg:   reg,
+		trans: remote.WithTransport(trans),
+		auth:  remote.WithAuth(auth),
+	}
+
+	opts := []remote.Option{remote.WithContext(ctx), plan.trans, plan.auth}
+
+	refs, err := m.registryReferences(ctx, kc, clusterName, provider.Registry())
+	if err != nil {
+		return nil, err
+	}
+
+	repos, err := remote.Catalog(ctx, reg, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories: %w", err)
+	}
+
+	for _, repoName := range repos {
+		repo := reg.Repo(repoName)
+
+		tags, err := remote.List(repo, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %q: %w", repoName, err)
+		}
+
+		tagged := make(map[string][]string)
+
+		for _, tag := range tags {
+			desc, err := remote.Head(repo.Tag(tag), opts...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s:%s: %w", repoName, tag, err)
+			}
+
+			digest := desc.Digest.String()
+			tagged[digest] = append(tagged[digest], tag)
+
+			if slices.Contains(refs.get(repoName).tags, tag) {
+				refs.add(repoName, digest)
+			}
+		}
+
+		keep, err := referencedManifests(repo, refs.get(repoName).digests, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		// Signatures and attestations are found through the tag derived from the digest they belong to, rather than
+		// referenced, so are kept along with it.
+		for digest, digestTags := range tagged {
+			for _, tag := range digestTags {
+				if subject, ok := signatureSubject(tag); ok && keep[subject] {
+					keep[digest] = true
+				}
+			}
+		}
+
+		for _, digest := range slices.Sorted(maps.Keys(tagged)) {
+			if keep[digest] {
+				continue
+			}
+
+			plan.Stale = append(plan.Stale, StaleManifest{
+				Repository: repoName,
+				Digest:     digest,
+				Tags:       tagged[digest],
+			})
+		}
+
+		for _, digest := range slices.Sorted(maps.Keys(keep)) {
+			if len(tagged[digest]) > 0 {
+				continue
+			}
+
+			plan.Protect = append(plan.Protect, repo.Digest(digest))
+		}
+	}
+
+	return plan, nil
+}
+
+// RunRegistryGC deletes the stale manifests of the plan and runs the registry garbage collector, which removes the
+// untagged manifests and unreferenced blobs.
+func (m *Manager) RunRegistryGC(ctx context.Context, clusterName string, plan *RegistryGCPlan, out io.Writer) error {
+	opts := []remote.Option{remote.WithContext(ctx), plan.trans, plan.auth}
+
+	for _, ref := range plan.Protect {
+		desc, err := remote.Get(ref, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", ref, err)
+		}
+
+		tag := ref.Context().Tag(keepTagPrefix + strings.TrimPrefix(ref.DigestStr(), "sha256:")[:12])
+
+		m.logger.Info("Protecting untagged manifest", "ref", ref, "tag", tag)
+
+		if err := remote.Tag(tag, desc, opts...); err != nil {
+			return fmt.Errorf("failed to tag %s: %w", ref, err)
+		}
+	}
+
+	for _, stale := range plan.Stale {
+		ref := plan.reg.Repo(stale.Repository).Digest(stale.Digest)
+
+		m.logger.Info("Deleting manifest", "ref", ref)
+
+		if err := remote.Delete(ref, opts...); err != nil {
+			return fmt.Errorf("failed to delete %s, deletion may be disabled on the registry: %w", ref, err)
+		}
+	}
+
+	return m.clusters.PruneRegistry(ctx, clusterName, true, out)
+}
+
+// referencedManifests expands the referenced digests of a repository with the manifests of any referenced indexes,
+// as the children of an index carry no tag of their own.
+func referencedManifests(repo name.Repository, digests []string, opts []remote.Option) (map[string]bool, error) {
+	keep := make(map[string]bool)
+
+	for _, digest := range digests {
+		if keep[digest] {
+			continue
+		}
+
+		keep[digest] = true
+
+		desc, err := remote.Get(repo.Digest(digest), opts...)
+		if err != nil {
+			// The manifest may have been removed already, in which case there is nothing to keep.
+			continue
+		}
+
+		if !desc.MediaType.IsIndex() {
+			continue
+		}
+
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index %s: %w", digest, err)
+		}
+
+		manifest, err := idx.IndexManifest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index %s: %w", digest, err)
+		}
+
+		for _, child := range manifest.Manifests {
+			keep[child.Digest.String()] = true
+		}
+	}
+
+	return keep, nil
+}
+
+// signatureSubject returns the digest of the manifest a cosign signature or attestation tag, such as
+// "sha256-<hex>.sig", belongs to.
+func signatureSubject(tag string) (string, bool) {
+	for _, suffix := range []string{".sig", ".att"} {
+		if hex, ok := strings.CutSuffix(tag, suffix); ok {
+			if hex, ok := strings.CutPrefix(hex, "sha256-"); ok {
+				return "sha256:" + hex, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+type repoReferences struct {
+	digests []string
+	tags    []string
+}
+
+type registryRefs map[string]*repoReferences
+
+func (r registryRefs) get(repo string) *repoReferences {
+	if r[repo] == nil {
+		r[repo] = &repoReferences{}
+	}
+
+	return r[repo]
+}
+
+func (r registryRefs) add(repo string, digest string) {
+	refs := r.get(repo)
+
+	if !slices.Contains(refs.digests, digest) {
+		refs.digests = append(refs.digests, digest)
+	}
+}
+
+// addRef records an image reference if it points at the cluster registry.
+func (r registryRefs) addRef(registry string, ref string) {
+	ref = strings.TrimPrefix(ref, "docker-pullable://")
+	ref = strings.TrimPrefix(ref, "oci://")
+
+	rest, ok := strings.CutPrefix(ref, registry+"/")
+	if !ok {
+		return
+	}
+
+	if repo, digest, ok := strings.Cut(rest, "@"); ok {
+		repo, _ = splitImageTag(repo)
+		r.add(repo, digest)
+
+		return
+	}
+
+	repo, tag := splitImageTag(rest)
+	refs := r.get(repo)
+
+	if !slices.Contains(refs.tags, tag) {
+		refs.tags = append(refs.tags, tag)
+	}
+}
+
+// registryReferences collects the references to the cluster registry by workloads, Flux sources in the localflux
+// namespace and the image cache, keyed by repository.
+func (m *Manager) registryReferences(
+	ctx context.Context,
+	kc *cluster.K8sClient,
+	clusterName string,
+	registry string,
+) (registryRefs, error) {
+	refs := make(registryRefs)
+
+	addSpec := func(spec corev1.PodSpec) {
+		for _, c := range spec.InitContainers {
+			refs.addRef(registry, c.Image)
+		}
+
+		for _, c := range spec.Containers {
+			refs.addRef(registry, c.Image)
+		}
+	}
+
+	cs := kc.ClientSet()
+
+	pods, err := cs.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	for _, pod := range pods.Items {
+		addSpec(pod.Spec)
+
+		for _, s := range slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses) {
+			refs.addRef(registry, s.ImageID)
+		}
+	}
+
+	deployments, err := cs.AppsV1().Deployments("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+
+	for _, d := range deployments.Items {
+		addSpec(d.Spec.Template.Spec)
+	}
+
+	// Replica sets hold the rollout history of deployments, which may be rolled back to.
+	replicaSets, err := cs.AppsV1().ReplicaSets("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicasets: %w", err)
+	}
+
+	for _, r := range replicaSets.Items {
+		addSpec(r.Spec.Template.Spec)
+	}
+
+	statefulSets, err := cs.AppsV1().StatefulSets("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+
+	for _, s := range statefulSets.Items {
+		addSpec(s.Spec.Template.Spec)
+	}
+
+	daemonSets, err := cs.AppsV1().DaemonSets("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+
+	for _, d := range daemonSets.Items {
+		addSpec(d.Spec.Template.Spec)
+	}
+
+	cronJobs, err := cs.BatchV1().CronJobs("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cronjobs: %w", err)
+	}
+
+	for _, c := range cronJobs.Items {
+		addSpec(c.Spec.JobTemplate.Spec.Template.Spec)
+	}
+
+	jobs, err := cs.BatchV1().Jobs("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	for _, j := range jobs.Items {
+		addSpec(j.Spec.Template.Spec)
+	}
+
+	var sources sourcev1b2.OCIRepositoryList
+
+	if err := kc.Controller().List(ctx, &sources, client.InNamespace(cluster.LFNamespace)); err != nil {
+		return nil, fmt.Errorf("failed to list oci repositories: %w", err)
+	}
+
+	for _, src := range sources.Items {
+		ref := src.Spec.URL
+
+		if r := src.Spec.Reference; r != nil && r.Digest != "" {
+			refs.addRef(registry, ref+"@"+r.Digest)
+		} else if r != nil && r.Tag != "" {
+			refs.addRef(registry, ref+":"+r.Tag)
+		} else {
+			refs.addRef(registry, ref)
+		}
+
+		if a := src.Status.Artifact; a != nil {
+			if _, digest, ok := strings.Cut(a.Revision, "@"); ok {
+				refs.addRef(registry, ref+"@"+digest)
+			}
+		}
+	}
+
+	images, err := openImageCache(ctx, m, clusterName)
+	if err != nil {
+		m.logger.Warn("Failed to open image cache", "err", err)
+	}
+
+	if images != nil {
+		images.mu.Lock()
+
+		for image, record := range images.images {
+			refs.addRef(registry, image+"@"+record.Digest)
+
+			if record.Tag != "" {
+				refs.addRef(registry, image+":"+record.Tag)
+			}
+		}
+
+		images.mu.Unlock()
+	}
+
+	return refs, nil
+}
@@ -0,0 +1,82 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+	"github.com/csnewman/localflux/internal/wait"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Remove deletes the objects localflux created for a deployment. Objects are deleted in gcKinds order and each
+// deletion is awaited, so that Flux prunes the workloads a kustomization or release manages before its source goes.
+// Directly applied steps are left in place.
+func (m *Manager) Remove(ctx context.Context, clusterName string, name string, cb Callbacks) error {
+	deployment, err := m.findDeployment(name)
+	if err != nil {
+		return err
+	}
+
+	kc, err := m.k8sClient(ctx, clusterName)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+
+	names := map[string][]string{
+		v1alpha1.DeploymentKind: {fixName(deployment.Name)},
+	}
+
+	for _, step := range deployment.Steps {
+		remoteName := fixName(deployment.Name) + "-" + fixName(step.Name)
+
+		for _, kind := range stepKinds(step) {
+			names[kind] = append(names[kind], remoteName)
+		}
+
+		names["Secret"] = append(names["Secret"], remoteName+"-secrets")
+	}
+
+	for _, gvk := range gcKinds {
+		for _, objName := range names[gvk.Kind] {
+			cb.State(fmt.Sprintf("Removing %q", deployment.Name), gvk.Kind+" "+objName, start)
+
+			obj := &unstructured.Unstructured{}
+			obj.SetGroupVersionKind(gvk)
+			obj.SetNamespace(cluster.LFNamespace)
+			obj.SetName(objName)
+
+			m.logger.Info("Deleting", "kind", gvk.Kind, "name", objName)
+
+			if err := kc.Controller().Delete(ctx, obj); err != nil {
+				if apierrors.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+					continue
+				}
+
+				return fmt.Errorf("failed to delete %s %q: %w", gvk.Kind, objName, err)
+			}
+
+			if err := wait.Poll(ctx, wait.Default.WithTimeout(2*time.Minute), func(ctx context.Context) (wait.Status, error) {
+				err := kc.Controller().Get(ctx, client.ObjectKeyFromObject(obj), obj.DeepCopy())
+				if apierrors.IsNotFound(err) {
+					return wait.Done, nil
+				}
+
+				return wait.Pending, err
+			}); err != nil {
+				return fmt.Errorf("failed waiting for %s %q to be deleted: %w", gvk.Kind, objName, err)
+			}
+		}
+	}
+
+	cb.Completed(fmt.Sprintf("Removed %q", deployment.Name), time.Since(start))
+
+	return nil
+}
@@ -0,0 +1,723 @@
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/fluxcd/pkg/apis/kustomize"
+	"github.com/tonistiigi/fsutil"
+	fstypes "github.com/tonistiigi/fsutil/types"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/release"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	kustypes "sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/yaml"
+)
+
+// substituteAnnotation disables post-build substitution for a single resource, matching the flux annotation.
+const substituteAnnotation = "kustomize.toolkit.fluxcd.io/substitute"
+
+var substituteRegex = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)(?::?([-=])([^}]*))?}`)
+
+// RenderOptions customises a render.
+type RenderOptions struct {
+	// Steps limits the render to the named steps.
+	Steps []string
+	// Profile selects a named profile defined on the deployment.
+	Profile string
+	// Build builds the images on the cluster so that the rendered manifests reference the resulting digests. Otherwise,
+	// image references are left as written and no cluster is required.
+	Build bool
+	// Cluster is the cluster to build on. Only used when Build is set.
+	Cluster string
+}
+
+// Render renders the deployment's steps locally, applying the same substitutions, patches and image replacements as
+// a deployment would, and writes one file per step into dir. Hooks are not run and outputs are not resolved. The paths
+// of the written files are returned.
+func (m *Manager) Render(ctx context.Context, name string, dir string, opts RenderOptions, cb Callbacks) ([]string, error) {
+	deployment, err := m.findDeployment(name)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := m.selectProfile(deployment, opts.Profile)
+
+	deployment, err = applyProfile(deployment, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	deployment, err = m.renderTemplates(ctx, deployment, profile, opts.Cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	deployment, err = m.applyCompose(deployment, opts.Cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	steps, images, err := selectSteps(deployment, opts.Steps)
+	if err != nil {
+		return nil, err
+	}
+
+	steps, cleanup, err := stageManifests(steps)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cleanup()
+
+	steps, cleanupCompose, err := stageCompose(steps, cb)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cleanupCompose()
+
+	steps, cleanupGenerated, err := stageGenerators(ctx, steps)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cleanupGenerated()
+
+	var replacementImages []kustomize.Image
+
+	if opts.Build && len(images) > 0 {
+		clusterName := opts.Cluster
+		if clusterName == "" {
+			clusterName = m.cfg.DefaultCluster
+		}
+
+		t, err := m.connect(ctx, clusterName, cb)
+		if err != nil {
+			return nil, err
+		}
+
+		replacementImages, err = m.buildImages(ctx, t, images, false, nil, cb)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build images: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	var files []string
+
+	for _, step := range steps {
+		start := time.Now()
+
+		cb.State("Rendering", step.Name, start)
+
+		var rendered []byte
+
+		switch {
+		case step.Kustomize != nil:
+			rendered, err = m.renderKustomizeStep(ctx, step, replacementImages, nil, cb)
+		case step.Helm != nil:
+			rendered, err = m.renderHelmStep(ctx, step, replacementImages, nil, cb)
+		case step.Git != nil:
+			rendered, err = m.renderGitStep(ctx, step, replacementImages, nil, cb)
+		default:
+			err = fmt.Errorf("%w: no action defined", ErrInvalid)
+		}
+
+		if err != nil {
+			return files, fmt.Errorf("step %q failed: %w", step.Name, err)
+		}
+
+		path := filepath.Join(dir, fixName(step.Name)+".yaml")
+
+		if err := os.WriteFile(path, rendered, 0o644); err != nil {
+			return files, fmt.Errorf("failed to write %q: %w", path, err)
+		}
+
+		files = append(files, path)
+
+		cb.Completed(fmt.Sprintf("Rendered step %q", step.Name), time.Since(start))
+	}
+
+	return files, nil
+}
+
+// renderGitStep clones the step's repository locally and renders it as a kustomize step. Unlike a deployment, the
+// repository is fetched using the local git client and credentials.
+func (m *Manager) renderGitStep(
+	ctx context.Context,
+	step config.Step,
+	replacementImages []kustomize.Image,
+	outputs Outputs,
+	cb Callbacks,
+) ([]byte, error) {
+	tmp, err := os.MkdirTemp("", "localflux-git-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clone directory: %w", err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	cb.State("Rendering", step.Name+": cloning "+step.Git.URL, time.Now())
+
+	if err := cloneGit(ctx, step.Git, tmp); err != nil {
+		return nil, fmt.Errorf("failed to clone %q: %w", step.Git.URL, err)
+	}
+
+	return m.renderKustomizeStep(ctx, gitKustomizeStep(step, tmp), replacementImages, outputs, cb)
+}
+
+// renderKustomizeStep renders a kustomize step. Output references are resolved using outputs, or left unresolved if
+// outputs is nil.
+func (m *Manager) renderKustomizeStep(
+	ctx context.Context,
+	step config.Step,
+	replacementImages []kustomize.Image,
+	outputs Outputs,
+	cb Callbacks,
+) ([]byte, error) {
+	substitute := step.Kustomize.Substitute
+
+	// Secrets are only resolved when the result is applied, and are masked otherwise.
+	if outputs != nil {
+		expanded, err := outputs.expandMap(substitute)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand substitutions: %w", err)
+		}
+
+		substitute, err = m.newSecretResolver().expandMap(expanded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve secrets: %w", err)
+		}
+	} else {
+		if hasOutputRefs(substitute) {
+			cb.Warn(fmt.Sprintf("Step %q references outputs, which are left unresolved when rendering", step.Name))
+		}
+
+		masked := make(map[string]string, len(substitute))
+
+		for k, v := range substitute {
+			masked[k] = maskSecretRefs(v)
+		}
+
+		substitute = masked
+	}
+
+	tmp, err := os.MkdirTemp("", "localflux-render-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create render directory: %w", err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	// Copy the filtered context, as the same files are pushed to the cluster.
+	if err := copyContext(
+		ctx,
+		step.Kustomize.Context,
+		step.Kustomize.IncludePaths,
+		step.Kustomize.ExcludePaths,
+		tmp,
+	); err != nil {
+		return nil, err
+	}
+
+	patches := slices.Clone(step.Kustomize.Patches)
+
+	if step.Kustomize.RestartOnConfigChange {
+		hashPatches, err := configHashPatches(
+			kustomizeDir(step.Kustomize.Context, step.Kustomize.Path),
+			substitute,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute config hashes: %w", err)
+		}
+
+		patches = append(patches, hashPatches...)
+	}
+
+	fSys := filesys.MakeFsOnDisk()
+	path := kustomizeDir(tmp, step.Kustomize.Path)
+
+	if err := overlayKustomization(
+		fSys,
+		path,
+		step.Kustomize.Namespace,
+		step.Kustomize.Components,
+		patches,
+		replacementImages,
+	); err != nil {
+		return nil, err
+	}
+
+	return buildKustomization(fSys, path, substitute)
+}
+
+func hasOutputRefs(values map[string]string) bool {
+	for _, v := range values {
+		if outputRefRegex.MatchString(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copyContext copies the filtered build context into dst.
+func copyContext(ctx context.Context, src string, include []string, exclude []string, dst string) error {
+	cfs, err := fsutil.NewFS(src)
+	if err != nil {
+		return fmt.Errorf("invalid context: %w", err)
+	}
+
+	cfs, err = fsutil.NewFilterFS(cfs, &fsutil.FilterOpt{
+		IncludePatterns: include,
+		ExcludePatterns: exclude,
+	})
+	if err != nil {
+		return fmt.Errorf("invalid filter: %w", err)
+	}
+
+	err = cfs.Walk(ctx, "", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, filepath.FromSlash(path))
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0o755)
+		case d.Type()&fs.ModeSymlink != 0:
+			stat, ok := info.Sys().(*fstypes.Stat)
+			if !ok {
+				return nil
+			}
+
+			return os.Symlink(stat.Linkname, target)
+		case !d.Type().IsRegular():
+			return nil
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+
+		r, err := cfs.Open(path)
+		if err != nil {
+			return err
+		}
+
+		defer r.Close()
+
+		w, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(w, r); err != nil {
+			_ = w.Close()
+
+			return err
+		}
+
+		return w.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy context: %w", err)
+	}
+
+	return nil
+}
+
+// overlayKustomization adds the namespace, components, patches and images to the kustomization in dir, mirroring how
+// the kustomize-controller modifies it before building.
+func overlayKustomization(
+	fSys filesys.FileSystem,
+	dir string,
+	namespace string,
+	components []string,
+	patches []kustomize.Patch,
+	images []kustomize.Image,
+) error {
+	return editKustomization(fSys, dir, func(k *kustypes.Kustomization) error {
+		if namespace != "" {
+			k.Namespace = namespace
+		}
+
+		k.Components = append(k.Components, components...)
+
+		for _, patch := range patches {
+			kp := kustypes.Patch{
+				Patch: patch.Patch,
+			}
+
+			if patch.Target != nil {
+				kp.Target = &kustypes.Selector{
+					ResId: resid.ResId{
+						Gvk: resid.Gvk{
+							Group:   patch.Target.Group,
+							Version: patch.Target.Version,
+							Kind:    patch.Target.Kind,
+						},
+						Name:      patch.Target.Name,
+						Namespace: patch.Target.Namespace,
+					},
+					AnnotationSelector: patch.Target.AnnotationSelector,
+					LabelSelector:      patch.Target.LabelSelector,
+				}
+			}
+
+			k.Patches = append(k.Patches, kp)
+		}
+
+		for _, image := range images {
+			k.Images = append(k.Images, kustypes.Image{
+				Name:    image.Name,
+				NewName: image.NewName,
+				NewTag:  image.NewTag,
+				Digest:  image.Digest,
+			})
+		}
+
+		return nil
+	})
+}
+
+// editKustomization loads the kustomization in dir, applies fn and writes it back. If the directory has no
+// kustomization, one is generated from the manifests it contains, as the kustomize-controller does.
+func editKustomization(fSys filesys.FileSystem, dir string, fn func(k *kustypes.Kustomization) error) error {
+	path := filepath.Join(dir, konfig.DefaultKustomizationFileName())
+
+	var k kustypes.Kustomization
+
+	found := false
+
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		candidate := filepath.Join(dir, name)
+
+		if !fSys.Exists(candidate) {
+			continue
+		}
+
+		data, err := fSys.ReadFile(candidate)
+		if err != nil {
+			return fmt.Errorf("failed to read kustomization: %w", err)
+		}
+
+		if err := yaml.Unmarshal(data, &k); err != nil {
+			return fmt.Errorf("failed to parse kustomization: %w", err)
+		}
+
+		path = candidate
+		found = true
+
+		break
+	}
+
+	if !found {
+		resources, err := generateResources(fSys, dir)
+		if err != nil {
+			return err
+		}
+
+		k.Resources = resources
+	}
+
+	k.FixKustomization()
+
+	if err := fn(&k); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(&k)
+	if err != nil {
+		return fmt.Errorf("failed to encode kustomization: %w", err)
+	}
+
+	if err := fSys.WriteFile(path, data); err != nil {
+		return fmt.Errorf("failed to write kustomization: %w", err)
+	}
+
+	return nil
+}
+
+// generateResources lists the manifests within dir, treating subdirectories with their own kustomization as a single
+// resource.
+func generateResources(fSys filesys.FileSystem, dir string) ([]string, error) {
+	var resources []string
+
+	err := fSys.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if path == dir {
+				return nil
+			}
+
+			for _, name := range konfig.RecognizedKustomizationFileNames() {
+				if fSys.Exists(filepath.Join(path, name)) {
+					resources = append(resources, filepath.ToSlash(rel))
+
+					return filepath.SkipDir
+				}
+			}
+
+			return nil
+		}
+
+		if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+			resources = append(resources, filepath.ToSlash(rel))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate kustomization: %w", err)
+	}
+
+	return resources, nil
+}
+
+// buildKustomization builds the kustomization and applies the post-build substitutions to each resource.
+func buildKustomization(fSys filesys.FileSystem, dir string, substitute map[string]string) ([]byte, error) {
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+
+	resMap, err := k.Run(fSys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build kustomization: %w", err)
+	}
+
+	var out bytes.Buffer
+
+	for i, res := range resMap.Resources() {
+		data, err := res.AsYAML()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s %q: %w", res.GetKind(), res.GetName(), err)
+		}
+
+		if len(substitute) > 0 && res.GetAnnotations()[substituteAnnotation] != "disabled" {
+			data = substituteVars(data, substitute)
+		}
+
+		if i > 0 {
+			out.WriteString("---\n")
+		}
+
+		out.Write(data)
+	}
+
+	return out.Bytes(), nil
+}
+
+// substituteVars replaces ${var}, ${var:=default} and ${var:-default} references, as flux does during post-build
+// substitution. Unknown variables without a default are replaced with an empty string.
+func substituteVars(data []byte, vars map[string]string) []byte {
+	return substituteRegex.ReplaceAllFunc(data, func(ref []byte) []byte {
+		parts := substituteRegex.FindSubmatch(ref)
+
+		if v, ok := vars[string(parts[1])]; ok && (v != "" || len(parts[2]) == 0) {
+			return []byte(v)
+		}
+
+		return parts[3]
+	})
+}
+
+// renderHelmStep renders a helm step, excluding test hooks. Output references are resolved using outputs, or left
+// unresolved if outputs is nil.
+func (m *Manager) renderHelmStep(
+	ctx context.Context,
+	step config.Step,
+	replacementImages []kustomize.Image,
+	outputs Outputs,
+	cb Callbacks,
+) ([]byte, error) {
+	if err := validateHelm(step.Helm); err != nil {
+		return nil, err
+	}
+
+	values, err := helmValues(ctx, nil, step, replacementImages, cb)
+	if err != nil {
+		return nil, err
+	}
+
+	// Secrets are only resolved when the result is applied, and are masked otherwise.
+	if outputs != nil {
+		if _, err := outputs.expandValues(values); err != nil {
+			return nil, fmt.Errorf("failed to expand values: %w", err)
+		}
+
+		if _, err := walkValues(values, m.newSecretResolver().expand); err != nil {
+			return nil, fmt.Errorf("failed to resolve secrets: %w", err)
+		}
+	} else if _, err := walkValues(values, func(value string) (string, error) {
+		return maskSecretRefs(value), nil
+	}); err != nil {
+		return nil, err
+	}
+
+	encodedValues, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal values: %w", err)
+	}
+
+	if outputs == nil && outputRefRegex.Match(encodedValues) {
+		cb.Warn(fmt.Sprintf("Step %q references outputs, which are left unresolved when rendering", step.Name))
+	}
+
+	rel, err := m.renderHelmRelease(ctx, step, values, replacementImages)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+
+	out.WriteString(rel.Manifest)
+
+	for _, hook := range rel.Hooks {
+		if slices.Contains(hook.Events, release.HookTest) {
+			continue
+		}
+
+		fmt.Fprintf(&out, "---\n# Source: %s\n%s\n", hook.Path, hook.Manifest)
+	}
+
+	return out.Bytes(), nil
+}
+
+// renderHelmRelease renders the step's chart with the given values through a client-only dry-run install.
+func (m *Manager) renderHelmRelease(
+	ctx context.Context,
+	step config.Step,
+	values map[string]any,
+	replacementImages []kustomize.Image,
+) (*release.Release, error) {
+	namespace := step.Helm.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	settings := cli.New()
+
+	install := action.NewInstall(new(action.Configuration))
+	install.DryRun = true
+	install.ClientOnly = true
+	install.Replace = true
+	install.IncludeCRDs = true
+	install.ReleaseName = step.Name
+	install.Namespace = namespace
+	install.PostRenderer = &kustomizePostRenderer{
+		patches: step.Helm.Patches,
+		images:  replacementImages,
+	}
+
+	chartPath := step.Helm.Context
+
+	var err error
+
+	if step.Helm.Repo != "" || isOCIChart(step.Helm) {
+		ref := step.Helm.Chart
+		ociRepo := strings.HasPrefix(strings.ToLower(step.Helm.Repo), "oci://")
+
+		if isOCIChart(step.Helm) || ociRepo {
+			rc, err := registry.NewClient()
+			if err != nil {
+				return nil, fmt.Errorf("failed to create registry client: %w", err)
+			}
+
+			install.SetRegistryClient(rc)
+
+			if ociRepo {
+				ref = strings.TrimSuffix(step.Helm.Repo, "/") + "/" + step.Helm.Chart
+			}
+		} else {
+			install.RepoURL = step.Helm.Repo
+		}
+
+		install.Version = step.Helm.Version
+
+		chartPath, err = install.LocateChart(ref, settings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch chart: %w", err)
+		}
+	}
+
+	if step.Helm.Context != "" {
+		if err := m.buildHelmDependencies(chartPath); err != nil {
+			return nil, err
+		}
+	}
+
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart: %w", err)
+	}
+
+	rel, err := install.RunWithContext(ctx, chrt, values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render chart: %w", err)
+	}
+
+	return rel, nil
+}
+
+// kustomizePostRenderer applies patches and image replacements to rendered charts, mirroring the helm-controller's
+// kustomize post-renderer.
+type kustomizePostRenderer struct {
+	patches []kustomize.Patch
+	images  []kustomize.Image
+}
+
+func (r *kustomizePostRenderer) Run(rendered *bytes.Buffer) (*bytes.Buffer, error) {
+	if len(r.patches) == 0 && len(r.images) == 0 {
+		return rendered, nil
+	}
+
+	fSys := filesys.MakeFsInMemory()
+
+	if err := fSys.WriteFile("/resources.yaml", rendered.Bytes()); err != nil {
+		return nil, err
+	}
+
+	if err := overlayKustomization(fSys, "/", "", nil, r.patches, r.images); err != nil {
+		return nil, err
+	}
+
+	data, err := buildKustomization(fSys, "/", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewBuffer(data), nil
+}
@@ -0,0 +1,224 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
+	"github.com/fluxcd/pkg/apis/kustomize"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// imageUsage maps each built image to the workloads whose pods reference it.
+type imageUsage map[string][]string
+
+// findImageUsage scans pod specs within the namespaces for references to the built images. Pods are matched either by
+// the digest in their spec, the digest reported in their container statuses or, for tagged images, the tag.
+func findImageUsage(
+	ctx context.Context,
+	kc *cluster.K8sClient,
+	namespaces []string,
+	images []kustomize.Image,
+) (imageUsage, error) {
+	usage := make(imageUsage, len(images))
+
+	for _, image := range images {
+		usage[image.Name] = nil
+	}
+
+	for _, ns := range namespaces {
+		pods, err := kc.ClientSet().CoreV1().Pods(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods: %w", err)
+		}
+
+		var owners map[string]*metav1.OwnerReference
+
+		for _, pod := range pods.Items {
+			if !slices.ContainsFunc(images, func(image kustomize.Image) bool { return podUsesImage(&pod, image) }) {
+				continue
+			}
+
+			// ReplicaSets are only listed once a pod of the namespace uses an image.
+			if owners == nil {
+				owners, err = replicaSetOwners(ctx, kc, ns)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			workload := podWorkload(&pod, owners)
+
+			for _, image := range images {
+				if !podUsesImage(&pod, image) || slices.Contains(usage[image.Name], workload) {
+					continue
+				}
+
+				usage[image.Name] = append(usage[image.Name], workload)
+			}
+		}
+	}
+
+	for _, workloads := range usage {
+		slices.Sort(workloads)
+	}
+
+	return usage, nil
+}
+
+// replicaSetOwners returns the controllers of the ReplicaSets within the namespace, keyed by namespace and name.
+func replicaSetOwners(ctx context.Context, kc *cluster.K8sClient, ns string) (map[string]*metav1.OwnerReference, error) {
+	sets, err := kc.ClientSet().AppsV1().ReplicaSets(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replica sets: %w", err)
+	}
+
+	owners := make(map[string]*metav1.OwnerReference, len(sets.Items))
+
+	for _, rs := range sets.Items {
+		if owner := metav1.GetControllerOf(&rs); owner != nil {
+			owners[rs.Namespace+"/"+rs.Name] = owner
+		}
+	}
+
+	return owners, nil
+}
+
+// usageNamespaces returns the namespaces the steps deploy to, from their target namespaces and the inventories of
+// their kustomizations. The namespaces of direct steps without a target namespace are not known, so all namespaces
+// are searched instead.
+func usageNamespaces(
+	ctx context.Context,
+	kc *cluster.K8sClient,
+	deployment config.Deployment,
+	steps []config.Step,
+	opts DeployOptions,
+) []string {
+	var namespaces []string
+
+	for _, step := range steps {
+		ns := stepNamespace(step)
+		if ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+
+		if isDirect(step, opts) {
+			if ns == "" {
+				return []string{metav1.NamespaceAll}
+			}
+
+			continue
+		}
+
+		// Helm releases without a target namespace are installed into the namespace of the HelmRelease.
+		if step.Helm != nil && ns == "" {
+			namespaces = append(namespaces, cluster.LFNamespace)
+		}
+
+		if step.Kustomize == nil && step.Git == nil {
+			continue
+		}
+
+		var ks kustomizev1.Kustomization
+
+		if err := kc.Controller().Get(ctx, client.ObjectKey{
+			Namespace: cluster.LFNamespace,
+			Name:      fixName(deployment.Name) + "-" + fixName(step.Name),
+		}, &ks); err != nil {
+			return []string{metav1.NamespaceAll}
+		}
+
+		namespaces = append(namespaces, inventoryNamespaces(&ks)...)
+	}
+
+	slices.Sort(namespaces)
+
+	return slices.Compact(namespaces)
+}
+
+func podUsesImage(pod *corev1.Pod, image kustomize.Image) bool {
+	var refs []string
+
+	for _, c := range pod.Spec.InitContainers {
+		refs = append(refs, c.Image)
+	}
+
+	for _, c := range pod.Spec.Containers {
+		refs = append(refs, c.Image)
+	}
+
+	for _, s := range pod.Status.InitContainerStatuses {
+		refs = append(refs, s.ImageID)
+	}
+
+	for _, s := range pod.Status.ContainerStatuses {
+		refs = append(refs, s.ImageID)
+	}
+
+	for _, ref := range refs {
+		if image.Digest != "" && strings.HasSuffix(ref, "@"+image.Digest) {
+			return true
+		}
+
+		if image.NewTag != "" && ref == image.NewName+":"+image.NewTag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// podWorkload returns a readable name for the workload owning the pod, following ReplicaSets to their Deployment.
+func podWorkload(pod *corev1.Pod, replicaSetOwners map[string]*metav1.OwnerReference) string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return pod.Namespace + "/Pod/" + pod.Name
+	}
+
+	if owner.Kind == "ReplicaSet" {
+		if rsOwner, ok := replicaSetOwners[pod.Namespace+"/"+owner.Name]; ok {
+			owner = rsOwner
+		}
+	}
+
+	return pod.Namespace + "/" + owner.Kind + "/" + owner.Name
+}
+
+func (m *Manager) reportImageUsage(
+	ctx context.Context,
+	kc *cluster.K8sClient,
+	namespaces []string,
+	images []kustomize.Image,
+	cb Callbacks,
+) error {
+	if len(images) == 0 {
+		return nil
+	}
+
+	usage, err := findImageUsage(ctx, kc, namespaces, images)
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		workloads := usage[image.Name]
+
+		m.logger.Info("Image usage", "image", image.Name, "digest", image.Digest, "workloads", workloads)
+
+		if len(workloads) == 0 {
+			cb.Warn(fmt.Sprintf("Image %q was built but is not used by any workload", image.Name))
+
+			continue
+		}
+
+		cb.Info(fmt.Sprintf("Image %q is used by %s", image.Name, strings.Join(workloads, ", ")))
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package deployment
+
+import (
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/csnewman/localflux/internal/config"
+)
+
+const (
+	StepStatusPending   = "pending"
+	StepStatusSkipped   = "skipped"
+	StepStatusSucceeded = "succeeded"
+	StepStatusFailed    = "failed"
+)
+
+// Result is a machine-readable summary of a deployment run.
+type Result struct {
+	Deployment string           `json:"deployment"`
+	Cluster    string           `json:"cluster"`
+	Profile    string           `json:"profile,omitempty"`
+	Success    bool             `json:"success"`
+	Error      string           `json:"error,omitempty"`
+	StartedAt  time.Time        `json:"startedAt"`
+	Duration   Duration         `json:"duration"`
+	Images     []*ImageResult   `json:"images"`
+	Steps      []*StepResult    `json:"steps"`
+	Forwards   []*ForwardResult `json:"forwards"`
+}
+
+type ImageResult struct {
+	Image    string   `json:"image"`
+	Ref      string   `json:"ref"`
+	Digest   string   `json:"digest"`
+	Tag      string   `json:"tag,omitempty"`
+	Reused   bool     `json:"reused,omitempty"`
+	Duration Duration `json:"duration"`
+}
+
+type StepResult struct {
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"`
+	Status   string   `json:"status"`
+	Artifact string   `json:"artifact,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Duration Duration `json:"duration"`
+}
+
+type ForwardResult struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Port      int    `json:"port"`
+	Address   string `json:"address"`
+}
+
+// Duration is a time.Duration encoded in JSON as a string, e.g. "1.5s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(time.Duration(d).Round(time.Millisecond).String())), nil
+}
+
+func newResult(clusterName string, deployment config.Deployment, opts DeployOptions, steps []config.Step) *Result {
+	res := &Result{
+		Deployment: deployment.Name,
+		Cluster:    clusterName,
+		Profile:    opts.Profile,
+		StartedAt:  time.Now(),
+	}
+
+	for _, step := range deployment.Steps {
+		status := StepStatusSkipped
+
+		if slices.ContainsFunc(steps, func(s config.Step) bool {
+			return s.Name == step.Name
+		}) {
+			status = StepStatusPending
+		}
+
+		res.Steps = append(res.Steps, &StepResult{
+			Name:   step.Name,
+			Kind:   stepKind(step),
+			Status: status,
+		})
+	}
+
+	for _, forward := range directForwards(deployment.PortForward) {
+		res.Forwards = append(res.Forwards, &ForwardResult{
+			Kind:      forward.Kind,
+			Namespace: forward.Namespace,
+			Name:      forward.Name,
+			Port:      forward.Port,
+			Address:   forwardAddr(forward, ""),
+		})
+	}
+
+	return res
+}
+
+func (r *Result) step(name string) *StepResult {
+	for _, sr := range r.Steps {
+		if sr.Name == name {
+			return sr
+		}
+	}
+
+	sr := &StepResult{
+		Name: name,
+	}
+
+	r.Steps = append(r.Steps, sr)
+
+	return sr
+}
+
+func (r *Result) finish(err error) {
+	r.Duration = Duration(time.Since(r.StartedAt))
+	r.Success = err == nil
+
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+func (s *StepResult) finish(start time.Time, err error) {
+	s.Duration = Duration(time.Since(start))
+	s.Status = StepStatusSucceeded
+
+	if err != nil {
+		s.Status = StepStatusFailed
+		s.Error = err.Error()
+	}
+}
+
+func stepKind(step config.Step) string {
+	switch {
+	case step.Kustomize != nil:
+		return "kustomize"
+	case step.Helm != nil:
+		return "helm"
+	case step.Manifests != nil:
+		return "manifests"
+	case step.Git != nil:
+		return "git"
+	case step.Compose != nil:
+		return "compose"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,308 @@
+package deployment
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var ErrUnknownSecret = errors.New("unknown secret")
+
+const (
+	// secretRefPrefix starts a secret reference within a build arg, as seen by os.Expand.
+	secretRefPrefix = "secretRef:"
+	// secretValuesKey holds the helm values of steps whose values reference secrets.
+	secretValuesKey = "values.yaml"
+	// stepSecretsLabel marks the Secrets holding the resolved secrets of steps, which garbage collection lists.
+	stepSecretsLabel = "flux.local/step-secrets"
+	// keychainTimeout bounds looking up a secret in the OS keychain, which may prompt the user.
+	keychainTimeout = time.Minute
+)
+
+// secretRefRegex matches references to secrets, "${secretRef:<source>:<key>}", where the source is "env", "file" or
+// "keychain".
+var secretRefRegex = regexp.MustCompile(`\$\{secretRef:([^:}]+):([^}]+)}`)
+
+// secretMask replaces secrets in rendered manifests and diffs.
+const secretMask = "******"
+
+// secretResolver resolves secret references, recording the secrets it resolved so that they can be masked in output.
+type secretResolver struct {
+	dir     string
+	secrets []string
+}
+
+// newSecretResolver returns a resolver reading secret files relative to the config.
+func (m *Manager) newSecretResolver() *secretResolver {
+	return &secretResolver{
+		dir: m.configPath("."),
+	}
+}
+
+// hasSecretRefs reports whether the value references any secrets.
+func hasSecretRefs(value string) bool {
+	return secretRefRegex.MatchString(value)
+}
+
+// maskSecretRefs replaces the secret references within the value with secretMask, without resolving them.
+func maskSecretRefs(value string) string {
+	return secretRefRegex.ReplaceAllLiteralString(value, secretMask)
+}
+
+// expand replaces the secret references within the value with the secrets they refer to.
+func (r *secretResolver) expand(value string) (string, error) {
+	var resolveErr error
+
+	expanded := secretRefRegex.ReplaceAllStringFunc(value, func(ref string) string {
+		parts := secretRefRegex.FindStringSubmatch(ref)
+
+		secret, err := resolveSecret(r.dir, parts[1], parts[2])
+		if err != nil && resolveErr == nil {
+			resolveErr = err
+		}
+
+		r.secrets = append(r.secrets, secret)
+
+		return secret
+	})
+
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+
+	return expanded, nil
+}
+
+// split separates the values referencing secrets from the rest, resolving the secrets.
+func (r *secretResolver) split(values map[string]string) (map[string]string, map[string]string, error) {
+	var plain, secret map[string]string
+
+	for k, v := range values {
+		if !hasSecretRefs(v) {
+			if plain == nil {
+				plain = make(map[string]string)
+			}
+
+			plain[k] = v
+
+			continue
+		}
+
+		resolved, err := r.expand(v)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if secret == nil {
+			secret = make(map[string]string)
+		}
+
+		secret[k] = resolved
+	}
+
+	return plain, secret, nil
+}
+
+// mask replaces the resolved secrets within the text, as written and base64 encoded, with secretMask.
+func (r *secretResolver) mask(text string) string {
+	var pairs []string
+
+	for _, secret := range r.secrets {
+		if secret == "" {
+			continue
+		}
+
+		pairs = append(pairs, secret, secretMask, base64.StdEncoding.EncodeToString([]byte(secret)), secretMask)
+	}
+
+	if len(pairs) == 0 {
+		return text
+	}
+
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// resolveSecret reads the secret from an environment variable, a file relative to the directory, or the OS keychain
+// as "<service>/<account>". Trailing newlines are removed from files.
+func resolveSecret(dir string, source string, key string) (string, error) {
+	switch source {
+	case "env":
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			return "", fmt.Errorf("%w: environment variable %s is not set", ErrUnknownSecret, key)
+		}
+
+		return value, nil
+
+	case "file":
+		if !filepath.IsAbs(key) {
+			key = filepath.Join(dir, key)
+		}
+
+		raw, err := os.ReadFile(key)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+
+		return strings.TrimRight(string(raw), "\r\n"), nil
+
+	case "keychain":
+		idx := strings.LastIndex(key, "/")
+		if idx == -1 {
+			return "", fmt.Errorf("%w: keychain reference %q must be <service>/<account>", ErrUnknownSecret, key)
+		}
+
+		return keychainSecret(key[:idx], key[idx+1:])
+
+	default:
+		return "", fmt.Errorf("%w: unknown source %q, expected env, file or keychain", ErrUnknownSecret, source)
+	}
+}
+
+// keychainSecret looks up a generic password with the security CLI on macOS, or secret-tool on Linux, where the
+// secret is looked up by its service and account attributes.
+func keychainSecret(service string, account string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keychainTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux":
+		cmd = exec.CommandContext(ctx, "secret-tool", "lookup", "service", service, "account", account)
+	default:
+		return "", fmt.Errorf("%w: the keychain is not supported on %s", ErrUnknownSecret, runtime.GOOS)
+	}
+
+	cmd.Stdin = os.Stdin
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: keychain item %s/%s: %w", ErrUnknownSecret, service, account, err)
+	}
+
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// expandMap replaces the secret references within the values.
+func (r *secretResolver) expandMap(values map[string]string) (map[string]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	expanded := make(map[string]string, len(values))
+
+	for k, v := range values {
+		e, err := r.expand(v)
+		if err != nil {
+			return nil, err
+		}
+
+		expanded[k] = e
+	}
+
+	return expanded, nil
+}
+
+// postBuild returns the substitutions of a kustomization. Substitutions referencing secrets are resolved into the
+// Secret of the step and read by Flux from there.
+func (m *Manager) postBuild(
+	ctx context.Context,
+	kc *cluster.K8sClient,
+	remoteName string,
+	substitute map[string]string,
+) (*kustomizev1.PostBuild, error) {
+	plain, secret, err := m.newSecretResolver().split(substitute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
+	data := make(map[string][]byte, len(secret))
+
+	for k, v := range secret {
+		data[k] = []byte(v)
+	}
+
+	name, err := applyStepSecrets(ctx, kc, remoteName, data)
+	if err != nil {
+		return nil, err
+	}
+
+	postBuild := &kustomizev1.PostBuild{
+		Substitute: plain,
+	}
+
+	if name != "" {
+		postBuild.SubstituteFrom = []kustomizev1.SubstituteReference{
+			{
+				Kind: "Secret",
+				Name: name,
+			},
+		}
+	}
+
+	return postBuild, nil
+}
+
+// applyStepSecrets stores the resolved secrets of a step in a Secret in the localflux namespace, which the Flux objects
+// of the step reference rather than holding the secrets in plain text. The Secret is removed once the step no longer
+// has secrets, in which case an empty name is returned.
+func applyStepSecrets(
+	ctx context.Context,
+	kc *cluster.K8sClient,
+	remoteName string,
+	data map[string][]byte,
+) (string, error) {
+	name := remoteName + "-secrets"
+
+	if len(data) == 0 {
+		if err := deleteStepSecrets(ctx, kc, remoteName); err != nil {
+			return "", err
+		}
+
+		return "", nil
+	}
+
+	if err := kc.PatchSSA(ctx, &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cluster.LFNamespace,
+			Labels:    map[string]string{stepSecretsLabel: "true"},
+		},
+		Data: data,
+	}); err != nil {
+		return "", fmt.Errorf("failed to create secret: %w", err)
+	}
+
+	return name, nil
+}
+
+// deleteStepSecrets removes the Secret holding the resolved secrets of a step, if any.
+func deleteStepSecrets(ctx context.Context, kc *cluster.K8sClient, remoteName string) error {
+	err := kc.ClientSet().CoreV1().Secrets(cluster.LFNamespace).Delete(ctx, remoteName+"-secrets", metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete secret: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package deployment
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/csnewman/localflux/internal/config"
+)
+
+// maxScanSize limits the size of files inspected when detecting image references.
+const maxScanSize = 1024 * 1024
+
+// selectSteps returns the steps matching the given names, in dependency order, alongside the images referenced by
+// those steps. When no names are given, all steps and images are returned.
+func selectSteps(deployment config.Deployment, names []string) ([]config.Step, []config.Image, error) {
+	if len(names) == 0 {
+		steps, err := orderSteps(deployment, deployment.Steps)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return steps, deployment.Images, nil
+	}
+
+	for _, name := range names {
+		if !slices.ContainsFunc(deployment.Steps, func(step config.Step) bool {
+			return step.Name == name
+		}) {
+			return nil, nil, fmt.Errorf("%w: unknown step %q", ErrInvalid, name)
+		}
+	}
+
+	var (
+		steps  []config.Step
+		images []config.Image
+	)
+
+	for _, step := range deployment.Steps {
+		if !slices.Contains(names, step.Name) {
+			continue
+		}
+
+		steps = append(steps, step)
+	}
+
+	steps, err := orderSteps(deployment, steps)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, image := range deployment.Images {
+		for _, step := range steps {
+			referenced, err := stepReferencesImage(step, image.Image)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to inspect step %q: %w", step.Name, err)
+			}
+
+			if referenced {
+				images = append(images, image)
+
+				break
+			}
+		}
+	}
+
+	return steps, images, nil
+}
+
+// stepReferencesImage reports whether the step mentions the image, either in its inline helm values or in any of the
+// files within its context.
+func stepReferencesImage(step config.Step, image string) (bool, error) {
+	needle := []byte(image)
+
+	var dir string
+
+	switch {
+	case step.Kustomize != nil:
+		dir = step.Kustomize.Context
+	case step.Manifests != nil:
+		files, err := expandManifests(step.Manifests)
+		if err != nil {
+			return false, err
+		}
+
+		for _, file := range files {
+			found, err := fileContains(file, needle)
+			if err != nil {
+				return false, err
+			}
+
+			if found {
+				return true, nil
+			}
+		}
+	case step.Compose != nil:
+		return composeReferencesImage(step.Compose, image)
+	case step.Helm != nil:
+		if slices.ContainsFunc(step.Helm.ImageValues, func(mapping config.ImageValue) bool {
+			return mapping.Image == image
+		}) {
+			return true, nil
+		}
+
+		if step.Helm.Values != nil && bytes.Contains(step.Helm.Values.Raw, needle) {
+			return true, nil
+		}
+
+		for _, file := range step.Helm.ValueFiles {
+			found, err := fileContains(file, needle)
+			if err != nil {
+				return false, err
+			}
+
+			if found {
+				return true, nil
+			}
+		}
+
+		dir = step.Helm.Context
+	}
+
+	if dir == "" {
+		return false, nil
+	}
+
+	found := false
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		match, err := fileContains(path, needle)
+		if err != nil {
+			return err
+		}
+
+		if match {
+			found = true
+
+			return filepath.SkipAll
+		}
+
+		return nil
+	})
+
+	return found, err
+}
+
+func fileContains(path string, needle []byte) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	if info.Size() > maxScanSize {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Contains(data, needle), nil
+}
@@ -0,0 +1,161 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/fluxcd/pkg/apis/meta"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/google/go-containerregistry/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var ErrCosignNotFound = errors.New("cosign CLI not found")
+
+// Sign signs the pushed image digest with cosign. As the cluster registry is not necessarily reachable by name from
+// the host, cosign is pointed at a local proxy to it. Signatures are stored by repository and digest, so they are
+// found when the image is pulled through the registry name.
+func (b *Builder) Sign(ctx context.Context, signing config.Signing, image string, digest string, fn func(res *SolveStatus)) error {
+	if (signing.Key == "") == !signing.Keyless {
+		return fmt.Errorf("%w: signing of %q requires exactly one of key or keyless", ErrInvalid, image)
+	}
+
+	if _, err := exec.LookPath("cosign"); err != nil {
+		return fmt.Errorf("%w: %w", ErrCosignNotFound, err)
+	}
+
+	ref, err := name.ParseReference(image, name.Insecure)
+	if err != nil {
+		return fmt.Errorf("invalid image reference: %w", err)
+	}
+
+	addr, stop, err := b.registryProxy(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer stop()
+
+	target := addr + "/" + ref.Context().RepositoryStr() + "@" + digest
+
+	args := []string{"sign", "--yes", "--allow-insecure-registry"}
+
+	if signing.Key != "" {
+		args = append(args, "--key", signing.Key)
+	}
+
+	args = append(args, target)
+
+	b.logger.Info("Running cosign", "args", args)
+
+	cmd := exec.CommandContext(ctx, "cosign", args...)
+	cmd.Env = os.Environ()
+
+	if err := runVertexCommand(cmd, "cosign:"+image+"@"+digest, "[cosign] sign "+image+"@"+digest, fn); err != nil {
+		return fmt.Errorf("cosign sign failed: %w", err)
+	}
+
+	return nil
+}
+
+// registryProxy serves the cluster registry on a loopback address. The host of incoming requests is preserved, so
+// that locations returned by the registry point back at the proxy.
+func (b *Builder) registryProxy(ctx context.Context) (string, func(), error) {
+	trans, _, err := b.provider.RegistryConn(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to connect to registry: %w", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	srv := &http.Server{
+		Handler: &httputil.ReverseProxy{
+			Rewrite: func(r *httputil.ProxyRequest) {
+				r.SetURL(&url.URL{Scheme: "http", Host: r.In.Host})
+				r.Out.Host = r.In.Host
+			},
+			Transport: trans,
+		},
+	}
+
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			b.logger.Warn("Registry proxy failed", "err", err)
+		}
+	}()
+
+	return lis.Addr().String(), func() { _ = srv.Close() }, nil
+}
+
+// ociVerification returns the verification for the step artifacts of the deployment, creating the secret holding
+// the public key if needed.
+func ociVerification(
+	ctx context.Context,
+	kc *cluster.K8sClient,
+	deployment config.Deployment,
+) (*sourcev1.OCIRepositoryVerification, error) {
+	if deployment.Sign == nil || deployment.Sign.Verify == nil {
+		return nil, nil
+	}
+
+	verify := deployment.Sign.Verify
+
+	out := &sourcev1.OCIRepositoryVerification{
+		Provider: "cosign",
+	}
+
+	if verify.PublicKey != "" {
+		key, err := os.ReadFile(verify.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key: %w", err)
+		}
+
+		secretName := fixName(deployment.Name) + "-cosign"
+
+		if err := kc.PatchSSA(ctx, &corev1.Secret{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Secret",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      secretName,
+				Namespace: cluster.LFNamespace,
+			},
+			Data: map[string][]byte{
+				"cosign.pub": key,
+			},
+		}); err != nil {
+			return nil, fmt.Errorf("failed to create public key secret: %w", err)
+		}
+
+		out.SecretRef = &meta.LocalObjectReference{Name: secretName}
+	}
+
+	if verify.Issuer != "" || verify.Subject != "" {
+		out.MatchOIDCIdentity = []sourcev1.OIDCIdentityMatch{
+			{
+				Issuer:  verify.Issuer,
+				Subject: verify.Subject,
+			},
+		}
+	}
+
+	if out.SecretRef == nil && len(out.MatchOIDCIdentity) == 0 {
+		return nil, fmt.Errorf("%w: verification requires a public key, or an issuer and subject", ErrInvalid)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,225 @@
+package deployment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/tonistiigi/fsutil"
+)
+
+const (
+	TagStrategyDigest      = "digest"
+	TagStrategyContentHash = "contentHash"
+	TagStrategyGitSHA      = "gitSha"
+	TagStrategyTimestamp   = "timestamp"
+)
+
+// imageTag returns the tag to push the image with, or an empty string if the image should be referenced by digest.
+func imageTag(ctx context.Context, image config.Image, pinsFile string) (string, error) {
+	switch image.TagStrategy {
+	case "", TagStrategyDigest:
+		return "", nil
+	case TagStrategyContentHash:
+		return contextHash(ctx, image, pinsFile)
+	case TagStrategyGitSHA:
+		if isGitContext(image.Context) {
+			rev, err := gitContextRevision(ctx, image.Context)
+			if err != nil {
+				return "", err
+			}
+
+			return rev[:12], nil
+		}
+
+		return gitTag(ctx, image, pinsFile)
+	case TagStrategyTimestamp:
+		return time.Now().UTC().Format("20060102150405"), nil
+	default:
+		return "", fmt.Errorf("%w: unknown tag strategy %q", ErrInvalid, image.TagStrategy)
+	}
+}
+
+func imageContext(image config.Image) string {
+	if image.Context == "" {
+		return "./"
+	}
+
+	return image.Context
+}
+
+// contextHash hashes the filtered build context alongside the build settings, including the base images pinned in the
+// pins file, so that the tag only changes when the build inputs do.
+func contextHash(ctx context.Context, image config.Image, pinsFile string) (string, error) {
+	dir := imageContext(image)
+
+	h := sha256.New()
+
+	if isGitContext(dir) {
+		// The repository is fetched by buildkit, so it is identified by the commit its ref points at.
+		rev, err := gitContextRevision(ctx, dir)
+		if err != nil {
+			return "", err
+		}
+
+		_, _ = fmt.Fprintf(h, "git=%s rev=%s\n", dir, rev)
+	} else if err := hashTree(ctx, h, dir, image.IncludePaths, image.ExcludePaths); err != nil {
+		return "", err
+	}
+
+	switch {
+	case image.Custom != nil:
+		_, _ = fmt.Fprintf(h, "custom=%s\n", image.Custom.Command)
+	case image.Bazel != nil:
+		_, _ = fmt.Fprintf(h, "bazel=%s args=%v\n", image.Bazel.Target, image.Bazel.Args)
+	case image.Nix != nil:
+		_, _ = fmt.Fprintf(h, "flake=%s env=%v\n", image.Nix.Flake, image.Nix.Env)
+	case image.Buildpacks != nil:
+		_, _ = fmt.Fprintf(h, "builder=%s buildpacks=%v env=%v\n", image.Buildpacks.Builder, image.Buildpacks.Buildpacks, image.Buildpacks.Env)
+	case isGitContext(dir) && image.File == "":
+	default:
+		buildFile := imageDockerfile(image)
+
+		dockerfile, err := os.ReadFile(buildFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read dockerfile: %w", err)
+		}
+
+		h.Write(dockerfile)
+
+		if image.PinBaseImages {
+			pins, err := loadPins(pinsFile)
+			if err != nil {
+				return "", err
+			}
+
+			refs, err := baseImages(buildFile, image.BuildArgs)
+			if err != nil {
+				return "", err
+			}
+
+			for _, ref := range refs {
+				_, _ = fmt.Fprintf(h, "pin %s=%s\n", ref, pins.Pins[ref])
+			}
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(image.BuildContexts)) {
+		value := image.BuildContexts[name]
+
+		_, _ = fmt.Fprintf(h, "context %s=%s\n", name, value)
+
+		if info, err := os.Stat(value); err == nil && info.IsDir() {
+			if err := hashTree(ctx, h, value, nil, nil); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	_, _ = fmt.Fprintf(h, "target=%s\n", image.Target)
+
+	if len(image.Platforms) > 0 {
+		_, _ = fmt.Fprintf(h, "platforms=%s\n", strings.Join(image.Platforms, ","))
+	}
+
+	args := make([]string, 0, len(image.BuildArgs))
+
+	for k, v := range image.BuildArgs {
+		args = append(args, k+"="+v)
+	}
+
+	slices.Sort(args)
+
+	for _, arg := range args {
+		_, _ = fmt.Fprintf(h, "arg %s\n", arg)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+// hashTree writes the paths, modes and contents of the filtered directory to h.
+func hashTree(ctx context.Context, h io.Writer, dir string, includePaths []string, excludePaths []string) error {
+	cfs, err := fsutil.NewFS(dir)
+	if err != nil {
+		return fmt.Errorf("invalid build context: %w", err)
+	}
+
+	cfs, err = fsutil.NewFilterFS(cfs, &fsutil.FilterOpt{
+		IncludePatterns: includePaths,
+		ExcludePatterns: excludePaths,
+	})
+	if err != nil {
+		return fmt.Errorf("invalid filter: %w", err)
+	}
+
+	if err := cfs.Walk(ctx, "", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprintf(h, "%s %o\n", path, info.Mode())
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		r, err := cfs.Open(path)
+		if err != nil {
+			return err
+		}
+
+		defer r.Close()
+
+		_, err = io.Copy(h, r)
+
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to hash context: %w", err)
+	}
+
+	return nil
+}
+
+// gitTag returns the short commit of the repository containing the build context. When there are uncommitted changes,
+// it is suffixed with "-dirty" and a hash of the context, so that each change to the context is pushed with a new tag.
+func gitTag(ctx context.Context, image config.Image, pinsFile string) (string, error) {
+	dir := imageContext(image)
+
+	sha, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "--short=12", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get git commit: %w", err)
+	}
+
+	tag := strings.TrimSpace(string(sha))
+
+	status, err := exec.CommandContext(ctx, "git", "-C", dir, "status", "--porcelain", "--", ".").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get git status: %w", err)
+	}
+
+	if len(strings.TrimSpace(string(status))) > 0 {
+		hash, err := contextHash(ctx, image, pinsFile)
+		if err != nil {
+			return "", err
+		}
+
+		tag += "-dirty-" + hash[:8]
+	}
+
+	return tag, nil
+}
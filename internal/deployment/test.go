@@ -0,0 +1,115 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/csnewman/localflux/internal/relay"
+)
+
+var ErrRelayDisabled = errors.New("relay is not enabled for cluster")
+
+// Test runs a command with the deployment's port-forwards available on ephemeral local ports. The addresses are
+// exposed to the command using the same variables as Env. Forwards are torn down once the command exits. The name may
+// be omitted when the config defines a single deployment.
+func (m *Manager) Test(ctx context.Context, clusterName string, name string, command []string, cb Callbacks) error {
+	if clusterName == "" {
+		clusterName = m.cfg.DefaultCluster
+	}
+
+	if len(command) == 0 {
+		return fmt.Errorf("%w: a command must be passed", ErrInvalid)
+	}
+
+	if name == "" {
+		if len(m.cfg.Deployments) != 1 {
+			return fmt.Errorf("%w: a deployment name must be passed when the config does not define exactly one", ErrInvalid)
+		}
+
+		name = m.cfg.Deployments[0].Name
+	}
+
+	deployment, err := m.findRendered(ctx, name, clusterName)
+	if err != nil {
+		return err
+	}
+
+	provider, err := m.clusters.Provider(clusterName)
+	if err != nil {
+		return err
+	}
+
+	vars := environ(hookEnv{
+		cluster:    clusterName,
+		deployment: deployment.Name,
+		provider:   provider,
+	})
+
+	// Namespace forwards have no fixed local ports to describe, so only direct forwards are made.
+	if forwards := directForwards(deployment.PortForward); len(forwards) > 0 {
+		if !provider.RelayConfig().Enabled {
+			return fmt.Errorf("%w: %s", ErrRelayDisabled, clusterName)
+		}
+
+		start := time.Now()
+
+		cb.State("Forwarding ports", "", start)
+
+		kc, err := provider.K8sClient(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		rc := relay.NewClient(m.logger)
+
+		if err := rc.Connect(kc); err != nil {
+			return fmt.Errorf("failed to connect to relay: %w", err)
+		}
+
+		defer rc.Close()
+
+		forwardCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		addrs, err := rc.ForwardEphemeral(forwardCtx, mapPortForwards(forwards), quietRelayCallbacks{cb})
+		if err != nil {
+			return fmt.Errorf("failed to forward ports: %w", err)
+		}
+
+		for i, forward := range forwards {
+			m.logger.Info("Forwarding", "name", forward.Name, "port", forward.Port, "addr", addrs[i])
+
+			vars = append(vars, forwardEnv(forward, addrs[i].String())...)
+		}
+
+		cb.Completed("Ports forwarded", time.Since(start))
+	}
+
+	m.logger.Info("Running test command", "command", command)
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+
+	for _, v := range vars {
+		cmd.Env = append(cmd.Env, v.Name+"="+v.Value)
+	}
+
+	return cmd.Run()
+}
+
+// quietRelayCallbacks discards connection events and statistics, which would otherwise interleave with the test
+// command's output.
+type quietRelayCallbacks struct {
+	Callbacks
+}
+
+func (quietRelayCallbacks) Connection(relay.ConnectionEvent) {}
+
+func (quietRelayCallbacks) Stats([]*relay.ForwardStats) {}
@@ -0,0 +1,97 @@
+package deployment
+
+import (
+	"context"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/csnewman/localflux/internal/deployment")
+
+// endSpan records the outcome of the operation on the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// solveTracer turns the vertices of a solve status stream into spans, timed by buildkit rather than by when the
+// status arrived.
+type solveTracer struct {
+	ctx   context.Context
+	mu    sync.Mutex
+	spans map[digest.Digest]trace.Span
+	ended map[digest.Digest]bool
+}
+
+func newSolveTracer(ctx context.Context) *solveTracer {
+	return &solveTracer{
+		ctx:   ctx,
+		spans: make(map[digest.Digest]trace.Span),
+		ended: make(map[digest.Digest]bool),
+	}
+}
+
+// wrap returns a status callback that records the status before passing it on to fn.
+func (t *solveTracer) wrap(fn func(res *SolveStatus)) func(res *SolveStatus) {
+	return func(res *SolveStatus) {
+		t.record(res)
+		fn(res)
+	}
+}
+
+func (t *solveTracer) record(res *SolveStatus) {
+	if res == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, v := range res.Vertexes {
+		if v.Started == nil || t.ended[v.Digest] {
+			continue
+		}
+
+		span, ok := t.spans[v.Digest]
+		if !ok {
+			_, span = tracer.Start(t.ctx, v.Name, trace.WithTimestamp(*v.Started))
+			t.spans[v.Digest] = span
+		}
+
+		if v.Completed == nil {
+			continue
+		}
+
+		span.SetAttributes(attribute.Bool("localflux.cached", v.Cached))
+
+		if v.Error != "" {
+			span.SetStatus(codes.Error, v.Error)
+		}
+
+		span.End(trace.WithTimestamp(*v.Completed))
+
+		t.ended[v.Digest] = true
+		delete(t.spans, v.Digest)
+	}
+}
+
+// finish ends the spans of vertices that never completed, such as those cancelled by a failing build.
+func (t *solveTracer) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for d, span := range t.spans {
+		span.End()
+
+		delete(t.spans, d)
+	}
+}
@@ -3,6 +3,7 @@
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/scheme"
@@ -40,6 +41,12 @@ type Deployment struct {
 	HelmNames []string `json:"helmNames,omitempty"`
 	// +optional
 	PortForward []*PortForward `json:"portForward,omitempty"`
+	// +optional
+	ReverseForward []*ReverseForward `json:"reverseForward,omitempty"`
+	// BindAddress is the local address the relay of the deploying cluster serves port forwards on when they set none.
+	// Unset means the relay default, 127.0.0.1.
+	// +optional
+	BindAddress string `json:"bindAddress,omitempty"`
 }
 
 // DeploymentList contains a list of Deployment's
@@ -51,6 +58,9 @@ type DeploymentList struct {
 	Items           []Deployment `json:"items"`
 }
 
+// ForwardKindNamespace is the kind of forwards that forward every service of a namespace.
+const ForwardKindNamespace = "namespace"
+
 type PortForward struct {
 	Kind      string `json:"kind"`
 	Namespace string `json:"namespace"`
@@ -59,4 +69,27 @@ type PortForward struct {
 	Network   string `json:"network"`
 	// +optional
 	LocalPort *int `json:"localPort,omitempty"`
+	// +optional
+	BindAddress string `json:"bindAddress,omitempty"`
+	// +optional
+	Compression string `json:"compression,omitempty"`
+	// +optional
+	NetworkConditions *NetworkConditions `json:"networkConditions,omitempty"`
+}
+
+type NetworkConditions struct {
+	// +optional
+	Latency *metav1.Duration `json:"latency,omitempty"`
+	// +optional
+	Bandwidth *resource.Quantity `json:"bandwidth,omitempty"`
+	// +optional
+	PacketLoss int `json:"packetLoss,omitempty"`
+}
+
+type ReverseForward struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Port      int    `json:"port"`
+	LocalPort int    `json:"localPort"`
+	LocalHost string `json:"localHost"`
 }
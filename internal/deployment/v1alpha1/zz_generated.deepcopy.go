@@ -5,6 +5,7 @@
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -34,6 +35,17 @@ func (in *Deployment) DeepCopyInto(out *Deployment) {
 			}
 		}
 	}
+	if in.ReverseForward != nil {
+		in, out := &in.ReverseForward, &out.ReverseForward
+		*out = make([]*ReverseForward, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(ReverseForward)
+				**out = **in
+			}
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Deployment.
@@ -86,6 +98,31 @@ func (in *DeploymentList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkConditions) DeepCopyInto(out *NetworkConditions) {
+	*out = *in
+	if in.Latency != nil {
+		in, out := &in.Latency, &out.Latency
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Bandwidth != nil {
+		in, out := &in.Bandwidth, &out.Bandwidth
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkConditions.
+func (in *NetworkConditions) DeepCopy() *NetworkConditions {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkConditions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PortForward) DeepCopyInto(out *PortForward) {
 	*out = *in
@@ -94,6 +131,11 @@ func (in *PortForward) DeepCopyInto(out *PortForward) {
 		*out = new(int)
 		**out = **in
 	}
+	if in.NetworkConditions != nil {
+		in, out := &in.NetworkConditions, &out.NetworkConditions
+		*out = new(NetworkConditions)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PortForward.
@@ -105,3 +147,18 @@ func (in *PortForward) DeepCopy() *PortForward {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReverseForward) DeepCopyInto(out *ReverseForward) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReverseForward.
+func (in *ReverseForward) DeepCopy() *ReverseForward {
+	if in == nil {
+		return nil
+	}
+	out := new(ReverseForward)
+	in.DeepCopyInto(out)
+	return out
+}
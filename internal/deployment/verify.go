@@ -0,0 +1,254 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/relay"
+	"github.com/csnewman/localflux/internal/wait"
+)
+
+var ErrVerifyFailed = errors.New("verification failed")
+
+const (
+	defaultProbeRetries  = 10
+	defaultProbeInterval = 2 * time.Second
+	defaultProbeTimeout  = 5 * time.Second
+	maxProbeBody         = 1 << 20
+)
+
+// probeName returns the display name of a probe, falling back to its type.
+func probeName(probe config.Probe) string {
+	switch {
+	case probe.Name != "":
+		return probe.Name
+	case probe.HTTP != nil:
+		return "http"
+	case probe.TCP != nil:
+		return "tcp"
+	case probe.Exec != nil:
+		return "exec"
+	default:
+		return "probe"
+	}
+}
+
+// verifyStep runs the step's verification probes in order, failing on the first probe that does not pass within its
+// retries.
+func (m *Manager) verifyStep(
+	ctx context.Context,
+	deployment config.Deployment,
+	step config.Step,
+	cb Callbacks,
+	provider cluster.Provider,
+	kc *cluster.K8sClient,
+	env hookEnv,
+) error {
+	if len(step.Verify) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	title := fmt.Sprintf("Step %q", step.Name)
+
+	vars := environ(env)
+	relayVars := vars
+
+	if slices.ContainsFunc(step.Verify, func(p config.Probe) bool { return p.Relay }) {
+		forwards := directForwards(deployment.PortForward)
+		if len(forwards) == 0 {
+			return fmt.Errorf("%w: relay probes require port forwards", ErrInvalid)
+		}
+
+		if !provider.RelayConfig().Enabled {
+			return fmt.Errorf("%w: %s", ErrRelayDisabled, env.cluster)
+		}
+
+		cb.State(title, "Forwarding ports for verification", start)
+
+		rc := relay.NewClient(m.logger)
+
+		if err := rc.Connect(kc); err != nil {
+			return fmt.Errorf("failed to connect to relay: %w", err)
+		}
+
+		forwardCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		addrs, err := rc.ForwardEphemeral(forwardCtx, mapPortForwards(forwards), quietRelayCallbacks{cb})
+		if err != nil {
+			return fmt.Errorf("failed to forward ports: %w", err)
+		}
+
+		relayVars = slices.Clone(vars)
+
+		for i, forward := range forwards {
+			relayVars = append(relayVars, forwardEnv(forward, addrs[i].String())...)
+		}
+	}
+
+	for _, probe := range step.Verify {
+		probeVars := vars
+		if probe.Relay {
+			probeVars = relayVars
+		}
+
+		name := probeName(probe)
+
+		m.logger.Info("Verifying step", "step", step.Name, "probe", name)
+
+		if err := runProbe(ctx, probe, probeVars, func(attempt int, err error) {
+			cb.State(title, fmt.Sprintf("Verifying %q: attempt %d failed: %v", name, attempt, err), start)
+		}); err != nil {
+			return fmt.Errorf("%w: probe %q: %w", ErrVerifyFailed, name, err)
+		}
+	}
+
+	cb.Completed(fmt.Sprintf("Verified step %q", step.Name), time.Since(start))
+
+	return nil
+}
+
+// runProbe runs a probe until it passes or its retries are exhausted, returning the error of the last attempt.
+func runProbe(ctx context.Context, probe config.Probe, vars []EnvVar, failed func(attempt int, err error)) error {
+	retries := defaultProbeRetries
+	if probe.Retries != nil {
+		retries = *probe.Retries
+	}
+
+	interval := defaultProbeInterval
+	if probe.Interval != nil {
+		interval = probe.Interval.Duration
+	}
+
+	timeout := defaultProbeTimeout
+	if probe.Timeout != nil {
+		timeout = probe.Timeout.Duration
+	}
+
+	attempt := 0
+
+	return wait.Poll(ctx, wait.Interval(interval), func(ctx context.Context) (wait.Status, error) {
+		attempt++
+
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		err := probeOnce(attemptCtx, probe, vars)
+		if err == nil {
+			return wait.Done, nil
+		}
+
+		if attempt > retries || errors.Is(err, ErrInvalid) {
+			return wait.Pending, err
+		}
+
+		failed(attempt, err)
+
+		return wait.Pending, nil
+	})
+}
+
+func probeOnce(ctx context.Context, probe config.Probe, vars []EnvVar) error {
+	expand := func(s string) string {
+		return os.Expand(s, func(key string) string {
+			for _, v := range vars {
+				if v.Name == key {
+					return v.Value
+				}
+			}
+
+			return os.Getenv(key)
+		})
+	}
+
+	switch {
+	case probe.HTTP != nil:
+		return probeHTTP(ctx, probe.HTTP, expand)
+	case probe.TCP != nil:
+		var d net.Dialer
+
+		conn, err := d.DialContext(ctx, "tcp", expand(probe.TCP.Address))
+		if err != nil {
+			return err
+		}
+
+		return conn.Close()
+	case probe.Exec != nil:
+		if len(probe.Exec.Command) == 0 {
+			return fmt.Errorf("%w: no command specified", ErrInvalid)
+		}
+
+		cmd := exec.CommandContext(ctx, probe.Exec.Command[0], probe.Exec.Command[1:]...)
+		cmd.Env = os.Environ()
+
+		for _, v := range vars {
+			cmd.Env = append(cmd.Env, v.Name+"="+v.Value)
+		}
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("command failed: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("%w: no probe type specified", ErrInvalid)
+	}
+}
+
+func probeHTTP(ctx context.Context, probe config.HTTPProbe, expand func(string) string) error {
+	method := probe.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, expand(probe.URL), nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	for k, v := range probe.Headers {
+		req.Header.Set(k, expand(v))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if len(probe.ExpectStatus) > 0 {
+		if !slices.Contains(probe.ExpectStatus, resp.StatusCode) {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+	} else if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if probe.ExpectBody == "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	if err != nil {
+		return fmt.Errorf("failed to read body: %w", err)
+	}
+
+	if !strings.Contains(string(body), expand(probe.ExpectBody)) {
+		return fmt.Errorf("body does not contain %q", probe.ExpectBody)
+	}
+
+	return nil
+}
@@ -0,0 +1,531 @@
+package gitops
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	helmv2 "github.com/fluxcd/helm-controller/api/v2"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	sourcev1b2 "github.com/fluxcd/source-controller/api/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	ErrNothingFound = errors.New("no flux resources found")
+	ErrCycle        = errors.New("dependency cycle")
+)
+
+type Importer struct {
+	logger *slog.Logger
+	root   string
+	// repoRoot is the root of the git repository holding the directory, which Flux paths are relative to.
+	repoRoot string
+
+	kustomizations []*kustomizev1.Kustomization
+	helmReleases   []*helmv2.HelmRelease
+	helmRepos      map[string]*sourcev1.HelmRepository
+	images         []string
+
+	// Warnings contains notes about resources that could not be mapped exactly.
+	Warnings []string
+}
+
+func NewImporter(logger *slog.Logger, root string) *Importer {
+	return &Importer{
+		logger:    logger,
+		root:      root,
+		repoRoot:  findRepoRoot(root),
+		helmRepos: make(map[string]*sourcev1.HelmRepository),
+	}
+}
+
+// findRepoRoot returns the closest parent of the directory, or the directory itself, that holds a ".git" entry. The
+// directory is returned when it is not within a git repository.
+func findRepoRoot(dir string) string {
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+
+		current = parent
+	}
+}
+
+// Import scans the GitOps directory and produces a deployment with steps mapped from the Flux Kustomizations and
+// HelmReleases found inside it. Flux paths are resolved against the root of the git repository holding the directory,
+// and expressed relative to base.
+func (i *Importer) Import(name string, base string) (*v1alpha2.Deployment, error) {
+	if err := filepath.WalkDir(i.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		return i.readFile(path)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to scan %q: %w", i.root, err)
+	}
+
+	if len(i.kustomizations) == 0 && len(i.helmReleases) == 0 {
+		return nil, fmt.Errorf("%w in %q", ErrNothingFound, i.root)
+	}
+
+	deployment := &v1alpha2.Deployment{
+		Name: name,
+	}
+
+	for _, image := range i.images {
+		deployment.Images = append(deployment.Images, &v1alpha2.Image{
+			Image: image,
+		})
+
+		i.warn("Image %q was detected; set its build context", image)
+	}
+
+	ordered, err := i.order()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range ordered {
+		step, err := i.mapStep(key, base)
+		if err != nil {
+			return nil, err
+		}
+
+		if step != nil {
+			deployment.Steps = append(deployment.Steps, step)
+		}
+	}
+
+	return deployment, nil
+}
+
+func (i *Importer) warn(format string, args ...any) {
+	i.Warnings = append(i.Warnings, fmt.Sprintf(format, args...))
+}
+
+type kustomizeFile struct {
+	Images []struct {
+		Name    string `json:"name"`
+		NewName string `json:"newName"`
+	} `json:"images"`
+}
+
+func (i *Importer) readFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(raw)))
+
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			i.logger.Debug("Skipping unreadable file", "path", path, "err", err)
+
+			return nil
+		}
+
+		var meta metav1.TypeMeta
+
+		if err := yaml.Unmarshal(doc, &meta); err != nil {
+			continue
+		}
+
+		// Kustomize accepts kustomization files without a type.
+		if meta.Kind == "" && isKustomizationFile(path) {
+			i.readKustomizeFile(doc)
+
+			continue
+		} else if meta.Kind == "" {
+			continue
+		}
+
+		gv, err := schema.ParseGroupVersion(meta.APIVersion)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case gv.Group == kustomizev1.GroupVersion.Group && meta.Kind == kustomizev1.KustomizationKind:
+			var ks kustomizev1.Kustomization
+
+			if err := yaml.Unmarshal(doc, &ks); err != nil {
+				return fmt.Errorf("failed to decode kustomization in %q: %w", path, err)
+			}
+
+			i.kustomizations = append(i.kustomizations, &ks)
+
+			for _, image := range ks.Spec.Images {
+				i.addImage(image.Name, image.NewName)
+			}
+
+		case gv.Group == helmv2.GroupVersion.Group && meta.Kind == helmv2.HelmReleaseKind:
+			var hr helmv2.HelmRelease
+
+			if err := yaml.Unmarshal(doc, &hr); err != nil {
+				return fmt.Errorf("failed to decode helm release in %q: %w", path, err)
+			}
+
+			i.helmReleases = append(i.helmReleases, &hr)
+
+		case gv.Group == sourcev1.GroupVersion.Group && meta.Kind == sourcev1.HelmRepositoryKind:
+			var repo sourcev1.HelmRepository
+
+			if err := yaml.Unmarshal(doc, &repo); err != nil {
+				return fmt.Errorf("failed to decode helm repository in %q: %w", path, err)
+			}
+
+			i.helmRepos[repo.Namespace+"/"+repo.Name] = &repo
+
+		case gv.Group == "kustomize.config.k8s.io" && meta.Kind == "Kustomization":
+			i.readKustomizeFile(doc)
+		}
+	}
+}
+
+func isKustomizationFile(path string) bool {
+	name := filepath.Base(path)
+
+	return name == "kustomization.yaml" || name == "kustomization.yml"
+}
+
+func (i *Importer) readKustomizeFile(doc []byte) {
+	var kf kustomizeFile
+
+	if err := yaml.Unmarshal(doc, &kf); err != nil {
+		return
+	}
+
+	for _, image := range kf.Images {
+		i.addImage(image.Name, image.NewName)
+	}
+}
+
+func (i *Importer) addImage(name string, newName string) {
+	if newName != "" {
+		name = newName
+	}
+
+	if name == "" || slices.Contains(i.images, name) {
+		return
+	}
+
+	i.images = append(i.images, name)
+}
+
+func objectKey(kind string, namespace string, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// order returns object keys such that dependencies come before their dependents.
+func (i *Importer) order() ([]string, error) {
+	deps := make(map[string][]string)
+
+	var keys []string
+
+	for _, ks := range i.kustomizations {
+		key := objectKey(kustomizev1.KustomizationKind, ks.Namespace, ks.Name)
+		keys = append(keys, key)
+
+		for _, dep := range ks.Spec.DependsOn {
+			ns := dep.Namespace
+			if ns == "" {
+				ns = ks.Namespace
+			}
+
+			deps[key] = append(deps[key], objectKey(kustomizev1.KustomizationKind, ns, dep.Name))
+		}
+	}
+
+	for _, hr := range i.helmReleases {
+		key := objectKey(helmv2.HelmReleaseKind, hr.Namespace, hr.Name)
+		keys = append(keys, key)
+
+		for _, dep := range hr.Spec.DependsOn {
+			ns := dep.Namespace
+			if ns == "" {
+				ns = hr.Namespace
+			}
+
+			deps[key] = append(deps[key], objectKey(helmv2.HelmReleaseKind, ns, dep.Name))
+		}
+	}
+
+	var (
+		ordered  []string
+		visiting = make(map[string]bool)
+		visited  = make(map[string]bool)
+		visit    func(key string) error
+	)
+
+	visit = func(key string) error {
+		if visited[key] || !slices.Contains(keys, key) {
+			return nil
+		}
+
+		if visiting[key] {
+			return fmt.Errorf("%w: %s", ErrCycle, key)
+		}
+
+		visiting[key] = true
+
+		for _, dep := range deps[key] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+
+		visiting[key] = false
+		visited[key] = true
+		ordered = append(ordered, key)
+
+		return nil
+	}
+
+	for _, key := range keys {
+		if err := visit(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+func (i *Importer) mapStep(key string, base string) (*v1alpha2.Step, error) {
+	for _, ks := range i.kustomizations {
+		if objectKey(kustomizev1.KustomizationKind, ks.Namespace, ks.Name) == key {
+			return i.mapKustomization(ks, base)
+		}
+	}
+
+	for _, hr := range i.helmReleases {
+		if objectKey(helmv2.HelmReleaseKind, hr.Namespace, hr.Name) == key {
+			return i.mapHelmRelease(hr, base)
+		}
+	}
+
+	return nil, nil
+}
+
+func (i *Importer) relPath(base string, path string) (string, error) {
+	abs := filepath.Join(i.repoRoot, filepath.FromSlash(strings.TrimPrefix(path, "./")))
+
+	rel, err := filepath.Rel(base, abs)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path %q: %w", path, err)
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
+func (i *Importer) mapKustomization(ks *kustomizev1.Kustomization, base string) (*v1alpha2.Step, error) {
+	if ks.Spec.SourceRef.Kind != sourcev1.GitRepositoryKind {
+		i.warn("Kustomization %q uses a %s source; its path is assumed to be relative to the repository root",
+			ks.Name, ks.Spec.SourceRef.Kind)
+	}
+
+	ctx, err := i.relPath(base, ks.Spec.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	step := &v1alpha2.Step{
+		Name: ks.Name,
+		Kustomize: &v1alpha2.Kustomize{
+			Context:          ctx,
+			Namespace:        ks.Spec.TargetNamespace,
+			Components:       ks.Spec.Components,
+			Patches:          ks.Spec.Patches,
+			HealthChecks:     ks.Spec.HealthChecks,
+			HealthCheckExprs: ks.Spec.HealthCheckExprs,
+			Prune:            &ks.Spec.Prune,
+			Force:            &ks.Spec.Force,
+		},
+	}
+
+	if ks.Spec.PostBuild != nil {
+		step.Kustomize.Substitute = ks.Spec.PostBuild.Substitute
+
+		if len(ks.Spec.PostBuild.SubstituteFrom) > 0 {
+			i.warn("Kustomization %q uses substituteFrom, which is not imported", ks.Name)
+		}
+	}
+
+	return step, nil
+}
+
+func (i *Importer) mapHelmRelease(hr *helmv2.HelmRelease, base string) (*v1alpha2.Step, error) {
+	step := &v1alpha2.Step{
+		Name: hr.Name,
+		Helm: &v1alpha2.Helm{
+			Namespace: hr.Spec.TargetNamespace,
+			Values:    hr.Spec.Values,
+		},
+	}
+
+	if hr.Spec.Chart == nil {
+		i.warn("HelmRelease %q uses a chartRef, which is not imported", hr.Name)
+
+		return nil, nil
+	}
+
+	if hr.Spec.Install != nil {
+		step.Helm.Replace = &hr.Spec.Install.Replace
+	}
+
+	if hr.Spec.Upgrade != nil {
+		step.Helm.Force = &hr.Spec.Upgrade.Force
+	}
+
+	if len(hr.Spec.ValuesFrom) > 0 {
+		i.warn("HelmRelease %q uses valuesFrom, which is not imported", hr.Name)
+	}
+
+	for _, pr := range hr.Spec.PostRenderers {
+		if pr.Kustomize != nil {
+			step.Helm.Patches = append(step.Helm.Patches, pr.Kustomize.Patches...)
+
+			for _, image := range pr.Kustomize.Images {
+				i.addImage(image.Name, image.NewName)
+			}
+		}
+	}
+
+	spec := hr.Spec.Chart.Spec
+	ref := spec.SourceRef
+
+	switch ref.Kind {
+	case sourcev1.HelmRepositoryKind:
+		ns := ref.Namespace
+		if ns == "" {
+			ns = hr.Namespace
+		}
+
+		repo, ok := i.helmRepos[ns+"/"+ref.Name]
+		if !ok {
+			i.warn("HelmRelease %q references unknown HelmRepository %s/%s", hr.Name, ns, ref.Name)
+
+			return nil, nil
+		}
+
+		step.Helm.Repo = repo.Spec.URL
+		step.Helm.Chart = spec.Chart
+		step.Helm.Version = spec.Version
+
+	case sourcev1.GitRepositoryKind, sourcev1b2.BucketKind:
+		ctx, err := i.relPath(base, spec.Chart)
+		if err != nil {
+			return nil, err
+		}
+
+		step.Helm.Context = ctx
+
+	default:
+		i.warn("HelmRelease %q uses an unsupported %s source", hr.Name, ref.Kind)
+
+		return nil, nil
+	}
+
+	return step, nil
+}
+
+// defaultTrueFlags are the optional flags that default to true, so are kept when false.
+var defaultTrueFlags = []string{"prune", "force", "replace"}
+
+// Marshal encodes the deployment, or any other config object, as YAML, omitting empty fields and false booleans, other
+// than those of flags that default to true.
+func Marshal(v any) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic any
+
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(prune(generic))
+}
+
+func prune(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, inner := range t {
+			inner = prune(inner)
+
+			if isEmpty(inner) && (inner != false || !slices.Contains(defaultTrueFlags, k)) {
+				delete(t, k)
+
+				continue
+			}
+
+			t[k] = inner
+		}
+
+		return t
+	case []any:
+		for i, inner := range t {
+			t[i] = prune(inner)
+		}
+
+		return t
+	default:
+		return v
+	}
+}
+
+func isEmpty(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return t == ""
+	case bool:
+		return !t
+	case map[string]any:
+		return len(t) == 0
+	case []any:
+		return len(t) == 0
+	default:
+		return false
+	}
+}
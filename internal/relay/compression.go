@@ -0,0 +1,113 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+const (
+	CompressionNone   = "none"
+	CompressionSnappy = "snappy"
+	CompressionZstd   = "zstd"
+)
+
+// maxDecodedSize bounds decompressed messages, which are never larger than a single data chunk plus framing.
+const maxDecodedSize = 4 * bufferSize
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxDecodedSize))
+)
+
+// The compressors are registered with gRPC, which advertises them to the other end and uses the compressor of a
+// request for its responses.
+func init() {
+	encoding.RegisterCompressor(&blockCompressor{
+		name:   CompressionSnappy,
+		encode: func(src []byte) []byte { return snappy.Encode(nil, src) },
+		decode: func(src []byte) ([]byte, error) {
+			n, err := snappy.DecodedLen(src)
+			if err != nil {
+				return nil, err
+			}
+
+			if n > maxDecodedSize {
+				return nil, fmt.Errorf("%w: decoded message too large", ErrBadRequest)
+			}
+
+			return snappy.Decode(nil, src)
+		},
+	})
+
+	encoding.RegisterCompressor(&blockCompressor{
+		name:   CompressionZstd,
+		encode: func(src []byte) []byte { return zstdEncoder.EncodeAll(src, nil) },
+		decode: func(src []byte) ([]byte, error) { return zstdDecoder.DecodeAll(src, nil) },
+	})
+}
+
+// compressionOptions returns the call options relaying with the named compression. Relayed data is compressed in
+// both directions.
+func compressionOptions(compression string) []grpc.CallOption {
+	if compression == "" || compression == CompressionNone {
+		return nil
+	}
+
+	return []grpc.CallOption{grpc.UseCompressor(compression)}
+}
+
+// blockCompressor compresses each message as a single block. Messages are at most one data chunk, so buffering them
+// is cheap, and block formats avoid the overhead of streaming frames.
+type blockCompressor struct {
+	name   string
+	encode func(src []byte) []byte
+	decode func(src []byte) ([]byte, error)
+}
+
+func (b *blockCompressor) Name() string {
+	return b.name
+}
+
+func (b *blockCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return &blockWriter{w: w, encode: b.encode}, nil
+}
+
+func (b *blockCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	src, err := io.ReadAll(io.LimitReader(r, maxDecodedSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(src) > maxDecodedSize {
+		return nil, fmt.Errorf("%w: compressed message too large", ErrBadRequest)
+	}
+
+	decoded, err := b.decode(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+
+	return bytes.NewReader(decoded), nil
+}
+
+type blockWriter struct {
+	w      io.Writer
+	encode func(src []byte) []byte
+	buf    bytes.Buffer
+}
+
+func (b *blockWriter) Write(p []byte) (int, error) {
+	return b.buf.Write(p)
+}
+
+func (b *blockWriter) Close() error {
+	_, err := b.w.Write(b.encode(b.buf.Bytes()))
+
+	return err
+}
@@ -0,0 +1,181 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+var errDeadlineUnsupported = errors.New("deadlines are not supported by relayed connections")
+
+// relayConn is a connection tunneled through a relay stream, for use by in-process clients such as the HTTP proxy.
+type relayConn struct {
+	stream grpc.BidiStreamingClient[RelayRequest, RelayResponse]
+	cancel func()
+	remote string
+
+	readMu sync.Mutex
+	buf    []byte
+	eof    bool
+
+	writeMu sync.Mutex
+
+	closeOnce sync.Once
+}
+
+// dialRelay opens a relayed TCP connection to the address within the cluster.
+func (c *Client) dialRelay(ctx context.Context, remote string) (net.Conn, error) {
+	// The stream outlives the dial, so it is only bound to the client context.
+	streamCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	stream, err := c.relayClient.Relay(streamCtx)
+	if err != nil {
+		cancel()
+
+		return nil, fmt.Errorf("failed to relay: %w", err)
+	}
+
+	if err := stream.Send(&RelayRequest{
+		Message: &RelayRequest_Start{
+			Start: &RelayRequestStart{
+				Network: RelayNetwork_TCP,
+				Address: remote,
+			},
+		},
+	}); err != nil {
+		cancel()
+
+		return nil, fmt.Errorf("failed to send start: %w", err)
+	}
+
+	return &relayConn{
+		stream: stream,
+		cancel: cancel,
+		remote: remote,
+	}, nil
+}
+
+func (r *relayConn) Read(p []byte) (int, error) {
+	r.readMu.Lock()
+	defer r.readMu.Unlock()
+
+	for len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+
+		resp, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+
+		switch m := resp.GetMessage().(type) {
+		case *RelayResponse_Data:
+			r.buf = m.Data.Data
+		case *RelayResponse_Close:
+			// The server sends nothing further once its write side is closed.
+			if m.Close != RelayClose_CLOSE_READ {
+				r.eof = true
+			}
+		default:
+			return 0, fmt.Errorf("%w: unexpected message type", ErrBadRequest)
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+func (r *relayConn) Write(p []byte) (int, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	written := 0
+
+	for len(p) > 0 {
+		chunk := p[:min(len(p), bufferSize)]
+
+		if err := r.stream.Send(&RelayRequest{
+			Message: &RelayRequest_Data{
+				Data: &RelayData{
+					Data: chunk,
+				},
+			},
+		}); err != nil {
+			return written, err
+		}
+
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+
+	return written, nil
+}
+
+// CloseWrite half-closes the connection, as for a TCP connection.
+func (r *relayConn) CloseWrite() error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	return r.stream.Send(&RelayRequest{
+		Message: &RelayRequest_Close{
+			Close: RelayClose_CLOSE_WRITE,
+		},
+	})
+}
+
+func (r *relayConn) Close() error {
+	r.closeOnce.Do(func() {
+		r.writeMu.Lock()
+
+		_ = r.stream.Send(&RelayRequest{
+			Message: &RelayRequest_Close{
+				Close: RelayClose_CLOSE_FULL,
+			},
+		})
+
+		r.writeMu.Unlock()
+
+		r.cancel()
+	})
+
+	return nil
+}
+
+func (r *relayConn) LocalAddr() net.Addr {
+	return relayAddr("relay")
+}
+
+func (r *relayConn) RemoteAddr() net.Addr {
+	return relayAddr(r.remote)
+}
+
+func (r *relayConn) SetDeadline(time.Time) error {
+	return errDeadlineUnsupported
+}
+
+func (r *relayConn) SetReadDeadline(time.Time) error {
+	return errDeadlineUnsupported
+}
+
+func (r *relayConn) SetWriteDeadline(time.Time) error {
+	return errDeadlineUnsupported
+}
+
+type relayAddr string
+
+func (a relayAddr) Network() string {
+	return "relay"
+}
+
+func (a relayAddr) String() string {
+	return string(a)
+}
@@ -0,0 +1,306 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	DefaultDNSAddress = "127.0.0.1:5353"
+	DefaultDNSDomain  = "localflux"
+	clusterZone       = "svc.cluster.local."
+	// dnsTTL is kept short, as addresses are only stable for the lifetime of the relay client.
+	dnsTTL = 5
+)
+
+var ErrResolverUnsupported = errors.New("registering a resolver is not supported on this system")
+
+// firstLoopback is the first address handed out to forwards. 127.0.0.1 is left for the forwards on their local port.
+var firstLoopback = netip.MustParseAddr("127.42.0.1")
+
+type DNSOptions struct {
+	// Address is the address the server listens on.
+	Address string
+	// Domain is served alongside cluster.local.
+	Domain string
+	// RegisterResolver registers the server as the system resolver for its zones while it runs.
+	RegisterResolver bool
+}
+
+// dnsServer answers A queries for the names of forwards. It is authoritative for the cluster and development zones,
+// and refuses all other queries.
+type dnsServer struct {
+	logger  *slog.Logger
+	domain  string
+	mu      sync.Mutex
+	records map[string]netip.Addr
+	addrs   map[string]netip.Addr
+	next    netip.Addr
+}
+
+func newDNSServer(logger *slog.Logger, domain string) *dnsServer {
+	return &dnsServer{
+		logger:  logger,
+		domain:  strings.Trim(domain, ".") + ".",
+		records: make(map[string]netip.Addr),
+		addrs:   make(map[string]netip.Addr),
+		next:    firstLoopback,
+	}
+}
+
+// register allocates the loopback address of the forward, keeping it stable while the client runs, and adds its
+// names.
+func (d *dnsServer) register(forward *v1alpha1.PortForward) netip.Addr {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := forward.Namespace + "/" + forward.Name
+
+	addr, ok := d.addrs[key]
+	if !ok {
+		addr = d.next
+		d.next = d.next.Next()
+		d.addrs[key] = addr
+	}
+
+	name := strings.ToLower(forward.Name + "." + forward.Namespace + ".")
+
+	d.records[name+d.domain] = addr
+
+	if strings.EqualFold(forward.Kind, "service") {
+		d.records[name+clusterZone] = addr
+	}
+
+	return addr
+}
+
+func (d *dnsServer) lookup(name string) (netip.Addr, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	addr, ok := d.records[strings.ToLower(name)]
+
+	return addr, ok
+}
+
+func (d *dnsServer) zones() []string {
+	return []string{"cluster.local", strings.TrimSuffix(d.domain, ".")}
+}
+
+func (d *dnsServer) authoritative(name string) bool {
+	name = strings.ToLower(name)
+
+	for _, zone := range []string{clusterZone, d.domain} {
+		if name == zone || strings.HasSuffix(name, "."+zone) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serve answers queries on the connection until the context is cancelled.
+func (d *dnsServer) serve(ctx context.Context, conn net.PacketConn) error {
+	defer conn.Close()
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	d.logger.Info("Serving DNS", "addr", conn.LocalAddr(), "zones", d.zones())
+
+	buffer := make([]byte, 512)
+
+	for {
+		read, peer, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("could not read: %w", err)
+		}
+
+		resp, err := d.answer(buffer[:read])
+		if err != nil {
+			d.logger.Debug("Dropping DNS query", "peer", peer, "err", err)
+
+			continue
+		}
+
+		if _, err := conn.WriteTo(resp, peer); err != nil {
+			d.logger.Debug("Failed to write DNS response", "peer", peer, "err", err)
+		}
+	}
+}
+
+func (d *dnsServer) answer(query []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, err
+	}
+
+	question, err := parser.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	respHeader := dnsmessage.Header{
+		ID:               header.ID,
+		Response:         true,
+		OpCode:           header.OpCode,
+		RecursionDesired: header.RecursionDesired,
+	}
+
+	name := question.Name.String()
+
+	addr, found := d.lookup(name)
+
+	switch {
+	case !d.authoritative(name):
+		respHeader.RCode = dnsmessage.RCodeRefused
+	case !found:
+		respHeader.Authoritative = true
+		respHeader.RCode = dnsmessage.RCodeNameError
+	default:
+		respHeader.Authoritative = true
+	}
+
+	builder := dnsmessage.NewBuilder(nil, respHeader)
+	builder.EnableCompression()
+
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+
+	if err := builder.Question(question); err != nil {
+		return nil, err
+	}
+
+	// Names only have A records, other types are answered without records.
+	if found && question.Type == dnsmessage.TypeA && question.Class == dnsmessage.ClassINET {
+		if err := builder.StartAnswers(); err != nil {
+			return nil, err
+		}
+
+		if err := builder.AResource(
+			dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: dnsTTL},
+			dnsmessage.AResource{A: addr.As4()},
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	return builder.Finish()
+}
+
+// startDNS starts the DNS server, registering it as the system resolver if requested. The returned function reverts
+// the registration.
+func (c *Client) startDNS(ctx context.Context, cb Callbacks) (func(), error) {
+	c.dns = newDNSServer(c.logger, c.dnsOpts.Domain)
+
+	conn, err := net.ListenPacket("udp", c.dnsOpts.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for dns: %w", err)
+	}
+
+	go func() {
+		if err := c.dns.serve(ctx, conn); err != nil {
+			c.logger.Warn("DNS server failed", "err", err)
+
+			cb.Warn(fmt.Sprintf("DNS server failed: %v", err))
+		}
+	}()
+
+	cb.Info(fmt.Sprintf("Serving DNS for %s on %s", strings.Join(c.dns.zones(), ", "), c.dnsOpts.Address))
+
+	if !c.dnsOpts.RegisterResolver {
+		return func() {}, nil
+	}
+
+	revert, err := registerResolver(ctx, c.dnsOpts.Address, c.dns.zones())
+	if err != nil {
+		c.logger.Warn("Failed to register resolver", "err", err)
+
+		cb.Warn(fmt.Sprintf("Failed to register resolver: %v", err))
+
+		return func() {}, nil
+	}
+
+	return revert, nil
+}
+
+// registerResolver points the system resolver at the server for its zones. The returned function reverts this.
+func registerResolver(ctx context.Context, addr string, zones []string) (func(), error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dns address: %w", err)
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		var written []string
+
+		revert := func() {
+			for _, path := range written {
+				_ = os.Remove(path)
+			}
+		}
+
+		for _, zone := range zones {
+			path := filepath.Join("/etc/resolver", zone)
+
+			if err := os.WriteFile(path, []byte("nameserver "+host+"\nport "+port+"\n"), 0o644); err != nil {
+				revert()
+
+				return nil, fmt.Errorf("failed to write resolver: %w", err)
+			}
+
+			written = append(written, path)
+		}
+
+		return revert, nil
+	case "linux":
+		if _, err := exec.LookPath("resolvectl"); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrResolverUnsupported, err)
+		}
+
+		domains := make([]string, 0, len(zones))
+
+		for _, zone := range zones {
+			domains = append(domains, "~"+zone)
+		}
+
+		if out, err := exec.CommandContext(ctx, "resolvectl", "dns", "lo", addr).CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("resolvectl dns failed: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+
+		if out, err := exec.CommandContext(ctx, "resolvectl", append([]string{"domain", "lo"}, domains...)...).CombinedOutput(); err != nil {
+			_ = exec.Command("resolvectl", "revert", "lo").Run()
+
+			return nil, fmt.Errorf("resolvectl domain failed: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+
+		return func() {
+			_ = exec.Command("resolvectl", "revert", "lo").Run()
+		}, nil
+	default:
+		return nil, ErrResolverUnsupported
+	}
+}
@@ -0,0 +1,266 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/kubectl/pkg/polymorphichelpers"
+	ctlscheme "k8s.io/kubectl/pkg/scheme"
+)
+
+// Forward serves a single forward through the relay until the context is cancelled, for forwards that are not part
+// of any deployment. Connect must be called first.
+func (c *Client) Forward(ctx context.Context, forward *v1alpha1.PortForward, cb Callbacks) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go c.reportStats(ctx, cb)
+
+	status := newStatus(forwardName(forward), cancel, nil)
+
+	err := c.runForward(ctx, forward, status, cb)
+	if errors.Is(err, net.ErrClosed) && ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+// Reverse exposes a port on the host within the cluster until the context is cancelled, for services that are not
+// part of any deployment. The service is removed on return. Connect must be called first.
+func (c *Client) Reverse(ctx context.Context, reverse *v1alpha1.ReverseForward, cb Callbacks) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go c.reportStats(ctx, cb)
+
+	status := newStatus(reverseName(reverse), cancel, nil)
+
+	return c.runReverse(ctx, reverse, status, cb)
+}
+
+// ForwardDirect serves a single forward through API server port-forwards to the pod behind the resource, for clusters
+// without the relay deployed. Each connection opens its own port-forward, so this is slower than the relay.
+func (c *Client) ForwardDirect(
+	ctx context.Context,
+	kc *cluster.K8sClient,
+	forward *v1alpha1.PortForward,
+	cb Callbacks,
+) error {
+	c.client = kc
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go c.reportStats(ctx, cb)
+
+	local := netip.AddrPortFrom(c.bindAddress, uint16(localPort(forward)))
+
+	listeners, err := c.listenLocal(local)
+	if err != nil {
+		return err
+	}
+
+	grp, gctx := errgroup.WithContext(ctx)
+
+	for _, lis := range listeners {
+		grp.Go(func() error {
+			return c.serveDirect(gctx, lis, forward, cb)
+		})
+	}
+
+	return grp.Wait()
+}
+
+// serveDirect accepts connections to the forward until the context is cancelled.
+func (c *Client) serveDirect(
+	ctx context.Context,
+	lis *net.TCPListener,
+	forward *v1alpha1.PortForward,
+	cb Callbacks,
+) error {
+	defer lis.Close()
+
+	go func() {
+		<-ctx.Done()
+		_ = lis.Close()
+	}()
+
+	name := forwardName(forward)
+
+	for {
+		tcpConn, err := lis.AcceptTCP()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("could not accept connection: %w", err)
+		}
+
+		event := ConnectionEvent{
+			Kind:    ConnectionAccepted,
+			Forward: name,
+			ID:      c.lastConnID.Add(1),
+			Peer:    tcpConn.RemoteAddr().String(),
+		}
+
+		cb.Connection(event)
+
+		go func() {
+			start := time.Now()
+
+			stats := c.stats.open(name)
+
+			err := c.directInstance(ctx, forward, tcpConn, stats, c.newInspector(name, event.ID, cb))
+
+			event.Kind = ConnectionClosed
+			event.Sent = stats.sent.Load()
+			event.Received = stats.received.Load()
+			event.Duration = time.Since(start)
+
+			if err != nil && ctx.Err() == nil {
+				c.logger.Info("Port-forward failed", "conn", event.ID, "err", err)
+
+				event.Kind = ConnectionReset
+				event.Err = err
+			}
+
+			c.stats.close(name, stats, event.Err)
+
+			cb.Connection(event)
+		}()
+	}
+}
+
+// directInstance relays a single connection through a port-forward until both directions have been closed.
+func (c *Client) directInstance(
+	ctx context.Context,
+	forward *v1alpha1.PortForward,
+	tcpConn *net.TCPConn,
+	stats *connStats,
+	inspector *httpInspector,
+) error {
+	defer tcpConn.Close()
+	defer inspector.close()
+
+	begin := time.Now()
+
+	pod, port, err := c.forwardablePort(ctx, forward)
+	if err != nil {
+		return err
+	}
+
+	remote, err := c.client.PortForward(pod.Namespace, pod.Name, port)
+	if err != nil {
+		return fmt.Errorf("failed to port-forward to %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+
+	defer remote.Close()
+
+	stats.latency.Store(int64(time.Since(begin)))
+
+	up, down := newShapers(forward)
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = remote.Close()
+		_ = tcpConn.Close()
+	})
+	defer stop()
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	// Port-forwarded connections can not be half-closed, so the connection is closed once the local side finishes.
+	go func() {
+		defer wg.Done()
+
+		n, _ := io.Copy(remote, io.TeeReader(&shapedReader{ctx: ctx, r: tcpConn, shaper: up}, inspectFeed(inspector.sent)))
+		stats.sent.Add(n)
+
+		_ = remote.Close()
+	}()
+
+	n, err := io.Copy(tcpConn, io.TeeReader(&shapedReader{ctx: ctx, r: remote, shaper: down}, inspectFeed(inspector.received)))
+	stats.received.Add(n)
+
+	_ = tcpConn.CloseWrite()
+
+	wg.Wait()
+
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("could not relay: %w", err)
+	}
+
+	return nil
+}
+
+// forwardablePort returns a running pod behind the resource, and the container port the forwarded port maps to.
+// Service ports are mapped to the target port of the service.
+func (c *Client) forwardablePort(ctx context.Context, forward *v1alpha1.PortForward) (*corev1.Pod, int, error) {
+	builder := resource.NewBuilder(c.client).
+		WithScheme(ctlscheme.Scheme, ctlscheme.Scheme.PrioritizedVersionsAllGroups()...).
+		ContinueOnError().
+		NamespaceParam(forward.Namespace).
+		DefaultNamespace().
+		ResourceNames("pods", forward.Kind+"/"+forward.Name)
+
+	obj, err := builder.Do().Object()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find resource: %w", err)
+	}
+
+	pod, err := polymorphichelpers.AttachablePodForObjectFn(c.client, obj, time.Second*10)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find attachable pod: %w", err)
+	}
+
+	if !strings.EqualFold(forward.Kind, "service") {
+		return pod, forward.Port, nil
+	}
+
+	service, err := c.client.ClientSet().CoreV1().Services(forward.Namespace).Get(ctx, forward.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	for _, port := range service.Spec.Ports {
+		if int(port.Port) != forward.Port {
+			continue
+		}
+
+		switch {
+		case port.TargetPort.Type == intstr.Int && port.TargetPort.IntVal != 0:
+			return pod, int(port.TargetPort.IntVal), nil
+		case port.TargetPort.Type == intstr.String && port.TargetPort.StrVal != "":
+			for _, container := range pod.Spec.Containers {
+				for _, cp := range container.Ports {
+					if cp.Name == port.TargetPort.StrVal {
+						return pod, int(cp.ContainerPort), nil
+					}
+				}
+			}
+
+			return nil, 0, fmt.Errorf("pod %s has no port named %q", pod.Name, port.TargetPort.StrVal)
+		default:
+			return pod, forward.Port, nil
+		}
+	}
+
+	return nil, 0, fmt.Errorf("service %s/%s has no port %d", forward.Namespace, forward.Name, forward.Port)
+}
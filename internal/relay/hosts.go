@@ -0,0 +1,171 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	DefaultHostsFile    = "/etc/hosts"
+	DefaultHostsAddress = "127.0.0.1"
+	hostsBegin          = "# BEGIN localflux"
+	hostsEnd            = "# END localflux"
+)
+
+var ErrMalformedHosts = errors.New("malformed hosts file")
+
+type HostsOptions struct {
+	// File is the hosts file to maintain.
+	File string
+	// Address the hostnames resolve to.
+	Address string
+}
+
+// EnableHosts maintains hosts file entries for the Ingress hosts of deployments once the client runs.
+func (c *Client) EnableHosts(opts HostsOptions) {
+	if opts.File == "" {
+		opts.File = DefaultHostsFile
+	}
+
+	if opts.Address == "" {
+		opts.Address = DefaultHostsAddress
+	}
+
+	c.hostsOpts = &opts
+}
+
+// reconcileHosts rewrites the managed block of the hosts file when the Ingress hosts of the deployments change.
+func (c *Client) reconcileHosts(ctx context.Context, deployments []v1alpha1.Deployment, cb Callbacks) error {
+	hosts, err := c.ingressHosts(ctx, deployments)
+	if err != nil {
+		return err
+	}
+
+	if c.hostsWritten && slices.Equal(hosts, c.hosts) {
+		return nil
+	}
+
+	if err := writeHostsBlock(c.hostsOpts.File, c.hostsOpts.Address, hosts); err != nil {
+		return err
+	}
+
+	c.hosts = hosts
+	c.hostsWritten = true
+
+	cb.Info(fmt.Sprintf("Updated %s with %d hosts", c.hostsOpts.File, len(hosts)))
+
+	return nil
+}
+
+// ingressHosts returns the sorted hostnames of the Ingress resources applied by the Flux objects of the deployments.
+func (c *Client) ingressHosts(ctx context.Context, deployments []v1alpha1.Deployment) ([]string, error) {
+	var kustomizeNames, helmNames []string
+
+	for _, deployment := range deployments {
+		kustomizeNames = append(kustomizeNames, deployment.KustomizeNames...)
+		helmNames = append(helmNames, deployment.HelmNames...)
+	}
+
+	ingresses, err := c.client.ClientSet().NetworkingV1().Ingresses("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+
+	var hosts []string
+
+	for _, ingress := range ingresses.Items {
+		if !ownedByFlux(ingress, "kustomize.toolkit.fluxcd.io", kustomizeNames) &&
+			!ownedByFlux(ingress, "helm.toolkit.fluxcd.io", helmNames) {
+			continue
+		}
+
+		for _, rule := range ingress.Spec.Rules {
+			if rule.Host == "" || strings.HasPrefix(rule.Host, "*") || slices.Contains(hosts, rule.Host) {
+				continue
+			}
+
+			hosts = append(hosts, rule.Host)
+		}
+	}
+
+	slices.Sort(hosts)
+
+	return hosts, nil
+}
+
+// ownedByFlux reports whether the Flux object that applied the ingress, as recorded in its labels, is one of the
+// named objects in the localflux namespace.
+func ownedByFlux(ingress networkingv1.Ingress, group string, names []string) bool {
+	labels := ingress.GetLabels()
+
+	return labels[group+"/namespace"] == cluster.LFNamespace && slices.Contains(names, labels[group+"/name"])
+}
+
+// writeHostsBlock replaces the managed block of the hosts file, removing it when there are no hosts. The file is
+// rewritten in place, so that it still works when bind mounted into the relay container. A block without an end
+// marker is left untouched, as the lines after it can not be told apart from those of the block.
+func writeHostsBlock(path string, address string, hosts []string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read hosts file: %w", err)
+	}
+
+	var out bytes.Buffer
+
+	inBlock := false
+
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		switch strings.TrimSpace(line) {
+		case hostsBegin:
+			inBlock = true
+
+			continue
+		case hostsEnd:
+			inBlock = false
+
+			continue
+		}
+
+		if !inBlock && line != "" {
+			out.WriteString(line)
+		}
+	}
+
+	if inBlock {
+		return fmt.Errorf("%w: %s has %q without a matching %q", ErrMalformedHosts, path, hostsBegin, hostsEnd)
+	}
+
+	if len(hosts) > 0 {
+		if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+			out.WriteString("\n")
+		}
+
+		out.WriteString(hostsBegin + "\n")
+
+		for _, host := range hosts {
+			out.WriteString(address + " " + host + "\n")
+		}
+
+		out.WriteString(hostsEnd + "\n")
+	}
+
+	if bytes.Equal(out.Bytes(), data) {
+		return nil
+	}
+
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write hosts file: %w", err)
+	}
+
+	return nil
+}
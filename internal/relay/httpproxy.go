@@ -0,0 +1,164 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	DefaultHTTPProxyAddress = "127.0.0.1:8080"
+	// DefaultHTTPProxyDomain is resolved to loopback by browsers without any configuration.
+	DefaultHTTPProxyDomain = "localhost"
+)
+
+var ErrNoRoute = errors.New("no service for host")
+
+type HTTPProxyOptions struct {
+	// Address is the address the proxy listens on.
+	Address string
+	// Domain is the domain of hosts, alongside svc.cluster.local.
+	Domain string
+}
+
+// EnableHTTPProxy serves an HTTP proxy routing by host once the client runs.
+func (c *Client) EnableHTTPProxy(opts HTTPProxyOptions) {
+	if opts.Address == "" {
+		opts.Address = DefaultHTTPProxyAddress
+	}
+
+	if opts.Domain == "" {
+		opts.Domain = DefaultHTTPProxyDomain
+	}
+
+	c.httpProxyOpts = &opts
+}
+
+// startHTTPProxy serves requests for "<service>.<namespace>.<domain>" and "<service>.<namespace>.svc.cluster.local"
+// from the service through the relay. Upgraded connections, such as websockets, are relayed as is.
+func (c *Client) startHTTPProxy(ctx context.Context, cb Callbacks) error {
+	lis, err := net.Listen("tcp", c.httpProxyOpts.Address)
+	if err != nil {
+		return fmt.Errorf("failed to listen for http proxy: %w", err)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(&url.URL{Scheme: "http", Host: r.In.Host})
+			r.Out.Host = r.In.Host
+			r.SetXForwarded()
+		},
+		Transport: &http.Transport{
+			Proxy: nil,
+			DialContext: func(ctx context.Context, _ string, addr string) (net.Conn, error) {
+				host, _, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+
+				remote, err := c.routeHost(ctx, host)
+				if err != nil {
+					return nil, err
+				}
+
+				return c.dialRelay(ctx, remote)
+			},
+			DisableCompression: true,
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			c.logger.Info("HTTP proxy request failed", "host", r.Host, "err", err)
+
+			status := http.StatusBadGateway
+			if errors.Is(err, ErrNoRoute) {
+				status = http.StatusNotFound
+			}
+
+			http.Error(w, err.Error(), status)
+		},
+	}
+
+	srv := &http.Server{Handler: proxy}
+
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.logger.Warn("HTTP proxy failed", "err", err)
+
+			cb.Warn(fmt.Sprintf("HTTP proxy failed: %v", err))
+		}
+	}()
+
+	cb.Info(fmt.Sprintf(
+		"Serving HTTP proxy on %s for <service>.<namespace>.%s",
+		c.httpProxyOpts.Address,
+		c.httpProxyOpts.Domain,
+	))
+
+	return nil
+}
+
+// routeHost resolves the host to the cluster address of the service it names. The port named "http" is used, or
+// otherwise the first TCP port of the service.
+func (c *Client) routeHost(ctx context.Context, host string) (string, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	var rest string
+
+	for _, domain := range []string{"svc.cluster.local", c.httpProxyOpts.Domain} {
+		if v, ok := strings.CutSuffix(host, "."+domain); ok {
+			rest = v
+
+			break
+		}
+	}
+
+	name, namespace, ok := strings.Cut(rest, ".")
+	if !ok || name == "" || namespace == "" || strings.Contains(namespace, ".") {
+		return "", fmt.Errorf("%w: %q", ErrNoRoute, host)
+	}
+
+	service, err := c.client.ClientSet().CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("%w: %q", ErrNoRoute, host)
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get service: %w", err)
+	}
+
+	var port *corev1.ServicePort
+
+	for i, p := range service.Spec.Ports {
+		if p.Protocol != corev1.ProtocolTCP && p.Protocol != "" {
+			continue
+		}
+
+		if p.Name == "http" {
+			port = &service.Spec.Ports[i]
+
+			break
+		}
+
+		if port == nil {
+			port = &service.Spec.Ports[i]
+		}
+	}
+
+	if port == nil {
+		return "", fmt.Errorf("%w: service %s/%s has no tcp ports", ErrNoRoute, namespace, name)
+	}
+
+	return net.JoinHostPort(service.Spec.ClusterIP, strconv.Itoa(int(port.Port))), nil
+}
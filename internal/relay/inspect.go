@@ -0,0 +1,316 @@
+package relay
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+var errInspectStopped = errors.New("inspection stopped")
+
+const (
+	// maxPendingExchanges bounds the requests awaiting a response on a single connection.
+	maxPendingExchanges = 64
+	// maxQueuedChunks bounds the data of each direction awaiting parsing. Inspection stops once it is exceeded, rather
+	// than slowing down the connection.
+	maxQueuedChunks = 256
+)
+
+// InspectOptions configures the inspection of HTTP/1.1 traffic on forwards.
+type InspectOptions struct {
+	// BodyDir is the directory request and response bodies are written to, or empty to discard them.
+	BodyDir string
+}
+
+// EnableInspect logs the HTTP requests relayed over forwards once the client runs.
+func (c *Client) EnableInspect(opts InspectOptions) {
+	c.inspectOpts = &opts
+}
+
+// newInspector returns an inspector for a connection of the forward, or nil when inspection is disabled.
+func (c *Client) newInspector(forward string, conn uint64, cb Callbacks) *httpInspector {
+	if c.inspectOpts == nil {
+		return nil
+	}
+
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+
+	i := &httpInspector{
+		logger:  c.logger,
+		cb:      cb,
+		opts:    c.inspectOpts,
+		forward: forward,
+		conn:    conn,
+		reqR:    reqR,
+		respR:   respR,
+		reqCh:   make(chan []byte, maxQueuedChunks),
+		respCh:  make(chan []byte, maxQueuedChunks),
+		pending: make(chan *exchange, maxPendingExchanges),
+		done:    make(chan struct{}),
+	}
+
+	go pump(i.reqCh, reqW)
+	go pump(i.respCh, respW)
+	go i.readRequests()
+	go i.readResponses()
+
+	return i
+}
+
+// httpInspector parses the traffic of a single connection as HTTP/1.1, reporting each exchange. Inspection stops
+// once the traffic is not HTTP or the connection is upgraded, leaving the relayed data untouched.
+type httpInspector struct {
+	logger  *slog.Logger
+	cb      Callbacks
+	opts    *InspectOptions
+	forward string
+	conn    uint64
+	reqR    *io.PipeReader
+	respR   *io.PipeReader
+	reqCh   chan []byte
+	respCh  chan []byte
+	pending chan *exchange
+	done    chan struct{}
+	once    sync.Once
+}
+
+// exchange is a request awaiting its response.
+type exchange struct {
+	seq    int
+	req    *http.Request
+	start  time.Time
+	target string
+}
+
+// sent feeds data relayed into the cluster.
+func (i *httpInspector) sent(p []byte) {
+	if i != nil {
+		i.feed(i.reqCh, p)
+	}
+}
+
+// received feeds data relayed out of the cluster.
+func (i *httpInspector) received(p []byte) {
+	if i != nil {
+		i.feed(i.respCh, p)
+	}
+}
+
+// close ends inspection once the connection is closed, letting the exchanges in flight complete. It must not be
+// called concurrently with the feeds.
+func (i *httpInspector) close() {
+	if i == nil {
+		return
+	}
+
+	close(i.reqCh)
+	close(i.respCh)
+}
+
+// inspectFeed adapts a feed of the inspector to a writer.
+type inspectFeed func(p []byte)
+
+func (f inspectFeed) Write(p []byte) (int, error) {
+	f(p)
+
+	return len(p), nil
+}
+
+// feed queues a copy of the data for parsing, never blocking the connection.
+func (i *httpInspector) feed(ch chan []byte, p []byte) {
+	select {
+	case <-i.done:
+		return
+	default:
+	}
+
+	select {
+	case ch <- slices.Clone(p):
+	default:
+		i.stop()
+	}
+}
+
+// pump writes the queued data to the parser. Writes fail once inspection has stopped, which is ignored as the data
+// has already been relayed.
+func pump(ch chan []byte, w *io.PipeWriter) {
+	for p := range ch {
+		_, _ = w.Write(p)
+	}
+
+	_ = w.Close()
+}
+
+// stop ends inspection, unblocking any feeds.
+func (i *httpInspector) stop() {
+	i.once.Do(func() {
+		close(i.done)
+
+		_ = i.reqR.CloseWithError(errInspectStopped)
+		_ = i.respR.CloseWithError(errInspectStopped)
+	})
+}
+
+func (i *httpInspector) readRequests() {
+	br := bufio.NewReader(i.reqR)
+
+	for seq := 1; ; seq++ {
+		req, err := http.ReadRequest(br)
+		if errors.Is(err, io.EOF) {
+			close(i.pending)
+
+			return
+		} else if err != nil {
+			i.stop()
+
+			return
+		}
+
+		ex := &exchange{
+			seq:    seq,
+			req:    req,
+			start:  time.Now(),
+			target: req.RequestURI,
+		}
+
+		select {
+		case i.pending <- ex:
+		case <-i.done:
+			return
+		}
+
+		if err := i.drain(req.Body, ex.seq, "request"); err != nil {
+			i.stop()
+
+			return
+		}
+
+		if req.Method == http.MethodConnect {
+			i.stop()
+
+			return
+		}
+	}
+}
+
+func (i *httpInspector) readResponses() {
+	defer i.stop()
+
+	br := bufio.NewReader(i.respR)
+
+	for {
+		var ex *exchange
+
+		select {
+		case next, ok := <-i.pending:
+			if !ok {
+				return
+			}
+
+			ex = next
+		case <-i.done:
+			return
+		}
+
+		resp, err := http.ReadResponse(br, ex.req)
+		if err != nil {
+			return
+		}
+
+		// Informational responses precede the final response to the same request.
+		for resp.StatusCode >= 100 && resp.StatusCode < 200 && resp.StatusCode != http.StatusSwitchingProtocols {
+			if resp, err = http.ReadResponse(br, ex.req); err != nil {
+				return
+			}
+		}
+
+		if err := i.drain(resp.Body, ex.seq, "response"); err != nil {
+			return
+		}
+
+		i.report(ex, resp)
+
+		if resp.StatusCode == http.StatusSwitchingProtocols {
+			return
+		}
+	}
+}
+
+func (i *httpInspector) report(ex *exchange, resp *http.Response) {
+	duration := time.Since(ex.start)
+
+	i.logger.Info(
+		"HTTP exchange",
+		"forward", i.forward,
+		"conn", i.conn,
+		"method", ex.req.Method,
+		"target", ex.target,
+		"status", resp.StatusCode,
+		"duration", duration,
+	)
+
+	i.cb.Info(fmt.Sprintf(
+		"%s: %s %s %d %s",
+		i.forward,
+		ex.req.Method,
+		ex.target,
+		resp.StatusCode,
+		duration.Round(time.Millisecond),
+	))
+}
+
+// drain consumes a body, writing it to the body directory when set. Files are only created for non-empty bodies.
+func (i *httpInspector) drain(body io.ReadCloser, seq int, kind string) error {
+	defer body.Close()
+
+	var w io.Writer = io.Discard
+
+	if i.opts.BodyDir != "" {
+		f := &lazyFile{path: filepath.Join(i.opts.BodyDir, fmt.Sprintf("%d-%d-%s.body", i.conn, seq, kind))}
+		defer f.Close()
+
+		w = f
+	}
+
+	if _, err := io.Copy(w, body); err != nil {
+		return fmt.Errorf("failed to read %s body: %w", kind, err)
+	}
+
+	return nil
+}
+
+// lazyFile creates the file on the first write.
+type lazyFile struct {
+	path string
+	f    *os.File
+	err  error
+}
+
+func (l *lazyFile) Write(p []byte) (int, error) {
+	if l.f == nil && l.err == nil {
+		l.f, l.err = os.Create(l.path)
+	}
+
+	if l.err != nil {
+		return 0, l.err
+	}
+
+	return l.f.Write(p)
+}
+
+func (l *lazyFile) Close() error {
+	if l.f == nil {
+		return nil
+	}
+
+	return l.f.Close()
+}
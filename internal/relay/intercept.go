@@ -0,0 +1,424 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/wait"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var ErrNoInterceptedService = errors.New("no service routes the port to the workload")
+
+// interceptReplicasAnnotation records the replicas of an intercepted workload, so that an interrupted intercept can
+// still be restored by the next.
+const interceptReplicasAnnotation = "localflux.io/intercept-replicas"
+
+// InterceptOptions describes the workload port whose traffic is redirected to the host.
+type InterceptOptions struct {
+	// Kind is "deployment" or "statefulset".
+	Kind      string
+	Namespace string
+	Name      string
+	// Port is the container port of the workload.
+	Port      int
+	LocalHost string
+	LocalPort int
+}
+
+// interceptedService is a service with ports that route to the intercepted port.
+type interceptedService struct {
+	name  string
+	ports []string
+}
+
+// Intercept redirects the traffic services send to a port of the workload to a local address until the context is
+// cancelled. The workload is scaled down while intercepted, and the traffic is tunneled through the relay by
+// endpoint slices pointing at it. Other ports of the services have no endpoints while intercepted. Connect must be
+// called first.
+//
+// The scale and endpoint slices are reasserted periodically, as Flux may revert the scale of the workload.
+func (c *Client) Intercept(ctx context.Context, opts InterceptOptions, cb Callbacks) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go c.reportStats(ctx, cb)
+
+	workload, err := c.interceptedWorkload(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	services, err := c.interceptedServices(ctx, opts, &workload.Spec.Template)
+	if err != nil {
+		return err
+	}
+
+	stream, addr, err := c.listenReverse(ctx)
+	if err != nil {
+		return err
+	}
+
+	restoreCtx := context.WithoutCancel(ctx)
+
+	defer func() {
+		if err := c.deleteInterceptSlices(restoreCtx, opts.Namespace, services); err != nil {
+			c.logger.Warn("Failed to remove intercept endpoint slices", "err", err)
+
+			cb.Warn(fmt.Sprintf("Failed to remove intercept endpoint slices: %v", err))
+		}
+	}()
+
+	if err := c.applyInterceptSlices(ctx, opts.Namespace, services, addr); err != nil {
+		return err
+	}
+
+	replicas, err := c.scaleDown(ctx, opts, workload)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := c.restoreScale(restoreCtx, opts, replicas); err != nil {
+			c.logger.Warn("Failed to restore intercepted workload", "err", err)
+
+			cb.Error(fmt.Sprintf("Failed to restore %s/%s to %d replicas: %v", opts.Kind, opts.Name, replicas, err))
+		}
+	}()
+
+	for _, service := range services {
+		cb.Info(fmt.Sprintf("Intercepting service %s/%s", opts.Namespace, service.name))
+	}
+
+	go c.reassertIntercept(ctx, opts, services, addr, cb)
+
+	local := net.JoinHostPort(opts.LocalHost, strconv.Itoa(opts.LocalPort))
+	name := "intercept/" + opts.Namespace + "/" + opts.Name + ":" + strconv.Itoa(opts.Port)
+
+	err = c.acceptReverse(ctx, stream, local, name, cb)
+	if err == nil && ctx.Err() == nil {
+		return fmt.Errorf("relay stopped listening")
+	}
+
+	return err
+}
+
+func (c *Client) reassertIntercept(
+	ctx context.Context,
+	opts InterceptOptions,
+	services []interceptedService,
+	addr netip.AddrPort,
+	cb Callbacks,
+) {
+	first := true
+
+	_ = wait.Poll(ctx, wait.Interval(reconcileInterval), func(ctx context.Context) (wait.Status, error) {
+		// The intercept was just applied, so it is first reasserted after an interval.
+		if first {
+			first = false
+
+			return wait.Pending, nil
+		}
+
+		err := c.applyInterceptSlices(ctx, opts.Namespace, services, addr)
+		if err == nil {
+			err = c.setScale(ctx, opts, 0)
+		}
+
+		if err != nil && ctx.Err() == nil {
+			c.logger.Warn("Failed to reassert intercept", "err", err)
+
+			cb.Warn(fmt.Sprintf("Failed to reassert intercept: %v", err))
+		}
+
+		return wait.Pending, nil
+	})
+}
+
+// workload is the part of a deployment or statefulset used by intercepts.
+type workload struct {
+	metav1.ObjectMeta
+	Spec struct {
+		Replicas *int32
+		Template corev1.PodTemplateSpec
+	}
+}
+
+func (c *Client) interceptedWorkload(ctx context.Context, opts InterceptOptions) (*workload, error) {
+	apps := c.client.ClientSet().AppsV1()
+
+	var result workload
+
+	switch strings.ToLower(opts.Kind) {
+	case "deployment":
+		deployment, err := apps.Deployments(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deployment: %w", err)
+		}
+
+		result.ObjectMeta = deployment.ObjectMeta
+		result.Spec.Replicas = deployment.Spec.Replicas
+		result.Spec.Template = deployment.Spec.Template
+	case "statefulset":
+		statefulSet, err := apps.StatefulSets(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get statefulset: %w", err)
+		}
+
+		result.ObjectMeta = statefulSet.ObjectMeta
+		result.Spec.Replicas = statefulSet.Spec.Replicas
+		result.Spec.Template = statefulSet.Spec.Template
+	default:
+		return nil, fmt.Errorf("unsupported kind %q: expected deployment or statefulset", opts.Kind)
+	}
+
+	return &result, nil
+}
+
+// interceptedServices returns the services selecting the workload with ports that target the intercepted port.
+func (c *Client) interceptedServices(
+	ctx context.Context,
+	opts InterceptOptions,
+	template *corev1.PodTemplateSpec,
+) ([]interceptedService, error) {
+	services, err := c.client.ClientSet().CoreV1().Services(opts.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	var result []interceptedService
+
+	for _, service := range services.Items {
+		intercepted := interceptedService{
+			name: service.Name,
+		}
+
+		if len(service.Spec.Selector) == 0 {
+			continue
+		}
+
+		if !labels.SelectorFromSet(service.Spec.Selector).Matches(labels.Set(template.Labels)) {
+			continue
+		}
+
+		for _, port := range service.Spec.Ports {
+			if port.Protocol != corev1.ProtocolTCP && port.Protocol != "" {
+				continue
+			}
+
+			if targetPort(port, template) == opts.Port {
+				intercepted.ports = append(intercepted.ports, port.Name)
+			}
+		}
+
+		if len(intercepted.ports) > 0 {
+			result = append(result, intercepted)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%w: %s/%s port %d", ErrNoInterceptedService, opts.Namespace, opts.Name, opts.Port)
+	}
+
+	return result, nil
+}
+
+// targetPort resolves the container port a service port targets.
+func targetPort(port corev1.ServicePort, template *corev1.PodTemplateSpec) int {
+	switch {
+	case port.TargetPort.Type == intstr.String && port.TargetPort.StrVal != "":
+		for _, container := range template.Spec.Containers {
+			for _, cp := range container.Ports {
+				if cp.Name == port.TargetPort.StrVal {
+					return int(cp.ContainerPort)
+				}
+			}
+		}
+
+		return 0
+	case port.TargetPort.Type == intstr.Int && port.TargetPort.IntVal != 0:
+		return int(port.TargetPort.IntVal)
+	default:
+		return int(port.Port)
+	}
+}
+
+func interceptSliceName(service string) string {
+	return service + "-localflux-intercept"
+}
+
+// applyInterceptSlices adds an endpoint slice pointing at the relay to each service. Slices not managed by the
+// endpoint slice controller are left alone by it, and are used alongside its own.
+func (c *Client) applyInterceptSlices(
+	ctx context.Context,
+	namespace string,
+	services []interceptedService,
+	addr netip.AddrPort,
+) error {
+	addressType := discoveryv1.AddressTypeIPv4
+	if addr.Addr().Is6() {
+		addressType = discoveryv1.AddressTypeIPv6
+	}
+
+	for _, service := range services {
+		sliceLabels := map[string]string{
+			"app.kubernetes.io/component":  "intercept",
+			"app.kubernetes.io/managed-by": "localflux",
+			discoveryv1.LabelServiceName:   service.name,
+			discoveryv1.LabelManagedBy:     "localflux",
+		}
+
+		// Endpoints are matched to service ports by name, so the relay is listed under each intercepted port.
+		var ports []discoveryv1.EndpointPort
+
+		for _, name := range service.ports {
+			ports = append(ports, discoveryv1.EndpointPort{
+				Name:     ptr(name),
+				Protocol: ptr(corev1.ProtocolTCP),
+				Port:     ptr(int32(addr.Port())),
+			})
+		}
+
+		if err := c.client.PatchSSA(ctx, &discoveryv1.EndpointSlice{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "EndpointSlice",
+				APIVersion: "discovery.k8s.io/v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      interceptSliceName(service.name),
+				Namespace: namespace,
+				Labels:    sliceLabels,
+			},
+			AddressType: addressType,
+			Endpoints: []discoveryv1.Endpoint{
+				{
+					Addresses: []string{addr.Addr().String()},
+				},
+			},
+			Ports: ports,
+		}); err != nil {
+			return fmt.Errorf("failed to apply endpoint slice for %s: %w", service.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) deleteInterceptSlices(ctx context.Context, namespace string, services []interceptedService) error {
+	var errs []error
+
+	for _, service := range services {
+		err := c.client.ClientSet().DiscoveryV1().EndpointSlices(namespace).Delete(
+			ctx,
+			interceptSliceName(service.name),
+			metav1.DeleteOptions{},
+		)
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// scaleDown scales the workload to zero, returning its replicas beforehand. The replicas are recorded on the
+// workload, and taken from there when a previous intercept was interrupted.
+func (c *Client) scaleDown(ctx context.Context, opts InterceptOptions, workload *workload) (int32, error) {
+	replicas := int32(1)
+	if workload.Spec.Replicas != nil {
+		replicas = *workload.Spec.Replicas
+	}
+
+	recorded, interrupted := workload.Annotations[interceptReplicasAnnotation]
+
+	if interrupted {
+		if n, err := strconv.ParseInt(recorded, 10, 32); err == nil {
+			replicas = int32(n)
+		}
+	}
+
+	if err := c.annotateReplicas(ctx, opts, ptr(strconv.Itoa(int(replicas)))); err != nil {
+		return 0, err
+	}
+
+	if err := c.setScale(ctx, opts, 0); err != nil {
+		// The workload was not scaled down, so the record is removed, unless it is kept for an interrupted intercept.
+		if !interrupted {
+			if clearErr := c.annotateReplicas(context.WithoutCancel(ctx), opts, nil); clearErr != nil {
+				err = errors.Join(err, clearErr)
+			}
+		}
+
+		return 0, err
+	}
+
+	return replicas, nil
+}
+
+func (c *Client) restoreScale(ctx context.Context, opts InterceptOptions, replicas int32) error {
+	if err := c.setScale(ctx, opts, replicas); err != nil {
+		return err
+	}
+
+	return c.annotateReplicas(ctx, opts, nil)
+}
+
+func (c *Client) setScale(ctx context.Context, opts InterceptOptions, replicas int32) error {
+	apps := c.client.ClientSet().AppsV1()
+	patch := fmt.Appendf(nil, `{"spec":{"replicas":%d}}`, replicas)
+
+	var err error
+
+	if strings.EqualFold(opts.Kind, "statefulset") {
+		_, err = apps.StatefulSets(opts.Namespace).Patch(
+			ctx, opts.Name, types.MergePatchType, patch, metav1.PatchOptions{}, "scale",
+		)
+	} else {
+		_, err = apps.Deployments(opts.Namespace).Patch(
+			ctx, opts.Name, types.MergePatchType, patch, metav1.PatchOptions{}, "scale",
+		)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to scale %s/%s: %w", opts.Kind, opts.Name, err)
+	}
+
+	return nil
+}
+
+// annotateReplicas records the replicas on the workload, or removes the record when nil.
+func (c *Client) annotateReplicas(ctx context.Context, opts InterceptOptions, replicas *string) error {
+	value := "null"
+	if replicas != nil {
+		value = strconv.Quote(*replicas)
+	}
+
+	patch := fmt.Appendf(nil, `{"metadata":{"annotations":{%q:%s}}}`, interceptReplicasAnnotation, value)
+
+	apps := c.client.ClientSet().AppsV1()
+
+	var err error
+
+	if strings.EqualFold(opts.Kind, "statefulset") {
+		_, err = apps.StatefulSets(opts.Namespace).Patch(ctx, opts.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	} else {
+		_, err = apps.Deployments(opts.Namespace).Patch(ctx, opts.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to annotate %s/%s: %w", opts.Kind, opts.Name, err)
+	}
+
+	return nil
+}
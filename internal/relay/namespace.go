@@ -0,0 +1,150 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DefaultNamespacePortBase is the start of the range local ports of namespace forwards are assigned from.
+	DefaultNamespacePortBase = 20000
+	namespacePortRange       = 10000
+)
+
+// expandForwards replaces the namespace forwards with a forward for each service port in the namespace. Local ports
+// already used by other forwards are recorded, so that the assigned ports do not collide with them.
+func (c *Client) expandForwards(ctx context.Context, forwards map[string]*v1alpha1.PortForward, cb Callbacks) {
+	namespaces := make(map[string]*v1alpha1.PortForward)
+	used := make(map[int]bool)
+
+	for key, forward := range forwards {
+		if strings.EqualFold(forward.Kind, v1alpha1.ForwardKindNamespace) {
+			namespaces[key] = forward
+
+			delete(forwards, key)
+
+			continue
+		}
+
+		used[localPort(forward)] = true
+	}
+
+	// Namespaces are expanded in a fixed order, so that ports are assigned the same way each time.
+	for _, key := range slices.Sorted(maps.Keys(namespaces)) {
+		expanded, err := c.expandNamespace(ctx, namespaces[key], used)
+		if err != nil {
+			c.logger.Warn("Failed to expand namespace forward", "key", key, "err", err)
+
+			cb.Warn(fmt.Sprintf("Failed to expand namespace forward: %v", err))
+
+			continue
+		}
+
+		for _, forward := range expanded {
+			forwards[pfKey(forward)] = forward
+		}
+	}
+}
+
+// expandNamespace returns a service forward for each TCP port of the services in the namespace. Local ports are
+// derived from a hash of the service and port, so they stay the same as other services come and go. Collisions are
+// resolved by probing the following ports in name order.
+func (c *Client) expandNamespace(
+	ctx context.Context,
+	forward *v1alpha1.PortForward,
+	used map[int]bool,
+) ([]*v1alpha1.PortForward, error) {
+	namespace := forward.Name
+
+	services, err := c.client.ClientSet().CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services in %s: %w", namespace, err)
+	}
+
+	base := DefaultNamespacePortBase
+	if forward.LocalPort != nil {
+		base = *forward.LocalPort
+	}
+
+	slices.SortFunc(services.Items, func(a, b corev1.Service) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	var expanded []*v1alpha1.PortForward
+
+	for _, service := range services.Items {
+		// Headless and external name services have no cluster address to relay to.
+		if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == corev1.ClusterIPNone {
+			continue
+		}
+
+		for _, port := range service.Spec.Ports {
+			if port.Protocol != corev1.ProtocolTCP && port.Protocol != "" {
+				continue
+			}
+
+			if forward.Port != 0 && int(port.Port) != forward.Port {
+				continue
+			}
+
+			local := assignPort(base, service.Name+":"+strconv.Itoa(int(port.Port)), used)
+			if local == 0 {
+				return nil, fmt.Errorf("no free local ports for namespace %s", namespace)
+			}
+
+			expanded = append(expanded, &v1alpha1.PortForward{
+				Kind:              "service",
+				Namespace:         namespace,
+				Name:              service.Name,
+				Port:              int(port.Port),
+				Network:           "tcp",
+				LocalPort:         &local,
+				BindAddress:       forward.BindAddress,
+				Compression:       forward.Compression,
+				NetworkConditions: forward.NetworkConditions,
+			})
+		}
+	}
+
+	return expanded, nil
+}
+
+// assignPort returns the first unused port of the range, starting from the hash of the key, and marks it as used.
+// Zero is returned once the range is exhausted.
+func assignPort(base int, key string, used map[int]bool) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	offset := int(h.Sum32() % namespacePortRange)
+
+	for i := range namespacePortRange {
+		port := base + (offset+i)%namespacePortRange
+
+		if port > 65535 || used[port] {
+			continue
+		}
+
+		used[port] = true
+
+		return port
+	}
+
+	return 0
+}
+
+func localPort(forward *v1alpha1.PortForward) int {
+	if forward.LocalPort != nil {
+		return *forward.LocalPort
+	}
+
+	return forward.Port
+}
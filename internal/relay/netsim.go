@@ -0,0 +1,128 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"time"
+
+	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+)
+
+// retransmitTimeout is the delay of lost chunks, matching the minimum retransmission timeout of Linux.
+const retransmitTimeout = 200 * time.Millisecond
+
+// shaper applies the network conditions of a forward to one direction of a connection. A nil shaper leaves data
+// untouched.
+type shaper struct {
+	latency   time.Duration
+	bandwidth int64
+	loss      int
+	// next is the time the bandwidth limit allows the next chunk to be sent.
+	next time.Time
+}
+
+// newShapers returns a shaper for each direction of a connection of the forward, or nil when the forward has no
+// network conditions.
+func newShapers(forward *v1alpha1.PortForward) (*shaper, *shaper) {
+	conditions := forward.NetworkConditions
+	if conditions == nil {
+		return nil, nil
+	}
+
+	s := shaper{
+		loss: conditions.PacketLoss,
+	}
+
+	if conditions.Latency != nil {
+		s.latency = conditions.Latency.Duration
+	}
+
+	if conditions.Bandwidth != nil {
+		s.bandwidth = conditions.Bandwidth.Value()
+	}
+
+	if s.latency <= 0 && s.bandwidth <= 0 && s.loss <= 0 {
+		return nil, nil
+	}
+
+	up, down := s, s
+
+	return &up, &down
+}
+
+// wait blocks until a chunk of n bytes may be delivered.
+func (s *shaper) wait(ctx context.Context, n int) error {
+	if s == nil {
+		return nil
+	}
+
+	delay := s.latency
+
+	if s.loss > 0 && rand.IntN(100) < s.loss {
+		delay += retransmitTimeout
+	}
+
+	if s.bandwidth > 0 {
+		now := time.Now()
+		if s.next.Before(now) {
+			s.next = now
+		}
+
+		s.next = s.next.Add(time.Duration(int64(n) * int64(time.Second) / s.bandwidth))
+
+		delay = max(delay, time.Until(s.next))
+	}
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// shapedReader delays the data read from the underlying reader.
+type shapedReader struct {
+	ctx    context.Context
+	r      io.Reader
+	shaper *shaper
+}
+
+func (r *shapedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.shaper.wait(r.ctx, n); werr != nil {
+			return 0, werr
+		}
+	}
+
+	return n, err
+}
+
+// conditionsKey describes the network conditions of a forward, so that changing them restarts the forward.
+func conditionsKey(conditions *v1alpha1.NetworkConditions) string {
+	if conditions == nil {
+		return ""
+	}
+
+	var latency, bandwidth string
+
+	if conditions.Latency != nil {
+		latency = conditions.Latency.Duration.String()
+	}
+
+	if conditions.Bandwidth != nil {
+		bandwidth = conditions.Bandwidth.String()
+	}
+
+	return fmt.Sprintf("latency=%s bandwidth=%s loss=%d", latency, bandwidth, conditions.PacketLoss)
+}
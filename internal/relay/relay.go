@@ -4,6 +4,7 @@ package relay
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -14,15 +15,20 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/csnewman/localflux/internal/cluster"
 	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+	"github.com/csnewman/localflux/internal/wait"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/tools/clientcmd"
@@ -31,7 +37,23 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-const bufferSize = 64 * 1024
+const (
+	bufferSize = 64 * 1024
+	// reconcileInterval is the time between reconciliations while they succeed.
+	reconcileInterval = 10 * time.Second
+	// forwardStableAfter is how long a forward must run before a failure no longer counts towards its backoff.
+	forwardStableAfter = 30 * time.Second
+	// keepaliveTime is the interval between client pings. The server permits pings at half this interval.
+	keepaliveTime = 30 * time.Second
+)
+
+// retryBackoff spaces out retries of failed reconciliations and forwards.
+var retryBackoff = wait.Backoff{
+	Initial: time.Second,
+	Max:     30 * time.Second,
+	Factor:  2,
+	Jitter:  0.2,
+}
 
 type Callbacks interface {
 	Completed(msg string, dur time.Duration)
@@ -45,22 +67,93 @@ type Callbacks interface {
 	Warn(msg string)
 
 	Error(msg string)
+
+	// Connection reports the lifecycle of individual relayed connections.
+	Connection(event ConnectionEvent)
+
+	// Stats periodically reports the statistics of each forward.
+	Stats(stats []*ForwardStats)
+}
+
+type ConnectionEventKind string
+
+const (
+	ConnectionAccepted ConnectionEventKind = "accepted"
+	ConnectionClosed   ConnectionEventKind = "closed"
+	ConnectionReset    ConnectionEventKind = "reset"
+)
+
+// ConnectionEvent describes a change in the state of a single relayed connection. Byte counts and duration are only
+// set once the connection has ended.
+type ConnectionEvent struct {
+	Kind ConnectionEventKind
+	// Forward names the forward the connection was accepted on, e.g. "service/default/web:80".
+	Forward string
+	// ID identifies the connection within the client.
+	ID uint64
+	// Peer is the local address of the connecting client.
+	Peer string
+	// Sent is the number of bytes relayed into the cluster.
+	Sent int64
+	// Received is the number of bytes relayed out of the cluster.
+	Received int64
+	Duration time.Duration
+	// Err is the cause of a reset.
+	Err error
 }
 
 type Client struct {
-	logger      *slog.Logger
-	relayClient RelayClient
-	client      *cluster.K8sClient
-	statuses    map[string]*Status
+	logger        *slog.Logger
+	relayConn     *grpc.ClientConn
+	relayClient   RelayClient
+	queryClient   QueryClient
+	client        *cluster.K8sClient
+	statusesMu    sync.Mutex
+	statuses      map[string]*Status
+	statusAddress string
+	bindAddress   netip.Addr
+	lastConnID    atomic.Uint64
+	stats         *statsTracker
+	dnsOpts       *DNSOptions
+	dns           *dnsServer
+	hostsOpts     *HostsOptions
+	hosts         []string
+	hostsWritten  bool
+	httpProxyOpts *HTTPProxyOptions
+	inspectOpts   *InspectOptions
+	webSocketOpts *WebSocketOptions
+	// relayPod is the relay pod last tunneled to.
+	relayPod atomic.Pointer[string]
 }
 
 func NewClient(logger *slog.Logger) *Client {
 	return &Client{
 		logger:   logger,
 		statuses: make(map[string]*Status),
+		stats:    newStatsTracker(),
+		// Forwards are only served locally by default, rather than exposing cluster services to the network.
+		bindAddress: netip.MustParseAddr("127.0.0.1"),
 	}
 }
 
+// SetBindAddress sets the local address forwards are served on, unless set by the forward.
+func (c *Client) SetBindAddress(addr netip.Addr) {
+	c.bindAddress = addr
+}
+
+// EnableDNS serves the names of forwards over DNS once the client runs.
+func (c *Client) EnableDNS(opts DNSOptions) {
+	if opts.Address == "" {
+		opts.Address = DefaultDNSAddress
+	}
+
+	if opts.Domain == "" {
+		opts.Domain = DefaultDNSDomain
+	}
+
+	c.dnsOpts = &opts
+}
+
 func (c *Client) Run(ctx context.Context, name string, b64 string, cb Callbacks) error {
 	cb.State("Relaying", "Configuring", time.Now())
 
@@ -107,70 +200,274 @@ func (c *Client) Run(ctx context.Context, name string, b64 string, cb Callbacks)
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	c.client, err = cluster.NewK8sClientFromConfig(config, rawConfig)
+	kc, err := cluster.NewK8sClientFromConfig(config, rawConfig)
 	if err != nil {
 		return fmt.Errorf("failed to create k8s client: %w", err)
 	}
 
-	relayConn, err := grpc.NewClient(
-		"127.0.0.1",
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
-			c.logger.Info("Finding relay pod")
+	if err := c.Connect(kc); err != nil {
+		return err
+	}
 
-			podList, err := c.client.ClientSet().CoreV1().Pods(cluster.LFNamespace).List(ctx, metav1.ListOptions{
-				LabelSelector: "app.kubernetes.io/component=relay",
-			})
-			if err != nil {
-				return nil, fmt.Errorf("failed to list pods: %w", err)
-			}
+	if c.dnsOpts != nil {
+		revert, err := c.startDNS(ctx, cb)
+		if err != nil {
+			return err
+		}
+
+		defer revert()
+	}
 
-			var podName string
+	if c.httpProxyOpts != nil {
+		if err := c.startHTTPProxy(ctx, cb); err != nil {
+			return err
+		}
+	}
 
-			for _, pod := range podList.Items {
-				if pod.Status.Phase != corev1.PodRunning {
-					continue
-				}
+	// The status is informational, so relaying continues without it.
+	if c.statusAddress != "" {
+		if err := c.startStatus(ctx, name, cb); err != nil {
+			c.logger.Warn("Failed to serve status", "err", err)
+
+			cb.Warn(fmt.Sprintf("Failed to serve status: %v", err))
+		}
+	}
+
+	if c.hostsOpts != nil {
+		defer func() {
+			if !c.hostsWritten {
+				return
+			}
 
-				podName = pod.Name
+			if err := writeHostsBlock(c.hostsOpts.File, c.hostsOpts.Address, nil); err != nil {
+				c.logger.Warn("Failed to remove hosts", "err", err)
 			}
+		}()
+	}
+
+	cb.State("Relaying", "", time.Now())
 
-			if podName == "" {
-				c.logger.Warn("Failed to find any active relay pods!")
+	go c.reportStats(ctx, cb)
+
+	return c.reconcileLoop(ctx, cb)
+}
+
+// reconcileLoop reconciles the forwards until the context is cancelled. Failures, such as the cluster or relay being
+// unreachable, are reported as warnings and retried with backoff.
+func (c *Client) reconcileLoop(ctx context.Context, cb Callbacks) error {
+	failures := 0
+
+	for {
+		interval := reconcileInterval
 
-				return nil, fmt.Errorf("failed to find relay pod")
+		if err := c.reconcile(ctx, cb); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
 
-			c.logger.Info("Found relay pod", "pod", podName)
+			interval = retryBackoff.Delay(failures)
+			failures++
+
+			c.logger.Warn("Reconciliation failed", "err", err, "retry", interval)
+
+			cb.Warn(fmt.Sprintf("Reconciliation failed, retrying in %s: %v", interval.Round(time.Second), err))
+		} else if failures > 0 {
+			failures = 0
+
+			cb.Info("Reconciliation recovered")
+		}
+
+		timer := time.NewTimer(interval)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reportStats reports the statistics of the forwards every second until the context is cancelled.
+func (c *Client) reportStats(ctx context.Context, cb Callbacks) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cb.Stats(c.Stats())
+		}
+	}
+}
+
+// Stats returns the statistics of the connections relayed by the client, by forward.
+func (c *Client) Stats() []*ForwardStats {
+	return c.stats.snapshot()
+}
+
+// ServerStats returns the statistics of the connections relayed by the relay server, by forward. These include the
+// connections of all clients.
+func (c *Client) ServerStats(ctx context.Context) ([]*ForwardStats, error) {
+	resp, err := c.queryClient.GetStats(ctx, &StatsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stats: %w", err)
+	}
+
+	return resp.Forwards, nil
+}
+
+// Close closes the connection to the relay server.
+func (c *Client) Close() error {
+	if c.relayConn == nil {
+		return nil
+	}
+
+	return c.relayConn.Close()
+}
 
-			return c.client.PortForward(cluster.LFNamespace, podName, 8080)
+// Connect prepares the client to relay traffic through the relay pod of the cluster.
+func (c *Client) Connect(kc *cluster.K8sClient) error {
+	c.client = kc
+
+	// All relayed connections are streams multiplexed over the single connection of the channel, which is tunneled
+	// through one port-forward to the relay pod. The tunnel is kept open while idle, as re-establishing the
+	// port-forward would add its latency to the next connection.
+	//
+	// The channel reconnects on its own once the relay pod restarts, finding the new pod through the dialer. Keepalives
+	// detect port-forwards that silently stopped working.
+	dialer := c.dialRelayPod
+	if c.webSocketOpts != nil {
+		dialer = c.dialWebSocket
+	}
+
+	relayConn, err := grpc.NewClient(
+		"127.0.0.1",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithIdleTimeout(0),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  retryBackoff.Initial,
+				Multiplier: retryBackoff.Factor,
+				Jitter:     retryBackoff.Jitter,
+				MaxDelay:   retryBackoff.Max,
+			},
+			MinConnectTimeout: 10 * time.Second,
+		}),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                keepaliveTime,
+			Timeout:             10 * time.Second,
+			PermitWithoutStream: true,
 		}),
+		grpc.WithContextDialer(dialer),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create grpc client: %w", err)
 	}
 
+	// The tunnel is established up front, rather than by the first relayed connection.
+	relayConn.Connect()
+
+	c.relayConn = relayConn
 	c.relayClient = NewRelayClient(relayConn)
+	c.queryClient = NewQueryClient(relayConn)
 
-	cb.State("Relaying", "", time.Now())
+	return nil
+}
 
-	if err := c.reconcile(ctx, cb); err != nil {
-		return fmt.Errorf("reconciliation failed: %w", err)
+// clusterForwards returns the forwards configured for the cluster, rather than by a deployment.
+func (c *Client) clusterForwards(ctx context.Context) ([]*v1alpha1.PortForward, error) {
+	cm, err := c.client.ClientSet().CoreV1().ConfigMaps(cluster.LFNamespace).Get(
+		ctx,
+		cluster.ClusterForwardsConfigMap,
+		metav1.GetOptions{},
+	)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get cluster forwards: %w", err)
 	}
 
-	t := time.NewTicker(time.Second * 10)
-	defer t.Stop()
+	var forwards []*v1alpha1.PortForward
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-t.C:
-			if err := c.reconcile(ctx, cb); err != nil {
-				return fmt.Errorf("reconciliation failed: %w", err)
-			}
+	if data := cm.Data[cluster.ClusterForwardsKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &forwards); err != nil {
+			return nil, fmt.Errorf("failed to parse cluster forwards: %w", err)
+		}
+	}
+
+	return forwards, nil
+}
+
+// dialRelayPod tunnels to a ready relay pod, trying each in turn. The pod of the previous tunnel is tried last, as the
+// channel only redials once its tunnel failed, failing over to another relay server when there is one.
+func (c *Client) dialRelayPod(ctx context.Context, _ string) (net.Conn, error) {
+	c.logger.Info("Finding relay pod")
+
+	podList, err := c.client.ClientSet().CoreV1().Pods(cluster.LFNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app.kubernetes.io/component=relay",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	var pods []string
+
+	for _, pod := range podList.Items {
+		if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil || !podReady(&pod) {
+			continue
+		}
+
+		pods = append(pods, pod.Name)
+	}
+
+	if len(pods) == 0 {
+		c.logger.Warn("Failed to find any active relay pods!")
+
+		return nil, fmt.Errorf("failed to find relay pod")
+	}
+
+	slices.Sort(pods)
+
+	if previous := c.relayPod.Load(); previous != nil {
+		if i := slices.Index(pods, *previous); i >= 0 && len(pods) > 1 {
+			pods = append(slices.Delete(pods, i, i+1), *previous)
 		}
 	}
+
+	var errs []error
+
+	for _, pod := range pods {
+		conn, err := c.client.PortForward(cluster.LFNamespace, pod, 8080)
+		if err != nil {
+			c.logger.Warn("Failed to connect to relay pod", "pod", pod, "err", err)
+
+			errs = append(errs, fmt.Errorf("%s: %w", pod, err))
+
+			continue
+		}
+
+		c.logger.Info("Connected to relay pod", "pod", pod)
+
+		c.relayPod.Store(&pod)
+
+		return conn, nil
+	}
+
+	return nil, fmt.Errorf("failed to connect to relay pods: %w", errors.Join(errs...))
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
 }
 
 func (c *Client) reconcile(ctx context.Context, cb Callbacks) error {
@@ -180,7 +477,25 @@ func (c *Client) reconcile(ctx context.Context, cb Callbacks) error {
 		return fmt.Errorf("failed to list deployments: %w", err)
 	}
 
+	if c.hostsOpts != nil {
+		if err := c.reconcileHosts(ctx, deployments.Items, cb); err != nil {
+			c.logger.Warn("Failed to update hosts", "err", err)
+
+			cb.Warn(fmt.Sprintf("Failed to update hosts: %v", err))
+		}
+	}
+
 	forwards := make(map[string]*v1alpha1.PortForward)
+	reverses := make(map[string]*v1alpha1.ReverseForward)
+
+	clusterForwards, err := c.clusterForwards(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, forward := range clusterForwards {
+		forwards[pfKey(forward)] = forward
+	}
 
 	for _, deployment := range deployments.Items {
 		for _, forward := range deployment.PortForward {
@@ -188,14 +503,27 @@ func (c *Client) reconcile(ctx context.Context, cb Callbacks) error {
 
 			forwards[key] = forward
 		}
+
+		for _, reverse := range deployment.ReverseForward {
+			reverses[rfKey(reverse)] = reverse
+		}
 	}
 
+	c.expandForwards(ctx, forwards, cb)
+
+	c.statusesMu.Lock()
+	defer c.statusesMu.Unlock()
+
 	for _, key := range slices.Collect(maps.Keys(c.statuses)) {
 		_, ok := forwards[key]
 		if ok {
 			continue
 		}
 
+		if _, ok := reverses[key]; ok {
+			continue
+		}
+
 		status, ok := c.statuses[key]
 		if !ok {
 			continue
@@ -213,41 +541,199 @@ func (c *Client) reconcile(ctx context.Context, cb Callbacks) error {
 	}
 
 	for key, forward := range forwards {
-		status, ok := c.statuses[key]
-		if ok && status.active.Load() {
+		previous, ok := c.statuses[key]
+		if ok && (previous.active.Load() || !previous.retryDue()) {
 			continue
 		}
 
 		cb.Info(fmt.Sprintf("Creating forward: %s", key))
 
 		forwardCtx, forwardCancel := context.WithCancel(ctx)
-		status = &Status{
-			cancel: forwardCancel,
-		}
-
-		status.active.Store(true)
+		status := newStatus(forwardName(forward), forwardCancel, previous)
 
+		// The forward is only marked inactive once its failure is recorded, so that its retry is not started early.
 		go func() {
-			if err := c.runForward(forwardCtx, forward, status); err != nil {
+			defer status.active.Store(false)
+
+			if err := c.runForward(forwardCtx, forward, status, cb); err != nil {
 				c.logger.Warn("Port forward error", "key", key, "err", err)
 
 				cb.Warn(fmt.Sprintf("Port forward error: %v", err.Error()))
+
+				status.failed(err)
 			}
 		}()
 
 		c.statuses[key] = status
 
 	}
+
+	for key, reverse := range reverses {
+		previous, ok := c.statuses[key]
+		if ok && (previous.active.Load() || !previous.retryDue()) {
+			continue
+		}
+
+		cb.Info(fmt.Sprintf("Creating reverse forward: %s", key))
+
+		forwardCtx, forwardCancel := context.WithCancel(ctx)
+		status := newStatus(reverseName(reverse), forwardCancel, previous)
+
+		go func() {
+			defer status.active.Store(false)
+
+			if err := c.runReverse(forwardCtx, reverse, status, cb); err != nil {
+				c.logger.Warn("Reverse forward error", "key", key, "err", err)
+
+				cb.Warn(fmt.Sprintf("Reverse forward error: %v", err.Error()))
+
+				status.failed(err)
+			}
+		}()
+
+		c.statuses[key] = status
+	}
+
 	return nil
 }
 
-func (c *Client) runForward(ctx context.Context, forward *v1alpha1.PortForward, status *Status) error {
-	defer func() {
-		status.active.Store(false)
-	}()
-
+func (c *Client) runForward(ctx context.Context, forward *v1alpha1.PortForward, status *Status, cb Callbacks) error {
 	defer status.cancel()
 
+	localPort := forward.Port
+	if forward.LocalPort != nil {
+		localPort = *forward.LocalPort
+	}
+
+	bind := c.bindAddress
+
+	if forward.BindAddress != "" {
+		addr, err := netip.ParseAddr(forward.BindAddress)
+		if err != nil {
+			return fmt.Errorf("failed to parse bind address: %w", err)
+		}
+
+		bind = addr
+	}
+
+	local := netip.AddrPortFrom(bind, uint16(localPort))
+
+	switch strings.ToLower(forward.Network) {
+	case "tcp":
+		listeners, err := c.listenLocal(local)
+		if err != nil {
+			return err
+		}
+
+		if c.dns != nil {
+			// The forward is also served on its own loopback address at the cluster port, which its names resolve to.
+			mapped := netip.AddrPortFrom(c.dns.register(forward), uint16(forward.Port))
+
+			mappedLis, err := net.ListenTCP("tcp", net.TCPAddrFromAddrPort(mapped))
+			if err != nil {
+				for _, lis := range listeners {
+					_ = lis.Close()
+				}
+
+				return fmt.Errorf("could not listen on mapped address: %w", err)
+			}
+
+			listeners = append(listeners, mappedLis)
+		}
+
+		resolver := status.trackRemote(c.resolver(forward))
+
+		grp, gctx := errgroup.WithContext(ctx)
+
+		for _, lis := range listeners {
+			status.addLocal(lis.Addr().String())
+
+			grp.Go(func() error {
+				return c.relayTCP(gctx, lis, forward, resolver, cb)
+			})
+		}
+
+		return grp.Wait()
+	default:
+		return fmt.Errorf("unsupported network: %s", forward.Network)
+	}
+}
+
+// listenLocal listens on the local address of a forward. Forwards on the IPv4 loopback address are also served on the
+// IPv6 loopback address when available, so that "localhost" reaches them whichever family clients resolve it to.
+// Wildcard addresses already accept both families.
+func (c *Client) listenLocal(local netip.AddrPort) ([]*net.TCPListener, error) {
+	lis, err := net.ListenTCP("tcp", net.TCPAddrFromAddrPort(local))
+	if err != nil {
+		return nil, fmt.Errorf("could not listen: %w", err)
+	}
+
+	listeners := []*net.TCPListener{lis}
+
+	if local.Addr() != netip.AddrFrom4([4]byte{127, 0, 0, 1}) {
+		return listeners, nil
+	}
+
+	companion := netip.AddrPortFrom(netip.IPv6Loopback(), local.Port())
+
+	lis6, err := net.ListenTCP("tcp6", net.TCPAddrFromAddrPort(companion))
+	if err != nil {
+		c.logger.Debug("Not serving forward over IPv6 loopback", "addr", companion, "err", err)
+
+		return listeners, nil
+	}
+
+	return append(listeners, lis6), nil
+}
+
+// ForwardEphemeral starts the forwards on ephemeral loopback ports. The bound address of each forward is returned in
+// the same order. Forwards stop once the context is cancelled.
+func (c *Client) ForwardEphemeral(
+	ctx context.Context,
+	forwards []*v1alpha1.PortForward,
+	cb Callbacks,
+) ([]netip.AddrPort, error) {
+	addrs := make([]netip.AddrPort, 0, len(forwards))
+	listeners := make([]*net.TCPListener, 0, len(forwards))
+
+	for _, forward := range forwards {
+		if !strings.EqualFold(forward.Network, "tcp") {
+			for _, lis := range listeners {
+				_ = lis.Close()
+			}
+
+			return nil, fmt.Errorf("unsupported network: %s", forward.Network)
+		}
+
+		lis, err := net.ListenTCP("tcp", net.TCPAddrFromAddrPort(netip.MustParseAddrPort("127.0.0.1:0")))
+		if err != nil {
+			for _, lis := range listeners {
+				_ = lis.Close()
+			}
+
+			return nil, fmt.Errorf("could not listen: %w", err)
+		}
+
+		listeners = append(listeners, lis)
+		addrs = append(addrs, lis.Addr().(*net.TCPAddr).AddrPort())
+	}
+
+	for i, forward := range forwards {
+		key := pfKey(forward)
+
+		go func() {
+			if err := c.relayTCP(ctx, listeners[i], forward, c.resolver(forward), cb); err != nil && ctx.Err() == nil {
+				c.logger.Warn("Port forward error", "key", key, "err", err)
+
+				cb.Warn(fmt.Sprintf("Port forward error: %v", err.Error()))
+			}
+		}()
+	}
+
+	return addrs, nil
+}
+
+func (c *Client) resolver(forward *v1alpha1.PortForward) func(ctx context.Context) (string, error) {
 	var remoteResolver func(ctx context.Context) (string, error)
 
 	switch strings.ToLower(forward.Kind) {
@@ -258,7 +744,7 @@ func (c *Client) runForward(ctx context.Context, forward *v1alpha1.PortForward,
 				return "", fmt.Errorf("failed to get service: %w", err)
 			}
 
-			return service.Spec.ClusterIP + ":" + strconv.Itoa(forward.Port), nil
+			return net.JoinHostPort(service.Spec.ClusterIP, strconv.Itoa(forward.Port)), nil
 		}
 	default:
 		remoteResolver = func(ctx context.Context) (string, error) {
@@ -279,31 +765,25 @@ func (c *Client) runForward(ctx context.Context, forward *v1alpha1.PortForward,
 				return "", fmt.Errorf("failed to find attachable pod: %w", err)
 			}
 
-			return forwardablePod.Status.PodIP + ":" + strconv.Itoa(forward.Port), nil
+			return net.JoinHostPort(forwardablePod.Status.PodIP, strconv.Itoa(forward.Port)), nil
 		}
 	}
 
-	localPort := forward.Port
-	if forward.LocalPort != nil {
-		localPort = *forward.LocalPort
-	}
-
-	local, err := netip.ParseAddrPort("0.0.0.0:" + strconv.Itoa(localPort))
-	if err != nil {
-		return fmt.Errorf("failed to parse address: %w", err)
-	}
-
-	switch strings.ToLower(forward.Network) {
-	case "tcp":
-		return c.relayTCP(ctx, local, remoteResolver)
-	default:
-		return fmt.Errorf("unsupported network: %s", forward.Network)
-	}
+	return remoteResolver
 }
 
 type Status struct {
 	active atomic.Bool
 	cancel func()
+
+	mu       sync.Mutex
+	name     string
+	remote   string
+	local    []string
+	err      error
+	started  time.Time
+	failures int
+	retryAt  time.Time
 }
 
 func pfKey(pf *v1alpha1.PortForward) string {
@@ -313,17 +793,39 @@ func pfKey(pf *v1alpha1.PortForward) string {
 		k += " local=" + strconv.Itoa(*pf.LocalPort)
 	}
 
+	if pf.BindAddress != "" {
+		k += " bind=" + pf.BindAddress
+	}
+
+	if pf.Compression != "" {
+		k += " compression=" + pf.Compression
+	}
+
+	if pf.NetworkConditions != nil {
+		k += " " + conditionsKey(pf.NetworkConditions)
+	}
+
 	return k
 }
 
-func (c *Client) relayTCP(ctx context.Context, bind netip.AddrPort, remoteResolver func(ctx context.Context) (string, error)) error {
-	lis, err := net.ListenTCP("tcp", net.TCPAddrFromAddrPort(bind))
-	if err != nil {
-		return fmt.Errorf("could not listen: %w", err)
-	}
+// forwardName returns a short, human-readable name for a forward.
+func forwardName(pf *v1alpha1.PortForward) string {
+	return strings.ToLower(pf.Kind) + "/" + pf.Namespace + "/" + pf.Name + ":" + strconv.Itoa(pf.Port)
+}
 
+func (c *Client) relayTCP(
+	ctx context.Context,
+	lis *net.TCPListener,
+	forward *v1alpha1.PortForward,
+	remoteResolver func(ctx context.Context) (string, error),
+	cb Callbacks,
+) error {
 	defer lis.Close()
 
+	name := forwardName(forward)
+	bind := lis.Addr().String()
+	opts := compressionOptions(forward.Compression)
+
 	go func() {
 		<-ctx.Done()
 		_ = lis.Close()
@@ -342,46 +844,102 @@ func (c *Client) relayTCP(ctx context.Context, bind netip.AddrPort, remoteResolv
 			return fmt.Errorf("could not accept connection: %w", err)
 		}
 
+		// A failed resolution only drops the connection, as the remote is often briefly missing during rollouts.
 		if time.Since(lastResolve) >= time.Second {
-			remote, err = remoteResolver(ctx)
+			resolved, err := remoteResolver(ctx)
 			if err != nil {
-				_ = tcpConn.CloseWrite()
+				c.logger.Warn("Could not resolve remote address", "bind", bind, "err", err)
+
+				cb.Warn(fmt.Sprintf("Dropped connection to %s: could not resolve remote address: %v", name, err))
 
-				return fmt.Errorf("could not resolve remote address: %w", err)
+				_ = tcpConn.Close()
+
+				continue
 			}
 
+			remote = resolved
 			lastResolve = time.Now()
 		}
 
+		event := ConnectionEvent{
+			Kind:    ConnectionAccepted,
+			Forward: name,
+			ID:      c.lastConnID.Add(1),
+			Peer:    tcpConn.RemoteAddr().String(),
+		}
+
+		cb.Connection(event)
+
 		go func() {
-			c.logger.Info("Relaying TCP", "bind", bind)
+			c.logger.Info("Relaying TCP", "bind", bind, "conn", event.ID)
+
+			start := time.Now()
+
+			stats := c.stats.open(name)
+			up, down := newShapers(forward)
+			inspector := c.newInspector(name, event.ID, cb)
+
+			err := relayTCPClientInstance(ctx, c.relayClient, tcpConn, &RelayRequestStart{
+				Network: RelayNetwork_TCP,
+				Address: remote,
+				Forward: name,
+			}, stats, up, down, inspector, opts...)
 
-			if err := relayTCPClientInstance(ctx, c.relayClient, tcpConn, remote); err != nil {
-				c.logger.Info("Relaying failed", "bind", bind, "err", err)
+			event.Kind = ConnectionClosed
+			event.Sent = stats.sent.Load()
+			event.Received = stats.received.Load()
+			event.Duration = time.Since(start)
+
+			if err != nil && ctx.Err() == nil {
+				c.logger.Info("Relaying failed", "bind", bind, "conn", event.ID, "err", err)
+
+				event.Kind = ConnectionReset
+				event.Err = err
 			}
+
+			c.stats.close(name, stats, event.Err)
+
+			cb.Connection(event)
 		}()
 	}
 }
 
-func relayTCPClientInstance(ctx context.Context, rc RelayClient, tcpConn *net.TCPConn, remote string) error {
+// relayTCPClientInstance relays a single connection until both directions have been closed. The stream is cancelled
+// on return, releasing the server side. The shapers, which may be nil, delay the data sent and received, and the
+// inspector, which may also be nil, observes it.
+func relayTCPClientInstance(
+	ctx context.Context,
+	rc RelayClient,
+	tcpConn *net.TCPConn,
+	start *RelayRequestStart,
+	stats *connStats,
+	up *shaper,
+	down *shaper,
+	inspector *httpInspector,
+	opts ...grpc.CallOption,
+) error {
 	defer tcpConn.Close()
+	defer inspector.close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	conn, err := rc.Relay(ctx)
+	conn, err := rc.Relay(ctx, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to relay: %w", err)
 	}
 
 	if err := conn.Send(&RelayRequest{
 		Message: &RelayRequest_Start{
-			Start: &RelayRequestStart{
-				Network: RelayNetwork_TCP,
-				Address: remote,
-			},
+			Start: start,
 		},
 	}); err != nil {
 		return fmt.Errorf("failed to send start: %w", err)
 	}
 
+	// The connect latency is not recorded, as the server reports no response until the target sends data. The
+	// server records the time taken to dial the target instead.
+
 	grp, gctx := errgroup.WithContext(ctx)
 
 	go func() {
@@ -404,12 +962,19 @@ func relayTCPClientInstance(ctx context.Context, rc RelayClient, tcpConn *net.TC
 			buffer := make([]byte, bufferSize)
 
 			read, err := tcpConn.Read(buffer)
-			if errors.Is(err, io.EOF) {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
 				return nil
 			} else if err != nil {
 				return fmt.Errorf("could not read: %w", err)
 			}
 
+			stats.sent.Add(int64(read))
+			inspector.sent(buffer[:read])
+
+			if err := up.wait(gctx, read); err != nil {
+				return nil
+			}
+
 			if err := conn.Send(&RelayRequest{
 				Message: &RelayRequest_Data{
 					Data: &RelayData{
@@ -431,15 +996,27 @@ func relayTCPClientInstance(ctx context.Context, rc RelayClient, tcpConn *net.TC
 
 			switch m := resp.GetMessage().(type) {
 			case *RelayResponse_Data:
+				if err := down.wait(gctx, len(m.Data.Data)); err != nil {
+					return nil
+				}
+
 				if _, err := tcpConn.Write(m.Data.Data); err != nil {
 					return fmt.Errorf("failed to write: %w", err)
 				}
+
+				stats.received.Add(int64(len(m.Data.Data)))
+				inspector.received(m.Data.Data)
 			case *RelayResponse_Close:
+				// The server sends nothing further once its write side is closed.
 				switch m.Close {
 				case RelayClose_CLOSE_FULL:
 					_ = tcpConn.Close()
+
+					return nil
 				case RelayClose_CLOSE_WRITE:
 					_ = tcpConn.CloseWrite()
+
+					return nil
 				case RelayClose_CLOSE_READ:
 					_ = tcpConn.CloseRead()
 				default:
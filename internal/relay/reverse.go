@@ -0,0 +1,322 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var ErrServiceExists = errors.New("service not managed by localflux")
+
+func rfKey(rf *v1alpha1.ReverseForward) string {
+	return "reverse ns=" + rf.Namespace + " name=" + rf.Name + " port=" + strconv.Itoa(rf.Port) +
+		" local=" + net.JoinHostPort(rf.LocalHost, strconv.Itoa(rf.LocalPort))
+}
+
+// reverseName returns a short, human-readable name for a reverse forward.
+func reverseName(rf *v1alpha1.ReverseForward) string {
+	return "reverse/" + rf.Namespace + "/" + rf.Name + ":" + strconv.Itoa(rf.Port)
+}
+
+// runReverse has the relay server listen on behalf of the client, and points a selectorless service at it. Each
+// connection the server accepts is tunneled to the local address. The service is removed once the forward stops.
+func (c *Client) runReverse(ctx context.Context, reverse *v1alpha1.ReverseForward, status *Status, cb Callbacks) error {
+	defer status.cancel()
+
+	local := net.JoinHostPort(reverse.LocalHost, strconv.Itoa(reverse.LocalPort))
+
+	stream, addr, err := c.listenReverse(ctx)
+	if err != nil {
+		return err
+	}
+
+	status.setRemote(addr.String())
+	status.addLocal(local)
+
+	if err := c.applyReverseService(ctx, reverse, addr); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := c.deleteReverseService(context.WithoutCancel(ctx), reverse); err != nil {
+			c.logger.Warn("Failed to remove reverse forward service", "name", reverse.Name, "err", err)
+		}
+	}()
+
+	return c.acceptReverse(ctx, stream, local, reverseName(reverse), cb)
+}
+
+// listenReverse has the relay server listen on behalf of the client, returning the address it listens on within the
+// cluster.
+func (c *Client) listenReverse(
+	ctx context.Context,
+) (grpc.ServerStreamingClient[ListenResponse], netip.AddrPort, error) {
+	stream, err := c.relayClient.Listen(ctx, &ListenRequest{Network: RelayNetwork_TCP})
+	if err != nil {
+		return nil, netip.AddrPort{}, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, netip.AddrPort{}, fmt.Errorf("failed to receive: %w", err)
+	}
+
+	started := resp.GetStarted()
+	if started == nil {
+		return nil, netip.AddrPort{}, fmt.Errorf("%w: expected listen start", ErrBadRequest)
+	}
+
+	addr, err := netip.ParseAddrPort(started.Address)
+	if err != nil {
+		return nil, netip.AddrPort{}, fmt.Errorf("failed to parse listen address: %w", err)
+	}
+
+	return stream, addr, nil
+}
+
+// acceptReverse tunnels each connection the server accepts to the local address, until the stream ends.
+func (c *Client) acceptReverse(
+	ctx context.Context,
+	stream grpc.ServerStreamingClient[ListenResponse],
+	local string,
+	name string,
+	cb Callbacks,
+) error {
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("failed to receive: %w", err)
+		}
+
+		accepted := resp.GetAccepted()
+		if accepted == nil {
+			return fmt.Errorf("%w: unexpected message type", ErrBadRequest)
+		}
+
+		event := ConnectionEvent{
+			Kind:    ConnectionAccepted,
+			Forward: name,
+			ID:      c.lastConnID.Add(1),
+			Peer:    accepted.Peer,
+		}
+
+		cb.Connection(event)
+
+		go func() {
+			c.logger.Info("Relaying reverse TCP", "local", local, "conn", event.ID)
+
+			start := time.Now()
+
+			stats := c.stats.open(name)
+
+			err := c.relayReverseInstance(ctx, local, name, accepted.Id, stats)
+
+			event.Kind = ConnectionClosed
+			event.Sent = stats.sent.Load()
+			event.Received = stats.received.Load()
+			event.Duration = time.Since(start)
+
+			if err != nil && ctx.Err() == nil {
+				c.logger.Info("Relaying failed", "local", local, "conn", event.ID, "err", err)
+
+				event.Kind = ConnectionReset
+				event.Err = err
+			}
+
+			c.stats.close(name, stats, event.Err)
+
+			cb.Connection(event)
+		}()
+	}
+}
+
+// relayReverseInstance connects to the local address and claims the accepted connection from the server. Connections
+// that can not be made locally are still claimed, so that the server closes them straight away.
+func (c *Client) relayReverseInstance(
+	ctx context.Context,
+	local string,
+	name string,
+	id string,
+	stats *connStats,
+) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", local)
+	if err != nil {
+		if rc, rerr := c.relayClient.Relay(ctx); rerr == nil {
+			_ = rc.Send(&RelayRequest{Message: &RelayRequest_Start{Start: &RelayRequestStart{Accept: id, Forward: name}}})
+			_ = rc.CloseSend()
+		}
+
+		return fmt.Errorf("could not dial %s: %w", local, err)
+	}
+
+	return relayTCPClientInstance(ctx, c.relayClient, conn.(*net.TCPConn), &RelayRequestStart{
+		Network: RelayNetwork_TCP,
+		Accept:  id,
+		Forward: name,
+	}, stats, nil, nil, nil)
+}
+
+// isReverseManaged reports whether the object was created by a reverse forward, rather than by the user.
+func isReverseManaged(obj metav1.Object) bool {
+	return obj.GetLabels()["app.kubernetes.io/managed-by"] == "localflux"
+}
+
+// checkReverseService fails when a service or endpoint slice of the reverse forward's name exists, but was not created
+// by a reverse forward, so that it is not taken over.
+func (c *Client) checkReverseService(ctx context.Context, reverse *v1alpha1.ReverseForward) error {
+	svc, err := c.client.ClientSet().CoreV1().Services(reverse.Namespace).Get(ctx, reverse.Name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get service: %w", err)
+	} else if err == nil && !isReverseManaged(svc) {
+		return fmt.Errorf("%w: service %s/%s already exists", ErrServiceExists, reverse.Namespace, reverse.Name)
+	}
+
+	slice, err := c.client.ClientSet().DiscoveryV1().EndpointSlices(reverse.Namespace).Get(
+		ctx,
+		reverse.Name,
+		metav1.GetOptions{},
+	)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get endpoint slice: %w", err)
+	} else if err == nil && !isReverseManaged(slice) {
+		return fmt.Errorf("%w: endpoint slice %s/%s already exists", ErrServiceExists, reverse.Namespace, reverse.Name)
+	}
+
+	return nil
+}
+
+func reverseLabels() map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/component":  "reverse-forward",
+		"app.kubernetes.io/managed-by": "localflux",
+	}
+}
+
+// applyReverseService creates the service for the reverse forward, with a single endpoint pointing at the relay.
+// Existing services are only updated when they were created by a reverse forward.
+func (c *Client) applyReverseService(ctx context.Context, reverse *v1alpha1.ReverseForward, addr netip.AddrPort) error {
+	const portName = "tcp"
+
+	if err := c.checkReverseService(ctx, reverse); err != nil {
+		return err
+	}
+
+	if err := c.client.PatchSSA(ctx, &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      reverse.Name,
+			Namespace: reverse.Namespace,
+			Labels:    reverseLabels(),
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name:       portName,
+					Protocol:   corev1.ProtocolTCP,
+					Port:       int32(reverse.Port),
+					TargetPort: intstr.FromInt32(int32(addr.Port())),
+				},
+			},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to apply service: %w", err)
+	}
+
+	labels := reverseLabels()
+	labels[discoveryv1.LabelServiceName] = reverse.Name
+
+	addressType := discoveryv1.AddressTypeIPv4
+	if addr.Addr().Is6() {
+		addressType = discoveryv1.AddressTypeIPv6
+	}
+
+	if err := c.client.PatchSSA(ctx, &discoveryv1.EndpointSlice{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "EndpointSlice",
+			APIVersion: "discovery.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      reverse.Name,
+			Namespace: reverse.Namespace,
+			Labels:    labels,
+		},
+		AddressType: addressType,
+		Endpoints: []discoveryv1.Endpoint{
+			{
+				Addresses: []string{addr.Addr().String()},
+			},
+		},
+		Ports: []discoveryv1.EndpointPort{
+			{
+				Name:     ptr(portName),
+				Protocol: ptr(corev1.ProtocolTCP),
+				Port:     ptr(int32(addr.Port())),
+			},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to apply endpoint slice: %w", err)
+	}
+
+	return nil
+}
+
+// deleteReverseService removes the service and endpoint slice of the reverse forward, leaving those that were not
+// created by a reverse forward.
+func (c *Client) deleteReverseService(ctx context.Context, reverse *v1alpha1.ReverseForward) error {
+	services := c.client.ClientSet().CoreV1().Services(reverse.Namespace)
+
+	svc, err := services.Get(ctx, reverse.Name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get service: %w", err)
+	}
+
+	if err == nil && isReverseManaged(svc) {
+		if err := services.Delete(ctx, reverse.Name, metav1.DeleteOptions{
+			Preconditions: metav1.NewUIDPreconditions(string(svc.UID)),
+		}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete service: %w", err)
+		}
+	}
+
+	endpointSlices := c.client.ClientSet().DiscoveryV1().EndpointSlices(reverse.Namespace)
+
+	slice, err := endpointSlices.Get(ctx, reverse.Name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get endpoint slice: %w", err)
+	}
+
+	if err == nil && isReverseManaged(slice) {
+		if err := endpointSlices.Delete(ctx, reverse.Name, metav1.DeleteOptions{
+			Preconditions: metav1.NewUIDPreconditions(string(slice.UID)),
+		}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete endpoint slice: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -8,33 +8,62 @@ import (
 	"log/slog"
 	"net"
 	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 )
 
 var ErrBadRequest = errors.New("bad request")
 
+// acceptTimeout bounds how long a connection accepted by Listen waits to be claimed by the client.
+const acceptTimeout = 10 * time.Second
+
 type Server struct {
 	UnimplementedRelayServer
-	logger *slog.Logger
+	logger    *slog.Logger
+	pendingMu sync.Mutex
+	pending   map[string]*pendingConn
+	lastID    atomic.Uint64
+	stats     *statsTracker
+	wsAddress string
+	wsToken   string
+}
+
+// pendingConn is a connection accepted by Listen that has not yet been claimed.
+type pendingConn struct {
+	conn     *net.TCPConn
+	accepted time.Time
 }
 
 func NewServer(logger *slog.Logger) *Server {
 	return &Server{
-		logger: logger,
+		logger:  logger,
+		pending: make(map[string]*pendingConn),
+		stats:   newStatsTracker(),
 	}
 }
 
 func (s *Server) Run(context context.Context) error {
 	s.logger.Info("Starting relay server")
 
-	srv := grpc.NewServer()
+	srv := grpc.NewServer(grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+		MinTime:             keepaliveTime / 2,
+		PermitWithoutStream: true,
+	}))
 	RegisterRelayServer(srv, s)
+	RegisterQueryServer(srv, &serverQuery{s: s})
+	reflection.Register(srv)
 
-	lis, err := net.Listen("tcp", "0.0.0.0:8080")
+	lis, err := net.Listen("tcp", ":8080")
 	if err != nil {
 		return fmt.Errorf("could not listen on port 8080: %w", err)
 	}
@@ -44,6 +73,14 @@ func (s *Server) Run(context context.Context) error {
 		_ = lis.Close()
 	}()
 
+	if s.wsAddress != "" {
+		go func() {
+			if err := s.serveWebSocket(context, srv); err != nil {
+				s.logger.Error("WebSocket endpoint failed", "err", err)
+			}
+		}()
+	}
+
 	return srv.Serve(lis)
 }
 
@@ -58,6 +95,29 @@ func (s *Server) Relay(g grpc.BidiStreamingServer[RelayRequest, RelayResponse])
 		return fmt.Errorf("%w: no start", ErrBadRequest)
 	}
 
+	forward := start.Forward
+	if forward == "" {
+		forward = start.Address
+	}
+
+	if start.Accept != "" {
+		pending := s.claim(start.Accept)
+		if pending == nil {
+			return status.Errorf(codes.NotFound, "no pending connection %q", start.Accept)
+		}
+
+		s.logger.Info("Relaying accepted TCP", "id", start.Accept)
+
+		stats := s.stats.open(forward)
+		stats.latency.Store(int64(time.Since(pending.accepted)))
+
+		err := relayTCPConn(g, pending.conn, stats)
+
+		s.closeStats(g, forward, stats, err)
+
+		return err
+	}
+
 	addr, err := netip.ParseAddrPort(start.Address)
 	if err != nil {
 		return fmt.Errorf("failed to parse address: %w", err)
@@ -67,7 +127,13 @@ func (s *Server) Relay(g grpc.BidiStreamingServer[RelayRequest, RelayResponse])
 	case RelayNetwork_TCP:
 		s.logger.Info("Relaying TCP", "dest", addr)
 
-		if err := relayTCPServer(g, addr); err != nil {
+		stats := s.stats.open(forward)
+
+		err := relayTCPServer(g, addr, stats)
+
+		s.closeStats(g, forward, stats, err)
+
+		if err != nil {
 			s.logger.Info("Relaying TCP failed", "dest", addr, "err", err)
 
 			return err
@@ -83,12 +149,80 @@ func (s *Server) Relay(g grpc.BidiStreamingServer[RelayRequest, RelayResponse])
 	}
 }
 
-func relayTCPServer(g grpc.BidiStreamingServer[RelayRequest, RelayResponse], addr netip.AddrPort) error {
+// closeStats records the end of a relayed connection. Connections ended by the client cancelling the stream are not
+// counted as errors.
+func (s *Server) closeStats(
+	g grpc.BidiStreamingServer[RelayRequest, RelayResponse],
+	forward string,
+	stats *connStats,
+	err error,
+) {
+	if g.Context().Err() != nil {
+		err = nil
+	}
+
+	s.stats.close(forward, stats, err)
+}
+
+// serverQuery serves the Query service of the server.
+type serverQuery struct {
+	UnimplementedQueryServer
+	s *Server
+}
+
+// Health reports the server as serving, as it can only be reached while it is.
+func (q *serverQuery) Health(context.Context, *HealthRequest) (*HealthResponse, error) {
+	return &HealthResponse{
+		Status: HealthStatus_SERVING,
+	}, nil
+}
+
+func (q *serverQuery) ListForwards(context.Context, *ListForwardsRequest) (*ListForwardsResponse, error) {
+	stats := q.s.stats.snapshot()
+
+	forwards := make([]*ForwardStatus, 0, len(stats))
+
+	for _, f := range stats {
+		forwards = append(forwards, &ForwardStatus{
+			Name:   f.Forward,
+			Active: f.Active > 0,
+		})
+	}
+
+	return &ListForwardsResponse{
+		Forwards: forwards,
+	}, nil
+}
+
+func (q *serverQuery) GetStats(context.Context, *StatsRequest) (*StatsResponse, error) {
+	return &StatsResponse{
+		Forwards: q.s.stats.snapshot(),
+	}, nil
+}
+
+func relayTCPServer(
+	g grpc.BidiStreamingServer[RelayRequest, RelayResponse],
+	addr netip.AddrPort,
+	stats *connStats,
+) error {
+	begin := time.Now()
+
 	tcpConn, err := net.DialTCP("tcp", nil, net.TCPAddrFromAddrPort(addr))
 	if err != nil {
 		return fmt.Errorf("could not dial: %w", err)
 	}
 
+	stats.latency.Store(int64(time.Since(begin)))
+
+	return relayTCPConn(g, tcpConn, stats)
+}
+
+// relayTCPConn relays the connection over the stream until both directions have been closed.
+func relayTCPConn(
+	g grpc.BidiStreamingServer[RelayRequest, RelayResponse],
+	tcpConn *net.TCPConn,
+	stats *connStats,
+) error {
 	defer tcpConn.Close()
 
 	grp, gctx := errgroup.WithContext(g.Context())
@@ -119,6 +253,8 @@ func relayTCPServer(g grpc.BidiStreamingServer[RelayRequest, RelayResponse], add
 				return fmt.Errorf("could not read: %w", err)
 			}
 
+			stats.received.Add(int64(read))
+
 			if err := g.Send(&RelayResponse{
 				Message: &RelayResponse_Data{
 					Data: &RelayData{
@@ -143,6 +279,8 @@ func relayTCPServer(g grpc.BidiStreamingServer[RelayRequest, RelayResponse], add
 				if _, err := tcpConn.Write(m.Data.Data); err != nil {
 					return fmt.Errorf("failed to write: %w", err)
 				}
+
+				stats.sent.Add(int64(len(m.Data.Data)))
 			case *RelayRequest_Close:
 				switch m.Close {
 				case RelayClose_CLOSE_FULL:
@@ -162,3 +300,109 @@ func relayTCPServer(g grpc.BidiStreamingServer[RelayRequest, RelayResponse], add
 
 	return grp.Wait()
 }
+
+func (s *Server) Listen(req *ListenRequest, g grpc.ServerStreamingServer[ListenResponse]) error {
+	if req.Network != RelayNetwork_TCP {
+		return status.Error(codes.Unimplemented, "only tcp listening is supported")
+	}
+
+	lis, err := net.ListenTCP("tcp", &net.TCPAddr{})
+	if err != nil {
+		return fmt.Errorf("could not listen: %w", err)
+	}
+
+	defer lis.Close()
+
+	go func() {
+		<-g.Context().Done()
+		_ = lis.Close()
+	}()
+
+	addr := net.JoinHostPort(podIP(), strconv.Itoa(lis.Addr().(*net.TCPAddr).Port))
+
+	s.logger.Info("Listening for client", "addr", addr)
+
+	if err := g.Send(&ListenResponse{
+		Message: &ListenResponse_Started{
+			Started: &ListenStarted{
+				Address: addr,
+			},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to send started: %w", err)
+	}
+
+	for {
+		tcpConn, err := lis.AcceptTCP()
+		if err != nil {
+			if g.Context().Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("could not accept connection: %w", err)
+		}
+
+		id := strconv.FormatUint(s.lastID.Add(1), 10)
+
+		s.pendingMu.Lock()
+		s.pending[id] = &pendingConn{
+			conn:     tcpConn,
+			accepted: time.Now(),
+		}
+		s.pendingMu.Unlock()
+
+		// Connections the client never claims are dropped.
+		time.AfterFunc(acceptTimeout, func() {
+			if unclaimed := s.claim(id); unclaimed != nil {
+				_ = unclaimed.conn.Close()
+			}
+		})
+
+		if err := g.Send(&ListenResponse{
+			Message: &ListenResponse_Accepted{
+				Accepted: &ListenAccepted{
+					Id:   id,
+					Peer: tcpConn.RemoteAddr().String(),
+				},
+			},
+		}); err != nil {
+			return fmt.Errorf("failed to send accepted: %w", err)
+		}
+	}
+}
+
+// claim removes the pending connection, returning nil if it was already claimed or dropped.
+func (s *Server) claim(id string) *pendingConn {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	pending, ok := s.pending[id]
+	if !ok {
+		return nil
+	}
+
+	delete(s.pending, id)
+
+	return pending
+}
+
+// podIP returns the address the relay pod is reachable on, as set by the downward API, falling back to the first
+// global unicast interface address of either family.
+func podIP() string {
+	if ip := os.Getenv("POD_IP"); ip != "" {
+		return ip
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+			return ipNet.IP.String()
+		}
+	}
+
+	return ""
+}
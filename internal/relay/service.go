@@ -0,0 +1,345 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrServiceUnsupported = errors.New("installing the relay as a service is not supported on this system")
+
+const (
+	// serviceUnit is the user-level systemd unit running the client.
+	serviceUnit = "localflux-relay.service"
+	// serviceLabel is the label of the launchd agent running the client.
+	serviceLabel = "io.localflux.relay"
+)
+
+type ServiceState string
+
+const (
+	ServiceNotInstalled ServiceState = "not installed"
+	ServiceRunning      ServiceState = "running"
+	ServiceStopped      ServiceState = "stopped"
+)
+
+// ServiceOptions configures the relay client service.
+type ServiceOptions struct {
+	// Executable is the path of the localflux binary.
+	Executable string
+	// Args are the arguments of the binary, starting with the relay command.
+	Args []string
+	// Env are the additional environment variables of the process.
+	Env map[string]string
+}
+
+// InstallService registers the client as a service of the current user, started now and on login. An existing
+// service is replaced.
+func InstallService(ctx context.Context, opts ServiceOptions) error {
+	path, err := servicePath()
+	if err != nil {
+		return err
+	}
+
+	var definition string
+
+	switch runtime.GOOS {
+	case "linux":
+		definition = systemdUnit(opts)
+	case "darwin":
+		definition = launchdAgent(opts)
+	}
+
+	// The running service keeps its previous definition until restarted.
+	_ = StopService(ctx)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create service directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, []byte(definition), 0o644); err != nil {
+		return fmt.Errorf("failed to write service: %w", err)
+	}
+
+	if runtime.GOOS == "linux" {
+		if err := systemctl(ctx, "daemon-reload"); err != nil {
+			return err
+		}
+
+		if err := systemctl(ctx, "enable", serviceUnit); err != nil {
+			return err
+		}
+	}
+
+	return StartService(ctx)
+}
+
+// UninstallService stops the service and removes it.
+func UninstallService(ctx context.Context) error {
+	path, err := servicePath()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err := StopService(ctx); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "linux" {
+		if err := systemctl(ctx, "disable", serviceUnit); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove service: %w", err)
+	}
+
+	if runtime.GOOS == "linux" {
+		return systemctl(ctx, "daemon-reload")
+	}
+
+	return nil
+}
+
+// StartService starts the installed service.
+func StartService(ctx context.Context) error {
+	path, err := servicePath()
+	if err != nil {
+		return err
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		return systemctl(ctx, "start", serviceUnit)
+	case "darwin":
+		if _, loaded := launchdAgentState(ctx); loaded {
+			return nil
+		}
+
+		return launchctl(ctx, "bootstrap", launchdDomain(), path)
+	default:
+		return ErrServiceUnsupported
+	}
+}
+
+// StopService stops the service until it is next started, or the user next logs in.
+func StopService(ctx context.Context) error {
+	switch runtime.GOOS {
+	case "linux":
+		return systemctl(ctx, "stop", serviceUnit)
+	case "darwin":
+		if _, loaded := launchdAgentState(ctx); !loaded {
+			return nil
+		}
+
+		return launchctl(ctx, "bootout", launchdDomain()+"/"+serviceLabel)
+	default:
+		return ErrServiceUnsupported
+	}
+}
+
+// ServiceStatus returns the state of the service.
+func ServiceStatus(ctx context.Context) (ServiceState, error) {
+	path, err := servicePath()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return ServiceNotInstalled, nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to check service: %w", err)
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		// is-active exits non-zero for inactive units, which is reported on stdout regardless.
+		out, _ := exec.CommandContext(ctx, "systemctl", "--user", "is-active", serviceUnit).Output()
+
+		if strings.TrimSpace(string(out)) == "active" {
+			return ServiceRunning, nil
+		}
+
+		return ServiceStopped, nil
+	default:
+		if running, _ := launchdAgentState(ctx); running {
+			return ServiceRunning, nil
+		}
+
+		return ServiceStopped, nil
+	}
+}
+
+// launchdAgentState returns whether the agent is running, and whether it is loaded at all. Agents that exited remain
+// loaded until booted out, awaiting their restart.
+func launchdAgentState(ctx context.Context) (bool, bool) {
+	out, err := exec.CommandContext(ctx, "launchctl", "print", launchdDomain()+"/"+serviceLabel).Output()
+	if err != nil {
+		return false, false
+	}
+
+	return bytes.Contains(out, []byte("state = running")), true
+}
+
+// ServiceLogsHint returns how to view the output of the service.
+func ServiceLogsHint() string {
+	if runtime.GOOS == "darwin" {
+		return launchdLogPath()
+	}
+
+	return "journalctl --user -u " + serviceUnit
+}
+
+func servicePath() (string, error) {
+	switch runtime.GOOS {
+	case "linux":
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find config directory: %w", err)
+		}
+
+		return filepath.Join(dir, "systemd", "user", serviceUnit), nil
+	case "darwin":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find home directory: %w", err)
+		}
+
+		return filepath.Join(home, "Library", "LaunchAgents", serviceLabel+".plist"), nil
+	default:
+		return "", ErrServiceUnsupported
+	}
+}
+
+func systemdUnit(opts ServiceOptions) string {
+	var b strings.Builder
+
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=localflux relay client\n")
+	b.WriteString("After=network-online.target\n\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("ExecStart=" + systemdQuote(opts.Executable))
+
+	for _, arg := range opts.Args {
+		b.WriteString(" " + systemdQuote(arg))
+	}
+
+	b.WriteString("\n")
+
+	for _, key := range sortedKeys(opts.Env) {
+		b.WriteString("Environment=" + systemdQuote(key+"="+opts.Env[key]) + "\n")
+	}
+
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=5\n\n")
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=default.target\n")
+
+	return b.String()
+}
+
+// systemdQuote quotes the word, escaping the specifiers and variables systemd would otherwise expand.
+func systemdQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(s)
+
+	return `"` + s + `"`
+}
+
+func launchdAgent(opts ServiceOptions) string {
+	logPath := launchdLogPath()
+
+	var b strings.Builder
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString(`<plist version="1.0">` + "\n<dict>\n")
+	b.WriteString("\t<key>Label</key>\n\t<string>" + serviceLabel + "</string>\n")
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+
+	for _, arg := range append([]string{opts.Executable}, opts.Args...) {
+		b.WriteString("\t\t<string>" + xmlEscape(arg) + "</string>\n")
+	}
+
+	b.WriteString("\t</array>\n")
+
+	if len(opts.Env) > 0 {
+		b.WriteString("\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+
+		for _, key := range sortedKeys(opts.Env) {
+			b.WriteString("\t\t<key>" + xmlEscape(key) + "</key>\n")
+			b.WriteString("\t\t<string>" + xmlEscape(opts.Env[key]) + "</string>\n")
+		}
+
+		b.WriteString("\t</dict>\n")
+	}
+
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<true/>\n")
+	b.WriteString("\t<key>StandardOutPath</key>\n\t<string>" + xmlEscape(logPath) + "</string>\n")
+	b.WriteString("\t<key>StandardErrorPath</key>\n\t<string>" + xmlEscape(logPath) + "</string>\n")
+	b.WriteString("</dict>\n</plist>\n")
+
+	return b.String()
+}
+
+func launchdLogPath() string {
+	home, _ := os.UserHomeDir()
+
+	return filepath.Join(home, "Library", "Logs", "localflux-relay.log")
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+
+	_ = xml.EscapeText(&b, []byte(s))
+
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+func launchdDomain() string {
+	return "gui/" + strconv.Itoa(os.Getuid())
+}
+
+func systemctl(ctx context.Context, args ...string) error {
+	out, err := exec.CommandContext(ctx, "systemctl", append([]string{"--user"}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s failed: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+func launchctl(ctx context.Context, args ...string) error {
+	out, err := exec.CommandContext(ctx, "launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %s failed: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
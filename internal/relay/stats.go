@@ -0,0 +1,139 @@
+package relay
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connStats counts the bytes relayed over a connection.
+type connStats struct {
+	sent     atomic.Int64
+	received atomic.Int64
+	// latency is the time taken to establish the connection, in nanoseconds, or zero if it never was. It is only
+	// recorded by the side that dials the target: the server for relayed connections, and the client for
+	// port-forwards.
+	latency atomic.Int64
+}
+
+// statsTracker aggregates the statistics of relayed connections by forward. Byte counts include the connections that
+// are still active.
+type statsTracker struct {
+	mu       sync.Mutex
+	forwards map[string]*forwardCounters
+}
+
+type forwardCounters struct {
+	active   map[*connStats]struct{}
+	total    int64
+	errors   int64
+	sent     int64
+	received int64
+	connects int64
+	latency  time.Duration
+}
+
+func newStatsTracker() *statsTracker {
+	return &statsTracker{
+		forwards: make(map[string]*forwardCounters),
+	}
+}
+
+// open records a new connection of the forward, returning the stats to count it with.
+func (t *statsTracker) open(forward string) *connStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counters, ok := t.forwards[forward]
+	if !ok {
+		counters = &forwardCounters{
+			active: make(map[*connStats]struct{}),
+		}
+
+		t.forwards[forward] = counters
+	}
+
+	stats := &connStats{}
+
+	counters.active[stats] = struct{}{}
+	counters.total++
+
+	return stats
+}
+
+// close records the end of a connection opened with open. Connections that ended with an error are counted as
+// errors.
+func (t *statsTracker) close(forward string, stats *connStats, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counters, ok := t.forwards[forward]
+	if !ok {
+		return
+	}
+
+	delete(counters.active, stats)
+
+	counters.sent += stats.sent.Load()
+	counters.received += stats.received.Load()
+
+	if latency := stats.latency.Load(); latency > 0 {
+		counters.connects++
+		counters.latency += time.Duration(latency)
+	}
+
+	if err != nil {
+		counters.errors++
+	}
+}
+
+// snapshot returns the current statistics of each forward, sorted by name.
+func (t *statsTracker) snapshot() []*ForwardStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make([]*ForwardStats, 0, len(t.forwards))
+
+	for name, counters := range t.forwards {
+		stats := &ForwardStats{
+			Forward:  name,
+			Active:   int64(len(counters.active)),
+			Total:    counters.total,
+			Sent:     counters.sent,
+			Received: counters.received,
+			Errors:   counters.errors,
+		}
+
+		connects := counters.connects
+		latency := counters.latency
+
+		for active := range counters.active {
+			stats.Sent += active.sent.Load()
+			stats.Received += active.received.Load()
+
+			if l := active.latency.Load(); l > 0 {
+				connects++
+				latency += time.Duration(l)
+			}
+		}
+
+		if connects > 0 {
+			stats.ConnectLatencyNs = int64(latency) / connects
+		}
+
+		result = append(result, stats)
+	}
+
+	slices.SortFunc(result, func(a, b *ForwardStats) int {
+		return strings.Compare(a.Forward, b.Forward)
+	})
+
+	return result
+}
+
+// ConnectLatency returns the mean time taken to establish connections.
+func (x *ForwardStats) ConnectLatency() time.Duration {
+	return time.Duration(x.GetConnectLatencyNs())
+}
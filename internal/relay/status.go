@@ -0,0 +1,281 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+)
+
+// DefaultStatusAddress is the address the client serves its Query service on, used by "localflux relay status".
+const DefaultStatusAddress = "127.0.0.1:7681"
+
+// queryTimeout bounds the requests made to the Query service of a client.
+const queryTimeout = 5 * time.Second
+
+// EnableStatus serves the Query service of the client once the client runs.
+func (c *Client) EnableStatus(address string) {
+	if address == "" {
+		address = DefaultStatusAddress
+	}
+
+	c.statusAddress = address
+}
+
+// startStatus serves the Query service of the client on its status address.
+func (c *Client) startStatus(ctx context.Context, name string, cb Callbacks) error {
+	lis, err := net.Listen("tcp", c.statusAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen for status: %w", err)
+	}
+
+	srv := grpc.NewServer()
+	RegisterQueryServer(srv, &clientQuery{c: c, name: name})
+	reflection.Register(srv)
+
+	go func() {
+		<-ctx.Done()
+		srv.Stop()
+	}()
+
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			c.logger.Warn("Status server failed", "err", err)
+
+			cb.Warn(fmt.Sprintf("Status server failed: %v", err))
+		}
+	}()
+
+	return nil
+}
+
+// clientQuery serves the Query service of a running client.
+type clientQuery struct {
+	UnimplementedQueryServer
+	c    *Client
+	name string
+}
+
+// Health reports the client as serving while it is connected to the relay server and none of its forwards have
+// stopped.
+func (q *clientQuery) Health(context.Context, *HealthRequest) (*HealthResponse, error) {
+	if state := q.c.relayConn.GetState(); state != connectivity.Ready {
+		return &HealthResponse{
+			Status: HealthStatus_NOT_SERVING,
+			Detail: fmt.Sprintf("relay connection is %s", strings.ToLower(state.String())),
+		}, nil
+	}
+
+	var stopped []string
+
+	for _, status := range q.c.forwardStatuses() {
+		if !status.Active {
+			stopped = append(stopped, status.Name)
+		}
+	}
+
+	if len(stopped) > 0 {
+		return &HealthResponse{
+			Status: HealthStatus_NOT_SERVING,
+			Detail: "forwards stopped: " + strings.Join(stopped, ", "),
+		}, nil
+	}
+
+	return &HealthResponse{
+		Status: HealthStatus_SERVING,
+	}, nil
+}
+
+func (q *clientQuery) ListForwards(context.Context, *ListForwardsRequest) (*ListForwardsResponse, error) {
+	return &ListForwardsResponse{
+		Context:  q.name,
+		Forwards: q.c.forwardStatuses(),
+	}, nil
+}
+
+func (q *clientQuery) GetStats(context.Context, *StatsRequest) (*StatsResponse, error) {
+	return &StatsResponse{
+		Forwards: q.c.Stats(),
+	}, nil
+}
+
+// forwardStatuses returns the status of each forward, sorted by name. Statuses are only read here, as the forwards
+// are reconciled on a separate goroutine.
+func (c *Client) forwardStatuses() []*ForwardStatus {
+	c.statusesMu.Lock()
+	defer c.statusesMu.Unlock()
+
+	result := make([]*ForwardStatus, 0, len(c.statuses))
+
+	for _, status := range c.statuses {
+		result = append(result, status.report())
+	}
+
+	slices.SortFunc(result, func(a, b *ForwardStatus) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return result
+}
+
+// QueryStatus requests the forwards and health of the relay client serving on the address.
+func QueryStatus(ctx context.Context, address string) (*ListForwardsResponse, *HealthResponse, error) {
+	var (
+		forwards *ListForwardsResponse
+		health   *HealthResponse
+	)
+
+	err := callQuery(ctx, address, func(ctx context.Context, qc QueryClient) error {
+		var err error
+
+		if forwards, err = qc.ListForwards(ctx, &ListForwardsRequest{}); err != nil {
+			return fmt.Errorf("failed to list forwards: %w", err)
+		}
+
+		if health, err = qc.Health(ctx, &HealthRequest{}); err != nil {
+			return fmt.Errorf("failed to check health: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return forwards, health, nil
+}
+
+// QueryStats requests the statistics of the connections relayed by the relay client serving on the address.
+func QueryStats(ctx context.Context, address string) ([]*ForwardStats, error) {
+	var stats []*ForwardStats
+
+	err := callQuery(ctx, address, func(ctx context.Context, qc QueryClient) error {
+		resp, err := qc.GetStats(ctx, &StatsRequest{})
+		if err != nil {
+			return fmt.Errorf("failed to get stats: %w", err)
+		}
+
+		stats = resp.Forwards
+
+		return nil
+	})
+
+	return stats, err
+}
+
+// callQuery calls the Query service of the relay client serving on the address. Clients that are not running fail
+// the call rather than being waited for.
+func callQuery(ctx context.Context, address string, fn func(ctx context.Context, qc QueryClient) error) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return fmt.Errorf("failed to create grpc client: %w", err)
+	}
+
+	defer conn.Close()
+
+	if err := fn(ctx, NewQueryClient(conn)); err != nil {
+		return fmt.Errorf("failed to query relay client: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Status) report() *ForwardStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &ForwardStatus{
+		Name:   s.name,
+		Remote: s.remote,
+		Local:  slices.Clone(s.local),
+		Active: s.active.Load(),
+	}
+
+	if s.err != nil {
+		report.Error = s.err.Error()
+	}
+
+	return report
+}
+
+// newStatus returns the status of a starting forward, carrying over the failures of its previous run.
+func newStatus(name string, cancel func(), previous *Status) *Status {
+	status := &Status{
+		cancel:  cancel,
+		name:    name,
+		started: time.Now(),
+	}
+
+	if previous != nil {
+		previous.mu.Lock()
+		status.failures = previous.failures
+		previous.mu.Unlock()
+	}
+
+	status.active.Store(true)
+
+	return status
+}
+
+// failed records the error that stopped the forward, and schedules its retry. Forwards that ran for a while start
+// their backoff over.
+func (s *Status) failed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.started) >= forwardStableAfter {
+		s.failures = 0
+	}
+
+	s.err = err
+	s.retryAt = time.Now().Add(retryBackoff.Delay(s.failures))
+	s.failures++
+}
+
+// retryDue reports whether a stopped forward may be started again.
+func (s *Status) retryDue() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return !time.Now().Before(s.retryAt)
+}
+
+func (s *Status) setRemote(remote string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remote = remote
+}
+
+func (s *Status) addLocal(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.local = append(s.local, addr)
+}
+
+// trackRemote wraps the resolver, recording each resolved address.
+func (s *Status) trackRemote(
+	resolver func(ctx context.Context) (string, error),
+) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		remote, err := resolver(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		s.setRemote(remote)
+
+		return remote, nil
+	}
+}
@@ -0,0 +1,311 @@
+package relay
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WebSocketOptions configures the websocket transport of the client, which tunnels the gRPC channel over a WebSocket
+// rather than an API server port-forward.
+type WebSocketOptions struct {
+	// URL is the URL of the endpoint. Defaults to the node port of the first ready node.
+	URL string
+}
+
+// EnableWebSocket connects to the relay server over a WebSocket once the client connects.
+func (c *Client) EnableWebSocket(opts WebSocketOptions) {
+	c.webSocketOpts = &opts
+}
+
+// dialWebSocket tunnels to the WebSocket endpoint of the relay server, authenticating with the token of the cluster.
+func (c *Client) dialWebSocket(ctx context.Context, _ string) (net.Conn, error) {
+	secret, err := c.client.ClientSet().CoreV1().Secrets(cluster.LFNamespace).Get(
+		ctx,
+		cluster.RelayTokenSecret,
+		metav1.GetOptions{},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relay token: %w", err)
+	}
+
+	url := c.webSocketOpts.URL
+	if url == "" {
+		url, err = c.nodePortURL(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.logger.Info("Connecting to relay over WebSocket", "url", url)
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+string(secret.Data[cluster.RelayTokenKey]))
+
+	ws, resp, err := websocket.DefaultDialer.DialContext(ctx, url, header)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", url, err)
+	}
+
+	return &wsConn{ws: ws}, nil
+}
+
+// nodePortURL returns the URL of the endpoint on the node port of the first ready node.
+func (c *Client) nodePortURL(ctx context.Context) (string, error) {
+	svc, err := c.client.ClientSet().CoreV1().Services(cluster.LFNamespace).Get(
+		ctx,
+		cluster.RelayWebSocketService,
+		metav1.GetOptions{},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to get relay websocket service: %w", err)
+	}
+
+	var nodePort int32
+
+	for _, port := range svc.Spec.Ports {
+		if port.NodePort != 0 {
+			nodePort = port.NodePort
+		}
+	}
+
+	if nodePort == 0 {
+		return "", fmt.Errorf("relay websocket service has no node port")
+	}
+
+	nodes, err := c.client.ClientSet().CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	for _, node := range nodes.Items {
+		if !nodeReady(&node) {
+			continue
+		}
+
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == corev1.NodeInternalIP {
+				host := net.JoinHostPort(addr.Address, strconv.Itoa(int(nodePort)))
+
+				return "ws://" + host + cluster.RelayWebSocketPath, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("failed to find a ready node")
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// EnableWebSocket serves the gRPC service over WebSockets on the address once the server runs, alongside the plain
+// listener. Clients must present the token.
+func (s *Server) EnableWebSocket(address string, token string) {
+	s.wsAddress = address
+	s.wsToken = token
+}
+
+// serveWebSocket upgrades authenticated requests to the endpoint, handing the connections to the gRPC server.
+func (s *Server) serveWebSocket(ctx context.Context, srv *grpc.Server) error {
+	tcpLis, err := net.Listen("tcp", s.wsAddress)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %w", s.wsAddress, err)
+	}
+
+	lis := &connListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+		addr:  tcpLis.Addr(),
+	}
+
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  bufferSize,
+		WriteBufferSize: bufferSize,
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET "+cluster.RelayWebSocketPath, func(w http.ResponseWriter, r *http.Request) {
+		expected := "Bearer " + s.wsToken
+
+		if s.wsToken == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+			return
+		}
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			s.logger.Warn("Failed to upgrade websocket", "err", err)
+
+			return
+		}
+
+		s.logger.Info("Accepted websocket client", "peer", r.RemoteAddr)
+
+		select {
+		case lis.conns <- &wsConn{ws: ws}:
+		case <-lis.done:
+			_ = ws.Close()
+		}
+	})
+
+	httpSrv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = httpSrv.Close()
+		_ = lis.Close()
+	}()
+
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			s.logger.Warn("WebSocket gRPC server stopped", "err", err)
+		}
+	}()
+
+	if err := httpSrv.Serve(tcpLis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve websocket: %w", err)
+	}
+
+	return nil
+}
+
+// connListener hands connections accepted elsewhere to a server.
+type connListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+	addr  net.Addr
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
+
+// wsConn adapts a WebSocket to a stream of bytes, carried in binary messages.
+type wsConn struct {
+	ws *websocket.Conn
+
+	readMu sync.Mutex
+	reader io.Reader
+
+	writeMu sync.Mutex
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for {
+		if c.reader == nil {
+			kind, reader, err := c.ws.NextReader()
+			if err != nil {
+				var closeErr *websocket.CloseError
+				if errors.As(err, &closeErr) && closeErr.Code == websocket.CloseNormalClosure {
+					return 0, io.EOF
+				}
+
+				return 0, err
+			}
+
+			if kind != websocket.BinaryMessage {
+				continue
+			}
+
+			c.reader = reader
+		}
+
+		n, err := c.reader.Read(p)
+		if errors.Is(err, io.EOF) {
+			c.reader = nil
+
+			if n == 0 {
+				continue
+			}
+
+			err = nil
+		}
+
+		return n, err
+	}
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (c *wsConn) Close() error {
+	return c.ws.Close()
+}
+
+func (c *wsConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+func (c *wsConn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	return errors.Join(c.ws.SetReadDeadline(t), c.ws.SetWriteDeadline(t))
+}
+
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
@@ -0,0 +1,175 @@
+// Package selftest deploys a small built-in demo to check that a cluster and localflux work end to end.
+package selftest
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/csnewman/localflux/internal/cluster"
+	"github.com/csnewman/localflux/internal/config"
+	"github.com/csnewman/localflux/internal/config/v1alpha2"
+	"github.com/csnewman/localflux/internal/deployment"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//go:embed _demo
+var demo embed.FS
+
+const (
+	// Name is the name of the deployment, which is also used as its namespace.
+	Name = "localflux-selftest"
+
+	// imagePlaceholder is replaced in the demo manifests with the image pushed to the cluster registry.
+	imagePlaceholder = "localflux.invalid/selftest"
+
+	expectBody = "Hello World from LocalFlux demo!"
+)
+
+// Run builds and deploys the embedded demo to the cluster, requests its endpoint through the relay and removes it
+// again. This exercises the cluster, registry, buildkit, flux and relay integration in one go.
+func Run(ctx context.Context, logger *slog.Logger, cfg config.Config, clusterName string, cb deployment.Callbacks) error {
+	if clusterName == "" {
+		clusterName = cfg.DefaultCluster
+	}
+
+	cm := cluster.NewManager(logger, cfg)
+
+	provider, err := cm.Provider(clusterName)
+	if err != nil {
+		return err
+	}
+
+	if !provider.RelayConfig().Enabled {
+		return fmt.Errorf("%w: %s", deployment.ErrRelayDisabled, clusterName)
+	}
+
+	dir, err := os.MkdirTemp("", "localflux-selftest-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	image := provider.Registry() + "/localflux/selftest"
+
+	if err := extract(dir, image); err != nil {
+		return err
+	}
+
+	// Only the cluster definitions are kept from the user's config, so that the demo runs in isolation.
+	testCfg := cfg.DeepCopy()
+	testCfg.Deployments = []*v1alpha2.Deployment{demoDeployment(dir, image)}
+
+	m := deployment.NewManager(logger, testCfg, cluster.NewManager(logger, testCfg))
+
+	_, deployErr := m.Deploy(ctx, clusterName, Name, deployment.DeployOptions{}, cb)
+
+	// Clean up even when the run was interrupted, as the demo would otherwise be left running.
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 3*time.Minute)
+	defer cancel()
+
+	return errors.Join(deployErr, cleanup(cleanupCtx, m, provider, clusterName, cb))
+}
+
+func demoDeployment(dir string, image string) *v1alpha2.Deployment {
+	return &v1alpha2.Deployment{
+		Name: Name,
+		Images: []*v1alpha2.Image{
+			{
+				Image:   image,
+				Context: filepath.Join(dir, "hello"),
+			},
+		},
+		Steps: []*v1alpha2.Step{
+			{
+				Name: "hello",
+				Kustomize: &v1alpha2.Kustomize{
+					Context:   filepath.Join(dir, "deploy"),
+					Namespace: Name,
+				},
+				Verify: []*v1alpha2.Probe{
+					{
+						Name:  "relay",
+						Relay: true,
+						HTTP: &v1alpha2.HTTPProbe{
+							URL:        "${LOCALFLUX_THE_DEPLOYMENT_8080_URL}",
+							ExpectBody: expectBody,
+						},
+					},
+				},
+			},
+		},
+		PortForward: []*v1alpha2.PortForward{
+			{
+				Kind:      "Deployment",
+				Namespace: Name,
+				Name:      "the-deployment",
+				Port:      8080,
+			},
+		},
+	}
+}
+
+// extract writes the embedded demo to dir, pointing its manifests at the given image.
+func extract(dir string, image string) error {
+	root, err := fs.Sub(demo, "_demo")
+	if err != nil {
+		return fmt.Errorf("failed to open demo: %w", err)
+	}
+
+	return fs.WalkDir(root, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(path))
+
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+
+		data, err := fs.ReadFile(root, path)
+		if err != nil {
+			return fmt.Errorf("failed to read demo file: %w", err)
+		}
+
+		data = []byte(strings.ReplaceAll(string(data), imagePlaceholder, image))
+
+		if err := os.WriteFile(target, data, 0o644); err != nil {
+			return fmt.Errorf("failed to write demo file: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func cleanup(ctx context.Context, m *deployment.Manager, provider cluster.Provider, clusterName string, cb deployment.Callbacks) error {
+	if err := m.Remove(ctx, clusterName, Name, cb); err != nil {
+		return fmt.Errorf("failed to remove demo: %w", err)
+	}
+
+	kc, err := provider.K8sClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %w", err)
+	}
+
+	if err := kc.Controller().Delete(ctx, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: Name,
+		},
+	}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete namespace: %w", err)
+	}
+
+	return nil
+}
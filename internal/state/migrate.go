@@ -0,0 +1,63 @@
+package state
+
+import (
+	"fmt"
+	"os"
+)
+
+// migration moves the state directory from the previous version to version.
+type migration struct {
+	version     int
+	description string
+	apply       func(s *Store) error
+}
+
+// migrations must be ordered by version, with no gaps. Existing migrations must never be modified once released;
+// changes to the layout are made by appending a new migration.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "Create initial layout",
+		apply: func(s *Store) error {
+			for _, dir := range []string{DirRuns, DirLocks, DirCache, DirRelay, DirTimings} {
+				if err := os.MkdirAll(s.Path(dir), 0o755); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	},
+}
+
+// CurrentVersion is the layout version written by this build.
+var CurrentVersion = migrations[len(migrations)-1].version
+
+func (s *Store) migrate() error {
+	version, err := s.version()
+	if err != nil {
+		return err
+	}
+
+	if version > CurrentVersion {
+		return fmt.Errorf("%w: found version %d, expected at most %d", ErrNewerVersion, version, CurrentVersion)
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+
+		s.logger.Info("Migrating state directory", "version", m.version, "description", m.description)
+
+		if err := m.apply(s); err != nil {
+			return fmt.Errorf("failed to migrate state to version %d: %w", m.version, err)
+		}
+
+		if err := s.setVersion(m.version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+// Package state manages the local state directory, by default ~/.localflux, shared by features that persist data
+// between runs. The directory layout is versioned and migrated forward when opened.
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+var ErrNewerVersion = errors.New("state directory was written by a newer version of localflux")
+
+// HomeEnv overrides the location of the state directory.
+const HomeEnv = "LOCALFLUX_HOME"
+
+const (
+	// DirRuns holds records of previous runs.
+	DirRuns = "runs"
+	// DirLocks holds lock files coordinating concurrent invocations.
+	DirLocks = "locks"
+	// DirCache holds data that can be recreated at any time.
+	DirCache = "cache"
+	// DirRelay holds state of the relay daemon.
+	DirRelay = "relay"
+	// DirTimings holds the duration history of previous steps.
+	DirTimings = "timings"
+)
+
+const (
+	versionFile = "VERSION"
+	rootLock    = ".lock"
+	lockRetry   = 100 * time.Millisecond
+)
+
+type Store struct {
+	logger *slog.Logger
+	root   string
+}
+
+// DefaultDir returns the state directory, honouring LOCALFLUX_HOME.
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(HomeEnv); dir != "" {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+
+	return filepath.Join(home, ".localflux"), nil
+}
+
+// Open opens the default state directory, creating and migrating it as needed.
+func Open(ctx context.Context, logger *slog.Logger) (*Store, error) {
+	dir, err := DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenDir(ctx, logger, dir)
+}
+
+// OpenDir opens the state directory at root, creating and migrating it as needed. Migration holds an exclusive lock
+// so that concurrent invocations do not migrate at the same time.
+func OpenDir(ctx context.Context, logger *slog.Logger, root string) (*Store, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	s := &Store{
+		logger: logger,
+		root:   root,
+	}
+
+	lock := flock.New(filepath.Join(root, rootLock))
+
+	if _, err := lock.TryLockContext(ctx, lockRetry); err != nil {
+		return nil, fmt.Errorf("failed to lock state directory: %w", err)
+	}
+
+	defer lock.Unlock()
+
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Root returns the path of the state directory.
+func (s *Store) Root() string {
+	return s.root
+}
+
+// Path returns the absolute path of an entry within the state directory.
+func (s *Store) Path(elem ...string) string {
+	return filepath.Join(append([]string{s.root}, elem...)...)
+}
+
+// ReadJSON decodes the entry at path into v. Missing entries return an error matching os.ErrNotExist.
+func (s *Store) ReadJSON(path string, v any) error {
+	data, err := os.ReadFile(s.Path(path))
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// WriteJSON atomically replaces the entry at path with v encoded as JSON.
+func (s *Store) WriteJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %q: %w", path, err)
+	}
+
+	return s.writeFile(path, data)
+}
+
+func (s *Store) writeFile(path string, data []byte) error {
+	target := s.Path(path)
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to write %q: %w", path, err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+
+		return fmt.Errorf("failed to write %q: %w", path, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %q: %w", path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("failed to write %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// Remove deletes the entry at path. Missing entries are ignored.
+func (s *Store) Remove(path string) error {
+	if err := os.RemoveAll(s.Path(path)); err != nil {
+		return fmt.Errorf("failed to remove %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// List returns the names of the entries in dir in lexical order. A missing directory is treated as empty.
+func (s *Store) List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(s.Path(dir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list %q: %w", dir, err)
+	}
+
+	names := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		names = append(names, entry.Name())
+	}
+
+	slices.Sort(names)
+
+	return names, nil
+}
+
+// Prune removes all but the last keep entries of dir, in lexical order. Entries should therefore be named so that
+// they sort by age, e.g. prefixed with a timestamp.
+func (s *Store) Prune(dir string, keep int) error {
+	names, err := s.List(dir)
+	if err != nil {
+		return err
+	}
+
+	for len(names) > keep {
+		if err := os.RemoveAll(s.Path(dir, names[0])); err != nil {
+			return fmt.Errorf("failed to prune %q: %w", names[0], err)
+		}
+
+		names = names[1:]
+	}
+
+	return nil
+}
+
+// Lock takes an exclusive, named lock shared across processes, waiting until it is available or the context is
+// cancelled. The returned function releases the lock.
+func (s *Store) Lock(ctx context.Context, name string) (func(), error) {
+	if err := os.MkdirAll(s.Path(DirLocks), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	lock := flock.New(s.Path(DirLocks, name+".lock"))
+
+	if _, err := lock.TryLockContext(ctx, lockRetry); err != nil {
+		return nil, fmt.Errorf("failed to acquire lock %q: %w", name, err)
+	}
+
+	return func() {
+		if err := lock.Unlock(); err != nil {
+			s.logger.Warn("Failed to release lock", "name", name, "err", err)
+		}
+	}, nil
+}
+
+func (s *Store) version() (int, error) {
+	data, err := os.ReadFile(s.Path(versionFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read state version: %w", err)
+	}
+
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid state version: %w", err)
+	}
+
+	return version, nil
+}
+
+func (s *Store) setVersion(version int) error {
+	return s.writeFile(versionFile, []byte(strconv.Itoa(version)+"\n"))
+}
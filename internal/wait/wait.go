@@ -0,0 +1,144 @@
+// Package wait provides polling with adaptive intervals and jitter, keeping API server load low when many
+// deployments or clusters are handled at once.
+package wait
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+var ErrTimeout = errors.New("timed out")
+
+// Status is reported by a condition after each attempt.
+type Status int
+
+const (
+	// Pending means the condition is not yet met and nothing has changed, so the interval grows.
+	Pending Status = iota
+	// Progressing means the condition is not yet met but the observed state changed, so the interval is reset.
+	Progressing
+	// Done means the condition is met and polling stops.
+	Done
+)
+
+// Backoff controls the interval between attempts.
+type Backoff struct {
+	// Initial is the interval after the first attempt and after any attempt reporting Progressing.
+	Initial time.Duration
+	// Max caps the interval.
+	Max time.Duration
+	// Factor multiplies the interval after each attempt reporting Pending. Values below one keep it constant.
+	Factor float64
+	// Jitter randomises each interval by up to this fraction in either direction, e.g. 0.2 for ±20%.
+	Jitter float64
+	// Timeout bounds the total time spent polling. Zero disables the timeout.
+	Timeout time.Duration
+}
+
+// Default suits waiting on API server state that normally settles within seconds.
+var Default = Backoff{
+	Initial: 100 * time.Millisecond,
+	Max:     2 * time.Second,
+	Factor:  1.5,
+	Jitter:  0.2,
+}
+
+// WithTimeout returns a copy of the backoff with the given timeout.
+func (b Backoff) WithTimeout(timeout time.Duration) Backoff {
+	b.Timeout = timeout
+
+	return b
+}
+
+// Interval returns a fixed interval with jitter, for periodic work that should not synchronise across clients.
+func Interval(interval time.Duration) Backoff {
+	return Backoff{
+		Initial: interval,
+		Max:     interval,
+		Jitter:  0.1,
+	}
+}
+
+// Poll runs fn immediately and then repeatedly until it reports Done, returns an error, the context is cancelled or
+// the timeout elapses. A timeout is reported as ErrTimeout.
+func Poll(ctx context.Context, b Backoff, fn func(ctx context.Context) (Status, error)) error {
+	var deadline <-chan time.Time
+
+	if b.Timeout > 0 {
+		timer := time.NewTimer(b.Timeout)
+		defer timer.Stop()
+
+		deadline = timer.C
+	}
+
+	interval := b.Initial
+
+	for {
+		status, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+
+		switch status {
+		case Done:
+			return nil
+		case Progressing:
+			interval = b.Initial
+		}
+
+		timer := time.NewTimer(jitter(interval, b.Jitter))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		case <-deadline:
+			timer.Stop()
+
+			return ErrTimeout
+		case <-timer.C:
+		}
+
+		if status == Pending && b.Factor > 1 {
+			interval = time.Duration(float64(interval) * b.Factor)
+
+			if b.Max > 0 {
+				interval = min(interval, b.Max)
+			}
+		}
+	}
+}
+
+// Delay returns the interval before the given retry of failed work, counting from zero, with jitter applied.
+func (b Backoff) Delay(attempt int) time.Duration {
+	interval := b.Initial
+
+	for range attempt {
+		if b.Factor <= 1 {
+			break
+		}
+
+		interval = time.Duration(float64(interval) * b.Factor)
+
+		if b.Max > 0 && interval >= b.Max {
+			interval = b.Max
+
+			break
+		}
+	}
+
+	return jitter(interval, b.Jitter)
+}
+
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 || d <= 0 {
+		return d
+	}
+
+	delta := float64(d) * fraction * (rand.Float64()*2 - 1)
+
+	return d + time.Duration(delta)
+}
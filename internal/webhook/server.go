@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// Path is the path the deployment webhook is served on.
+	Path = "/validate-deployment"
+	// Port is the port the webhook server listens on.
+	Port = 9443
+)
+
+// Server serves the validating webhook of flux.local deployments from within the cluster.
+type Server struct {
+	logger *slog.Logger
+	scheme *runtime.Scheme
+	client client.Client
+}
+
+// NewServer creates a server using the in-cluster credentials.
+func NewServer(logger *slog.Logger) (*Server, error) {
+	scheme := runtime.NewScheme()
+
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("failed to register types: %w", err)
+	}
+
+	restConfig, err := ctrlconfig.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubernetes config: %w", err)
+	}
+
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	return &Server{
+		logger: logger,
+		scheme: scheme,
+		client: c,
+	}, nil
+}
+
+// Run serves the webhook on the address until the context is cancelled, using the "tls.crt" and "tls.key" files of
+// the certificate directory.
+func (s *Server) Run(ctx context.Context, addr string, certDir string) error {
+	s.logger.Info("Starting webhook server", "addr", addr)
+
+	mux := http.NewServeMux()
+	mux.Handle(Path, admission.WithCustomValidator(s.scheme, &v1alpha1.Deployment{}, s))
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	err := srv.ListenAndServeTLS(filepath.Join(certDir, "tls.crt"), filepath.Join(certDir, "tls.key"))
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Server) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, s.validate(ctx, obj)
+}
+
+func (s *Server) ValidateUpdate(ctx context.Context, _ runtime.Object, obj runtime.Object) (admission.Warnings, error) {
+	return nil, s.validate(ctx, obj)
+}
+
+func (s *Server) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (s *Server) validate(ctx context.Context, obj runtime.Object) error {
+	deployment, ok := obj.(*v1alpha1.Deployment)
+	if !ok {
+		return fmt.Errorf("unexpected object %T", obj)
+	}
+
+	var others v1alpha1.DeploymentList
+
+	if err := s.client.List(ctx, &others); err != nil {
+		return fmt.Errorf("failed to list deployments: %w", err)
+	}
+
+	errs := Validate(deployment, others.Items)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	s.logger.Info("Rejected deployment", "namespace", deployment.Namespace, "name", deployment.Name, "err", errs)
+
+	return apierrors.NewInvalid(v1alpha1.GroupVersion.WithKind(v1alpha1.DeploymentKind).GroupKind(), deployment.Name, errs)
+}
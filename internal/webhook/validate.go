@@ -0,0 +1,255 @@
+package webhook
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var compressions = []string{"", "none", "snappy", "zstd"}
+
+// defaultBindAddress is the address the relay serves forwards on when neither the forward nor the relay sets one, for
+// deployments that do not record the bind address of their relay.
+var defaultBindAddress = netip.MustParseAddr("127.0.0.1")
+
+// Validate checks the port and reverse forwards of the deployment, and that they do not collide with each other or
+// with those of the other deployments. Forwards collide when they are served on the same local address, or create the
+// same reverse forward service. Forwards without a bind address are served on the bind address of their deployment.
+func Validate(deployment *v1alpha1.Deployment, others []v1alpha1.Deployment) field.ErrorList {
+	var errs field.ErrorList
+
+	if deployment.BindAddress != "" {
+		if _, err := netip.ParseAddr(deployment.BindAddress); err != nil {
+			errs = append(errs, field.Invalid(
+				field.NewPath("bindAddress"),
+				deployment.BindAddress,
+				"must be an IP address",
+			))
+		}
+	}
+
+	var local []localClaim
+
+	reverse := make(map[string]string)
+
+	for _, other := range others {
+		if other.Namespace == deployment.Namespace && other.Name == deployment.Name {
+			continue
+		}
+
+		owner := fmt.Sprintf("deployment %s/%s", other.Namespace, other.Name)
+
+		for _, forward := range other.PortForward {
+			if addr, ok := localAddr(forward, bindAddress(&other)); ok {
+				local = append(local, localClaim{addr: addr, owner: owner})
+			}
+		}
+
+		for _, forward := range other.ReverseForward {
+			reverse[forward.Namespace+"/"+forward.Name] = owner
+		}
+	}
+
+	for i, forward := range deployment.PortForward {
+		path := field.NewPath("portForward").Index(i)
+
+		errs = append(errs, validatePortForward(path, forward)...)
+
+		addr, ok := localAddr(forward, bindAddress(deployment))
+		if !ok {
+			continue
+		}
+
+		if i := slices.IndexFunc(local, func(claim localClaim) bool { return overlaps(claim.addr, addr) }); i != -1 {
+			errs = append(errs, field.Duplicate(
+				path.Child("localPort"),
+				fmt.Sprintf("local address %s is already forwarded by %s", local[i].addr, local[i].owner),
+			))
+
+			continue
+		}
+
+		local = append(local, localClaim{addr: addr, owner: path.String()})
+	}
+
+	for i, forward := range deployment.ReverseForward {
+		path := field.NewPath("reverseForward").Index(i)
+
+		errs = append(errs, validateReverseForward(path, forward)...)
+
+		key := forward.Namespace + "/" + forward.Name
+
+		if owner, ok := reverse[key]; ok {
+			errs = append(errs, field.Duplicate(
+				path.Child("name"),
+				fmt.Sprintf("service %s is already created by %s", key, owner),
+			))
+
+			continue
+		}
+
+		reverse[key] = path.String()
+	}
+
+	return errs
+}
+
+func validatePortForward(path *field.Path, forward *v1alpha1.PortForward) field.ErrorList {
+	var errs field.ErrorList
+
+	namespaceKind := strings.EqualFold(forward.Kind, v1alpha1.ForwardKindNamespace)
+
+	switch {
+	case forward.Kind == "":
+		errs = append(errs, field.Required(path.Child("kind"), ""))
+	case strings.Contains(forward.Kind, "/"):
+		errs = append(errs, field.Invalid(path.Child("kind"), forward.Kind, "must be a resource kind"))
+	}
+
+	if namespaceKind {
+		errs = append(errs, validateName(path.Child("name"), forward.Name, validation.IsDNS1123Label)...)
+	} else {
+		errs = append(errs, validateName(path.Child("namespace"), forward.Namespace, validation.IsDNS1123Label)...)
+		errs = append(errs, validateName(path.Child("name"), forward.Name, validation.IsDNS1123Subdomain)...)
+	}
+
+	// The namespace kind forwards every port when the port is unset.
+	if forward.Port != 0 || !namespaceKind {
+		errs = append(errs, validatePort(path.Child("port"), forward.Port)...)
+	}
+
+	if forward.LocalPort != nil {
+		errs = append(errs, validatePort(path.Child("localPort"), *forward.LocalPort)...)
+	}
+
+	if forward.BindAddress != "" {
+		if _, err := netip.ParseAddr(forward.BindAddress); err != nil {
+			errs = append(errs, field.Invalid(path.Child("bindAddress"), forward.BindAddress, "must be an IP address"))
+		}
+	}
+
+	if !slices.ContainsFunc(compressions, func(c string) bool { return strings.EqualFold(c, forward.Compression) }) {
+		errs = append(errs, field.NotSupported(path.Child("compression"), forward.Compression, compressions[1:]))
+	}
+
+	if forward.NetworkConditions != nil {
+		errs = append(errs, validateNetworkConditions(path.Child("networkConditions"), forward.NetworkConditions)...)
+	}
+
+	return errs
+}
+
+func validateNetworkConditions(path *field.Path, conditions *v1alpha1.NetworkConditions) field.ErrorList {
+	var errs field.ErrorList
+
+	if conditions.Latency != nil && conditions.Latency.Duration < 0 {
+		errs = append(errs, field.Invalid(path.Child("latency"), conditions.Latency.String(), "must not be negative"))
+	}
+
+	if conditions.Bandwidth != nil && conditions.Bandwidth.Sign() <= 0 {
+		errs = append(errs, field.Invalid(path.Child("bandwidth"), conditions.Bandwidth.String(), "must be positive"))
+	}
+
+	if conditions.PacketLoss < 0 || conditions.PacketLoss > 100 {
+		errs = append(errs, field.Invalid(path.Child("packetLoss"), conditions.PacketLoss, "must be between 0 and 100"))
+	}
+
+	return errs
+}
+
+func validateReverseForward(path *field.Path, forward *v1alpha1.ReverseForward) field.ErrorList {
+	var errs field.ErrorList
+
+	errs = append(errs, validateName(path.Child("namespace"), forward.Namespace, validation.IsDNS1123Label)...)
+	errs = append(errs, validateName(path.Child("name"), forward.Name, validation.IsDNS1035Label)...)
+	errs = append(errs, validatePort(path.Child("port"), forward.Port)...)
+
+	// The local port defaults to the service port.
+	if forward.LocalPort != 0 {
+		errs = append(errs, validatePort(path.Child("localPort"), forward.LocalPort)...)
+	}
+
+	return errs
+}
+
+func validateName(path *field.Path, name string, check func(string) []string) field.ErrorList {
+	if name == "" {
+		return field.ErrorList{field.Required(path, "")}
+	}
+
+	var errs field.ErrorList
+
+	for _, msg := range check(name) {
+		errs = append(errs, field.Invalid(path, name, msg))
+	}
+
+	return errs
+}
+
+func validatePort(path *field.Path, port int) field.ErrorList {
+	var errs field.ErrorList
+
+	for _, msg := range validation.IsValidPortNum(port) {
+		errs = append(errs, field.Invalid(path, port, msg))
+	}
+
+	return errs
+}
+
+// localClaim is a local address claimed by a port forward.
+type localClaim struct {
+	addr  netip.AddrPort
+	owner string
+}
+
+// bindAddress returns the address the forwards of the deployment that set none are served on.
+func bindAddress(deployment *v1alpha1.Deployment) netip.Addr {
+	addr, err := netip.ParseAddr(deployment.BindAddress)
+	if err != nil {
+		return defaultBindAddress
+	}
+
+	return addr.Unmap()
+}
+
+// localAddr returns the local address the forward is served on. Forwards without a bind address are served on the
+// given default. Forwards of the namespace kind are served on a range of ports assigned by the relay, so never
+// collide.
+func localAddr(forward *v1alpha1.PortForward, defaultAddr netip.Addr) (netip.AddrPort, bool) {
+	if strings.EqualFold(forward.Kind, v1alpha1.ForwardKindNamespace) {
+		return netip.AddrPort{}, false
+	}
+
+	port := forward.Port
+	if forward.LocalPort != nil {
+		port = *forward.LocalPort
+	}
+
+	addr := defaultAddr
+
+	if forward.BindAddress != "" {
+		parsed, err := netip.ParseAddr(forward.BindAddress)
+		if err != nil {
+			return netip.AddrPort{}, false
+		}
+
+		addr = parsed.Unmap()
+	}
+
+	return netip.AddrPortFrom(addr, uint16(port)), true
+}
+
+// overlaps reports whether listening on both addresses collides. Unspecified addresses, such as 0.0.0.0, listen on
+// every address of the port.
+func overlaps(a netip.AddrPort, b netip.AddrPort) bool {
+	if a.Port() != b.Port() {
+		return false
+	}
+
+	return a.Addr() == b.Addr() || a.Addr().IsUnspecified() || b.Addr().IsUnspecified()
+}
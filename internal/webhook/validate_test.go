@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/csnewman/localflux/internal/deployment/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateCollisions(t *testing.T) {
+	forward := func(kind string, port int, bindAddress string) *v1alpha1.PortForward {
+		return &v1alpha1.PortForward{
+			Kind:        kind,
+			Namespace:   "default",
+			Name:        "app",
+			Port:        port,
+			Network:     "tcp",
+			BindAddress: bindAddress,
+		}
+	}
+
+	service := func(port int, bindAddress string) *v1alpha1.PortForward {
+		return forward("Service", port, bindAddress)
+	}
+
+	deployment := func(name string, bindAddress string, forwards ...*v1alpha1.PortForward) v1alpha1.Deployment {
+		return v1alpha1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "localflux",
+			},
+			PortForward: forwards,
+			BindAddress: bindAddress,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		own     v1alpha1.Deployment
+		other   v1alpha1.Deployment
+		collide bool
+	}{
+		{
+			name:    "ipv4 same address",
+			own:     deployment("a", "", service(8080, "127.0.0.1")),
+			other:   deployment("b", "", service(8080, "127.0.0.1")),
+			collide: true,
+		},
+		{
+			name:  "ipv4 different addresses",
+			own:   deployment("a", "", service(8080, "127.0.0.1")),
+			other: deployment("b", "", service(8080, "127.0.0.2")),
+		},
+		{
+			name:  "ipv4 different ports",
+			own:   deployment("a", "", service(8080, "")),
+			other: deployment("b", "", service(8081, "")),
+		},
+		{
+			name:    "unset matches default",
+			own:     deployment("a", "", service(8080, "")),
+			other:   deployment("b", "", service(8080, "127.0.0.1")),
+			collide: true,
+		},
+		{
+			name:    "ipv4 mapped ipv6",
+			own:     deployment("a", "", service(8080, "::ffff:127.0.0.1")),
+			other:   deployment("b", "", service(8080, "127.0.0.1")),
+			collide: true,
+		},
+		{
+			name:    "ipv6 same address",
+			own:     deployment("a", "", service(8080, "::1")),
+			other:   deployment("b", "", service(8080, "::1")),
+			collide: true,
+		},
+		{
+			name:  "ipv6 and ipv4 loopback",
+			own:   deployment("a", "", service(8080, "::1")),
+			other: deployment("b", "", service(8080, "127.0.0.1")),
+		},
+		{
+			name:    "ipv4 unspecified",
+			own:     deployment("a", "", service(8080, "0.0.0.0")),
+			other:   deployment("b", "", service(8080, "127.0.0.1")),
+			collide: true,
+		},
+		{
+			name:    "ipv6 unspecified",
+			own:     deployment("a", "", service(8080, "::1")),
+			other:   deployment("b", "", service(8080, "::")),
+			collide: true,
+		},
+		{
+			name:    "recorded unspecified bind address",
+			own:     deployment("a", "", service(8080, "127.0.0.1")),
+			other:   deployment("b", "0.0.0.0", service(8080, "")),
+			collide: true,
+		},
+		{
+			name:  "recorded bind address",
+			own:   deployment("a", "", service(8080, "")),
+			other: deployment("b", "192.168.1.2", service(8080, "")),
+		},
+		{
+			name:  "namespace kind",
+			own:   deployment("a", "", forward(v1alpha1.ForwardKindNamespace, 8080, "")),
+			other: deployment("b", "", service(8080, "")),
+		},
+		{
+			name:  "same deployment",
+			own:   deployment("a", "", service(8080, "")),
+			other: deployment("a", "", service(8080, "")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := Validate(&tt.own, []v1alpha1.Deployment{tt.other})
+
+			if collide := len(errs) > 0; collide != tt.collide {
+				t.Errorf("collide = %v, want %v: %v", collide, tt.collide, errs)
+			}
+		})
+	}
+}
+
+func TestValidateOwnForwards(t *testing.T) {
+	tests := []struct {
+		name     string
+		forwards []*v1alpha1.PortForward
+		want     int
+	}{
+		{
+			name: "distinct",
+			forwards: []*v1alpha1.PortForward{
+				{Kind: "Service", Namespace: "default", Name: "a", Port: 80, Network: "tcp"},
+				{Kind: "Service", Namespace: "default", Name: "b", Port: 81, Network: "tcp"},
+			},
+		},
+		{
+			name: "same local port",
+			forwards: []*v1alpha1.PortForward{
+				{Kind: "Service", Namespace: "default", Name: "a", Port: 80, Network: "tcp"},
+				{Kind: "Service", Namespace: "default", Name: "b", Port: 80, Network: "tcp"},
+			},
+			want: 1,
+		},
+		{
+			name: "invalid bind address",
+			forwards: []*v1alpha1.PortForward{
+				{Kind: "Service", Namespace: "default", Name: "a", Port: 80, Network: "tcp", BindAddress: "localhost"},
+			},
+			want: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := Validate(&v1alpha1.Deployment{PortForward: tt.forwards}, nil)
+
+			if len(errs) != tt.want {
+				t.Errorf("got %d errors, want %d: %v", len(errs), tt.want, errs)
+			}
+		})
+	}
+}